@@ -10,8 +10,8 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
-	"strings"
 	"sync"
+	"unsafe"
 
 	"github.com/appveen/mongo-go-driver/bson/bsonrw"
 	"github.com/appveen/mongo-go-driver/bson/bsontype"
@@ -62,23 +62,40 @@ func (sc *StructCodec) EncodeValue(r EncodeContext, vw bsonrw.ValueWriter, val r
 		return err
 	}
 
+	// Fields are accessed through their offsets, which requires an addressable struct.
+	if !val.CanAddr() {
+		addressable := reflect.New(val.Type()).Elem()
+		addressable.Set(val)
+		val = addressable
+	}
+	base := unsafe.Pointer(val.UnsafeAddr())
+
 	dw, err := vw.WriteDocument()
 	if err != nil {
 		return err
 	}
-	var rv reflect.Value
-	for _, desc := range sd.fl {
-		if desc.inline == nil {
-			rv = val.Field(desc.idx)
-		} else {
-			rv = val.FieldByIndex(desc.inline)
+	kw, _ := dw.(bsonrw.ElementKeyWriter)
+
+	for i := range sd.fl {
+		desc := &sd.fl[i]
+		ptr := unsafe.Pointer(uintptr(base) + desc.offset)
+
+		if kw != nil && desc.encodeKind != fastNone {
+			if desc.omitEmpty && desc.isFastZero(ptr) {
+				continue
+			}
+			if err = desc.encodeFast(kw, ptr); err != nil {
+				return err
+			}
+			continue
 		}
 
 		if desc.encoder == nil {
-			return ErrNoEncoder{Type: rv.Type()}
+			return ErrNoEncoder{Type: desc.typ}
 		}
 
 		encoder := desc.encoder
+		rv := reflect.NewAt(desc.typ, ptr).Elem()
 
 		iszero := sc.isZero
 		if iz, ok := encoder.(CodecZeroer); ok {
@@ -89,7 +106,12 @@ func (sc *StructCodec) EncodeValue(r EncodeContext, vw bsonrw.ValueWriter, val r
 			continue
 		}
 
-		vw2, err := dw.WriteDocumentElement(desc.name)
+		var vw2 bsonrw.ValueWriter
+		if kw != nil {
+			vw2, err = kw.WriteElementKey(desc.key)
+		} else {
+			vw2, err = dw.WriteDocumentElement(desc.name)
+		}
 		if err != nil {
 			return err
 		}
@@ -150,9 +172,20 @@ func (sc *StructCodec) DecodeValue(r DecodeContext, vr bsonrw.ValueReader, val r
 	if err != nil {
 		return err
 	}
+	kr, _ := dr.(bsonrw.ElementKeyReader)
+	base := unsafe.Pointer(val.UnsafeAddr())
 
+	next := 0
 	for {
-		name, vr, err := dr.ReadElement()
+		var key []byte
+		var vr bsonrw.ValueReader
+		if kr != nil {
+			key, vr, err = kr.ReadElementKey()
+		} else {
+			var name string
+			name, vr, err = dr.ReadElement()
+			key = []byte(name)
+		}
 		if err == bsonrw.ErrEOD {
 			break
 		}
@@ -160,15 +193,8 @@ func (sc *StructCodec) DecodeValue(r DecodeContext, vr bsonrw.ValueReader, val r
 			return err
 		}
 
-		fd, exists := sd.fm[name]
-		if !exists {
-			// if the original name isn't found in the struct description, try again with the name in lowercase
-			// this could match if a BSON tag isn't specified because by default, describeStruct lowercases all field
-			// names
-			fd, exists = sd.fm[strings.ToLower(name)]
-		}
-
-		if !exists {
+		idx := sd.lookupField(key, next)
+		if idx < 0 {
 			if sd.inlineMap < 0 {
 				// The encoding/json package requires a flag to return on error for non-existent fields.
 				// This functionality seems appropriate for the struct codec.
@@ -184,37 +210,34 @@ func (sc *StructCodec) DecodeValue(r DecodeContext, vr bsonrw.ValueReader, val r
 			if err != nil {
 				return err
 			}
-			inlineMap.SetMapIndex(reflect.ValueOf(name), elem)
+			inlineMap.SetMapIndex(reflect.ValueOf(string(key)), elem)
 			continue
 		}
+		next = idx + 1
 
-		var field reflect.Value
-		if fd.inline == nil {
-			field = val.Field(fd.idx)
-		} else {
-			field = val.FieldByIndex(fd.inline)
-		}
+		fd := &sd.fl[idx]
+		ptr := unsafe.Pointer(uintptr(base) + fd.offset)
 
-		if !field.CanSet() { // Being settable is a super set of being addressable.
-			return fmt.Errorf("cannot decode element '%s' into field %v; it is not settable", name, field)
+		if fd.decodeKind != fastNone {
+			decoded, err := fd.decodeFast(vr, ptr)
+			if err != nil {
+				return err
+			}
+			if decoded {
+				continue
+			}
 		}
+
+		field := reflect.NewAt(fd.typ, ptr).Elem()
 		if field.Kind() == reflect.Ptr && field.IsNil() {
 			field.Set(reflect.New(field.Type().Elem()))
 		}
-		field = field.Addr()
 
 		dctx := DecodeContext{Registry: r.Registry, Truncate: fd.truncate || r.Truncate}
 		if fd.decoder == nil {
-			return ErrNoDecoder{Type: field.Elem().Type()}
+			return ErrNoDecoder{Type: fd.typ}
 		}
 
-		if decoder, ok := fd.decoder.(ValueDecoder); ok {
-			err = decoder.DecodeValue(dctx, vr, field.Elem())
-			if err != nil {
-				return err
-			}
-			continue
-		}
 		err = fd.decoder.DecodeValue(dctx, vr, field)
 		if err != nil {
 			return err
@@ -255,20 +278,25 @@ func (sc *StructCodec) isZero(i interface{}) bool {
 }
 
 type structDescription struct {
-	fm        map[string]fieldDescription
+	fm        map[string]int // field name to index in fl
 	fl        []fieldDescription
 	inlineMap int
 }
 
 type fieldDescription struct {
 	name      string
+	key       []byte // name encoded as a BSON cstring
 	idx       int
+	offset    uintptr // offset from the start of the outermost struct, including inlined structs
+	typ       reflect.Type
 	omitEmpty bool
 	minSize   bool
 	truncate  bool
-	inline    []int
 	encoder   ValueEncoder
 	decoder   ValueDecoder
+
+	encodeKind fastKind
+	decodeKind fastKind
 }
 
 func (sc *StructCodec) describeStruct(r *Registry, t reflect.Type) (*structDescription, error) {
@@ -283,7 +311,7 @@ func (sc *StructCodec) describeStruct(r *Registry, t reflect.Type) (*structDescr
 
 	numFields := t.NumField()
 	sd := &structDescription{
-		fm:        make(map[string]fieldDescription, numFields),
+		fm:        make(map[string]int, numFields),
 		fl:        make([]fieldDescription, 0, numFields),
 		inlineMap: -1,
 	}
@@ -304,7 +332,7 @@ func (sc *StructCodec) describeStruct(r *Registry, t reflect.Type) (*structDescr
 			decoder = nil
 		}
 
-		description := fieldDescription{idx: i, encoder: encoder, decoder: decoder}
+		description := fieldDescription{idx: i, offset: sf.Offset, typ: sf.Type, encoder: encoder, decoder: decoder}
 
 		stags, err := sc.parser.ParseStructTags(sf)
 		if err != nil {
@@ -337,12 +365,8 @@ func (sc *StructCodec) describeStruct(r *Registry, t reflect.Type) (*structDescr
 					if _, exists := sd.fm[fd.name]; exists {
 						return nil, fmt.Errorf("(struct %s) duplicated key %s", t.String(), fd.name)
 					}
-					if fd.inline == nil {
-						fd.inline = []int{i, fd.idx}
-					} else {
-						fd.inline = append([]int{i}, fd.inline...)
-					}
-					sd.fm[fd.name] = fd
+					fd.offset += sf.Offset
+					sd.fm[fd.name] = len(sd.fl)
 					sd.fl = append(sd.fl, fd)
 				}
 			default:
@@ -355,7 +379,8 @@ func (sc *StructCodec) describeStruct(r *Registry, t reflect.Type) (*structDescr
 			return nil, fmt.Errorf("struct %s) duplicated key %s", t.String(), description.name)
 		}
 
-		sd.fm[description.name] = description
+		description.compile()
+		sd.fm[description.name] = len(sd.fl)
 		sd.fl = append(sd.fl, description)
 	}
 
@@ -0,0 +1,267 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsoncodec
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/appveen/mongo-go-driver/bson/bsonrw"
+	"github.com/appveen/mongo-go-driver/bson/bsontype"
+	"github.com/appveen/mongo-go-driver/bson/primitive"
+)
+
+// primitiveEncoder wraps a default ValueEncoderFunc for a type the StructCodec knows how to
+// encode directly. The StructCodec only inlines the encoding of fields whose encoder is a
+// primitiveEncoder, so encoders registered by users for these types are always called.
+type primitiveEncoder struct {
+	ValueEncoderFunc
+}
+
+// primitiveDecoder wraps a default ValueDecoderFunc for a type the StructCodec knows how to
+// decode directly. See primitiveEncoder.
+type primitiveDecoder struct {
+	ValueDecoderFunc
+}
+
+// fastKind identifies a field type that the StructCodec reads and writes through a pointer to
+// the field instead of through the field's ValueEncoder or ValueDecoder.
+type fastKind uint8
+
+const (
+	fastNone fastKind = iota
+	fastBool
+	fastInt
+	fastInt32
+	fastInt64
+	fastFloat64
+	fastString
+	fastObjectID
+)
+
+func fastKindOf(t reflect.Type) fastKind {
+	if t == tOID {
+		return fastObjectID
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return fastBool
+	case reflect.Int:
+		return fastInt
+	case reflect.Int32:
+		return fastInt32
+	case reflect.Int64:
+		return fastInt64
+	case reflect.Float64:
+		return fastFloat64
+	case reflect.String:
+		return fastString
+	default:
+		return fastNone
+	}
+}
+
+// compile precomputes the encoded key of the field and whether it can be encoded and decoded
+// without going through reflection.
+func (fd *fieldDescription) compile() {
+	fd.key = append([]byte(fd.name), 0x00)
+
+	kind := fastKindOf(fd.typ)
+	if _, ok := fd.encoder.(primitiveEncoder); ok {
+		// A Zeroer decides for itself whether it should be omitted. ObjectID is the exception
+		// since isFastZero knows its implementation.
+		if !fd.omitEmpty || kind == fastObjectID || !fd.typ.Implements(tZeroer) {
+			fd.encodeKind = kind
+		}
+	}
+	if _, ok := fd.decoder.(primitiveDecoder); ok {
+		fd.decodeKind = kind
+	}
+}
+
+// isFastZero reports whether the field at ptr is zero according to StructCodec.isZero.
+func (fd *fieldDescription) isFastZero(ptr unsafe.Pointer) bool {
+	switch fd.encodeKind {
+	case fastBool:
+		return !*(*bool)(ptr)
+	case fastInt:
+		return *(*int)(ptr) == 0
+	case fastInt32:
+		return *(*int32)(ptr) == 0
+	case fastInt64:
+		return *(*int64)(ptr) == 0
+	case fastFloat64:
+		return *(*float64)(ptr) == 0
+	case fastString:
+		return len(*(*string)(ptr)) == 0
+	case fastObjectID:
+		return (*primitive.ObjectID)(ptr).IsZero()
+	}
+	return false
+}
+
+// encodeFast writes the field at ptr as an element of the document being written by kw. It
+// matches the behavior of the default encoder for the field's type.
+func (fd *fieldDescription) encodeFast(kw bsonrw.ElementKeyWriter, ptr unsafe.Pointer) error {
+	switch fd.encodeKind {
+	case fastBool:
+		return kw.WriteBooleanElement(fd.key, *(*bool)(ptr))
+	case fastInt:
+		i64 := int64(*(*int)(ptr))
+		if fitsIn32Bits(i64) {
+			return kw.WriteInt32Element(fd.key, int32(i64))
+		}
+		return kw.WriteInt64Element(fd.key, i64)
+	case fastInt32:
+		return kw.WriteInt32Element(fd.key, *(*int32)(ptr))
+	case fastInt64:
+		i64 := *(*int64)(ptr)
+		if fd.minSize && fitsIn32Bits(i64) {
+			return kw.WriteInt32Element(fd.key, int32(i64))
+		}
+		return kw.WriteInt64Element(fd.key, i64)
+	case fastFloat64:
+		return kw.WriteDoubleElement(fd.key, *(*float64)(ptr))
+	case fastString:
+		return kw.WriteStringElement(fd.key, *(*string)(ptr))
+	case fastObjectID:
+		return kw.WriteObjectIDElement(fd.key, *(*primitive.ObjectID)(ptr))
+	}
+	return ErrNoEncoder{Type: fd.typ}
+}
+
+// decodeFast reads the value from vr into the field at ptr. If the BSON type of the value
+// requires one of the conversions done by the field's decoder, nothing is read and false is
+// returned.
+func (fd *fieldDescription) decodeFast(vr bsonrw.ValueReader, ptr unsafe.Pointer) (bool, error) {
+	switch fd.decodeKind {
+	case fastBool:
+		if vr.Type() != bsontype.Boolean {
+			return false, nil
+		}
+		b, err := vr.ReadBoolean()
+		if err != nil {
+			return true, err
+		}
+		*(*bool)(ptr) = b
+	case fastInt, fastInt64:
+		var i64 int64
+		switch vr.Type() {
+		case bsontype.Int32:
+			i32, err := vr.ReadInt32()
+			if err != nil {
+				return true, err
+			}
+			i64 = int64(i32)
+		case bsontype.Int64:
+			if fd.decodeKind == fastInt && strconv.IntSize == 32 {
+				// Let the decoder check for overflow.
+				return false, nil
+			}
+			var err error
+			i64, err = vr.ReadInt64()
+			if err != nil {
+				return true, err
+			}
+		default:
+			return false, nil
+		}
+		if fd.decodeKind == fastInt {
+			*(*int)(ptr) = int(i64)
+		} else {
+			*(*int64)(ptr) = i64
+		}
+	case fastInt32:
+		if vr.Type() != bsontype.Int32 {
+			return false, nil
+		}
+		i32, err := vr.ReadInt32()
+		if err != nil {
+			return true, err
+		}
+		*(*int32)(ptr) = i32
+	case fastFloat64:
+		if vr.Type() != bsontype.Double {
+			return false, nil
+		}
+		f64, err := vr.ReadDouble()
+		if err != nil {
+			return true, err
+		}
+		*(*float64)(ptr) = f64
+	case fastString:
+		if vr.Type() != bsontype.String {
+			return false, nil
+		}
+		str, err := vr.ReadString()
+		if err != nil {
+			return true, err
+		}
+		*(*string)(ptr) = str
+	case fastObjectID:
+		if vr.Type() != bsontype.ObjectID {
+			return false, nil
+		}
+		oid, err := vr.ReadObjectID()
+		if err != nil {
+			return true, err
+		}
+		*(*primitive.ObjectID)(ptr) = oid
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// lookupField returns the index in sd.fl of the field an element key maps to, or -1 if there is
+// no such field. Documents are usually stored in the order their fields are declared, so the
+// field at hint is tried before doing any map lookups.
+func (sd *structDescription) lookupField(key []byte, hint int) int {
+	if hint < len(sd.fl) && sd.fl[hint].name == string(key) {
+		return hint
+	}
+	if idx, exists := sd.fm[string(key)]; exists {
+		return idx
+	}
+
+	// if the original name isn't found in the struct description, try again with the name in lowercase
+	// this could match if a BSON tag isn't specified because by default, describeStruct lowercases all field
+	// names
+	var buf [64]byte
+	lower, ok := appendLowerASCII(buf[:0], key)
+	if !ok {
+		if idx, exists := sd.fm[strings.ToLower(string(key))]; exists {
+			return idx
+		}
+		return -1
+	}
+	if hint < len(sd.fl) && sd.fl[hint].name == string(lower) {
+		return hint
+	}
+	if idx, exists := sd.fm[string(lower)]; exists {
+		return idx
+	}
+	return -1
+}
+
+// appendLowerASCII appends key to dst with its uppercase letters replaced by lowercase ones. It
+// returns false if key contains non-ASCII characters, which require strings.ToLower.
+func appendLowerASCII(dst []byte, key []byte) ([]byte, bool) {
+	for _, c := range key {
+		if c >= 0x80 {
+			return dst, false
+		}
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		dst = append(dst, c)
+	}
+	return dst, true
+}
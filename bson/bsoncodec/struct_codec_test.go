@@ -7,9 +7,14 @@
 package bsoncodec
 
 import (
+	"bytes"
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/appveen/mongo-go-driver/bson/bsonrw"
+	"github.com/appveen/mongo-go-driver/bson/primitive"
+	"github.com/appveen/mongo-go-driver/x/bsonx/bsoncore"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -45,3 +50,171 @@ func TestZeoerInterfaceUsedByDecoder(t *testing.T) {
 	var zp *zeroTest
 	assert.True(t, enc.isZero(zp))
 }
+
+type zeroString string
+
+func (zeroString) IsZero() bool { return true }
+
+type planString string
+
+type planInline struct {
+	Inlined int64
+	Flag    bool `bson:"flag"`
+}
+
+type planTest struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	Bool      bool
+	Int       int
+	BigInt    int
+	Int32     int32
+	Int64     int64
+	MinSize   int64 `bson:",minsize"`
+	Float     float64
+	String    string
+	Named     planString
+	Omitted   int64              `bson:",omitempty"`
+	OmittedID primitive.ObjectID `bson:",omitempty"`
+	Zeroer    zeroString         `bson:",omitempty"`
+	Uint      uint32
+	Ptr       *int64
+	Nested    planInline
+	Inline    planInline `bson:",inline"`
+}
+
+func TestStructCodecCompiledPlan(t *testing.T) {
+	oid := primitive.ObjectID{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0A, 0x0B, 0x0C}
+	i64 := int64(42)
+	val := planTest{
+		ID:      oid,
+		Bool:    true,
+		Int:     1,
+		BigInt:  1 << 40,
+		Int32:   2,
+		Int64:   3,
+		MinSize: 4,
+		Float:   3.14159,
+		String:  "hello",
+		Named:   "world",
+		Zeroer:  "omitted",
+		Uint:    5,
+		Ptr:     &i64,
+		Nested:  planInline{Inlined: 6, Flag: true},
+		Inline:  planInline{Inlined: 7, Flag: true},
+	}
+	want := bsoncore.BuildDocument(nil,
+		bsoncore.AppendObjectIDElement(nil, "_id", oid),
+		bsoncore.AppendBooleanElement(nil, "bool", true),
+		bsoncore.AppendInt32Element(nil, "int", 1),
+		bsoncore.AppendInt64Element(nil, "bigint", 1<<40),
+		bsoncore.AppendInt32Element(nil, "int32", 2),
+		bsoncore.AppendInt64Element(nil, "int64", 3),
+		bsoncore.AppendInt32Element(nil, "minsize", 4),
+		bsoncore.AppendDoubleElement(nil, "float", 3.14159),
+		bsoncore.AppendStringElement(nil, "string", "hello"),
+		bsoncore.AppendStringElement(nil, "named", "world"),
+		bsoncore.AppendInt64Element(nil, "uint", 5),
+		bsoncore.AppendInt64Element(nil, "ptr", 42),
+		bsoncore.AppendDocumentElement(nil, "nested", bsoncore.BuildDocument(nil,
+			bsoncore.AppendInt64Element(nil, "inlined", 6),
+			bsoncore.AppendBooleanElement(nil, "flag", true),
+		)),
+		bsoncore.AppendInt64Element(nil, "inlined", 7),
+		bsoncore.AppendBooleanElement(nil, "flag", true),
+	)
+
+	encode := func(t *testing.T, r *Registry, val reflect.Value) []byte {
+		t.Helper()
+		enc, err := r.LookupEncoder(val.Type())
+		noerr(t, err)
+		var got bsonrw.SliceWriter
+		vw, err := bsonrw.NewBSONValueWriter(&got)
+		noerr(t, err)
+		noerr(t, enc.EncodeValue(EncodeContext{Registry: r}, vw, val))
+		return got
+	}
+	decode := func(t *testing.T, r *Registry, doc []byte, val reflect.Value) error {
+		t.Helper()
+		dec, err := r.LookupDecoder(val.Type())
+		noerr(t, err)
+		return dec.DecodeValue(DecodeContext{Registry: r}, bsonrw.NewBSONDocumentReader(doc), val)
+	}
+
+	t.Run("encode", func(t *testing.T) {
+		r := buildDefaultRegistry()
+		got := encode(t, r, reflect.ValueOf(val))
+		if !bytes.Equal(got, want) {
+			t.Errorf("Encoded document does not match.\n\tgot %v\n\twant %v", bsoncore.Document(got), bsoncore.Document(want))
+		}
+
+		got = encode(t, r, reflect.ValueOf(&val).Elem())
+		if !bytes.Equal(got, want) {
+			t.Errorf("Encoded document of an addressable struct does not match.\n\tgot %v\n\twant %v", bsoncore.Document(got), bsoncore.Document(want))
+		}
+	})
+	t.Run("decode", func(t *testing.T) {
+		var got planTest
+		noerr(t, decode(t, buildDefaultRegistry(), want, reflect.ValueOf(&got).Elem()))
+		val.Zeroer = ""
+		if !reflect.DeepEqual(got, val) {
+			t.Errorf("Decoded struct does not match.\n\tgot %+v\n\twant %+v", got, val)
+		}
+	})
+	t.Run("decode out of order with conversions", func(t *testing.T) {
+		doc := bsoncore.BuildDocument(nil,
+			bsoncore.AppendStringElement(nil, "unknown", "skipped"),
+			bsoncore.AppendInt64Element(nil, "Int32", 2),
+			bsoncore.AppendDoubleElement(nil, "INT64", 3),
+			bsoncore.AppendInt32Element(nil, "float", 4),
+			bsoncore.AppendInt32Element(nil, "Inlined", 5),
+			bsoncore.AppendInt32Element(nil, "bigint", 6),
+		)
+		var got planTest
+		noerr(t, decode(t, buildDefaultRegistry(), doc, reflect.ValueOf(&got).Elem()))
+		want := planTest{Int32: 2, Int64: 3, Float: 4, BigInt: 6, Inline: planInline{Inlined: 5}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Decoded struct does not match.\n\tgot %+v\n\twant %+v", got, want)
+		}
+
+		doc = bsoncore.BuildDocument(nil, bsoncore.AppendDoubleElement(nil, "int64", 3.5))
+		err := decode(t, buildDefaultRegistry(), doc, reflect.ValueOf(&got).Elem())
+		if err == nil {
+			t.Errorf("Expected an error when decoding a fractional double into an int64 without truncation")
+		}
+	})
+	t.Run("registered codecs take precedence", func(t *testing.T) {
+		rb := NewRegistryBuilder()
+		defaultValueEncoders.RegisterDefaultEncoders(rb)
+		defaultValueDecoders.RegisterDefaultDecoders(rb)
+		rb.RegisterEncoder(tInt64, ValueEncoderFunc(func(_ EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+			return vw.WriteString("int64")
+		}))
+		rb.RegisterDecoder(tString, ValueDecoderFunc(func(_ DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+			if err := vr.Skip(); err != nil {
+				return err
+			}
+			val.SetString("string")
+			return nil
+		}))
+		r := rb.Build()
+
+		type custom struct {
+			I int64
+			S string
+		}
+		got := encode(t, r, reflect.ValueOf(custom{I: 1, S: "foo"}))
+		want := bsoncore.BuildDocument(nil,
+			bsoncore.AppendStringElement(nil, "i", "int64"),
+			bsoncore.AppendStringElement(nil, "s", "foo"),
+		)
+		if !bytes.Equal(got, want) {
+			t.Errorf("Encoded document does not match.\n\tgot %v\n\twant %v", bsoncore.Document(got), bsoncore.Document(want))
+		}
+
+		var c custom
+		noerr(t, decode(t, r, bsoncore.BuildDocument(nil, bsoncore.AppendStringElement(nil, "s", "foo")), reflect.ValueOf(&c).Elem()))
+		if c.S != "string" {
+			t.Errorf("Registered decoder was not used. got %q; want %q", c.S, "string")
+		}
+	})
+}
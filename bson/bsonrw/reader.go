@@ -61,3 +61,11 @@ type ValueReader interface {
 type BytesReader interface {
 	ReadValueBytes(dst []byte) (bsontype.Type, []byte, error)
 }
+
+// ElementKeyReader is an optional interface that a DocumentReader may implement to read an
+// element's key without allocating a string for it. The returned key does not include the
+// null terminator and aliases the reader's underlying buffer, so it is only valid until the
+// next read.
+type ElementKeyReader interface {
+	ReadElementKey() ([]byte, ValueReader, error)
+}
@@ -21,6 +21,7 @@ import (
 )
 
 var _ ValueReader = (*valueReader)(nil)
+var _ ElementKeyReader = (*valueReader)(nil)
 
 var vrPool = sync.Pool{
 	New: func() interface{} {
@@ -675,33 +676,49 @@ func (vr *valueReader) ReadUndefined() error {
 }
 
 func (vr *valueReader) ReadElement() (string, ValueReader, error) {
+	key, err := vr.readElementKey("ReadElement")
+	if err != nil {
+		return "", nil, err
+	}
+	return string(key), vr, nil
+}
+
+func (vr *valueReader) ReadElementKey() ([]byte, ValueReader, error) {
+	key, err := vr.readElementKey("ReadElementKey")
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, vr, nil
+}
+
+func (vr *valueReader) readElementKey(callerName string) ([]byte, error) {
 	switch vr.stack[vr.frame].mode {
 	case mTopLevel, mDocument, mCodeWithScope:
 	default:
-		return "", nil, vr.invalidTransitionErr(mElement, "ReadElement", []mode{mTopLevel, mDocument, mCodeWithScope})
+		return nil, vr.invalidTransitionErr(mElement, callerName, []mode{mTopLevel, mDocument, mCodeWithScope})
 	}
 
 	t, err := vr.readByte()
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
 
 	if t == 0 {
 		if vr.offset != vr.stack[vr.frame].end {
-			return "", nil, vr.invalidDocumentLengthError()
+			return nil, vr.invalidDocumentLengthError()
 		}
 
 		vr.pop()
-		return "", nil, ErrEOD
+		return nil, ErrEOD
 	}
 
-	name, err := vr.readCString()
+	key, err := vr.readCStringBytes()
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
 
 	vr.pushElement(bsontype.Type(t))
-	return name, vr, nil
+	return key, nil
 }
 
 func (vr *valueReader) ReadValue() (ValueReader, error) {
@@ -777,14 +794,24 @@ func (vr *valueReader) readByte() (byte, error) {
 }
 
 func (vr *valueReader) readCString() (string, error) {
+	b, err := vr.readCStringBytes()
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// readCStringBytes reads a cstring and returns it without the null byte. The returned slice
+// aliases vr.d.
+func (vr *valueReader) readCStringBytes() ([]byte, error) {
 	idx := bytes.IndexByte(vr.d[vr.offset:], 0x00)
 	if idx < 0 {
-		return "", io.EOF
+		return nil, io.EOF
 	}
 	start := vr.offset
 	// idx does not include the null byte
 	vr.offset += int64(idx) + 1
-	return string(vr.d[start : start+int64(idx)]), nil
+	return vr.d[start : start+int64(idx)], nil
 }
 
 func (vr *valueReader) skipCString() error {
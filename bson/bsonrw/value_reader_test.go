@@ -1505,6 +1505,52 @@ func TestValueReader(t *testing.T) {
 	})
 }
 
+func TestValueReaderElementKey(t *testing.T) {
+	idx, doc := bsoncore.AppendDocumentStart(nil)
+	doc = bsoncore.AppendInt32Element(doc, "foo", 1)
+	doc = bsoncore.AppendStringElement(doc, "bar", "baz")
+	doc, err := bsoncore.AppendDocumentEnd(doc, idx)
+	noerr(t, err)
+
+	dr, err := NewBSONDocumentReader(doc).ReadDocument()
+	noerr(t, err)
+	kr := dr.(ElementKeyReader)
+
+	key, vr, err := kr.ReadElementKey()
+	noerr(t, err)
+	if string(key) != "foo" {
+		t.Errorf("Incorrect key. got %q; want %q", key, "foo")
+	}
+	i32, err := vr.ReadInt32()
+	noerr(t, err)
+	if i32 != 1 {
+		t.Errorf("Incorrect value. got %d; want %d", i32, 1)
+	}
+
+	key, vr, err = kr.ReadElementKey()
+	noerr(t, err)
+	if string(key) != "bar" {
+		t.Errorf("Incorrect key. got %q; want %q", key, "bar")
+	}
+	str, err := vr.ReadString()
+	noerr(t, err)
+	if str != "baz" {
+		t.Errorf("Incorrect value. got %q; want %q", str, "baz")
+	}
+
+	_, _, err = kr.ReadElementKey()
+	if err != ErrEOD {
+		t.Errorf("Expected ErrEOD at the end of the document. got %v", err)
+	}
+
+	vr2 := &valueReader{stack: []vrState{{mode: mTopLevel}, {mode: mArray}}, frame: 1}
+	wanterr := vr2.invalidTransitionErr(mElement, "ReadElementKey", []mode{mTopLevel, mDocument, mCodeWithScope})
+	_, _, err = vr2.ReadElementKey()
+	if !cmp.Equal(err, wanterr, cmp.Comparer(compareErrors)) {
+		t.Errorf("Expected correct invalid transition error. got %v; want %v", err, wanterr)
+	}
+}
+
 func errequal(t *testing.T, err1, err2 error) bool {
 	t.Helper()
 	if err1 == nil && err2 == nil { // If they are both nil, they are equal
@@ -20,6 +20,7 @@ import (
 )
 
 var _ ValueWriter = (*valueWriter)(nil)
+var _ ElementKeyWriter = (*valueWriter)(nil)
 
 var vwPool = sync.Pool{
 	New: func() interface{} {
@@ -125,6 +126,7 @@ func (vm vwMode) String() string {
 type vwState struct {
 	mode   mode
 	key    string
+	ckey   []byte // pre-encoded key, takes precedence over key when set
 	arrkey int
 	start  int32
 }
@@ -157,6 +159,7 @@ func (vw *valueWriter) push(m mode) {
 	// Clean the stack
 	vw.stack[vw.frame].mode = m
 	vw.stack[vw.frame].key = ""
+	vw.stack[vw.frame].ckey = nil
 	vw.stack[vw.frame].arrkey = 0
 	vw.stack[vw.frame].start = 0
 
@@ -240,6 +243,10 @@ func (vw *valueWriter) invalidTransitionError(destination mode, name string, mod
 func (vw *valueWriter) writeElementHeader(t bsontype.Type, destination mode, callerName string, addmodes ...mode) error {
 	switch vw.stack[vw.frame].mode {
 	case mElement:
+		if ckey := vw.stack[vw.frame].ckey; ckey != nil {
+			vw.buf = append(append(vw.buf, byte(t)), ckey...)
+			break
+		}
 		vw.buf = bsoncore.AppendHeader(vw.buf, t, vw.stack[vw.frame].key)
 	case mValue:
 		// TODO: Do this with a cache of the first 1000 or so array keys.
@@ -497,6 +504,92 @@ func (vw *valueWriter) WriteDocumentElement(key string) (ValueWriter, error) {
 	return vw, nil
 }
 
+func (vw *valueWriter) WriteElementKey(key []byte) (ValueWriter, error) {
+	if err := vw.ensureDocument("WriteElementKey"); err != nil {
+		return nil, err
+	}
+
+	vw.push(mElement)
+	vw.stack[vw.frame].ckey = key
+
+	return vw, nil
+}
+
+func (vw *valueWriter) WriteBooleanElement(key []byte, b bool) error {
+	if err := vw.writeKeyedHeader(bsontype.Boolean, key, "WriteBooleanElement"); err != nil {
+		return err
+	}
+
+	vw.buf = bsoncore.AppendBoolean(vw.buf, b)
+	return nil
+}
+
+func (vw *valueWriter) WriteDoubleElement(key []byte, f float64) error {
+	if err := vw.writeKeyedHeader(bsontype.Double, key, "WriteDoubleElement"); err != nil {
+		return err
+	}
+
+	vw.buf = bsoncore.AppendDouble(vw.buf, f)
+	return nil
+}
+
+func (vw *valueWriter) WriteInt32Element(key []byte, i32 int32) error {
+	if err := vw.writeKeyedHeader(bsontype.Int32, key, "WriteInt32Element"); err != nil {
+		return err
+	}
+
+	vw.buf = bsoncore.AppendInt32(vw.buf, i32)
+	return nil
+}
+
+func (vw *valueWriter) WriteInt64Element(key []byte, i64 int64) error {
+	if err := vw.writeKeyedHeader(bsontype.Int64, key, "WriteInt64Element"); err != nil {
+		return err
+	}
+
+	vw.buf = bsoncore.AppendInt64(vw.buf, i64)
+	return nil
+}
+
+func (vw *valueWriter) WriteObjectIDElement(key []byte, oid primitive.ObjectID) error {
+	if err := vw.writeKeyedHeader(bsontype.ObjectID, key, "WriteObjectIDElement"); err != nil {
+		return err
+	}
+
+	vw.buf = bsoncore.AppendObjectID(vw.buf, oid)
+	return nil
+}
+
+func (vw *valueWriter) WriteStringElement(key []byte, s string) error {
+	if err := vw.writeKeyedHeader(bsontype.String, key, "WriteStringElement"); err != nil {
+		return err
+	}
+
+	vw.buf = bsoncore.AppendString(vw.buf, s)
+	return nil
+}
+
+// writeKeyedHeader writes the header of an element with a pre-encoded key directly into the
+// current document. Since the value is appended immediately afterwards, no element frame is
+// pushed onto the stack.
+func (vw *valueWriter) writeKeyedHeader(t bsontype.Type, key []byte, callerName string) error {
+	if err := vw.ensureDocument(callerName); err != nil {
+		return err
+	}
+
+	vw.buf = append(append(vw.buf, byte(t)), key...)
+	return nil
+}
+
+func (vw *valueWriter) ensureDocument(callerName string) error {
+	switch vw.stack[vw.frame].mode {
+	case mTopLevel, mDocument:
+		return nil
+	default:
+		return vw.invalidTransitionError(mElement, callerName, []mode{mTopLevel, mDocument})
+	}
+}
+
 func (vw *valueWriter) WriteDocumentEnd() error {
 	switch vw.stack[vw.frame].mode {
 	case mTopLevel, mDocument:
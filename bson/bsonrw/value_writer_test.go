@@ -436,3 +436,66 @@ func vwCodeWithScopeNoNested(t *testing.T, vw *valueWriter) {
 
 	return
 }
+
+func TestValueWriterElementKey(t *testing.T) {
+	oid := primitive.ObjectID{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0A, 0x0B, 0x0C}
+	key := []byte("foo\x00")
+
+	t.Run("success", func(t *testing.T) {
+		var got SliceWriter
+		vw := newValueWriter(&got)
+		dw, err := vw.WriteDocument()
+		noerr(t, err)
+		kw := dw.(ElementKeyWriter)
+
+		noerr(t, kw.WriteBooleanElement(key, true))
+		noerr(t, kw.WriteDoubleElement(key, 3.14159))
+		noerr(t, kw.WriteInt32Element(key, 12345))
+		noerr(t, kw.WriteInt64Element(key, 1234567890))
+		noerr(t, kw.WriteObjectIDElement(key, oid))
+		noerr(t, kw.WriteStringElement(key, "hello, world"))
+		vw2, err := kw.WriteElementKey(key)
+		noerr(t, err)
+		noerr(t, vw2.WriteNull())
+		dw2, err := kw.WriteElementKey(key)
+		noerr(t, err)
+		subdw, err := dw2.WriteDocument()
+		noerr(t, err)
+		vw3, err := subdw.WriteDocumentElement("bar")
+		noerr(t, err)
+		noerr(t, vw3.WriteInt32(1))
+		noerr(t, subdw.WriteDocumentEnd())
+		noerr(t, dw.WriteDocumentEnd())
+
+		idx, want := bsoncore.AppendDocumentStart(nil)
+		want = bsoncore.AppendBooleanElement(want, "foo", true)
+		want = bsoncore.AppendDoubleElement(want, "foo", 3.14159)
+		want = bsoncore.AppendInt32Element(want, "foo", 12345)
+		want = bsoncore.AppendInt64Element(want, "foo", 1234567890)
+		want = bsoncore.AppendObjectIDElement(want, "foo", oid)
+		want = bsoncore.AppendStringElement(want, "foo", "hello, world")
+		want = bsoncore.AppendNullElement(want, "foo")
+		want = bsoncore.AppendDocumentElement(want, "foo", bsoncore.BuildDocument(nil, bsoncore.AppendInt32Element(nil, "bar", 1)))
+		want, err = bsoncore.AppendDocumentEnd(want, idx)
+		noerr(t, err)
+		if !bytes.Equal(got, want) {
+			t.Errorf("Bytes are not equal.\n\tgot %v\n\twant %v", got, want)
+		}
+	})
+	t.Run("incorrect transition", func(t *testing.T) {
+		vw := newValueWriter(ioutil.Discard)
+		vw.push(mArray)
+		want := TransitionError{current: mArray, destination: mElement, parent: mTopLevel,
+			name: "WriteInt64Element", modes: []mode{mTopLevel, mDocument}, action: "write"}
+		got := vw.WriteInt64Element(key, 1)
+		if !compareErrors(got, want) {
+			t.Errorf("Did not get expected error. got %v; want %v", got, want)
+		}
+
+		want.name = "WriteElementKey"
+		_, got = vw.WriteElementKey(key)
+		if !compareErrors(got, want) {
+			t.Errorf("Did not get expected error. got %v; want %v", got, want)
+		}
+	})
+}
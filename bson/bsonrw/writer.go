@@ -62,6 +62,23 @@ type BytesWriter interface {
 	WriteValueBytes(t bsontype.Type, b []byte) error
 }
 
+// ElementKeyWriter is an optional interface that a DocumentWriter may implement to write
+// elements whose key has already been encoded as a BSON cstring, i.e. the key bytes followed by
+// a null terminator. Encoders that write the same keys repeatedly can encode them once and
+// write common primitive elements without going through an intermediate ValueWriter.
+//
+// Implementations do not validate the key, so callers must ensure it is properly terminated
+// and contains no other null bytes.
+type ElementKeyWriter interface {
+	WriteElementKey(key []byte) (ValueWriter, error)
+	WriteBooleanElement(key []byte, b bool) error
+	WriteDoubleElement(key []byte, f float64) error
+	WriteInt32Element(key []byte, i32 int32) error
+	WriteInt64Element(key []byte, i64 int64) error
+	WriteObjectIDElement(key []byte, oid primitive.ObjectID) error
+	WriteStringElement(key []byte, s string) error
+}
+
 // SliceWriter allows a pointer to a slice of bytes to be used as an io.Writer.
 type SliceWriter []byte
 
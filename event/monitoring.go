@@ -8,6 +8,7 @@ package event // import "github.com/appveen/mongo-go-driver/event"
 
 import (
 	"context"
+	"time"
 
 	"github.com/appveen/mongo-go-driver/bson"
 )
@@ -89,3 +90,30 @@ type PoolEvent struct {
 type PoolMonitor struct {
 	Event func(*PoolEvent)
 }
+
+// strings for client-side encryption monitoring types
+const (
+	KeyCacheHit  = "DataKeyCacheHit"
+	KeyCacheMiss = "DataKeyCacheMiss"
+	KmsRequest   = "KmsRequest"
+)
+
+// EncryptionEvent contains all information summarizing a data key cache lookup or a KMS round trip. Data key cache
+// events identify the data key by KeyID or KeyAltName, depending on how libmongocrypt requested it. Cache hits also
+// name the Provider libmongocrypt decrypts the cached data key with, which is "local" since AWS data keys and data
+// keys of custom KMS providers are cached rewrapped with the local master key. KMS events name the Provider, the
+// Duration of the round trip, and the Failure if it failed.
+type EncryptionEvent struct {
+	Type       string        `json:"type"`
+	KeyID      []byte        `json:"keyId,omitempty"`
+	KeyAltName string        `json:"keyAltName,omitempty"`
+	Provider   string        `json:"provider,omitempty"`
+	Duration   time.Duration `json:"duration,omitempty"`
+	Failure    string        `json:"failure,omitempty"`
+}
+
+// EncryptionMonitor is a function that allows the user to gain access to data key cache and KMS events occurring
+// during client-side encryption
+type EncryptionMonitor struct {
+	Event func(*EncryptionEvent)
+}
@@ -0,0 +1,163 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongo
+
+import (
+	"github.com/appveen/mongo-go-driver/bson"
+	"github.com/appveen/mongo-go-driver/bson/bsoncodec"
+	"github.com/appveen/mongo-go-driver/bson/primitive"
+)
+
+// OperationType is the type of operation that caused a change event.
+type OperationType string
+
+// These constants are the operation types that can be reported by a change stream.
+const (
+	OperationInsert       OperationType = "insert"
+	OperationUpdate       OperationType = "update"
+	OperationReplace      OperationType = "replace"
+	OperationDelete       OperationType = "delete"
+	OperationDrop         OperationType = "drop"
+	OperationRename       OperationType = "rename"
+	OperationDropDatabase OperationType = "dropDatabase"
+	OperationInvalidate   OperationType = "invalidate"
+)
+
+// IsDocumentChange returns true if the operation type describes a change to a single document, i.e. an insert,
+// update, replace or delete.
+func (ot OperationType) IsDocumentChange() bool {
+	switch ot {
+	case OperationInsert, OperationUpdate, OperationReplace, OperationDelete:
+		return true
+	}
+	return false
+}
+
+// IsInvalidate returns true if the operation type is invalidate. No further events are returned by a change stream
+// after an invalidate event, but the stream can be restarted with the StartAfter option.
+func (ot OperationType) IsInvalidate() bool {
+	return ot == OperationInvalidate
+}
+
+// HasFullDocument returns true if a change event with this operation type can include a fullDocument field. Insert and
+// replace events always include it and update events include it if the FullDocument option is set to UpdateLookup.
+func (ot OperationType) HasFullDocument() bool {
+	switch ot {
+	case OperationInsert, OperationUpdate, OperationReplace:
+		return true
+	}
+	return false
+}
+
+// ChangeNamespace is the namespace of a change event.
+type ChangeNamespace struct {
+	Database   string `bson:"db"`
+	Collection string `bson:"coll,omitempty"`
+}
+
+// UpdateDescription describes the fields that were updated or removed by an update operation.
+type UpdateDescription struct {
+	UpdatedFields bson.Raw `bson:"updatedFields"`
+	RemovedFields []string `bson:"removedFields"`
+
+	registry *bsoncodec.Registry
+}
+
+// DecodeUpdatedFields decodes the updated fields into val using the registry of the change stream the event came
+// from. Keys of updated fields in embedded documents use dotted notation, e.g. "address.city".
+func (ud *UpdateDescription) DecodeUpdatedFields(val interface{}) error {
+	return bson.UnmarshalWithRegistry(registryOrDefault(ud.registry), ud.UpdatedFields, val)
+}
+
+// DecodeRemovedFields decodes the removed fields into val using the registry of the change stream the event came
+// from. The removed fields are decoded as a document mapping each removed field name to null, so decoding into a
+// struct leaves the struct fields of removed keys at their zero value and decoding into a map yields the removed keys.
+func (ud *UpdateDescription) DecodeRemovedFields(val interface{}) error {
+	doc := make(bson.D, 0, len(ud.RemovedFields))
+	for _, field := range ud.RemovedFields {
+		doc = append(doc, bson.E{Key: field, Value: nil})
+	}
+	raw, err := bson.MarshalWithRegistry(registryOrDefault(ud.registry), doc)
+	if err != nil {
+		return err
+	}
+	return bson.UnmarshalWithRegistry(registryOrDefault(ud.registry), raw, val)
+}
+
+// ChangeEvent is a change event returned by a change stream. A ChangeEvent for the current document of a change
+// stream can be obtained with ChangeStream.Event.
+type ChangeEvent struct {
+	// ID is the resume token of the event.
+	ID bson.Raw `bson:"_id"`
+	// OperationType is the type of operation that caused the event.
+	OperationType OperationType `bson:"operationType"`
+	// FullDocument is the document created or replaced by an insert or replace operation, or the current version of
+	// the document after an update operation if the FullDocument option is set to UpdateLookup. It can be decoded
+	// with DecodeFullDocument.
+	FullDocument bson.Raw `bson:"fullDocument,omitempty"`
+	// Namespace is the database and collection the event occurred in.
+	Namespace ChangeNamespace `bson:"ns"`
+	// To is the new namespace of a rename event.
+	To *ChangeNamespace `bson:"to,omitempty"`
+	// DocumentKey contains the _id and shard key of the changed document.
+	DocumentKey bson.Raw `bson:"documentKey,omitempty"`
+	// UpdateDescription describes the changes made by an update operation. It is nil for other operation types.
+	UpdateDescription *UpdateDescription `bson:"updateDescription,omitempty"`
+	// ClusterTime is the timestamp of the oplog entry for the operation.
+	ClusterTime primitive.Timestamp `bson:"clusterTime"`
+
+	registry *bsoncodec.Registry
+}
+
+// DecodeFullDocument decodes the full document into val using the registry of the change stream the event came
+// from. If the event does not have a full document, ErrNoDocuments is returned.
+func (ce *ChangeEvent) DecodeFullDocument(val interface{}) error {
+	if len(ce.FullDocument) == 0 {
+		return ErrNoDocuments
+	}
+	return bson.UnmarshalWithRegistry(registryOrDefault(ce.registry), ce.FullDocument, val)
+}
+
+// DocumentID returns the _id of the changed document from the document key. The zero RawValue is returned if the
+// event does not have a document key.
+func (ce *ChangeEvent) DocumentID() bson.RawValue {
+	if len(ce.DocumentKey) == 0 {
+		return bson.RawValue{}
+	}
+	val, _ := ce.DocumentKey.LookupErr("_id")
+	return val
+}
+
+// Event decodes the current document of the change stream into a ChangeEvent. The raw fields of the returned
+// ChangeEvent are copies and remain valid after the next call to Next.
+func (cs *ChangeStream) Event() (*ChangeEvent, error) {
+	if cs.cursor == nil {
+		return nil, ErrNilCursor
+	}
+	return newChangeEvent(cs.registry, cs.Current)
+}
+
+func newChangeEvent(registry *bsoncodec.Registry, raw bson.Raw) (*ChangeEvent, error) {
+	registry = registryOrDefault(registry)
+
+	// the bson.Raw fields are decoded into copies, so the event does not reference the cursor's batch
+	ce := &ChangeEvent{registry: registry}
+	if err := bson.UnmarshalWithRegistry(registry, raw, ce); err != nil {
+		return nil, err
+	}
+	if ce.UpdateDescription != nil {
+		ce.UpdateDescription.registry = registry
+	}
+	return ce, nil
+}
+
+func registryOrDefault(registry *bsoncodec.Registry) *bsoncodec.Registry {
+	if registry == nil {
+		return bson.DefaultRegistry
+	}
+	return registry
+}
@@ -0,0 +1,84 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongo
+
+import (
+	"testing"
+
+	"github.com/appveen/mongo-go-driver/bson"
+	"github.com/appveen/mongo-go-driver/bson/primitive"
+	"github.com/appveen/mongo-go-driver/internal/testutil/assert"
+)
+
+func TestChangeEvent(t *testing.T) {
+	type person struct {
+		Name string `bson:"name"`
+		Age  int32  `bson:"age"`
+	}
+
+	t.Run("decodes update event", func(t *testing.T) {
+		raw, err := bson.Marshal(bson.D{
+			{"_id", bson.D{{"_data", "token"}}},
+			{"operationType", "update"},
+			{"clusterTime", primitive.Timestamp{T: 10, I: 2}},
+			{"ns", bson.D{{"db", "db"}, {"coll", "people"}}},
+			{"documentKey", bson.D{{"_id", int32(1)}}},
+			{"updateDescription", bson.D{
+				{"updatedFields", bson.D{{"age", int32(42)}}},
+				{"removedFields", bson.A{"name"}},
+			}},
+			{"fullDocument", bson.D{{"_id", int32(1)}, {"age", int32(42)}}},
+		})
+		assert.Nil(t, err, "Marshal error: %v", err)
+
+		ce, err := newChangeEvent(nil, raw)
+		assert.Nil(t, err, "newChangeEvent error: %v", err)
+		assert.Equal(t, OperationUpdate, ce.OperationType, "expected operation type %v, got %v", OperationUpdate,
+			ce.OperationType)
+		assert.True(t, ce.OperationType.IsDocumentChange(), "expected update to be a document change")
+		assert.Equal(t, ChangeNamespace{"db", "people"}, ce.Namespace, "unexpected namespace %v", ce.Namespace)
+		assert.Equal(t, primitive.Timestamp{T: 10, I: 2}, ce.ClusterTime, "unexpected cluster time %v", ce.ClusterTime)
+		assert.Equal(t, int32(1), ce.DocumentID().Int32(), "unexpected document ID %v", ce.DocumentID())
+		assert.Equal(t, "token", ce.ID.Lookup("_data").StringValue(), "unexpected resume token %v", ce.ID)
+
+		var full person
+		err = ce.DecodeFullDocument(&full)
+		assert.Nil(t, err, "DecodeFullDocument error: %v", err)
+		assert.Equal(t, person{Age: 42}, full, "expected full document %v, got %v", person{Age: 42}, full)
+
+		assert.NotNil(t, ce.UpdateDescription, "expected update description, got nil")
+		var updated person
+		err = ce.UpdateDescription.DecodeUpdatedFields(&updated)
+		assert.Nil(t, err, "DecodeUpdatedFields error: %v", err)
+		assert.Equal(t, int32(42), updated.Age, "expected age 42, got %v", updated.Age)
+
+		removed := map[string]interface{}{}
+		err = ce.UpdateDescription.DecodeRemovedFields(&removed)
+		assert.Nil(t, err, "DecodeRemovedFields error: %v", err)
+		_, ok := removed["name"]
+		assert.True(t, ok, "expected name to be removed, got %v", removed)
+	})
+	t.Run("no full document", func(t *testing.T) {
+		raw, err := bson.Marshal(bson.D{
+			{"_id", bson.D{{"_data", "token"}}},
+			{"operationType", "drop"},
+			{"ns", bson.D{{"db", "db"}, {"coll", "people"}}},
+		})
+		assert.Nil(t, err, "Marshal error: %v", err)
+
+		ce, err := newChangeEvent(nil, raw)
+		assert.Nil(t, err, "newChangeEvent error: %v", err)
+		assert.False(t, ce.OperationType.IsDocumentChange(), "expected drop not to be a document change")
+		assert.Nil(t, ce.UpdateDescription, "expected no update description, got %v", ce.UpdateDescription)
+		err = ce.DecodeFullDocument(&person{})
+		assert.Equal(t, ErrNoDocuments, err, "expected error %v, got %v", ErrNoDocuments, err)
+	})
+	t.Run("nil cursor", func(t *testing.T) {
+		_, err := (&ChangeStream{}).Event()
+		assert.Equal(t, ErrNilCursor, err, "expected error %v, got %v", ErrNilCursor, err)
+	})
+}
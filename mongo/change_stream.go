@@ -60,6 +60,7 @@ type ChangeStream struct {
 	options       *options.ChangeStreamOptions
 	selector      description.ServerSelector
 	operationTime *primitive.Timestamp
+	checkpointer  *resumeTokenCheckpointer
 }
 
 type changeStreamConfig struct {
@@ -447,8 +448,16 @@ func (cs *ChangeStream) Close(ctx context.Context) error {
 		return nil // cursor is already closed
 	}
 
+	var checkpointErr error
+	if cs.checkpointer != nil {
+		checkpointErr = cs.checkpointer.flush(ctx, cs.resumeToken)
+	}
+
 	cs.err = replaceErrors(cs.cursor.Close(ctx))
 	cs.cursor = nil
+	if cs.err == nil {
+		cs.err = checkpointErr
+	}
 	return cs.Err()
 }
 
@@ -464,6 +473,12 @@ func (cs *ChangeStream) Next(ctx context.Context) bool {
 		ctx = context.Background()
 	}
 
+	if cs.checkpointer != nil {
+		if cs.err = cs.checkpointer.next(ctx, cs.resumeToken); cs.err != nil {
+			return false
+		}
+	}
+
 	if len(cs.batch) == 0 {
 		cs.loopNext(ctx)
 		if cs.err != nil || len(cs.batch) == 0 {
@@ -477,6 +492,9 @@ func (cs *ChangeStream) Next(ctx context.Context) bool {
 	if cs.err = cs.storeResumeToken(); cs.err != nil {
 		return false
 	}
+	if cs.checkpointer != nil {
+		cs.checkpointer.returned = true
+	}
 	return true
 }
 
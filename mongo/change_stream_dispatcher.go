@@ -0,0 +1,552 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/appveen/mongo-go-driver/bson"
+	"github.com/appveen/mongo-go-driver/bson/bsoncodec"
+	"github.com/appveen/mongo-go-driver/mongo/options"
+	"github.com/appveen/mongo-go-driver/x/bsonx/bsoncore"
+)
+
+// ErrSubscriberTooSlow is returned by ChangeStreamSubscription.Err when the subscription was closed by the
+// BackpressureDisconnect policy because its buffer was full.
+var ErrSubscriberTooSlow = errors.New("change stream subscriber fell behind and was disconnected")
+
+// ErrSubscriptionClosed is returned by ChangeStreamSubscription.Err when the subscription or its dispatcher was
+// closed.
+var ErrSubscriptionClosed = errors.New("change stream subscription is closed")
+
+// ChangeStreamDispatcher multiplexes a single server-side change stream to multiple in-process subscribers. Each
+// subscriber has its own $match filter, evaluated on the client, and its own bounded buffer.
+//
+// The dispatcher tracks the position of every subscriber. ResumeToken returns the resume token of the slowest
+// subscriber, i.e. the last event that every subscriber has processed or does not need, and the dispatcher resumes
+// from that token if its change stream fails. Events that are replayed after resuming are not delivered again to
+// subscribers that already received them.
+//
+// A typical usage of the ChangeStreamDispatcher type would be:
+//
+//		d, err := mongo.NewChangeStreamDispatcher(ctx, coll, mongo.Pipeline{})
+//		inserts, err := d.Subscribe(mongo.Pipeline{{{"$match", bson.D{{"operationType", "insert"}}}}})
+//		go d.Run(ctx)
+//
+//		for inserts.Next(ctx) {
+//			// do something with inserts.Current....
+//		}
+type ChangeStreamDispatcher struct {
+	watcher  Watcher
+	pipeline interface{}
+	opts     *options.ChangeStreamOptions
+	registry *bsoncodec.Registry
+
+	mu           sync.Mutex
+	cs           *ChangeStream
+	subs         []*ChangeStreamSubscription
+	seq          int64
+	log          []dispatchedToken
+	initialToken bson.Raw
+	replay       []dispatchedToken
+	running      bool
+	closed       bool
+}
+
+type dispatchedToken struct {
+	seq   int64
+	token bson.Raw
+}
+
+type dispatchedEvent struct {
+	seq int64
+	doc bson.Raw
+}
+
+// NewChangeStreamDispatcher opens a change stream on w with the given pipeline and options and returns a dispatcher
+// for it. Events are not read from the change stream until Run is called.
+func NewChangeStreamDispatcher(ctx context.Context, w Watcher, pipeline interface{},
+	opts ...*options.ChangeStreamOptions) (*ChangeStreamDispatcher, error) {
+
+	csOpts := options.MergeChangeStreamOptions(opts...)
+	cs, err := w.Watch(ctx, pipeline, csOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChangeStreamDispatcher{
+		watcher:      w,
+		pipeline:     pipeline,
+		opts:         csOpts,
+		registry:     cs.registry,
+		cs:           cs,
+		initialToken: cs.ResumeToken(),
+	}, nil
+}
+
+// Subscribe adds a subscriber to the dispatcher. The pipeline must be a slice of $match stages, which are evaluated
+// on the client against each change event; an empty pipeline matches every event. The subscriber only receives events
+// dispatched after Subscribe returns.
+func (d *ChangeStreamDispatcher) Subscribe(pipeline interface{},
+	opts ...*options.SubscriberOptions) (*ChangeStreamSubscription, error) {
+
+	pipelineArr, _, err := transformAggregatePipelinev2(d.registry, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	m, err := compileMatchPipeline(pipelineArr)
+	if err != nil {
+		return nil, err
+	}
+
+	so := options.MergeSubscriberOptions(opts...)
+	bufSize := options.DefaultSubscriberBufferSize
+	if so.BufferSize != nil && *so.BufferSize > 0 {
+		bufSize = *so.BufferSize
+	}
+	policy := options.BackpressureBlock
+	if so.Backpressure != nil {
+		policy = *so.Backpressure
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return nil, ErrSubscriptionClosed
+	}
+
+	sub := &ChangeStreamSubscription{
+		dispatcher: d,
+		matcher:    m,
+		bufSize:    bufSize,
+		policy:     policy,
+		lastSeen:   d.seq,
+		ready:      make(chan struct{}, 1),
+		space:      make(chan struct{}, 1),
+	}
+	d.subs = append(d.subs, sub)
+	return sub, nil
+}
+
+// Run reads events from the change stream and dispatches them to the subscribers until ctx is cancelled, the
+// dispatcher is closed, or the change stream fails. If the change stream fails, Run re-opens it from the slowest
+// subscriber's resume token, giving up if it fails again before returning an event that was not dispatched yet. The
+// change stream is closed when Run returns. Run returns nil if the dispatcher was closed.
+func (d *ChangeStreamDispatcher) Run(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	d.mu.Lock()
+	if d.running {
+		d.mu.Unlock()
+		return errors.New("change stream dispatcher is already running")
+	}
+	d.running = true
+	d.mu.Unlock()
+
+	defer func() {
+		d.mu.Lock()
+		d.running = false
+		cs := d.cs
+		d.mu.Unlock()
+		_ = cs.Close(context.Background())
+	}()
+
+	var reopened bool
+	for {
+		d.mu.Lock()
+		cs, closed := d.cs, d.closed
+		d.mu.Unlock()
+		if closed {
+			return nil
+		}
+
+		if !cs.Next(ctx) {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			err := cs.Err()
+			if err == nil {
+				err = ErrNilCursor
+			}
+			if reopened {
+				d.fail(err)
+				return err
+			}
+			if err = d.reopen(ctx, err); err != nil {
+				d.fail(err)
+				return err
+			}
+			reopened = true
+			continue
+		}
+
+		d.mu.Lock()
+		seq := d.seq
+		d.mu.Unlock()
+		if err := d.dispatch(ctx, cs.Current); err != nil {
+			return err
+		}
+
+		// replayed events do not count as progress of the re-opened change stream
+		d.mu.Lock()
+		if d.seq != seq {
+			reopened = false
+		}
+		d.mu.Unlock()
+	}
+}
+
+// reopen replaces the failed change stream with one that resumes from the slowest subscriber's position. If the
+// change stream cannot be re-opened, cause is returned.
+func (d *ChangeStreamDispatcher) reopen(ctx context.Context, cause error) error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	old := d.cs
+	token := d.resumeTokenLocked()
+	pos := d.minPositionLocked()
+	d.mu.Unlock()
+
+	_ = old.Close(ctx)
+
+	// without a token, nothing was dispatched yet and the original options still describe the starting point
+	opts := *d.opts
+	if token != nil {
+		opts.SetResumeAfter(token)
+		opts.SetStartAfter(nil)
+		opts.SetStartAtOperationTime(nil)
+	}
+	cs, err := d.watcher.Watch(ctx, d.pipeline, &opts)
+	if err != nil {
+		return cause
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cs = cs
+	d.replay = d.replay[:0]
+	for _, logged := range d.log {
+		if logged.seq > pos {
+			d.replay = append(d.replay, logged)
+		}
+	}
+	return nil
+}
+
+// dispatch assigns a sequence number to the event and delivers it to every subscriber.
+func (d *ChangeStreamDispatcher) dispatch(ctx context.Context, current bson.Raw) error {
+	doc := make(bson.Raw, len(current))
+	copy(doc, current)
+	token, _ := doc.Lookup("_id").DocumentOK()
+
+	d.mu.Lock()
+	var seq int64
+	if len(d.replay) > 0 && bytes.Equal(d.replay[0].token, token) {
+		// an event that was already dispatched before the change stream was re-opened
+		seq = d.replay[0].seq
+		d.replay = d.replay[1:]
+	} else {
+		d.replay = nil
+		d.seq++
+		seq = d.seq
+		d.log = append(d.log, dispatchedToken{seq: seq, token: token})
+	}
+	subs := make([]*ChangeStreamSubscription, len(d.subs))
+	copy(subs, d.subs)
+	d.mu.Unlock()
+
+	ev := dispatchedEvent{seq: seq, doc: doc}
+	for _, sub := range subs {
+		if err := sub.deliver(ctx, ev); err != nil {
+			return err
+		}
+	}
+
+	d.mu.Lock()
+	d.pruneLogLocked()
+	d.mu.Unlock()
+	return nil
+}
+
+// ResumeToken returns the resume token of the slowest subscriber's position. A change stream opened with this token
+// as ResumeAfter returns every event that at least one subscriber has not processed yet.
+func (d *ChangeStreamDispatcher) ResumeToken() bson.Raw {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.resumeTokenLocked()
+}
+
+// Close closes all subscriptions of the dispatcher. If Run is in progress, it returns after the change stream's
+// current getMore completes and closes the change stream; otherwise Close closes the change stream.
+func (d *ChangeStreamDispatcher) Close(ctx context.Context) error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	cs, running := d.cs, d.running
+	subs := d.subs
+	d.subs = nil
+	d.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.closeWithError(ErrSubscriptionClosed, false)
+	}
+	if running || cs == nil {
+		return nil
+	}
+	return cs.Close(ctx)
+}
+
+// fail closes every subscription with err after the change stream could not be resumed. Events that are already
+// buffered can still be read by the subscribers.
+func (d *ChangeStreamDispatcher) fail(err error) {
+	d.mu.Lock()
+	subs := d.subs
+	d.subs = nil
+	d.closed = true
+	d.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.closeWithError(err, false)
+	}
+}
+
+func (d *ChangeStreamDispatcher) unsubscribe(sub *ChangeStreamSubscription) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i, s := range d.subs {
+		if s == sub {
+			d.subs = append(d.subs[:i], d.subs[i+1:]...)
+			break
+		}
+	}
+	d.pruneLogLocked()
+}
+
+// minPositionLocked returns the sequence number of the last event every open subscriber has processed. The caller
+// must hold d.mu.
+func (d *ChangeStreamDispatcher) minPositionLocked() int64 {
+	pos := d.seq
+	for _, sub := range d.subs {
+		if p, open := sub.position(); open && p < pos {
+			pos = p
+		}
+	}
+	return pos
+}
+
+func (d *ChangeStreamDispatcher) resumeTokenLocked() bson.Raw {
+	pos := d.minPositionLocked()
+	for _, logged := range d.log {
+		if logged.seq == pos {
+			return logged.token
+		}
+	}
+	return d.initialToken
+}
+
+// pruneLogLocked drops the tokens of events before the slowest subscriber's position. The caller must hold d.mu.
+func (d *ChangeStreamDispatcher) pruneLogLocked() {
+	pos := d.minPositionLocked()
+	i := 0
+	for i < len(d.log) && d.log[i].seq < pos {
+		i++
+	}
+	if i > 0 {
+		d.log = append(d.log[:0], d.log[i:]...)
+	}
+}
+
+// ChangeStreamSubscription is a subscriber of a ChangeStreamDispatcher. It is iterated like a ChangeStream.
+type ChangeStreamSubscription struct {
+	// Current is the current change event. It remains valid after subsequent calls to Next.
+	Current bson.Raw
+
+	dispatcher *ChangeStreamDispatcher
+	matcher    matcher
+	bufSize    int
+	policy     options.BackpressurePolicy
+	ready      chan struct{}
+	space      chan struct{}
+
+	mu         sync.Mutex
+	queue      []dispatchedEvent
+	processing int64 // sequence number of the event returned by the last call to Next
+	lastSeen   int64 // sequence number of the last event dispatched to this subscriber
+	closed     bool
+	err        error
+}
+
+// Next waits for the next event that matches the subscriber's filter. It returns true if an event is available in
+// Current and false if ctx was cancelled or the subscription was closed and has no buffered events left, in which
+// case Err returns the reason.
+// Calling Next marks the previously returned event as processed.
+func (s *ChangeStreamSubscription) Next(ctx context.Context) bool {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	for {
+		s.mu.Lock()
+		s.processing = 0
+		if !s.closed {
+			s.err = nil // clear a context error from a previous call
+		}
+		if len(s.queue) > 0 {
+			ev := s.queue[0]
+			s.queue = s.queue[1:]
+			s.processing = ev.seq
+			s.Current = ev.doc
+			s.mu.Unlock()
+			notify(s.space)
+			return true
+		}
+		if s.closed {
+			s.mu.Unlock()
+			return false
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-s.ready:
+		case <-ctx.Done():
+			s.mu.Lock()
+			if !s.closed {
+				s.err = ctx.Err()
+			}
+			s.mu.Unlock()
+			return false
+		}
+	}
+}
+
+// Decode decodes the current event into val using the dispatcher's registry.
+func (s *ChangeStreamSubscription) Decode(val interface{}) error {
+	return bson.UnmarshalWithRegistry(s.dispatcher.registry, s.Current, val)
+}
+
+// Event decodes the current event into a ChangeEvent.
+func (s *ChangeStreamSubscription) Event() (*ChangeEvent, error) {
+	return newChangeEvent(s.dispatcher.registry, s.Current)
+}
+
+// Err returns the reason the subscription stopped, if any.
+func (s *ChangeStreamSubscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+// Close removes the subscriber from its dispatcher. Buffered events are discarded and no longer hold back the
+// dispatcher's resume token.
+func (s *ChangeStreamSubscription) Close() error {
+	s.closeWithError(ErrSubscriptionClosed, true)
+	s.dispatcher.unsubscribe(s)
+	return nil
+}
+
+// position returns the sequence number of the last event the subscriber has processed or skipped, and whether the
+// subscription is still open.
+func (s *ChangeStreamSubscription) position() (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case s.closed:
+		return 0, false
+	case s.processing > 0:
+		return s.processing - 1, true
+	case len(s.queue) > 0:
+		return s.queue[0].seq - 1, true
+	}
+	return s.lastSeen, true
+}
+
+// deliver applies the subscriber's filter to ev and buffers it according to the backpressure policy. It only returns
+// an error if ctx is cancelled while blocked on a full buffer.
+func (s *ChangeStreamSubscription) deliver(ctx context.Context, ev dispatchedEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed || ev.seq <= s.lastSeen {
+		return nil
+	}
+	if !s.matcher.match(bsoncore.Document(ev.doc)) {
+		s.lastSeen = ev.seq
+		return nil
+	}
+
+	for len(s.queue) >= s.bufSize {
+		switch s.policy {
+		case options.BackpressureDropNewest:
+			s.lastSeen = ev.seq
+			return nil
+		case options.BackpressureDropOldest:
+			s.queue = s.queue[1:]
+		case options.BackpressureDisconnect:
+			s.closed = true
+			s.err = ErrSubscriberTooSlow
+			s.queue = nil
+			notify(s.ready)
+			return nil
+		default:
+			s.mu.Unlock()
+			select {
+			case <-s.space:
+			case <-ctx.Done():
+				s.mu.Lock()
+				return ctx.Err()
+			}
+			s.mu.Lock()
+			if s.closed {
+				return nil
+			}
+		}
+	}
+
+	s.queue = append(s.queue, ev)
+	s.lastSeen = ev.seq
+	notify(s.ready)
+	return nil
+}
+
+// closeWithError closes the subscription with err. If discard is false, Next returns the buffered events before
+// reporting that the subscription is closed.
+func (s *ChangeStreamSubscription) closeWithError(err error, discard bool) {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		s.err = err
+	}
+	if discard {
+		s.queue = nil
+	}
+	s.mu.Unlock()
+
+	notify(s.ready)
+	notify(s.space)
+}
+
+// notify performs a non-blocking send on a signal channel with a buffer of one.
+func notify(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
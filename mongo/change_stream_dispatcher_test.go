@@ -0,0 +1,175 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongo
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/appveen/mongo-go-driver/bson"
+	"github.com/appveen/mongo-go-driver/internal/testutil/assert"
+	"github.com/appveen/mongo-go-driver/mongo/options"
+	"github.com/appveen/mongo-go-driver/x/bsonx/bsoncore"
+)
+
+// testChangeEvent returns a change event with resume token i and the given operation type.
+func testChangeEvent(i int, opType string) bsoncore.Document {
+	return bsoncore.BuildDocumentFromElements(nil,
+		bsoncore.AppendDocumentElement(nil, "_id", changeEventToken(i)),
+		bsoncore.AppendStringElement(nil, "operationType", opType),
+	)
+}
+
+// fakeWatcher opens change streams over a fixed list of events. A change stream starts after the event whose _id
+// equals the ResumeAfter option and fails with errExhausted after returning the last event.
+type fakeWatcher struct {
+	events  []bsoncore.Document
+	resumes []bson.Raw
+}
+
+func (fw *fakeWatcher) Watch(_ context.Context, _ interface{},
+	opts ...*options.ChangeStreamOptions) (*ChangeStream, error) {
+
+	cso := options.MergeChangeStreamOptions(opts...)
+	start := 0
+	if token, ok := cso.ResumeAfter.(bson.Raw); ok {
+		fw.resumes = append(fw.resumes, token)
+		for i, ev := range fw.events {
+			if bytes.Equal(ev.Lookup("_id").Document(), token) {
+				start = i + 1
+			}
+		}
+	}
+
+	batch := make([]bsoncore.Document, len(fw.events)-start)
+	copy(batch, fw.events[start:])
+	return &ChangeStream{
+		cursor:   &testChangeStreamCursor{newTestBatchCursor(0, 0)},
+		batch:    batch,
+		registry: bson.DefaultRegistry,
+	}, nil
+}
+
+func subscribe(t *testing.T, d *ChangeStreamDispatcher, pipeline interface{},
+	opts ...*options.SubscriberOptions) *ChangeStreamSubscription {
+
+	t.Helper()
+	sub, err := d.Subscribe(pipeline, opts...)
+	assert.Nil(t, err, "Subscribe error: %v", err)
+	return sub
+}
+
+func drainOperationTypes(sub *ChangeStreamSubscription) []string {
+	var ops []string
+	for sub.Next(bgCtx) {
+		ops = append(ops, sub.Current.Lookup("operationType").StringValue())
+	}
+	return ops
+}
+
+func TestChangeStreamDispatcher(t *testing.T) {
+	updates := Pipeline{{{"$match", bson.D{{"operationType", "update"}}}}}
+
+	t.Run("fans out with per-subscriber filters", func(t *testing.T) {
+		fw := &fakeWatcher{events: []bsoncore.Document{
+			testChangeEvent(0, "insert"),
+			testChangeEvent(1, "update"),
+			testChangeEvent(2, "insert"),
+			testChangeEvent(3, "update"),
+		}}
+		d, err := NewChangeStreamDispatcher(bgCtx, fw, Pipeline{})
+		assert.Nil(t, err, "NewChangeStreamDispatcher error: %v", err)
+		all := subscribe(t, d, Pipeline{})
+		upd := subscribe(t, d, updates)
+
+		err = d.Run(bgCtx)
+		assert.Equal(t, errExhausted, err, "expected error %v, got %v", errExhausted, err)
+
+		// the dispatcher resumed once from the slowest subscriber, which had not processed anything, and the replayed
+		// events were not delivered again
+		assert.Equal(t, 0, len(fw.resumes), "expected resume without token, got %v", fw.resumes)
+		expected := []string{"insert", "update", "insert", "update"}
+		got := drainOperationTypes(all)
+		assert.Equal(t, expected, got, "expected events %v, got %v", expected, got)
+		got = drainOperationTypes(upd)
+		assert.Equal(t, []string{"update", "update"}, got, "expected events %v, got %v", []string{"update", "update"}, got)
+		assert.Equal(t, errExhausted, upd.Err(), "expected error %v, got %v", errExhausted, upd.Err())
+	})
+	t.Run("unsupported filter is rejected", func(t *testing.T) {
+		d := &ChangeStreamDispatcher{registry: bson.DefaultRegistry}
+		regex := Pipeline{{{"$match", bson.D{{"ns.coll", bson.D{{"$regex", "^ord"}, {"$options", "l"}}}}}}}
+		_, err := d.Subscribe(regex)
+		assert.NotNil(t, err, "expected error, got nil")
+	})
+	t.Run("resume token follows slowest subscriber", func(t *testing.T) {
+		d := &ChangeStreamDispatcher{registry: bson.DefaultRegistry}
+		fast := subscribe(t, d, Pipeline{})
+		slow := subscribe(t, d, Pipeline{})
+		filtered := subscribe(t, d, updates)
+
+		for i := 0; i < 3; i++ {
+			err := d.dispatch(bgCtx, bson.Raw(testChangeEvent(i, "insert")))
+			assert.Nil(t, err, "dispatch error: %v", err)
+		}
+		assert.Nil(t, d.ResumeToken(), "expected no resume token before any event was processed")
+
+		for fast.Next(bgCtx) {
+			if fast.Current.Lookup("_id", "_data").Int32() == 2 {
+				break
+			}
+		}
+		assert.True(t, slow.Next(bgCtx), "expected an event")
+		assert.True(t, slow.Next(bgCtx), "expected an event")
+		// the second event is being processed by the slow subscriber, so only the first is complete
+		assert.Equal(t, changeEventToken(0), d.ResumeToken(), "expected token %v, got %v", changeEventToken(0),
+			d.ResumeToken())
+
+		_ = slow.Close()
+		// the filtered subscriber has seen all events and none of them matched
+		assert.Equal(t, changeEventToken(1), d.ResumeToken(), "expected token %v, got %v", changeEventToken(1),
+			d.ResumeToken())
+		_ = filtered.Close()
+	})
+	t.Run("backpressure policies", func(t *testing.T) {
+		d := &ChangeStreamDispatcher{registry: bson.DefaultRegistry}
+		newest := subscribe(t, d, Pipeline{},
+			options.Subscriber().SetBufferSize(2).SetBackpressure(options.BackpressureDropNewest))
+		oldest := subscribe(t, d, Pipeline{},
+			options.Subscriber().SetBufferSize(2).SetBackpressure(options.BackpressureDropOldest))
+		disconnect := subscribe(t, d, Pipeline{},
+			options.Subscriber().SetBufferSize(2).SetBackpressure(options.BackpressureDisconnect))
+
+		ops := []string{"insert", "update", "delete"}
+		for i, op := range ops {
+			err := d.dispatch(bgCtx, bson.Raw(testChangeEvent(i, op)))
+			assert.Nil(t, err, "dispatch error: %v", err)
+		}
+		assert.Nil(t, d.Close(bgCtx), "Close error")
+
+		got := drainOperationTypes(newest)
+		assert.Equal(t, []string{"insert", "update"}, got, "expected events %v, got %v", ops[:2], got)
+		got = drainOperationTypes(oldest)
+		assert.Equal(t, []string{"update", "delete"}, got, "expected events %v, got %v", ops[1:], got)
+		got = drainOperationTypes(disconnect)
+		assert.Equal(t, 0, len(got), "expected no events, got %v", got)
+		assert.Equal(t, ErrSubscriberTooSlow, disconnect.Err(), "expected error %v, got %v", ErrSubscriberTooSlow,
+			disconnect.Err())
+	})
+	t.Run("blocked dispatch honors context", func(t *testing.T) {
+		d := &ChangeStreamDispatcher{registry: bson.DefaultRegistry}
+		_ = subscribe(t, d, Pipeline{}, options.Subscriber().SetBufferSize(1))
+
+		err := d.dispatch(bgCtx, bson.Raw(testChangeEvent(0, "insert")))
+		assert.Nil(t, err, "dispatch error: %v", err)
+
+		ctx, cancel := context.WithCancel(bgCtx)
+		cancel()
+		err = d.dispatch(ctx, bson.Raw(testChangeEvent(1, "insert")))
+		assert.Equal(t, context.Canceled, err, "expected error %v, got %v", context.Canceled, err)
+	})
+}
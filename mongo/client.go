@@ -319,38 +319,33 @@ func (c *Client) configure(opts *options.ClientOptions) error {
 		return operation.NewIsMaster().AppName(appName).Compressors(comps)
 	}
 	// Auth & Database & Password & Username
-	if opts.Auth != nil {
-		cred := &auth.Cred{
-			Username:    opts.Auth.Username,
-			Password:    opts.Auth.Password,
-			PasswordSet: opts.Auth.PasswordSet,
-			Props:       opts.Auth.AuthMechanismProperties,
-			Source:      opts.Auth.AuthSource,
-		}
-		mechanism := opts.Auth.AuthMechanism
-
-		if len(cred.Source) == 0 {
-			switch strings.ToUpper(mechanism) {
-			case auth.MongoDBX509, auth.GSSAPI, auth.PLAIN:
-				cred.Source = "$external"
-			default:
-				cred.Source = "admin"
-			}
-		}
-
-		authenticator, err := auth.CreateAuthenticator(mechanism, cred)
-		if err != nil {
-			return err
-		}
-
+	if opts.Auth != nil || opts.CredentialProvider != nil {
 		handshakeOpts := &auth.HandshakeOptions{
-			AppName:       appName,
-			Authenticator: authenticator,
-			Compressors:   comps,
+			AppName:     appName,
+			Compressors: comps,
 		}
-		if mechanism == "" {
-			// Required for SASL mechanism negotiation during handshake
-			handshakeOpts.DBUser = cred.Source + "." + cred.Username
+		if provider := opts.CredentialProvider; provider != nil {
+			handshakeOpts.Credentials = auth.NewProvidedCredentials(
+				func(ctx context.Context) (string, *auth.Cred, error) {
+					credential, err := provider.Credential(ctx)
+					if err != nil {
+						return "", nil, err
+					}
+					mechanism, cred := newAuthCred(&credential)
+					return mechanism, cred, nil
+				},
+			)
+		} else {
+			mechanism, cred := newAuthCred(opts.Auth)
+			authenticator, err := auth.CreateAuthenticator(mechanism, cred)
+			if err != nil {
+				return err
+			}
+			handshakeOpts.Authenticator = authenticator
+			if mechanism == "" {
+				// Required for SASL mechanism negotiation during handshake
+				handshakeOpts.DBUser = cred.Source + "." + cred.Username
+			}
 		}
 		if opts.AuthenticateToAnything != nil && *opts.AuthenticateToAnything {
 			// Authenticate arbiters
@@ -524,6 +519,32 @@ func (c *Client) configure(opts *options.ClientOptions) error {
 	return nil
 }
 
+// newAuthCred returns the mechanism and auth.Cred for a credential, defaulting the source for its mechanism.
+func newAuthCred(credential *options.Credential) (string, *auth.Cred) {
+	cred := &auth.Cred{
+		Username:    credential.Username,
+		Password:    credential.Password,
+		PasswordSet: credential.PasswordSet,
+		Props:       credential.AuthMechanismProperties,
+		Source:      credential.AuthSource,
+
+		AWSCredentialProvider: credential.AWSCredentialProvider,
+		OIDCCallback:          credential.OIDCCallback,
+		OIDCRefreshCallback:   credential.OIDCRefreshCallback,
+	}
+	mechanism := credential.AuthMechanism
+
+	if len(cred.Source) == 0 {
+		switch strings.ToUpper(mechanism) {
+		case auth.MongoDBX509, auth.GSSAPI, auth.PLAIN, auth.MongoDBAWS, auth.MongoDBOIDC:
+			cred.Source = "$external"
+		default:
+			cred.Source = "admin"
+		}
+	}
+	return mechanism, cred
+}
+
 func (c *Client) configureAutoEncryption(opts *options.AutoEncryptionOptions) error {
 	if err := c.configureKeyVault(opts); err != nil {
 		return err
@@ -584,6 +605,16 @@ func (c *Client) configureCrypt(opts *options.AutoEncryptionOptions) error {
 		KmsProviders:         opts.KmsProviders,
 		BypassAutoEncryption: bypass,
 		SchemaMap:            cryptSchemaMap,
+		CustomKmsProviders:   opts.CustomKmsProviders,
+		KmsEndpoints:         opts.KmsEndpoints,
+		KmsTLSConfig:         opts.TLSConfig,
+		Monitor:              opts.Monitor,
+	}
+	if opts.KeyCacheTTL != nil {
+		cryptOpts.KeyCacheTTL = *opts.KeyCacheTTL
+	}
+	if opts.KeyCacheMaxSize != nil {
+		cryptOpts.KeyCacheMaxSize = *opts.KeyCacheMaxSize
 	}
 
 	var err error
@@ -47,11 +47,22 @@ func NewClientEncryption(keyVaultClient *Client, opts ...*options.ClientEncrypti
 	var err error
 	kr := keyRetriever{coll: ce.keyVaultColl}
 	cir := collInfoRetriever{client: ce.keyVaultClient}
-	ce.crypt, err = driver.NewCrypt(&driver.CryptOptions{
-		KeyFn:        kr.cryptKeys,
-		CollInfoFn:   cir.cryptCollInfo,
-		KmsProviders: ceo.KmsProviders,
-	})
+	cryptOptions := &driver.CryptOptions{
+		KeyFn:              kr.cryptKeys,
+		CollInfoFn:         cir.cryptCollInfo,
+		KmsProviders:       ceo.KmsProviders,
+		CustomKmsProviders: ceo.CustomKmsProviders,
+		KmsEndpoints:       ceo.KmsEndpoints,
+		KmsTLSConfig:       ceo.TLSConfig,
+		Monitor:            ceo.Monitor,
+	}
+	if ceo.KeyCacheTTL != nil {
+		cryptOptions.KeyCacheTTL = *ceo.KeyCacheTTL
+	}
+	if ceo.KeyCacheMaxSize != nil {
+		cryptOptions.KeyCacheMaxSize = *ceo.KeyCacheMaxSize
+	}
+	ce.crypt, err = driver.NewCrypt(cryptOptions)
 	if err != nil {
 		return nil, err
 	}
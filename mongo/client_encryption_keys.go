@@ -0,0 +1,163 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongo
+
+import (
+	"context"
+	"errors"
+
+	"github.com/appveen/mongo-go-driver/bson"
+	"github.com/appveen/mongo-go-driver/bson/bsontype"
+	"github.com/appveen/mongo-go-driver/bson/primitive"
+	"github.com/appveen/mongo-go-driver/mongo/options"
+	"github.com/appveen/mongo-go-driver/x/bsonx/bsoncore"
+	cryptOpts "github.com/appveen/mongo-go-driver/x/mongo/driver/mongocrypt/options"
+)
+
+// ErrMasterKeyWithoutProvider is returned by RewrapManyDataKey if a master key is specified without a KMS provider.
+var ErrMasterKeyWithoutProvider = errors.New("a master key requires a KMS provider")
+
+// RewrapManyDataKeyResult is the result of a RewrapManyDataKey operation.
+type RewrapManyDataKeyResult struct {
+	// The result of updating the re-encrypted data keys in the key vault collection. It is nil if no data key matched
+	// the filter.
+	BulkWriteResult *BulkWriteResult
+}
+
+// GetKey finds the data key with the given _id in the key vault collection.
+func (ce *ClientEncryption) GetKey(ctx context.Context, id primitive.Binary) *SingleResult {
+	return ce.keyVaultColl.FindOne(ctx, bson.D{{"_id", id}})
+}
+
+// GetKeys finds all data keys in the key vault collection.
+func (ce *ClientEncryption) GetKeys(ctx context.Context) (*Cursor, error) {
+	return ce.keyVaultColl.Find(ctx, bson.D{})
+}
+
+// GetKeyByAltName finds the data key with the given key alt name in the key vault collection.
+func (ce *ClientEncryption) GetKeyByAltName(ctx context.Context, keyAltName string) *SingleResult {
+	return ce.keyVaultColl.FindOne(ctx, bson.D{{"keyAltNames", keyAltName}})
+}
+
+// DeleteKey removes the data key with the given _id from the key vault collection. Values encrypted with the data key
+// can no longer be decrypted once it has been removed.
+func (ce *ClientEncryption) DeleteKey(ctx context.Context, id primitive.Binary) (*DeleteResult, error) {
+	defer ce.invalidateKey(id)
+	return ce.keyVaultColl.DeleteOne(ctx, bson.D{{"_id", id}})
+}
+
+// AddKeyAltName adds a key alt name to the data key with the given _id. Returns the data key as it was before the
+// update, or ErrNoDocuments if there is no data key with the given _id.
+func (ce *ClientEncryption) AddKeyAltName(ctx context.Context, id primitive.Binary, keyAltName string) *SingleResult {
+	defer ce.invalidateKey(id)
+	update := bson.D{{"$addToSet", bson.D{{"keyAltNames", keyAltName}}}}
+	return ce.keyVaultColl.FindOneAndUpdate(ctx, bson.D{{"_id", id}}, update)
+}
+
+// RemoveKeyAltName removes a key alt name from the data key with the given _id. The keyAltNames field is removed from
+// the data key once it has no key alt names left. Returns the data key as it was before the update, or
+// ErrNoDocuments if there is no data key with the given _id.
+//
+// This requires MongoDB 4.2 or later.
+func (ce *ClientEncryption) RemoveKeyAltName(ctx context.Context, id primitive.Binary, keyAltName string) *SingleResult {
+	defer ce.invalidateKey(id)
+	return ce.keyVaultColl.FindOneAndUpdate(ctx, bson.D{{"_id", id}}, removeKeyAltNameUpdate(keyAltName))
+}
+
+// removeKeyAltNameUpdate returns the update pipeline that removes a key alt name from a data key, and the keyAltNames
+// field with it if it was the last one, in a single atomic update.
+func removeKeyAltNameUpdate(keyAltName string) bson.A {
+	return bson.A{
+		bson.D{{"$set", bson.D{{"keyAltNames", bson.D{{"$cond", bson.A{
+			// data keys without key alt names have no keyAltNames field rather than an empty array
+			bson.D{{"$eq", bson.A{"$keyAltNames", bson.A{keyAltName}}}},
+			"$$REMOVE",
+			bson.D{{"$filter", bson.D{
+				{"input", "$keyAltNames"},
+				{"cond", bson.D{{"$ne", bson.A{"$$this", keyAltName}}}},
+			}}},
+		}}}}}}},
+	}
+}
+
+// RewrapManyDataKey decrypts the data keys matching filter and re-encrypts them with the master key of the KMS
+// provider given in the options, or with their current master keys if no provider is given, then updates them in the
+// key vault collection. This allows rotating master keys and moving data keys to another KMS provider without
+// re-encrypting the values that were encrypted with the data keys.
+//
+// This requires libmongocrypt 1.5.0 or later.
+func (ce *ClientEncryption) RewrapManyDataKey(ctx context.Context, filter interface{},
+	opts ...*options.RewrapManyDataKeyOptions) (*RewrapManyDataKeyResult, error) {
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	rmdko := options.MergeRewrapManyDataKeyOptions(opts...)
+	co := cryptOpts.RewrapManyDataKey()
+	if rmdko.Provider != nil {
+		co.SetKmsProvider(*rmdko.Provider)
+	}
+	if rmdko.MasterKey != nil {
+		if rmdko.Provider == nil {
+			return nil, ErrMasterKeyWithoutProvider
+		}
+		keyDoc, err := transformBsoncoreDocument(ce.keyVaultClient.registry, rmdko.MasterKey)
+		if err != nil {
+			return nil, err
+		}
+		co.SetMasterKey(keyDoc)
+	}
+
+	filterDoc, err := transformBsoncoreDocument(ce.keyVaultClient.registry, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := ce.crypt.RewrapManyDataKey(ctx, filterDoc, co)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return &RewrapManyDataKeyResult{}, nil
+	}
+
+	defer func() {
+		for _, key := range keys {
+			ce.crypt.InvalidateKey(key.Lookup("_id"))
+		}
+	}()
+
+	res, err := ce.keyVaultColl.BulkWrite(ctx, rewrapUpdateModels(keys))
+	if err != nil {
+		return nil, EncryptionKeyVaultError{Wrapped: err}
+	}
+	return &RewrapManyDataKeyResult{BulkWriteResult: res}, nil
+}
+
+// rewrapUpdateModels returns the updates that store the master keys and key material of rewrapped data keys.
+func rewrapUpdateModels(keys []bsoncore.Document) []WriteModel {
+	models := make([]WriteModel, 0, len(keys))
+	for _, key := range keys {
+		raw := bson.Raw(key)
+		update := bson.D{
+			{"$set", bson.D{
+				{"masterKey", raw.Lookup("masterKey")},
+				{"keyMaterial", raw.Lookup("keyMaterial")},
+			}},
+			{"$currentDate", bson.D{{"updateDate", true}}},
+		}
+		models = append(models, NewUpdateOneModel().SetFilter(bson.D{{"_id", raw.Lookup("_id")}}).SetUpdate(update))
+	}
+	return models
+}
+
+// invalidateKey removes the data key with the given _id from the data key cache of the ClientEncryption after it was
+// changed in the key vault collection.
+func (ce *ClientEncryption) invalidateKey(id primitive.Binary) {
+	ce.crypt.InvalidateKey(bsoncore.Value{Type: bsontype.Binary, Data: bsoncore.AppendBinary(nil, id.Subtype, id.Data)})
+}
@@ -0,0 +1,95 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongo
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/appveen/mongo-go-driver/bson"
+	"github.com/appveen/mongo-go-driver/internal/testutil/assert"
+	"github.com/appveen/mongo-go-driver/mongo/options"
+	"github.com/appveen/mongo-go-driver/x/bsonx/bsoncore"
+)
+
+func TestClientEncryptionKeys(t *testing.T) {
+	t.Run("merge rewrap options", func(t *testing.T) {
+		masterKey := bson.D{{"key", "arn"}}
+		opts := options.MergeRewrapManyDataKeyOptions(
+			options.RewrapManyDataKey().SetProvider("aws").SetMasterKey(masterKey),
+			nil,
+			options.RewrapManyDataKey().SetProvider("local"),
+		)
+		assert.NotNil(t, opts.Provider, "expected provider to be set")
+		assert.Equal(t, "local", *opts.Provider, "expected provider %q, got %q", "local", *opts.Provider)
+		assert.Equal(t, masterKey, opts.MasterKey, "expected master key %v, got %v", masterKey, opts.MasterKey)
+
+		opts = options.MergeRewrapManyDataKeyOptions()
+		assert.Nil(t, opts.Provider, "expected no provider, got %v", opts.Provider)
+		assert.Nil(t, opts.MasterKey, "expected no master key, got %v", opts.MasterKey)
+	})
+	t.Run("master key without provider", func(t *testing.T) {
+		ce := &ClientEncryption{}
+		_, err := ce.RewrapManyDataKey(context.Background(), bson.D{},
+			options.RewrapManyDataKey().SetMasterKey(bson.D{{"key", "arn"}}))
+		assert.Equal(t, ErrMasterKeyWithoutProvider, err, "expected error %v, got %v", ErrMasterKeyWithoutProvider, err)
+	})
+	t.Run("rewrap update models", func(t *testing.T) {
+		var keys []bsoncore.Document
+		for i := byte(1); i <= 2; i++ {
+			key := bsoncore.BuildDocument(nil,
+				bsoncore.AppendBinaryElement(nil, "_id", 0x04, bytes.Repeat([]byte{i}, 16)),
+				bsoncore.AppendBinaryElement(nil, "keyMaterial", 0x00, []byte{i}),
+				bsoncore.AppendDocumentElement(nil, "masterKey",
+					bsoncore.BuildDocument(nil, bsoncore.AppendStringElement(nil, "provider", "local"))),
+				bsoncore.AppendInt32Element(nil, "status", 0),
+			)
+			keys = append(keys, key)
+		}
+
+		models := rewrapUpdateModels(keys)
+		assert.Equal(t, 2, len(models), "expected 2 models, got %d", len(models))
+		for i, model := range models {
+			uom, ok := model.(*UpdateOneModel)
+			assert.True(t, ok, "expected *UpdateOneModel, got %T", model)
+
+			filter, err := bson.Marshal(uom.Filter)
+			assert.Nil(t, err, "Marshal error: %v", err)
+			_, id := bson.Raw(filter).Lookup("_id").Binary()
+			assert.Equal(t, bytes.Repeat([]byte{byte(i + 1)}, 16), id, "expected filter on the data key's _id, got %v", id)
+
+			update, err := bson.Marshal(uom.Update)
+			assert.Nil(t, err, "Marshal error: %v", err)
+			set := bson.Raw(update).Lookup("$set").Document()
+			_, keyMaterial := set.Lookup("keyMaterial").Binary()
+			assert.Equal(t, []byte{byte(i + 1)}, keyMaterial, "expected key material to be set, got %v", keyMaterial)
+			provider := set.Lookup("masterKey", "provider").StringValue()
+			assert.Equal(t, "local", provider, "expected master key to be set, got provider %q", provider)
+			_, err = set.LookupErr("status")
+			assert.NotNil(t, err, "expected other fields not to be set")
+			currentDate := bson.Raw(update).Lookup("$currentDate", "updateDate").Boolean()
+			assert.True(t, currentDate, "expected updateDate to be set to the current date")
+		}
+	})
+	t.Run("remove key alt name update", func(t *testing.T) {
+		doc, err := bson.Marshal(bson.D{{"u", removeKeyAltNameUpdate("alt")}})
+		assert.Nil(t, err, "Marshal error: %v", err)
+		stages, err := bson.Raw(doc).Lookup("u").Array().Values()
+		assert.Nil(t, err, "Values error: %v", err)
+		assert.Equal(t, 1, len(stages), "expected a single pipeline stage, got %d", len(stages))
+
+		cond, err := stages[0].Document().Lookup("$set", "keyAltNames", "$cond").Array().Values()
+		assert.Nil(t, err, "Values error: %v", err)
+		assert.Equal(t, 3, len(cond), "expected $cond with 3 arguments, got %d", len(cond))
+		eq := cond[0].Document().Lookup("$eq", "1", "0").StringValue()
+		assert.Equal(t, "alt", eq, "expected comparison with the removed key alt name, got %q", eq)
+		assert.Equal(t, "$$REMOVE", cond[1].StringValue(), "expected keyAltNames to be removed, got %v", cond[1])
+		ne := cond[2].Document().Lookup("$filter", "cond", "$ne", "1").StringValue()
+		assert.Equal(t, "alt", ne, "expected other key alt names to be kept, got %q", ne)
+	})
+}
@@ -0,0 +1,300 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/appveen/mongo-go-driver/bson"
+	"github.com/appveen/mongo-go-driver/bson/bsontype"
+	"github.com/appveen/mongo-go-driver/bson/primitive"
+	"github.com/appveen/mongo-go-driver/x/bsonx/bsoncore"
+	cryptOpts "github.com/appveen/mongo-go-driver/x/mongo/driver/mongocrypt/options"
+)
+
+// encryptedSubtype is the BSON binary subtype of encrypted values.
+const encryptedSubtype byte = 6
+
+// encryptMetadata holds the data key and algorithm used to encrypt a field. Fields inherit the encryptMetadata of the
+// schemas that enclose them.
+type encryptMetadata struct {
+	keyID             *primitive.Binary
+	keyAltNamePointer string // JSON pointer to the document field holding the key alt name of the data key
+	algorithm         string
+}
+
+// encryptionSchema is a parsed JSON schema for client side field level encryption.
+type encryptionSchema struct {
+	encrypt    *encryptMetadata // the data key and algorithm if the field is encrypted
+	properties map[string]*encryptionSchema
+}
+
+// EncryptDocument explicitly encrypts the fields of doc that are marked for encryption in schema and returns the
+// resulting document. The schema uses the JSON schema format of options.AutoEncryptionOptions.SchemaMap: a field is
+// encrypted if it has an "encrypt" keyword, and "keyId" and "algorithm" are inherited from the "encryptMetadata" of
+// enclosing schemas. A "keyId" that is a JSON pointer, e.g. "/tenant", names the document field holding the key alt
+// name of the data key, which is looked up in the key vault collection. Fields that are already encrypted are left
+// unchanged.
+//
+// Unlike automatic encryption, EncryptDocument does not require mongocryptd.
+func (ce *ClientEncryption) EncryptDocument(ctx context.Context, doc interface{}, schema interface{}) (bson.Raw, error) {
+	return ce.transformBySchema(ctx, doc, schema, true)
+}
+
+// DecryptDocument explicitly decrypts the fields of doc that are marked for encryption in schema and returns the
+// resulting document. See EncryptDocument for the schema format. Marked fields that are not encrypted are left
+// unchanged.
+func (ce *ClientEncryption) DecryptDocument(ctx context.Context, doc interface{}, schema interface{}) (bson.Raw, error) {
+	return ce.transformBySchema(ctx, doc, schema, false)
+}
+
+func (ce *ClientEncryption) transformBySchema(ctx context.Context, doc interface{}, schema interface{},
+	encrypt bool) (bson.Raw, error) {
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	d, err := transformBsoncoreDocument(ce.keyVaultClient.registry, doc)
+	if err != nil {
+		return nil, err
+	}
+	s, err := transformBsoncoreDocument(ce.keyVaultClient.registry, schema)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := parseEncryptionSchema(bson.Raw(s), encryptMetadata{})
+	if err != nil {
+		return nil, err
+	}
+
+	st := &schemaTransformer{
+		ce:      ce,
+		root:    bson.Raw(d),
+		encrypt: encrypt,
+		keyIDs:  make(map[string]primitive.Binary),
+	}
+	res, err := st.transform(ctx, bson.Raw(d), parsed)
+	if err != nil {
+		return nil, err
+	}
+	return bson.Raw(res), nil
+}
+
+// parseEncryptionSchema parses a JSON schema, resolving the encryptMetadata inherited by encrypted fields.
+func parseEncryptionSchema(schema bson.Raw, inherited encryptMetadata) (*encryptionSchema, error) {
+	if md, ok := schema.Lookup("encryptMetadata").DocumentOK(); ok {
+		if err := inherited.merge(md); err != nil {
+			return nil, err
+		}
+	}
+
+	parsed := &encryptionSchema{}
+	if enc, ok := schema.Lookup("encrypt").DocumentOK(); ok {
+		md := inherited
+		if err := md.merge(enc); err != nil {
+			return nil, err
+		}
+		if md.algorithm == "" {
+			return nil, fmt.Errorf("encrypted field has no algorithm")
+		}
+		if md.keyID == nil && md.keyAltNamePointer == "" {
+			return nil, fmt.Errorf("encrypted field has no keyId")
+		}
+		parsed.encrypt = &md
+		return parsed, nil
+	}
+
+	if _, err := schema.LookupErr("patternProperties"); err == nil {
+		return nil, fmt.Errorf("patternProperties are not supported for explicit document encryption")
+	}
+
+	props, ok := schema.Lookup("properties").DocumentOK()
+	if !ok {
+		return parsed, nil
+	}
+	elems, err := props.Elements()
+	if err != nil {
+		return nil, err
+	}
+	parsed.properties = make(map[string]*encryptionSchema, len(elems))
+	for _, elem := range elems {
+		sub, ok := elem.Value().DocumentOK()
+		if !ok {
+			return nil, fmt.Errorf("schema of property %q is not a document", elem.Key())
+		}
+		if parsed.properties[elem.Key()], err = parseEncryptionSchema(sub, inherited); err != nil {
+			return nil, err
+		}
+	}
+
+	return parsed, nil
+}
+
+// merge overrides the metadata with the keyId and algorithm of an encryptMetadata or encrypt schema keyword.
+func (md *encryptMetadata) merge(doc bson.Raw) error {
+	if alg, ok := doc.Lookup("algorithm").StringValueOK(); ok {
+		md.algorithm = alg
+	}
+
+	keyID, err := doc.LookupErr("keyId")
+	if err != nil {
+		return nil
+	}
+	switch keyID.Type {
+	case bsontype.String:
+		pointer := keyID.StringValue()
+		if !strings.HasPrefix(pointer, "/") {
+			return fmt.Errorf("keyId %q is not a JSON pointer", pointer)
+		}
+		md.keyID, md.keyAltNamePointer = nil, pointer
+	case bsontype.Array:
+		vals, err := keyID.Array().Values()
+		if err != nil {
+			return err
+		}
+		if len(vals) != 1 {
+			return fmt.Errorf("keyId must contain exactly one key ID, got %d", len(vals))
+		}
+		subtype, data, ok := vals[0].BinaryOK()
+		if !ok {
+			return fmt.Errorf("keyId must contain a binary key ID, got %v", vals[0].Type)
+		}
+		md.keyID, md.keyAltNamePointer = &primitive.Binary{Subtype: subtype, Data: data}, ""
+	default:
+		return fmt.Errorf("keyId must be an array or a JSON pointer, got %v", keyID.Type)
+	}
+	return nil
+}
+
+// lookupJSONPointer returns the value at the given JSON pointer (RFC 6901) in doc.
+func lookupJSONPointer(doc bson.Raw, pointer string) (bson.RawValue, error) {
+	if !strings.HasPrefix(pointer, "/") {
+		return bson.RawValue{}, fmt.Errorf("%q is not a JSON pointer", pointer)
+	}
+
+	val := bson.RawValue{Type: bsontype.EmbeddedDocument, Value: doc}
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+
+		sub, ok := val.DocumentOK()
+		if !ok {
+			return bson.RawValue{}, fmt.Errorf("JSON pointer %q does not point into a document", pointer)
+		}
+		var err error
+		if val, err = sub.LookupErr(token); err != nil {
+			return bson.RawValue{}, fmt.Errorf("no field at JSON pointer %q", pointer)
+		}
+	}
+	return val, nil
+}
+
+// schemaTransformer encrypts or decrypts the fields of a document marked in a schema.
+type schemaTransformer struct {
+	ce      *ClientEncryption
+	root    bson.Raw // the document, for resolving JSON pointers
+	encrypt bool
+	keyIDs  map[string]primitive.Binary // data key IDs by key alt name
+}
+
+func (st *schemaTransformer) transform(ctx context.Context, doc bson.Raw,
+	schema *encryptionSchema) (bsoncore.Document, error) {
+
+	elems, err := doc.Elements()
+	if err != nil {
+		return nil, err
+	}
+
+	idx, out := bsoncore.AppendDocumentStart(nil)
+	for _, elem := range elems {
+		key, val := elem.Key(), elem.Value()
+		field := schema.properties[key]
+
+		switch {
+		case field == nil:
+			out = bsoncore.AppendValueElement(out, key, bsoncore.Value{Type: val.Type, Data: val.Value})
+		case field.encrypt != nil:
+			transformed, err := st.transformValue(ctx, val, field.encrypt)
+			if err != nil {
+				return nil, fmt.Errorf("field %q: %v", key, err)
+			}
+			out = bsoncore.AppendValueElement(out, key, transformed)
+		case val.Type == bsontype.EmbeddedDocument && field.properties != nil:
+			sub, err := st.transform(ctx, val.Document(), field)
+			if err != nil {
+				return nil, err
+			}
+			out = bsoncore.AppendDocumentElement(out, key, sub)
+		default:
+			out = bsoncore.AppendValueElement(out, key, bsoncore.Value{Type: val.Type, Data: val.Value})
+		}
+	}
+
+	return bsoncore.AppendDocumentEnd(out, idx)
+}
+
+func (st *schemaTransformer) transformValue(ctx context.Context, val bson.RawValue,
+	md *encryptMetadata) (bsoncore.Value, error) {
+
+	subtype, data, isBinary := val.BinaryOK()
+	encrypted := isBinary && subtype == encryptedSubtype
+
+	switch {
+	case st.encrypt && !encrypted:
+		keyID, err := st.keyID(ctx, md)
+		if err != nil {
+			return bsoncore.Value{}, err
+		}
+		opts := cryptOpts.ExplicitEncryption().SetKeyID(keyID).SetAlgorithm(md.algorithm)
+		subtype, data, err = st.ce.crypt.EncryptExplicit(ctx, bsoncore.Value{Type: val.Type, Data: val.Value}, opts)
+		if err != nil {
+			return bsoncore.Value{}, err
+		}
+		return bsoncore.Value{Type: bsontype.Binary, Data: bsoncore.AppendBinary(nil, subtype, data)}, nil
+	case !st.encrypt && encrypted:
+		return st.ce.crypt.DecryptExplicit(ctx, subtype, data)
+	default:
+		return bsoncore.Value{Type: val.Type, Data: val.Value}, nil
+	}
+}
+
+// keyID returns the ID of the data key for an encrypted field, looking up key alt names in the key vault collection.
+func (st *schemaTransformer) keyID(ctx context.Context, md *encryptMetadata) (primitive.Binary, error) {
+	if md.keyID != nil {
+		return *md.keyID, nil
+	}
+
+	val, err := lookupJSONPointer(st.root, md.keyAltNamePointer)
+	if err != nil {
+		return primitive.Binary{}, err
+	}
+	name, ok := val.StringValueOK()
+	if !ok {
+		return primitive.Binary{}, fmt.Errorf("key alt name at JSON pointer %q is not a string", md.keyAltNamePointer)
+	}
+	if id, ok := st.keyIDs[name]; ok {
+		return id, nil
+	}
+
+	key, err := st.ce.keyVaultColl.FindOne(ctx, bson.D{{"keyAltNames", name}}).DecodeBytes()
+	switch {
+	case err == ErrNoDocuments:
+		return primitive.Binary{}, fmt.Errorf("no data key with key alt name %q", name)
+	case err != nil:
+		return primitive.Binary{}, EncryptionKeyVaultError{Wrapped: err}
+	}
+	subtype, data, ok := key.Lookup("_id").BinaryOK()
+	if !ok {
+		return primitive.Binary{}, fmt.Errorf("data key with key alt name %q has no binary _id", name)
+	}
+
+	id := primitive.Binary{Subtype: subtype, Data: data}
+	st.keyIDs[name] = id
+	return id, nil
+}
@@ -0,0 +1,106 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongo
+
+import (
+	"testing"
+
+	"github.com/appveen/mongo-go-driver/bson"
+	"github.com/appveen/mongo-go-driver/bson/primitive"
+	"github.com/appveen/mongo-go-driver/internal/testutil/assert"
+)
+
+const (
+	deterministicAlgorithm = "AEAD_AES_256_CBC_HMAC_SHA_512-Deterministic"
+	randomAlgorithm        = "AEAD_AES_256_CBC_HMAC_SHA_512-Random"
+)
+
+func TestParseEncryptionSchema(t *testing.T) {
+	keyID := primitive.Binary{Subtype: 4, Data: []byte("0123456789abcdef")}
+
+	t.Run("inherited metadata", func(t *testing.T) {
+		schema, err := bson.Marshal(bson.D{
+			{"bsonType", "object"},
+			{"encryptMetadata", bson.D{{"keyId", bson.A{keyID}}, {"algorithm", randomAlgorithm}}},
+			{"properties", bson.D{
+				{"ssn", bson.D{{"encrypt", bson.D{{"bsonType", "string"}, {"algorithm", deterministicAlgorithm}}}}},
+				{"address", bson.D{
+					{"bsonType", "object"},
+					{"encryptMetadata", bson.D{{"keyId", "/tenant"}}},
+					{"properties", bson.D{
+						{"street", bson.D{{"encrypt", bson.D{{"bsonType", "string"}}}}},
+						{"city", bson.D{{"bsonType", "string"}}},
+					}},
+				}},
+			}},
+		})
+		assert.Nil(t, err, "Marshal error: %v", err)
+
+		parsed, err := parseEncryptionSchema(schema, encryptMetadata{})
+		assert.Nil(t, err, "parseEncryptionSchema error: %v", err)
+
+		ssn := parsed.properties["ssn"].encrypt
+		assert.NotNil(t, ssn, "expected ssn to be encrypted")
+		assert.Equal(t, deterministicAlgorithm, ssn.algorithm, "expected algorithm %v, got %v", deterministicAlgorithm, ssn.algorithm)
+		assert.Equal(t, keyID, *ssn.keyID, "expected key ID %v, got %v", keyID, *ssn.keyID)
+
+		street := parsed.properties["address"].properties["street"].encrypt
+		assert.NotNil(t, street, "expected street to be encrypted")
+		assert.Equal(t, randomAlgorithm, street.algorithm, "expected algorithm %v, got %v", randomAlgorithm, street.algorithm)
+		assert.Nil(t, street.keyID, "expected no key ID, got %v", street.keyID)
+		assert.Equal(t, "/tenant", street.keyAltNamePointer, "expected pointer /tenant, got %v", street.keyAltNamePointer)
+
+		city := parsed.properties["address"].properties["city"]
+		assert.Nil(t, city.encrypt, "expected city not to be encrypted")
+	})
+	t.Run("errors", func(t *testing.T) {
+		testCases := []struct {
+			name   string
+			schema bson.D
+		}{
+			{"no algorithm", bson.D{{"properties", bson.D{
+				{"a", bson.D{{"encrypt", bson.D{{"keyId", bson.A{keyID}}}}}},
+			}}}},
+			{"no key", bson.D{{"properties", bson.D{
+				{"a", bson.D{{"encrypt", bson.D{{"algorithm", randomAlgorithm}}}}},
+			}}}},
+			{"relative pointer", bson.D{{"properties", bson.D{
+				{"a", bson.D{{"encrypt", bson.D{{"algorithm", randomAlgorithm}, {"keyId", "tenant"}}}}},
+			}}}},
+			{"pattern properties", bson.D{{"patternProperties", bson.D{}}}},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				schema, err := bson.Marshal(tc.schema)
+				assert.Nil(t, err, "Marshal error: %v", err)
+				_, err = parseEncryptionSchema(schema, encryptMetadata{})
+				assert.NotNil(t, err, "expected error, got nil")
+			})
+		}
+	})
+}
+
+func TestLookupJSONPointer(t *testing.T) {
+	doc, err := bson.Marshal(bson.D{
+		{"tenant", "acme"},
+		{"a/b", bson.D{{"~c", int32(7)}}},
+	})
+	assert.Nil(t, err, "Marshal error: %v", err)
+
+	val, err := lookupJSONPointer(doc, "/tenant")
+	assert.Nil(t, err, "lookupJSONPointer error: %v", err)
+	assert.Equal(t, "acme", val.StringValue(), "expected acme, got %v", val)
+
+	val, err = lookupJSONPointer(doc, "/a~1b/~0c")
+	assert.Nil(t, err, "lookupJSONPointer error: %v", err)
+	assert.Equal(t, int32(7), val.Int32(), "expected 7, got %v", val)
+
+	_, err = lookupJSONPointer(doc, "/missing")
+	assert.NotNil(t, err, "expected error for missing field")
+	_, err = lookupJSONPointer(doc, "/tenant/x")
+	assert.NotNil(t, err, "expected error for pointer into string")
+}
@@ -1069,12 +1069,27 @@ func (coll *Collection) Find(ctx context.Context, filter interface{},
 	if fo.Snapshot != nil {
 		op.Snapshot(*fo.Snapshot)
 	}
+	var sort bsoncore.Document
 	if fo.Sort != nil {
-		sort, err := transformBsoncoreDocument(coll.registry, fo.Sort)
+		sort, err = transformBsoncoreDocument(coll.registry, fo.Sort)
 		if err != nil {
 			closeImplicitSession(sess)
 			return nil, err
 		}
+	}
+	resumable := fo.Resumable != nil && *fo.Resumable
+	if resumable {
+		if fo.CursorType != nil && *fo.CursorType != options.NonTailable {
+			closeImplicitSession(sess)
+			return nil, errors.New("resumable find cannot be used with a tailable cursor")
+		}
+		sort, err = resumableFindSort(sort)
+		if err != nil {
+			closeImplicitSession(sess)
+			return nil, err
+		}
+	}
+	if sort != nil {
 		op.Sort(sort)
 	}
 	retry := driver.RetryNone
@@ -1093,7 +1108,29 @@ func (coll *Collection) Find(ctx context.Context, filter interface{},
 		closeImplicitSession(sess)
 		return nil, replaceErrors(err)
 	}
-	return newCursorWithSession(bc, coll.registry, sess)
+	if !resumable {
+		return newCursorWithSession(bc, coll.registry, sess)
+	}
+
+	var limit int64
+	if fo.Limit != nil {
+		limit = int64(cursorOpts.Limit)
+	}
+	reissue := func(ctx context.Context, filter bsoncore.Document, limit int64) (batchCursor, error) {
+		if filter != nil {
+			// documents skipped by the original query are excluded by the resume filter
+			op.Filter(filter).Skip(0)
+		}
+		if limit > 0 {
+			op.Limit(limit)
+			cursorOpts.Limit = int32(limit)
+		}
+		if err := op.Execute(ctx); err != nil {
+			return nil, replaceErrors(err)
+		}
+		return op.Result(cursorOpts)
+	}
+	return newCursorWithSession(newResumableBatchCursor(bc, f, sort, limit, reissue), coll.registry, sess)
 }
 
 // FindOne returns up to one document that matches the model.
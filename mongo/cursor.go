@@ -103,6 +103,27 @@ func (c *Cursor) Next(ctx context.Context) bool {
 
 	// call the Next method in a loop until at least one document is returned in the next batch or
 	// the context times out.
+	for {
+		if !c.nextBatch(ctx) {
+			return false
+		}
+
+		doc, err = c.batch.Next()
+		switch err {
+		case nil:
+			c.Current = bson.Raw(doc)
+			return true
+		case io.EOF: // Empty batch so we continue
+		default:
+			c.err = err
+			return false
+		}
+	}
+}
+
+// nextBatch loads the next non-exhausted batch from the batch cursor into c.batch. It returns false if the cursor
+// has no more batches or an error occurred, in which case c.err is set.
+func (c *Cursor) nextBatch(ctx context.Context) bool {
 	for {
 		// If we don't have a next batch
 		if !c.bc.Next(ctx) {
@@ -126,16 +147,7 @@ func (c *Cursor) Next(ctx context.Context) bool {
 		}
 
 		c.batch = c.bc.Batch()
-		doc, err = c.batch.Next()
-		switch err {
-		case nil:
-			c.Current = bson.Raw(doc)
-			return true
-		case io.EOF: // Empty batch so we continue
-		default:
-			c.err = err
-			return false
-		}
+		return true
 	}
 }
 
@@ -0,0 +1,225 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/appveen/mongo-go-driver/bson"
+)
+
+// DecodeErrorMode specifies how a CursorIterator handles documents that cannot be decoded.
+type DecodeErrorMode uint8
+
+// These constants are the valid values for DecodeErrorMode.
+const (
+	// DecodeErrorStop stops iteration at the first document that cannot be decoded. The decoding error is returned
+	// from CursorIterator.Err. This matches the behavior of Cursor.Decode and Cursor.All.
+	DecodeErrorStop DecodeErrorMode = iota
+	// DecodeErrorSkip silently skips documents that cannot be decoded and continues iterating.
+	DecodeErrorSkip
+	// DecodeErrorReport skips documents that cannot be decoded and continues iterating. Each skipped document is
+	// reported as a *DecodeError through CursorIterator.DecodeErrors.
+	DecodeErrorReport
+)
+
+// DecodeError is reported by a CursorIterator for a document that could not be decoded.
+type DecodeError struct {
+	// Raw is a copy of the document that could not be decoded.
+	Raw bson.Raw
+	// Err is the error returned by the decoder.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("error decoding document: %v", e.Err)
+}
+
+// Unwrap returns the underlying decoding error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// CursorIterator decodes documents from a Cursor one at a time or one batch at a time, handling documents that cannot
+// be decoded according to its DecodeErrorMode. A CursorIterator is created with Cursor.Iterator.
+//
+// A typical usage of the CursorIterator type would be:
+//
+//		it := cur.Iterator(mongo.DecodeErrorReport)
+//		var elem MyType
+//		for it.Next(ctx, &elem) {
+//			// do something with elem....
+//		}
+//
+//		for _, de := range it.DecodeErrors() {
+//			log.Printf("skipped %v: %v", de.Raw, de.Err)
+//		}
+//
+//		if err := it.Err(); err != nil {
+//			log.Fatal(err)
+//		}
+//
+// DecodeErrors only reports the documents skipped during the most recent call to Next or NextBatch, so callers using
+// DecodeErrorReport should check it after each call.
+type CursorIterator struct {
+	cursor       *Cursor
+	mode         DecodeErrorMode
+	decodeErrors []*DecodeError
+	err          error
+}
+
+// Iterator returns a CursorIterator over the remaining documents of c that handles decoding errors according to mode.
+// The Cursor should not be used directly while the CursorIterator is in use.
+func (c *Cursor) Iterator(mode DecodeErrorMode) *CursorIterator {
+	return &CursorIterator{
+		cursor: c,
+		mode:   mode,
+	}
+}
+
+// Next decodes the next document into val, which must be a non-nil pointer. It returns true if a document was
+// decoded and false if the cursor is exhausted or an error occurred. Documents that cannot be decoded are handled
+// according to the iterator's DecodeErrorMode.
+func (it *CursorIterator) Next(ctx context.Context, val interface{}) bool {
+	it.decodeErrors = nil
+	if it.err != nil {
+		return false
+	}
+
+	for it.cursor.Next(ctx) {
+		err := it.cursor.Decode(val)
+		if err == nil {
+			return true
+		}
+		if !it.handleDecodeError(it.cursor.Current, err) {
+			return false
+		}
+		resetValue(val)
+	}
+
+	it.err = it.cursor.Err()
+	return false
+}
+
+// NextBatch decodes the remaining documents of the cursor's current batch, fetching the next batch from the server if
+// the current one is exhausted. The results parameter must be a pointer to a slice. The slice pointed to by results is
+// truncated and refilled, reusing its backing array, so callers can pass the same slice on every call to keep
+// allocations low. Documents that cannot be decoded are handled according to the iterator's DecodeErrorMode.
+//
+// NextBatch returns true if the batch contained any documents and false if the cursor is exhausted or an error
+// occurred. When it returns false, the slice pointed to by results is empty, even if documents of the batch were
+// decoded before the error.
+func (it *CursorIterator) NextBatch(ctx context.Context, results interface{}) bool {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	it.decodeErrors = nil
+	if it.err != nil {
+		return false
+	}
+
+	resultsVal := reflect.ValueOf(results)
+	if resultsVal.Kind() != reflect.Ptr || resultsVal.Elem().Kind() != reflect.Slice {
+		it.err = errors.New("results argument must be a pointer to a slice")
+		return false
+	}
+
+	c := it.cursor
+	sliceVal := resultsVal.Elem()
+	elemType := sliceVal.Type().Elem()
+	index := 0
+	for {
+		for {
+			doc, err := c.batch.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				it.err = err
+				resultsVal.Elem().Set(sliceVal.Slice(0, 0))
+				return false
+			}
+
+			if sliceVal.Len() == index {
+				sliceVal = reflect.Append(sliceVal, reflect.Zero(elemType))
+				sliceVal = sliceVal.Slice(0, sliceVal.Cap())
+			}
+			currElem := sliceVal.Index(index)
+			currElem.Set(reflect.Zero(elemType))
+
+			err = bson.UnmarshalWithRegistry(c.registry, doc, currElem.Addr().Interface())
+			if err == nil {
+				index++
+				continue
+			}
+			if !it.handleDecodeError(doc, err) {
+				resultsVal.Elem().Set(sliceVal.Slice(0, 0))
+				return false
+			}
+		}
+
+		if index > 0 || len(it.decodeErrors) > 0 {
+			resultsVal.Elem().Set(sliceVal.Slice(0, index))
+			return true
+		}
+
+		if !c.nextBatch(ctx) {
+			it.err = c.Err()
+			resultsVal.Elem().Set(sliceVal.Slice(0, 0))
+			return false
+		}
+	}
+}
+
+// DecodeErrors returns the documents that could not be decoded during the most recent call to Next or NextBatch. It
+// is only populated when the iterator's DecodeErrorMode is DecodeErrorReport.
+func (it *CursorIterator) DecodeErrors() []*DecodeError {
+	return it.decodeErrors
+}
+
+// Err returns the last error encountered by the iterator. If the DecodeErrorMode is DecodeErrorStop, this includes
+// the *DecodeError for the first document that could not be decoded.
+func (it *CursorIterator) Err() error { return it.err }
+
+// Close closes the underlying cursor.
+func (it *CursorIterator) Close(ctx context.Context) error {
+	return it.cursor.Close(ctx)
+}
+
+// handleDecodeError applies the iterator's DecodeErrorMode to a decoding failure for doc. It returns true if iteration
+// should continue.
+func (it *CursorIterator) handleDecodeError(doc []byte, err error) bool {
+	switch it.mode {
+	case DecodeErrorSkip:
+		return true
+	case DecodeErrorReport:
+		raw := make(bson.Raw, len(doc))
+		copy(raw, doc)
+		it.decodeErrors = append(it.decodeErrors, &DecodeError{Raw: raw, Err: err})
+		return true
+	default:
+		raw := make(bson.Raw, len(doc))
+		copy(raw, doc)
+		it.err = &DecodeError{Raw: raw, Err: err}
+		return false
+	}
+}
+
+// resetValue sets the value pointed to by val to its zero value so fields from a partially decoded document do not
+// leak into the next one.
+func resetValue(val interface{}) {
+	rv := reflect.ValueOf(val)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return
+	}
+	rv.Elem().Set(reflect.Zero(rv.Elem().Type()))
+}
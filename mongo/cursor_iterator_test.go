@@ -0,0 +1,194 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/appveen/mongo-go-driver/internal/testutil/assert"
+	"github.com/appveen/mongo-go-driver/x/bsonx/bsoncore"
+)
+
+type iteratorDoc struct {
+	Foo int32 `bson:"foo"`
+}
+
+// newMixedBatchCursor creates a testBatchCursor whose batches contain documents with an int32 "foo" field, except for
+// the documents at the indexes in bad, which have a string "foo" field and cannot be decoded into iteratorDoc.
+func newMixedBatchCursor(numBatches, batchSize int, bad ...int) *testBatchCursor {
+	badSet := make(map[int]bool, len(bad))
+	for _, idx := range bad {
+		badSet[idx] = true
+	}
+
+	batches := make([]*bsoncore.DocumentSequence, 0, numBatches)
+	counter := 0
+	for batch := 0; batch < numBatches; batch++ {
+		var docSequence []byte
+		for doc := 0; doc < batchSize; doc++ {
+			var elem []byte
+			if badSet[counter] {
+				elem = bsoncore.AppendStringElement(elem, "foo", "bar")
+			} else {
+				elem = bsoncore.AppendInt32Element(elem, "foo", int32(counter))
+			}
+			counter++
+			docSequence = append(docSequence, bsoncore.BuildDocumentFromElements(nil, elem)...)
+		}
+		batches = append(batches, &bsoncore.DocumentSequence{
+			Style: bsoncore.SequenceStyle,
+			Data:  docSequence,
+		})
+	}
+	return &testBatchCursor{batches: batches}
+}
+
+func TestCursorIterator(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Next", func(t *testing.T) {
+		t.Run("stop mode returns decode error", func(t *testing.T) {
+			cursor, err := newCursor(newMixedBatchCursor(1, 5, 2), nil)
+			assert.Nil(t, err, "newCursor error: %v", err)
+
+			it := cursor.Iterator(DecodeErrorStop)
+			var doc iteratorDoc
+			var count int
+			for it.Next(ctx, &doc) {
+				count++
+			}
+			assert.Equal(t, 2, count, "expected 2 documents, got %v", count)
+			de, ok := it.Err().(*DecodeError)
+			assert.True(t, ok, "expected error type %T, got %T", &DecodeError{}, it.Err())
+			assert.Equal(t, "bar", de.Raw.Lookup("foo").StringValue(), "expected raw document to be reported")
+		})
+		t.Run("skip mode continues iterating", func(t *testing.T) {
+			cursor, err := newCursor(newMixedBatchCursor(2, 3, 1, 4), nil)
+			assert.Nil(t, err, "newCursor error: %v", err)
+
+			it := cursor.Iterator(DecodeErrorSkip)
+			var doc iteratorDoc
+			var got []int32
+			for it.Next(ctx, &doc) {
+				got = append(got, doc.Foo)
+				assert.Equal(t, 0, len(it.DecodeErrors()), "expected no reported errors in skip mode")
+			}
+			assert.Nil(t, it.Err(), "iterator error: %v", it.Err())
+			assert.Equal(t, []int32{0, 2, 3, 5}, got, "expected %v, got %v", []int32{0, 2, 3, 5}, got)
+		})
+		t.Run("report mode attaches raw documents", func(t *testing.T) {
+			cursor, err := newCursor(newMixedBatchCursor(1, 4, 1, 2), nil)
+			assert.Nil(t, err, "newCursor error: %v", err)
+
+			it := cursor.Iterator(DecodeErrorReport)
+			var doc iteratorDoc
+			assert.True(t, it.Next(ctx, &doc), "expected first document")
+			assert.Equal(t, 0, len(it.DecodeErrors()), "expected no errors for first document")
+			assert.True(t, it.Next(ctx, &doc), "expected next decodable document")
+			assert.Equal(t, int32(3), doc.Foo, "expected foo 3, got %v", doc.Foo)
+			assert.Equal(t, 2, len(it.DecodeErrors()), "expected 2 reported errors, got %v", len(it.DecodeErrors()))
+			for _, de := range it.DecodeErrors() {
+				assert.NotNil(t, de.Err, "expected decode error to be set")
+				assert.Equal(t, "bar", de.Raw.Lookup("foo").StringValue(), "expected raw document to be reported")
+			}
+			assert.False(t, it.Next(ctx, &doc), "expected cursor to be exhausted")
+			assert.Nil(t, it.Err(), "iterator error: %v", it.Err())
+		})
+	})
+	t.Run("NextBatch", func(t *testing.T) {
+		t.Run("errors if argument is not pointer to slice", func(t *testing.T) {
+			cursor, err := newCursor(newMixedBatchCursor(1, 5), nil)
+			assert.Nil(t, err, "newCursor error: %v", err)
+
+			it := cursor.Iterator(DecodeErrorStop)
+			assert.False(t, it.NextBatch(ctx, []iteratorDoc{}), "expected NextBatch to return false")
+			assert.NotNil(t, it.Err(), "expected error, got nil")
+		})
+		t.Run("decodes one batch at a time", func(t *testing.T) {
+			cursor, err := newCursor(newMixedBatchCursor(3, 4), nil)
+			assert.Nil(t, err, "newCursor error: %v", err)
+
+			it := cursor.Iterator(DecodeErrorStop)
+			docs := make([]iteratorDoc, 0, 4)
+			var batches, total int
+			for it.NextBatch(ctx, &docs) {
+				assert.Equal(t, 4, len(docs), "expected 4 documents, got %v", len(docs))
+				assert.Equal(t, 4, cap(docs), "expected backing array to be reused")
+				for i, doc := range docs {
+					assert.Equal(t, int32(total+i), doc.Foo, "expected foo %v, got %v", total+i, doc.Foo)
+				}
+				batches++
+				total += len(docs)
+			}
+			assert.Nil(t, it.Err(), "iterator error: %v", it.Err())
+			assert.Equal(t, 3, batches, "expected 3 batches, got %v", batches)
+		})
+		t.Run("drains current batch after Next", func(t *testing.T) {
+			cursor, err := newCursor(newMixedBatchCursor(1, 4), nil)
+			assert.Nil(t, err, "newCursor error: %v", err)
+
+			it := cursor.Iterator(DecodeErrorStop)
+			var doc iteratorDoc
+			assert.True(t, it.Next(ctx, &doc), "expected first document")
+
+			var docs []iteratorDoc
+			assert.True(t, it.NextBatch(ctx, &docs), "expected remaining batch")
+			assert.Equal(t, 3, len(docs), "expected 3 documents, got %v", len(docs))
+			assert.Equal(t, int32(1), docs[0].Foo, "expected foo 1, got %v", docs[0].Foo)
+		})
+		t.Run("stop mode returns no partial batch", func(t *testing.T) {
+			cursor, err := newCursor(newMixedBatchCursor(1, 4, 2), nil)
+			assert.Nil(t, err, "newCursor error: %v", err)
+
+			it := cursor.Iterator(DecodeErrorStop)
+			docs := []iteratorDoc{{42}}
+			assert.False(t, it.NextBatch(ctx, &docs), "expected NextBatch to return false")
+			assert.Equal(t, 0, len(docs), "expected 0 documents, got %v", len(docs))
+			assert.NotNil(t, it.Err(), "expected error, got nil")
+		})
+		t.Run("nil context", func(t *testing.T) {
+			cursor, err := newCursor(newMixedBatchCursor(2, 2), nil)
+			assert.Nil(t, err, "newCursor error: %v", err)
+
+			it := cursor.Iterator(DecodeErrorStop)
+			var docs []iteratorDoc
+			var total int
+			for it.NextBatch(nil, &docs) {
+				total += len(docs)
+			}
+			assert.Nil(t, it.Err(), "iterator error: %v", it.Err())
+			assert.Equal(t, 4, total, "expected 4 documents, got %v", total)
+		})
+		t.Run("report mode collects errors per batch", func(t *testing.T) {
+			cursor, err := newCursor(newMixedBatchCursor(2, 3, 0, 1, 2, 4), nil)
+			assert.Nil(t, err, "newCursor error: %v", err)
+
+			it := cursor.Iterator(DecodeErrorReport)
+			var docs []iteratorDoc
+			assert.True(t, it.NextBatch(ctx, &docs), "expected first batch")
+			assert.Equal(t, 0, len(docs), "expected 0 documents, got %v", len(docs))
+			assert.Equal(t, 3, len(it.DecodeErrors()), "expected 3 reported errors, got %v", len(it.DecodeErrors()))
+
+			assert.True(t, it.NextBatch(ctx, &docs), "expected second batch")
+			assert.Equal(t, []iteratorDoc{{3}, {5}}, docs, "expected %v, got %v", []iteratorDoc{{3}, {5}}, docs)
+			assert.Equal(t, 1, len(it.DecodeErrors()), "expected 1 reported error, got %v", len(it.DecodeErrors()))
+
+			assert.False(t, it.NextBatch(ctx, &docs), "expected cursor to be exhausted")
+			assert.Nil(t, it.Err(), "iterator error: %v", it.Err())
+		})
+		t.Run("skip mode skips empty batches", func(t *testing.T) {
+			cursor, err := newCursor(newMixedBatchCursor(2, 2, 0, 1), nil)
+			assert.Nil(t, err, "newCursor error: %v", err)
+
+			it := cursor.Iterator(DecodeErrorSkip)
+			var docs []iteratorDoc
+			assert.True(t, it.NextBatch(ctx, &docs), "expected a batch")
+			assert.Equal(t, []iteratorDoc{{2}, {3}}, docs, "expected %v, got %v", []iteratorDoc{{2}, {3}}, docs)
+		})
+	})
+}
@@ -8,16 +8,20 @@ package gridfs // import "github.com/appveen/mongo-go-driver/mongo/gridfs"
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 
 	"io"
 
 	"errors"
 
+	"fmt"
+	"hash"
+	"sync"
 	"time"
 
 	"github.com/appveen/mongo-go-driver/bson"
-	"github.com/appveen/mongo-go-driver/bson/bsontype"
+	"github.com/appveen/mongo-go-driver/bson/bsoncodec"
 	"github.com/appveen/mongo-go-driver/bson/primitive"
 	"github.com/appveen/mongo-go-driver/mongo"
 	"github.com/appveen/mongo-go-driver/mongo/options"
@@ -28,14 +32,14 @@ import (
 	"github.com/appveen/mongo-go-driver/x/bsonx/bsoncore"
 )
 
-// TODO: add sessions options
-
 // DefaultChunkSize is the default size of each file chunk.
 const DefaultChunkSize int32 = 255 * 1024 // 255 KiB
 
 // ErrFileNotFound occurs if a user asks to download a file with a file ID that isn't found in the files collection.
 var ErrFileNotFound = errors.New("file with given parameters not found")
 
+var errInvalidHash = errors.New("gridfs: hash algorithms must have a name and a constructor")
+
 // Bucket represents a GridFS bucket.
 type Bucket struct {
 	db         *mongo.Database
@@ -48,6 +52,15 @@ type Bucket struct {
 	rc        *readconcern.ReadConcern
 	rp        *readpref.ReadPref
 
+	hashes         map[string]func() hash.Hash         // algorithms the bucket can verify digests with, by name
+	transformer    options.ChunkTransformer            // default chunk transformer for uploads
+	transformersMu sync.RWMutex                        // guards transformers, which uploads add to
+	transformers   map[string]options.ChunkTransformer // chunk transformers the bucket can reverse, by name
+
+	registry          *bsoncodec.Registry // decodes and encodes file metadata
+	uploadConcurrency int                 // number of chunk batches an upload stream inserts concurrently
+	downloadPrefetch  int                 // number of chunks a download stream fetches ahead of the reader
+
 	firstWriteDone bool
 	readBuf        []byte
 	writeBuf       []byte
@@ -58,8 +71,12 @@ type Bucket struct {
 
 // Upload contains options to upload a file to a bucket.
 type Upload struct {
-	chunkSize int32
-	metadata  bsonx.Doc
+	chunkSize   int32
+	metadata    bsonx.Doc
+	hash        *options.GridFSHash
+	transformer options.ChunkTransformer
+	concurrency int
+	resumable   bool
 }
 
 // NewBucket creates a GridFS bucket.
@@ -71,6 +88,9 @@ func NewBucket(db *mongo.Database, opts ...*options.BucketOptions) (*Bucket, err
 		wc:        db.WriteConcern(),
 		rc:        db.ReadConcern(),
 		rp:        db.ReadPreference(),
+
+		registry:          bson.DefaultRegistry,
+		uploadConcurrency: 1,
 	}
 
 	bo := options.MergeBucketOptions(opts...)
@@ -90,6 +110,44 @@ func NewBucket(db *mongo.Database, opts ...*options.BucketOptions) (*Bucket, err
 		b.rp = bo.ReadPreference
 	}
 
+	if bo.Registry != nil {
+		b.registry = bo.Registry
+	}
+	if bo.UploadConcurrency != nil {
+		if *bo.UploadConcurrency < 1 {
+			return nil, errors.New("gridfs: upload concurrency must be at least 1")
+		}
+		b.uploadConcurrency = *bo.UploadConcurrency
+	}
+	if bo.DownloadPrefetch != nil {
+		if *bo.DownloadPrefetch < 0 {
+			return nil, errors.New("gridfs: download prefetch must not be negative")
+		}
+		b.downloadPrefetch = *bo.DownloadPrefetch
+	}
+
+	sha256Hash := options.SHA256Hash()
+	b.hashes = map[string]func() hash.Hash{sha256Hash.Name: sha256Hash.New}
+	for _, h := range bo.Hashes {
+		if h.Name == "" || h.New == nil {
+			return nil, errInvalidHash
+		}
+		b.hashes[h.Name] = h.New
+	}
+
+	b.transformer = bo.Transformer
+	b.transformers = map[string]options.ChunkTransformer{
+		GzipTransformerName: gzipTransformer{level: gzip.DefaultCompression},
+	}
+	for _, t := range bo.Transformers {
+		if t != nil {
+			b.transformers[t.Name()] = t
+		}
+	}
+	if bo.Transformer != nil {
+		b.transformers[bo.Transformer.Name()] = bo.Transformer
+	}
+
 	var collOpts = options.Collection().SetWriteConcern(b.wc).SetReadConcern(b.rc).SetReadPreference(b.rp)
 
 	b.chunksColl = db.Collection(b.name+".chunks", collOpts)
@@ -117,6 +175,14 @@ func (b *Bucket) OpenUploadStream(filename string, opts ...*options.UploadOption
 	return b.OpenUploadStreamWithID(primitive.NewObjectID(), filename, opts...)
 }
 
+// OpenUploadStreamContext creates a file ID and a new upload stream for a file given the filename. The operations
+// needed to open the stream are bound to ctx.
+func (b *Bucket) OpenUploadStreamContext(ctx context.Context, filename string,
+	opts ...*options.UploadOptions) (*UploadStream, error) {
+
+	return b.OpenUploadStreamWithIDContext(ctx, primitive.NewObjectID(), filename, opts...)
+}
+
 // OpenUploadStreamWithID creates a new upload stream for a file given the file ID and filename.
 func (b *Bucket) OpenUploadStreamWithID(fileID interface{}, filename string, opts ...*options.UploadOptions) (*UploadStream, error) {
 	ctx, cancel := deadlineContext(b.writeDeadline)
@@ -124,6 +190,23 @@ func (b *Bucket) OpenUploadStreamWithID(fileID interface{}, filename string, opt
 		defer cancel()
 	}
 
+	return b.OpenUploadStreamWithIDContext(ctx, fileID, filename, opts...)
+}
+
+// OpenUploadStreamWithIDContext creates a new upload stream for a file given the file ID and filename. The operations
+// needed to open the stream are bound to ctx. The stream's WriteContext, CloseContext and AbortContext methods must be
+// used for the upload to take part in the session or transaction carried by a context.
+//
+// Before the first upload, the bucket creates the indexes on its collections if they do not exist. Indexes cannot be
+// created inside a transaction, so if ctx carries a session with a running transaction, the indexes are checked and
+// created outside of it.
+func (b *Bucket) OpenUploadStreamWithIDContext(ctx context.Context, fileID interface{}, filename string,
+	opts ...*options.UploadOptions) (*UploadStream, error) {
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
 	if err := b.checkFirstWrite(ctx); err != nil {
 		return nil, err
 	}
@@ -133,7 +216,13 @@ func (b *Bucket) OpenUploadStreamWithID(fileID interface{}, filename string, opt
 		return nil, err
 	}
 
-	return newUploadStream(upload, fileID, filename, b.chunksColl, b.filesColl), nil
+	us := newUploadStream(upload, fileID, filename, b.chunksColl, b.filesColl)
+	if upload.resumable {
+		if err = us.insertMarker(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return us, nil
 }
 
 // UploadFromStream creates a fileID and uploads a file given a source stream.
@@ -143,29 +232,55 @@ func (b *Bucket) UploadFromStream(filename string, source io.Reader, opts ...*op
 	return fileID, err
 }
 
+// UploadFromStreamContext creates a fileID and uploads a file given a source stream. The upload is bound to ctx.
+func (b *Bucket) UploadFromStreamContext(ctx context.Context, filename string, source io.Reader,
+	opts ...*options.UploadOptions) (primitive.ObjectID, error) {
+
+	fileID := primitive.NewObjectID()
+	err := b.UploadFromStreamWithIDContext(ctx, fileID, filename, source, opts...)
+	return fileID, err
+}
+
 // UploadFromStreamWithID uploads a file given a source stream.
 func (b *Bucket) UploadFromStreamWithID(fileID interface{}, filename string, source io.Reader, opts ...*options.UploadOptions) error {
-	us, err := b.OpenUploadStreamWithID(fileID, filename, opts...)
-	if err != nil {
-		return err
+	ctx, cancel := deadlineContext(b.writeDeadline)
+	if cancel != nil {
+		defer cancel()
+	}
+
+	return b.UploadFromStreamWithIDContext(ctx, fileID, filename, source, opts...)
+}
+
+// UploadFromStreamWithIDContext uploads a file given a source stream. The upload is bound to ctx. If ctx is cancelled
+// or expires, the chunks that were already uploaded are deleted, unless the upload is resumable.
+func (b *Bucket) UploadFromStreamWithIDContext(ctx context.Context, fileID interface{}, filename string,
+	source io.Reader, opts ...*options.UploadOptions) error {
+
+	if ctx == nil {
+		ctx = context.Background()
 	}
 
-	err = us.SetWriteDeadline(b.writeDeadline)
+	us, err := b.OpenUploadStreamWithIDContext(ctx, fileID, filename, opts...)
 	if err != nil {
-		_ = us.Close()
 		return err
 	}
 
 	for {
 		n, err := source.Read(b.readBuf)
 		if err != nil && err != io.EOF {
-			_ = us.Abort() // upload considered aborted if source stream returns an error
+			if !us.resumable {
+				_ = us.AbortContext(ctx) // upload considered aborted if source stream returns an error
+			}
 			return err
 		}
 
 		if n > 0 {
-			_, err := us.Write(b.readBuf[:n])
+			_, err := us.WriteContext(ctx, b.readBuf[:n])
 			if err != nil {
+				if ctx.Err() != nil && !us.resumable {
+					// ctx can no longer be used to delete the uploaded chunks
+					_ = us.AbortContext(context.Background())
+				}
 				return err
 			}
 		}
@@ -175,70 +290,155 @@ func (b *Bucket) UploadFromStreamWithID(fileID interface{}, filename string, sou
 		}
 	}
 
-	return us.Close()
+	return us.CloseContext(ctx)
 }
 
 // OpenDownloadStream creates a stream from which the contents of the file can be read.
-func (b *Bucket) OpenDownloadStream(fileID interface{}) (*DownloadStream, error) {
+func (b *Bucket) OpenDownloadStream(fileID interface{}, opts ...*options.DownloadOptions) (*DownloadStream, error) {
+	ctx, cancel := deadlineContext(b.readDeadline)
+	if cancel != nil {
+		defer cancel()
+	}
+
+	return b.OpenDownloadStreamContext(ctx, fileID, opts...)
+}
+
+// OpenDownloadStreamContext creates a stream from which the contents of the file can be read. The queries for the
+// file and its chunks are bound to ctx. The stream's ReadContext method must be used for reads to take part in the
+// session carried by a context.
+//
+// If hash verification is requested, the digest of the contents is checked when the last chunk is read sequentially,
+// and a *CorruptionError is returned instead of the chunk's data if it does not match. Reads after a Seek or Skip past
+// unread chunks and ReadAt calls are not verified.
+func (b *Bucket) OpenDownloadStreamContext(ctx context.Context, fileID interface{},
+	opts ...*options.DownloadOptions) (*DownloadStream, error) {
+
 	id, err := convertFileID(fileID)
 	if err != nil {
 		return nil, err
 	}
-	return b.openDownloadStream(bsonx.Doc{
+	do := options.MergeDownloadOptions(opts...)
+	verify := do.VerifyHash != nil && *do.VerifyHash
+	return b.openDownloadStream(ctx, bsonx.Doc{
 		{"_id", id},
-	})
+	}, verify)
 }
 
 // DownloadToStream downloads the file with the specified fileID and writes it to the provided io.Writer.
 // Returns the number of bytes written to the steam and an error, or nil if there was no error.
-func (b *Bucket) DownloadToStream(fileID interface{}, stream io.Writer) (int64, error) {
-	ds, err := b.OpenDownloadStream(fileID)
+func (b *Bucket) DownloadToStream(fileID interface{}, stream io.Writer, opts ...*options.DownloadOptions) (int64, error) {
+	ctx, cancel := deadlineContext(b.readDeadline)
+	if cancel != nil {
+		defer cancel()
+	}
+
+	return b.DownloadToStreamContext(ctx, fileID, stream, opts...)
+}
+
+// DownloadToStreamContext downloads the file with the specified fileID and writes it to the provided io.Writer. The
+// download is bound to ctx. Returns the number of bytes written to the stream and an error, or nil if there was no
+// error.
+func (b *Bucket) DownloadToStreamContext(ctx context.Context, fileID interface{}, stream io.Writer,
+	opts ...*options.DownloadOptions) (int64, error) {
+
+	ds, err := b.OpenDownloadStreamContext(ctx, fileID, opts...)
 	if err != nil {
 		return 0, err
 	}
 
-	return b.downloadToStream(ds, stream)
+	return b.downloadToStream(ctx, ds, stream)
 }
 
 // OpenDownloadStreamByName opens a download stream for the file with the given filename.
 func (b *Bucket) OpenDownloadStreamByName(filename string, opts ...*options.NameOptions) (*DownloadStream, error) {
-	var numSkip int32 = -1
-	var sortOrder int32 = 1
+	ctx, cancel := deadlineContext(b.readDeadline)
+	if cancel != nil {
+		defer cancel()
+	}
+
+	return b.OpenDownloadStreamByNameContext(ctx, filename, opts...)
+}
+
+// OpenDownloadStreamByNameContext opens a download stream for the file with the given filename. The queries for the
+// file and its chunks are bound to ctx.
+func (b *Bucket) OpenDownloadStreamByNameContext(ctx context.Context, filename string,
+	opts ...*options.NameOptions) (*DownloadStream, error) {
+
+	var revision int32 = -1
 
 	nameOpts := options.MergeNameOptions(opts...)
 	if nameOpts.Revision != nil {
-		numSkip = *nameOpts.Revision
+		revision = *nameOpts.Revision
 	}
 
-	if numSkip < 0 {
+	verify := nameOpts.VerifyHash != nil && *nameOpts.VerifyHash
+	ds, _, err := b.openDownloadStreamByName(ctx, filename, revision, verify)
+	return ds, err
+}
+
+// openDownloadStreamByName opens a download stream for the given revision of the file with the given filename. See
+// options.NameOptions.SetRevision for the meaning of revision.
+func (b *Bucket) openDownloadStreamByName(ctx context.Context, filename string, revision int32,
+	verify bool) (*DownloadStream, fileInfo, error) {
+
+	var sortOrder int32 = 1
+	if revision < 0 {
 		sortOrder = -1
-		numSkip = (-1 * numSkip) - 1
+		revision = (-1 * revision) - 1
 	}
 
-	findOpts := options.Find().SetSkip(int64(numSkip)).SetSort(bsonx.Doc{{"uploadDate", bsonx.Int32(sortOrder)}})
+	findOpts := options.Find().SetSkip(int64(revision)).SetSort(bsonx.Doc{{"uploadDate", bsonx.Int32(sortOrder)}})
 
-	return b.openDownloadStream(bsonx.Doc{{"filename", bsonx.String(filename)}}, findOpts)
+	// uploads in progress are not revisions of the file yet
+	filter := bsonx.Doc{
+		{"filename", bsonx.String(filename)},
+		{"inProgress", bsonx.Document(bsonx.Doc{{"$ne", bsonx.Boolean(true)}})},
+	}
+	return b.openDownloadStreamInfo(ctx, filter, verify, findOpts)
 }
 
 // DownloadToStreamByName downloads the file with the given name to the given io.Writer.
 func (b *Bucket) DownloadToStreamByName(filename string, stream io.Writer, opts ...*options.NameOptions) (int64, error) {
-	ds, err := b.OpenDownloadStreamByName(filename, opts...)
+	ctx, cancel := deadlineContext(b.readDeadline)
+	if cancel != nil {
+		defer cancel()
+	}
+
+	return b.DownloadToStreamByNameContext(ctx, filename, stream, opts...)
+}
+
+// DownloadToStreamByNameContext downloads the file with the given name to the given io.Writer. The download is bound
+// to ctx.
+func (b *Bucket) DownloadToStreamByNameContext(ctx context.Context, filename string, stream io.Writer,
+	opts ...*options.NameOptions) (int64, error) {
+
+	ds, err := b.OpenDownloadStreamByNameContext(ctx, filename, opts...)
 	if err != nil {
 		return 0, err
 	}
 
-	return b.downloadToStream(ds, stream)
+	return b.downloadToStream(ctx, ds, stream)
 }
 
 // Delete deletes all chunks and metadata associated with the file with the given file ID.
 func (b *Bucket) Delete(fileID interface{}) error {
-	// delete document in files collection and then chunks to minimize race conditions
-
 	ctx, cancel := deadlineContext(b.writeDeadline)
 	if cancel != nil {
 		defer cancel()
 	}
 
+	return b.DeleteContext(ctx, fileID)
+}
+
+// DeleteContext deletes all chunks and metadata associated with the file with the given file ID. The deletes are
+// bound to ctx, so they take part in the transaction carried by ctx, if any.
+func (b *Bucket) DeleteContext(ctx context.Context, fileID interface{}) error {
+	// delete document in files collection and then chunks to minimize race conditions
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
 	id, err := convertFileID(fileID)
 	if err != nil {
 		return err
@@ -262,6 +462,13 @@ func (b *Bucket) Find(filter interface{}, opts ...*options.GridFSFindOptions) (*
 		defer cancel()
 	}
 
+	return b.FindContext(ctx, filter, opts...)
+}
+
+// FindContext returns the files collection documents that match the given filter. The query is bound to ctx.
+func (b *Bucket) FindContext(ctx context.Context, filter interface{},
+	opts ...*options.GridFSFindOptions) (*mongo.Cursor, error) {
+
 	gfsOpts := options.MergeGridFSFindOptions(opts...)
 	find := options.Find()
 	if gfsOpts.BatchSize != nil {
@@ -293,6 +500,11 @@ func (b *Bucket) Rename(fileID interface{}, newFilename string) error {
 		defer cancel()
 	}
 
+	return b.RenameContext(ctx, fileID, newFilename)
+}
+
+// RenameContext renames the stored file with the specified file ID. The update is bound to ctx.
+func (b *Bucket) RenameContext(ctx context.Context, fileID interface{}, newFilename string) error {
 	id, err := convertFileID(fileID)
 	if err != nil {
 		return err
@@ -319,6 +531,11 @@ func (b *Bucket) Drop() error {
 		defer cancel()
 	}
 
+	return b.DropContext(ctx)
+}
+
+// DropContext drops the files and chunks collections associated with this bucket. The drops are bound to ctx.
+func (b *Bucket) DropContext(ctx context.Context) error {
 	err := b.filesColl.Drop(ctx)
 	if err != nil {
 		return err
@@ -327,43 +544,63 @@ func (b *Bucket) Drop() error {
 	return b.chunksColl.Drop(ctx)
 }
 
-func (b *Bucket) openDownloadStream(filter interface{}, opts ...*options.FindOptions) (*DownloadStream, error) {
-	ctx, cancel := deadlineContext(b.readDeadline)
-	if cancel != nil {
-		defer cancel()
+func (b *Bucket) openDownloadStream(ctx context.Context, filter interface{}, verify bool,
+	opts ...*options.FindOptions) (*DownloadStream, error) {
+
+	ds, _, err := b.openDownloadStreamInfo(ctx, filter, verify, opts...)
+	return ds, err
+}
+
+// openDownloadStreamInfo opens a download stream for the first file matching filter and also returns the file's
+// files collection document.
+func (b *Bucket) openDownloadStreamInfo(ctx context.Context, filter interface{}, verify bool,
+	opts ...*options.FindOptions) (*DownloadStream, fileInfo, error) {
+
+	if ctx == nil {
+		ctx = context.Background()
 	}
 
 	cursor, err := b.findFile(ctx, filter, opts...)
 	if err != nil {
-		return nil, err
+		return nil, fileInfo{}, err
 	}
 
-	fileLenElem, err := cursor.Current.LookupErr("length")
+	info, err := b.parseFileInfo(cursor.Current)
+	_ = cursor.Close(ctx)
 	if err != nil {
-		return nil, err
+		return nil, info, err
 	}
-	fileIDElem, err := cursor.Current.LookupErr("_id")
-	if err != nil {
-		return nil, err
+	if info.inProgress {
+		return nil, info, ErrUploadInProgress
 	}
 
-	var fileLen int64
-	switch fileLenElem.Type {
-	case bsontype.Int32:
-		fileLen = int64(fileLenElem.Int32())
-	default:
-		fileLen = fileLenElem.Int64()
+	ds, err := b.newDownloadStream(info)
+	if err != nil {
+		return nil, info, err
 	}
-
-	if fileLen == 0 {
-		return newDownloadStream(nil, b.chunkSize, 0), nil
+	if verify {
+		if ds.hasher, err = b.newHash(info); err != nil {
+			return nil, info, err
+		}
+		ds.hashDigest = info.hashDigest
+	}
+	if info.length == 0 {
+		if verify {
+			if err = ds.verifyHash(); err != nil {
+				return nil, info, err
+			}
+		}
+		return ds, info, nil
 	}
 
-	chunksCursor, err := b.findChunks(ctx, fileIDElem)
-	if err != nil {
-		return nil, err
+	if ds.prefetch > 0 {
+		// chunks are fetched by the first read
+		return ds, info, nil
 	}
-	return newDownloadStream(chunksCursor, b.chunkSize, int64(fileLen)), nil
+	if err = ds.openCursor(ctx); err != nil {
+		return nil, info, err
+	}
+	return ds, info, nil
 }
 
 func deadlineContext(deadline time.Time) (context.Context, context.CancelFunc) {
@@ -374,20 +611,24 @@ func deadlineContext(deadline time.Time) (context.Context, context.CancelFunc) {
 	return context.WithDeadline(context.Background(), deadline)
 }
 
-func (b *Bucket) downloadToStream(ds *DownloadStream, stream io.Writer) (int64, error) {
-	err := ds.SetReadDeadline(b.readDeadline)
+func (b *Bucket) downloadToStream(ctx context.Context, ds *DownloadStream, stream io.Writer) (int64, error) {
+	copied, err := io.Copy(stream, contextReader{ctx: ctx, ds: ds})
 	if err != nil {
-		_ = ds.Close()
+		_ = ds.CloseContext(ctx)
 		return 0, err
 	}
 
-	copied, err := io.Copy(stream, ds)
-	if err != nil {
-		_ = ds.Close()
-		return 0, err
-	}
+	return copied, ds.CloseContext(ctx)
+}
+
+// contextReader is an io.Reader that reads from a download stream with a fixed context.
+type contextReader struct {
+	ctx context.Context
+	ds  *DownloadStream
+}
 
-	return copied, ds.Close()
+func (cr contextReader) Read(p []byte) (int, error) {
+	return cr.ds.ReadContext(cr.ctx, p)
 }
 
 func (b *Bucket) deleteChunks(ctx context.Context, fileID interface{}) error {
@@ -413,21 +654,6 @@ func (b *Bucket) findFile(ctx context.Context, filter interface{}, opts ...*opti
 	return cursor, nil
 }
 
-func (b *Bucket) findChunks(ctx context.Context, fileID interface{}) (*mongo.Cursor, error) {
-	id, err := convertFileID(fileID)
-	if err != nil {
-		return nil, err
-	}
-	chunksCursor, err := b.chunksColl.Find(ctx,
-		bsonx.Doc{{"files_id", id}},
-		options.Find().SetSort(bsonx.Doc{{"n", bsonx.Int32(1)}})) // sort by chunk index
-	if err != nil {
-		return nil, err
-	}
-
-	return chunksCursor, nil
-}
-
 // Create an index if it doesn't already exist
 func createIndexIfNotExists(ctx context.Context, iv mongo.IndexView, model mongo.IndexModel) error {
 	c, err := iv.List(ctx)
@@ -516,6 +742,10 @@ func (b *Bucket) checkFirstWrite(ctx context.Context) error {
 		// before the first write operation, must determine if files collection is empty
 		// if so, create indexes if they do not already exist
 
+		if inTransaction(ctx) {
+			// indexes cannot be created in a transaction
+			ctx = withoutSession{ctx}
+		}
 		if err := b.createIndexes(ctx); err != nil {
 			return err
 		}
@@ -525,24 +755,61 @@ func (b *Bucket) checkFirstWrite(ctx context.Context) error {
 	return nil
 }
 
+// inTransaction reports whether ctx carries a session with a running transaction.
+func inTransaction(ctx context.Context) bool {
+	xs, ok := mongo.SessionFromContext(ctx).(mongo.XSession)
+	return ok && xs.ClientSession().TransactionRunning()
+}
+
+// withoutSession is a context that has the cancellation, deadline and values of its parent except for the parent's
+// session, so operations using it do not pick up the session.
+type withoutSession struct {
+	context.Context
+}
+
+func (ws withoutSession) Value(key interface{}) interface{} {
+	val := ws.Context.Value(key)
+	if sess, ok := val.(mongo.Session); ok && sess == mongo.SessionFromContext(ws.Context) {
+		// the session key is not exported, so the session is recognized by its value
+		return nil
+	}
+	return val
+}
+
 func (b *Bucket) parseUploadOptions(opts ...*options.UploadOptions) (*Upload, error) {
 	upload := &Upload{
-		chunkSize: b.chunkSize, // upload chunk size defaults to bucket's value
+		chunkSize:   b.chunkSize, // upload chunk size defaults to bucket's value
+		concurrency: b.uploadConcurrency,
 	}
 
 	uo := options.MergeUploadOptions(opts...)
 	if uo.ChunkSizeBytes != nil {
 		upload.chunkSize = *uo.ChunkSizeBytes
 	}
+	if uo.Resumable != nil {
+		upload.resumable = *uo.Resumable
+	}
+	upload.transformer = b.transformer
+	if uo.Transformer != nil {
+		upload.transformer = uo.Transformer
+		// allow this bucket to download the file
+		b.transformersMu.Lock()
+		if _, ok := b.transformers[uo.Transformer.Name()]; !ok {
+			b.transformers[uo.Transformer.Name()] = uo.Transformer
+		}
+		b.transformersMu.Unlock()
+	}
+	if uo.Hash != nil {
+		if uo.Hash.Name == "" || uo.Hash.New == nil {
+			return nil, errInvalidHash
+		}
+		upload.hash = uo.Hash
+	}
 	if uo.Registry == nil {
 		uo.Registry = bson.DefaultRegistry
 	}
 	if uo.Metadata != nil {
-		raw, err := bson.MarshalWithRegistry(uo.Registry, uo.Metadata)
-		if err != nil {
-			return nil, err
-		}
-		doc, err := bsonx.ReadDoc(raw)
+		doc, err := marshalMetadata(uo.Registry, uo.Metadata)
 		if err != nil {
 			return nil, err
 		}
@@ -556,6 +823,18 @@ type _convertFileID struct {
 	ID interface{} `bson:"_id"`
 }
 
+// chunkTransformer returns the chunk transformer with the given name, which is stored in files collection documents.
+func (b *Bucket) chunkTransformer(name string) (options.ChunkTransformer, error) {
+	b.transformersMu.RLock()
+	defer b.transformersMu.RUnlock()
+
+	t, ok := b.transformers[name]
+	if !ok {
+		return nil, fmt.Errorf("gridfs: unknown chunk transformer %q", name)
+	}
+	return t, nil
+}
+
 func convertFileID(fileID interface{}) (bsonx.Val, error) {
 	id := _convertFileID{
 		ID: fileID,
@@ -570,3 +849,12 @@ func convertFileID(fileID interface{}) (bsonx.Val, error) {
 	err = res.UnmarshalBSONValue(val.Type, val.Data)
 	return res, err
 }
+
+// transformerFileID returns the files_id passed to chunk transformers.
+func transformerFileID(id bsonx.Val) ([]byte, error) {
+	t, data, err := id.MarshalBSONValue()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{byte(t)}, data...), nil
+}
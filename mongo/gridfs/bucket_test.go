@@ -0,0 +1,68 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package gridfs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/appveen/mongo-go-driver/internal/testutil/assert"
+	"github.com/appveen/mongo-go-driver/mongo"
+	"github.com/appveen/mongo-go-driver/mongo/options"
+)
+
+type testContextKey struct{}
+
+func TestWithoutSession(t *testing.T) {
+	client, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	assert.Nil(t, err, "NewClient error: %v", err)
+	// connecting does not wait for a server
+	err = client.Connect(context.Background())
+	assert.Nil(t, err, "Connect error: %v", err)
+	defer func() {
+		_ = client.Disconnect(context.Background())
+	}()
+	sess, err := client.StartSession()
+	assert.Nil(t, err, "StartSession error: %v", err)
+	defer sess.EndSession(context.Background())
+
+	parent := context.WithValue(context.Background(), testContextKey{}, "value")
+	err = mongo.WithSession(parent, sess, func(sc mongo.SessionContext) error {
+		assert.NotNil(t, mongo.SessionFromContext(sc), "expected the parent to have a session")
+
+		ctx := withoutSession{sc}
+		assert.Nil(t, mongo.SessionFromContext(ctx), "expected the session to be hidden")
+		val := ctx.Value(testContextKey{})
+		assert.Equal(t, "value", val, "expected other values of the parent to be kept, got %v", val)
+		return nil
+	})
+	assert.Nil(t, err, "WithSession error: %v", err)
+}
+
+func TestUploadConcurrencyWithSession(t *testing.T) {
+	client, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	assert.Nil(t, err, "NewClient error: %v", err)
+	err = client.Connect(context.Background())
+	assert.Nil(t, err, "Connect error: %v", err)
+	defer func() {
+		_ = client.Disconnect(context.Background())
+	}()
+	sess, err := client.StartSession()
+	assert.Nil(t, err, "StartSession error: %v", err)
+	defer sess.EndSession(context.Background())
+
+	us := newUploadStream(&Upload{chunkSize: DefaultChunkSize, concurrency: 3}, nil, "filename", nil, nil)
+	assert.True(t, us.concurrent(context.Background()), "expected concurrent inserts without a session")
+	err = mongo.WithSession(context.Background(), sess, func(sc mongo.SessionContext) error {
+		assert.False(t, us.concurrent(sc), "expected serial inserts with a session")
+		return nil
+	})
+	assert.Nil(t, err, "WithSession error: %v", err)
+
+	us = newUploadStream(&Upload{chunkSize: DefaultChunkSize, concurrency: 1}, nil, "filename", nil, nil)
+	assert.False(t, us.concurrent(context.Background()), "expected serial inserts with a concurrency of 1")
+}
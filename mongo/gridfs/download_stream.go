@@ -8,12 +8,18 @@ package gridfs
 
 import (
 	"context"
+	"encoding/hex"
 	"errors"
+	"hash"
 	"io"
 	"math"
+	"sync"
 	"time"
 
+	"github.com/appveen/mongo-go-driver/bson"
 	"github.com/appveen/mongo-go-driver/mongo"
+	"github.com/appveen/mongo-go-driver/mongo/options"
+	"github.com/appveen/mongo-go-driver/x/bsonx"
 )
 
 // ErrWrongIndex is used when the chunk retrieved from the server does not have the expected index.
@@ -24,7 +30,15 @@ var ErrWrongSize = errors.New("chunk size does not match expected size")
 
 var errNoMoreChunks = errors.New("no more chunks remaining")
 
-// DownloadStream is a io.Reader that can be used to download a file from a GridFS bucket.
+var errInvalidWhence = errors.New("gridfs: invalid whence")
+
+var errNegativePosition = errors.New("gridfs: negative position")
+
+// chunkCacheSize is the number of chunks kept in memory by a download stream for ReadAt.
+const chunkCacheSize = 4
+
+// DownloadStream is a io.Reader that can be used to download a file from a GridFS bucket. It also implements
+// io.Seeker and io.ReaderAt. Both only download the chunks that contain the requested bytes.
 type DownloadStream struct {
 	numChunks     int32
 	chunkSize     int32
@@ -37,18 +51,57 @@ type DownloadStream struct {
 	expectedChunk int32 // index of next expected chunk
 	readDeadline  time.Time
 	fileLen       int64
+
+	chunksColl *mongo.Collection
+	fileID     interface{}
+	pos        int64 // offset of the next byte returned by Read
+	reposition bool  // the cursor must be re-opened at the chunk containing pos
+
+	hasher       hash.Hash // computes the digest of the contents if hash verification was requested
+	hashDigest   string    // the digest stored in the files collection document
+	hashedChunks int32     // number of chunks written to hash, in order
+
+	transformer options.ChunkTransformer // the transformer applied to the file's chunks when they were uploaded
+	chunkFileID []byte                   // the files_id passed to the transformer
+
+	cacheMu sync.Mutex
+	cache   []cachedChunk // chunks downloaded by ReadAt, most recently used last
+
+	prefetch    int                   // number of chunks fetched ahead of the chunk being read; 0 uses a cursor
+	pending     map[int32]*chunkFetch // chunks being fetched ahead, by index
+	nextFetch   int32                 // index of the next chunk to fetch ahead
+	fetchCtx    context.Context       // bounds the chunks fetched ahead, which outlive the read that started them
+	cancelFetch context.CancelFunc    // cancels fetchCtx when the stream is closed
+}
+
+type cachedChunk struct {
+	n    int32
+	data []byte
+}
+
+// chunkFetch is a chunk being fetched in the background by a prefetching download stream.
+type chunkFetch struct {
+	result chan fetchedChunk // buffered, so the fetch finishes even if the result is dropped after a seek
 }
 
-func newDownloadStream(cursor *mongo.Cursor, chunkSize int32, fileLen int64) *DownloadStream {
+type fetchedChunk struct {
+	data []byte
+	err  error
+}
+
+func newDownloadStream(chunksColl *mongo.Collection, fileID interface{}, chunkSize int32,
+	fileLen int64) *DownloadStream {
+
 	numChunks := int32(math.Ceil(float64(fileLen) / float64(chunkSize)))
 
 	return &DownloadStream{
-		numChunks: numChunks,
-		chunkSize: chunkSize,
-		cursor:    cursor,
-		buffer:    make([]byte, chunkSize),
-		done:      cursor == nil,
-		fileLen:   fileLen,
+		numChunks:  numChunks,
+		chunkSize:  chunkSize,
+		buffer:     make([]byte, chunkSize),
+		done:       fileLen == 0,
+		fileLen:    fileLen,
+		chunksColl: chunksColl,
+		fileID:     fileID,
 	}
 }
 
@@ -58,7 +111,27 @@ func (ds *DownloadStream) Close() error {
 		return ErrStreamClosed
 	}
 
+	ctx, cancel := deadlineContext(ds.readDeadline)
+	if cancel != nil {
+		defer cancel()
+	}
+
+	return ds.CloseContext(ctx)
+}
+
+// CloseContext closes this download stream and the cursor over the file's chunks. Killing the cursor is bound to ctx.
+func (ds *DownloadStream) CloseContext(ctx context.Context) error {
+	if ds.closed {
+		return ErrStreamClosed
+	}
+
 	ds.closed = true
+	if ds.cancelFetch != nil {
+		ds.cancelFetch()
+	}
+	if ds.cursor != nil {
+		return ds.cursor.Close(ctx)
+	}
 	return nil
 }
 
@@ -87,6 +160,20 @@ func (ds *DownloadStream) Read(p []byte) (int, error) {
 		defer cancel()
 	}
 
+	return ds.ReadContext(ctx, p)
+}
+
+// ReadContext reads the file from the server and writes it to a destination byte slice. Fetching chunks from the
+// server is bound to ctx.
+func (ds *DownloadStream) ReadContext(ctx context.Context, p []byte) (int, error) {
+	if ds.closed {
+		return 0, ErrStreamClosed
+	}
+
+	if ds.done {
+		return 0, io.EOF
+	}
+
 	bytesCopied := 0
 	var err error
 	for bytesCopied < len(p) {
@@ -109,6 +196,7 @@ func (ds *DownloadStream) Read(p []byte) (int, error) {
 
 		bytesCopied += copied
 		ds.bufferStart += copied
+		ds.pos += int64(copied)
 	}
 
 	return len(p), nil
@@ -129,78 +217,425 @@ func (ds *DownloadStream) Skip(skip int64) (int64, error) {
 		defer cancel()
 	}
 
-	var skipped int64
-	var err error
+	return ds.SkipContext(ctx, skip)
+}
 
-	for skipped < skip {
-		if ds.bufferStart == 0 {
-			err = ds.fillBuffer(ctx)
-			if err != nil {
-				if err == errNoMoreChunks {
-					return skipped, nil
-				}
+// SkipContext skips a given number of bytes in the file. The skipped chunks are not downloaded; the next read fetches
+// the chunks from the new position onwards.
+func (ds *DownloadStream) SkipContext(ctx context.Context, skip int64) (int64, error) {
+	if ds.closed {
+		return 0, ErrStreamClosed
+	}
+
+	if ds.done || skip <= 0 {
+		return 0, nil
+	}
+
+	if remaining := ds.fileLen - ds.pos; skip > remaining {
+		skip = remaining
+	}
+	if _, err := ds.Seek(skip, io.SeekCurrent); err != nil {
+		return 0, err
+	}
+	return skip, nil
+}
+
+// Seek sets the offset for the next Read to offset, interpreted according to whence, and returns the new offset. It
+// implements the io.Seeker interface. Seek does not contact the server; the next read fetches the chunk containing
+// the new offset. Seeking to an offset beyond the end of the file is allowed, and subsequent reads return io.EOF.
+func (ds *DownloadStream) Seek(offset int64, whence int) (int64, error) {
+	if ds.closed {
+		return 0, ErrStreamClosed
+	}
+
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = ds.pos + offset
+	case io.SeekEnd:
+		abs = ds.fileLen + offset
+	default:
+		return 0, errInvalidWhence
+	}
+	if abs < 0 {
+		return 0, errNegativePosition
+	}
+	if abs == ds.pos {
+		return abs, nil
+	}
+
+	ds.pos = abs
+	ds.done = abs >= ds.fileLen
+	if ds.bufferEnd > 0 {
+		// the buffer holds the chunk before the next expected one
+		bufferedChunkStart := int64(ds.expectedChunk-1) * int64(ds.chunkSize)
+		if abs >= bufferedChunkStart && abs < bufferedChunkStart+int64(ds.bufferEnd) {
+			ds.bufferStart = int(abs - bufferedChunkStart)
+			return abs, nil
+		}
+	}
+
+	ds.bufferStart, ds.bufferEnd = 0, 0
+	ds.reposition = true
+	return abs, nil
+}
+
+// ReadAt reads len(p) bytes of the file starting at offset off. It implements the io.ReaderAt interface and does not
+// change the offset used by Read and Seek.
+func (ds *DownloadStream) ReadAt(p []byte, off int64) (int, error) {
+	ctx, cancel := deadlineContext(ds.readDeadline)
+	if cancel != nil {
+		defer cancel()
+	}
+
+	return ds.ReadAtContext(ctx, p, off)
+}
+
+// ReadAtContext reads len(p) bytes of the file starting at offset off. Only the chunks that contain the requested
+// bytes and are not cached by the stream are fetched from the server, in a single query bound to ctx. If fewer than
+// len(p) bytes are read because the end of the file was reached, io.EOF is returned.
+func (ds *DownloadStream) ReadAtContext(ctx context.Context, p []byte, off int64) (int, error) {
+	if ds.closed {
+		return 0, ErrStreamClosed
+	}
+	if off < 0 {
+		return 0, errNegativePosition
+	}
+	if off >= ds.fileLen {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	end := off + int64(len(p))
+	if end > ds.fileLen {
+		end = ds.fileLen
+	}
+	first := int32(off / int64(ds.chunkSize))
+	last := int32((end - 1) / int64(ds.chunkSize))
+
+	chunks, err := ds.chunkRange(ctx, first, last)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	start := int(off - int64(first)*int64(ds.chunkSize))
+	for _, data := range chunks {
+		n += copy(p[n:], data[start:])
+		start = 0
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// chunkRange returns the data of the chunks with indexes from first to last inclusive, using cached chunks where
+// possible and fetching the rest from the server.
+func (ds *DownloadStream) chunkRange(ctx context.Context, first, last int32) ([][]byte, error) {
+	chunks := make([][]byte, last-first+1)
+	missingFirst, missingLast := int32(-1), int32(-1)
+
+	ds.cacheMu.Lock()
+	for n := first; n <= last; n++ {
+		if data := ds.cachedChunkLocked(n); data != nil {
+			chunks[n-first] = data
+			continue
+		}
+		if missingFirst == -1 {
+			missingFirst = n
+		}
+		missingLast = n
+	}
+	ds.cacheMu.Unlock()
 
-				return skipped, err
+	if missingFirst == -1 {
+		return chunks, nil
+	}
+
+	cursor, err := ds.findChunks(ctx, missingFirst, missingLast)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = cursor.Close(ctx)
+	}()
+
+	for n := missingFirst; n <= missingLast; n++ {
+		if !cursor.Next(ctx) {
+			if err = cursor.Err(); err != nil {
+				return nil, err
 			}
+			return nil, ErrWrongIndex
 		}
 
-		// try to skip whole chunk if possible
-		toSkip := 0
-		if skip-skipped < int64(len(ds.buffer)) {
-			// can skip whole chunk
-			toSkip = len(ds.buffer)
-		} else {
-			// can only skip part of buffer
-			toSkip = int(skip - skipped)
+		data, err := ds.chunkData(cursor.Current, n)
+		if err != nil {
+			return nil, err
 		}
+		cp := make([]byte, len(data))
+		copy(cp, data)
+		chunks[n-first] = cp
 
-		skipped += int64(toSkip)
-		ds.bufferStart = (ds.bufferStart + toSkip) % (int(ds.chunkSize))
+		ds.cacheMu.Lock()
+		ds.cacheChunkLocked(n, cp)
+		ds.cacheMu.Unlock()
 	}
 
-	return skip, nil
+	return chunks, nil
 }
 
-func (ds *DownloadStream) fillBuffer(ctx context.Context) error {
-	if !ds.cursor.Next(ctx) {
-		ds.done = true
-		return errNoMoreChunks
+func (ds *DownloadStream) cachedChunkLocked(n int32) []byte {
+	for i, c := range ds.cache {
+		if c.n == n {
+			// move to the most recently used position
+			copy(ds.cache[i:], ds.cache[i+1:])
+			ds.cache[len(ds.cache)-1] = c
+			return c.data
+		}
 	}
+	return nil
+}
+
+func (ds *DownloadStream) cacheChunkLocked(n int32, data []byte) {
+	if len(ds.cache) == chunkCacheSize {
+		ds.cache = append(ds.cache[:0], ds.cache[1:]...)
+	}
+	ds.cache = append(ds.cache, cachedChunk{n: n, data: data})
+}
 
-	chunkIndex, err := ds.cursor.Current.LookupErr("n")
+// findChunks returns a cursor over the file's chunks with indexes from first to last inclusive, sorted by index. If
+// last is negative, the cursor returns all chunks from first onwards.
+func (ds *DownloadStream) findChunks(ctx context.Context, first, last int32) (*mongo.Cursor, error) {
+	id, err := convertFileID(ds.fileID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if chunkIndex.Int32() != ds.expectedChunk {
-		return ErrWrongIndex
+	filter := bsonx.Doc{{"files_id", id}}
+	switch {
+	case last >= 0:
+		filter = append(filter, bsonx.Elem{"n", bsonx.Document(bsonx.Doc{
+			{"$gte", bsonx.Int32(first)},
+			{"$lte", bsonx.Int32(last)},
+		})})
+	case first > 0:
+		filter = append(filter, bsonx.Elem{"n", bsonx.Document(bsonx.Doc{{"$gte", bsonx.Int32(first)}})})
 	}
 
-	ds.expectedChunk++
-	data, err := ds.cursor.Current.LookupErr("data")
+	return ds.chunksColl.Find(ctx, filter,
+		options.Find().SetSort(bsonx.Doc{{"n", bsonx.Int32(1)}})) // sort by chunk index
+}
+
+// openCursor opens a cursor over the file's chunks starting at the chunk that contains the stream's offset.
+func (ds *DownloadStream) openCursor(ctx context.Context) error {
+	if ds.cursor != nil {
+		_ = ds.cursor.Close(ctx)
+		ds.cursor = nil
+	}
+
+	first := int32(ds.pos / int64(ds.chunkSize))
+	cursor, err := ds.findChunks(ctx, first, -1)
 	if err != nil {
 		return err
 	}
 
+	ds.cursor = cursor
+	ds.expectedChunk = first
+	ds.reposition = false
+	return nil
+}
+
+// chunkData validates the index of a chunk document, reverses the file's chunk transformer, if any, validates the size
+// of the result and returns it.
+func (ds *DownloadStream) chunkData(chunk bson.Raw, expected int32) ([]byte, error) {
+	chunkIndex, err := chunk.LookupErr("n")
+	if err != nil {
+		return nil, err
+	}
+
+	if chunkIndex.Int32() != expected {
+		return nil, ErrWrongIndex
+	}
+
+	data, err := chunk.LookupErr("data")
+	if err != nil {
+		return nil, err
+	}
+
 	_, dataBytes := data.Binary()
-	copied := copy(ds.buffer, dataBytes)
+	if ds.transformer != nil {
+		chunk := options.ChunkInfo{FileID: ds.chunkFileID, N: expected, ChunkSize: ds.chunkSize}
+		if dataBytes, err = ds.transformer.Reverse(chunk, dataBytes); err != nil {
+			return nil, &CorruptionError{FileID: ds.fileID, Chunk: expected, Err: err}
+		}
+	}
 
 	bytesLen := int32(len(dataBytes))
-	if ds.expectedChunk == ds.numChunks {
+	if expected == ds.numChunks-1 {
 		// final chunk can be fewer than ds.chunkSize bytes
-		bytesDownloaded := int64(ds.chunkSize) * (int64(ds.expectedChunk) - int64(1))
+		bytesDownloaded := int64(ds.chunkSize) * int64(expected)
 		bytesRemaining := ds.fileLen - int64(bytesDownloaded)
 
 		if int64(bytesLen) != bytesRemaining {
-			return ErrWrongSize
+			return nil, ErrWrongSize
 		}
 	} else if bytesLen != ds.chunkSize {
 		// all intermediate chunks must have size ds.chunkSize
-		return ErrWrongSize
+		return nil, ErrWrongSize
 	}
 
-	ds.bufferStart = 0
-	ds.bufferEnd = copied
+	return dataBytes, nil
+}
+
+// nextPrefetchedChunk returns the data of the chunk containing the stream's offset and starts fetching the following
+// ds.prefetch chunks concurrently. Each chunk is fetched by its own query, which is bound to the stream rather than to
+// ctx so it can be used by later reads. Only waiting for the chunk is bound to ctx.
+func (ds *DownloadStream) nextPrefetchedChunk(ctx context.Context) ([]byte, error) {
+	if ds.reposition {
+		ds.expectedChunk = int32(ds.pos / int64(ds.chunkSize))
+		ds.reposition = false
+	}
+	n := ds.expectedChunk
+	if n >= ds.numChunks {
+		return nil, errNoMoreChunks
+	}
+
+	if _, ok := ds.pending[n]; !ok {
+		// first read or seek outside of the prefetched chunks
+		ds.pending = make(map[int32]*chunkFetch, ds.prefetch+1)
+		ds.nextFetch = n
+	}
+	for idx := range ds.pending {
+		if idx < n {
+			delete(ds.pending, idx)
+		}
+	}
+	if ds.fetchCtx == nil {
+		ds.fetchCtx, ds.cancelFetch = context.WithCancel(context.Background())
+	}
+	for ; ds.nextFetch < ds.numChunks && ds.nextFetch <= n+int32(ds.prefetch); ds.nextFetch++ {
+		ds.pending[ds.nextFetch] = ds.startFetch(ds.fetchCtx, ds.nextFetch)
+	}
 
+	select {
+	case res := <-ds.pending[n].result:
+		delete(ds.pending, n)
+		return res.data, res.err
+	case <-ctx.Done():
+		// the fetch stays pending for the next read
+		return nil, ctx.Err()
+	}
+}
+
+func (ds *DownloadStream) startFetch(ctx context.Context, n int32) *chunkFetch {
+	fetch := &chunkFetch{result: make(chan fetchedChunk, 1)}
+	go func() {
+		fetch.result <- ds.fetchChunk(ctx, n)
+	}()
+	return fetch
+}
+
+// fetchChunk fetches and validates a single chunk. A missing chunk is reported as ErrWrongIndex, like a gap in the
+// chunks returned by a cursor.
+func (ds *DownloadStream) fetchChunk(ctx context.Context, n int32) fetchedChunk {
+	cursor, err := ds.findChunks(ctx, n, n)
+	if err != nil {
+		return fetchedChunk{err: err}
+	}
+	defer func() {
+		_ = cursor.Close(ctx)
+	}()
+
+	if !cursor.Next(ctx) {
+		if err = cursor.Err(); err != nil {
+			return fetchedChunk{err: err}
+		}
+		return fetchedChunk{err: ErrWrongIndex}
+	}
+
+	data, err := ds.chunkData(cursor.Current, n)
+	if err != nil {
+		return fetchedChunk{err: err}
+	}
+	if ds.transformer == nil {
+		// the data references the cursor's batch
+		data = append([]byte(nil), data...)
+	}
+	return fetchedChunk{data: data}
+}
+
+// nextCursorChunk returns the data of the next chunk returned by the stream's cursor, opening the cursor at the chunk
+// containing the stream's offset if necessary.
+func (ds *DownloadStream) nextCursorChunk(ctx context.Context) ([]byte, error) {
+	if ds.cursor == nil || ds.reposition {
+		if err := ds.openCursor(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if !ds.cursor.Next(ctx) {
+		if ds.hasher != nil {
+			if err := ds.cursor.Err(); err != nil {
+				ds.done = true
+				return nil, err
+			}
+		}
+		return nil, errNoMoreChunks
+	}
+
+	return ds.chunkData(ds.cursor.Current, ds.expectedChunk)
+}
+
+func (ds *DownloadStream) fillBuffer(ctx context.Context) error {
+	var dataBytes []byte
+	var err error
+	if ds.prefetch > 0 {
+		dataBytes, err = ds.nextPrefetchedChunk(ctx)
+	} else {
+		dataBytes, err = ds.nextCursorChunk(ctx)
+	}
+
+	missing := err == errNoMoreChunks || (ds.prefetch > 0 && err == ErrWrongIndex)
+	if missing && ds.hasher != nil && ds.hashedChunks == ds.expectedChunk && ds.expectedChunk < ds.numChunks {
+		ds.done = true
+		return &CorruptionError{FileID: ds.fileID, Chunk: ds.expectedChunk, Err: ErrMissingChunk}
+	}
+	if err == errNoMoreChunks {
+		ds.done = true
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if ds.hasher != nil && ds.hashedChunks == ds.expectedChunk {
+		_, _ = ds.hasher.Write(dataBytes)
+		ds.hashedChunks++
+		if ds.hashedChunks == ds.numChunks {
+			if err = ds.verifyHash(); err != nil {
+				return err
+			}
+		}
+	}
+
+	// the stream's offset is only inside the chunk if the cursor was re-opened after a seek
+	ds.bufferStart = int(ds.pos - int64(ds.expectedChunk)*int64(ds.chunkSize))
+	ds.bufferEnd = copy(ds.buffer, dataBytes)
+	ds.expectedChunk++
+
+	return nil
+}
+
+// verifyHash compares the digest of the hashed chunks with the digest stored in the files collection document.
+func (ds *DownloadStream) verifyHash() error {
+	if hex.EncodeToString(ds.hasher.Sum(nil)) != ds.hashDigest {
+		return &CorruptionError{FileID: ds.fileID, Chunk: -1, Err: ErrHashMismatch}
+	}
 	return nil
 }
@@ -0,0 +1,184 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package gridfs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/appveen/mongo-go-driver/bson"
+	"github.com/appveen/mongo-go-driver/bson/bsoncodec"
+	"github.com/appveen/mongo-go-driver/mongo"
+	"github.com/appveen/mongo-go-driver/mongo/options"
+	"github.com/appveen/mongo-go-driver/x/bsonx"
+)
+
+// ErrNoMetadata is used when the metadata of a file without metadata is decoded.
+var ErrNoMetadata = errors.New("file has no metadata")
+
+// File is a files collection document.
+type File struct {
+	ID         interface{} `bson:"_id"`
+	Length     int64       `bson:"length"`
+	ChunkSize  int32       `bson:"chunkSize"`
+	UploadDate time.Time   `bson:"uploadDate"`
+	Filename   string      `bson:"filename"`
+	Metadata   bson.Raw    `bson:"metadata,omitempty"`
+
+	registry *bsoncodec.Registry
+}
+
+// DecodeMetadata unmarshals the file's metadata into val using the registry of the bucket the file was found in, or
+// bson.DefaultRegistry if the file was not found through a bucket. It returns ErrNoMetadata if the file has no
+// metadata.
+func (f *File) DecodeMetadata(val interface{}) error {
+	if len(f.Metadata) == 0 {
+		return ErrNoMetadata
+	}
+
+	registry := f.registry
+	if registry == nil {
+		registry = bson.DefaultRegistry
+	}
+	return bson.UnmarshalWithRegistry(registry, f.Metadata, val)
+}
+
+// FileCursor iterates over the files found by Bucket.FindFiles.
+type FileCursor struct {
+	cursor   *mongo.Cursor
+	registry *bsoncodec.Registry
+	current  *File
+	err      error
+}
+
+// Next gets the next file. It returns true if there were no errors and the cursor contains another file.
+func (fc *FileCursor) Next(ctx context.Context) bool {
+	if fc.err != nil || !fc.cursor.Next(ctx) {
+		return false
+	}
+
+	file := &File{registry: fc.registry}
+	if fc.err = fc.cursor.Decode(file); fc.err != nil {
+		return false
+	}
+	fc.current = file
+	return true
+}
+
+// File returns the file the cursor is positioned at.
+func (fc *FileCursor) File() *File {
+	return fc.current
+}
+
+// All returns the remaining files and closes the cursor.
+func (fc *FileCursor) All(ctx context.Context) ([]*File, error) {
+	defer func() {
+		_ = fc.Close(ctx)
+	}()
+
+	var files []*File
+	for fc.Next(ctx) {
+		files = append(files, fc.current)
+	}
+	return files, fc.Err()
+}
+
+// Err returns the last error encountered by the cursor.
+func (fc *FileCursor) Err() error {
+	if fc.err != nil {
+		return fc.err
+	}
+	return fc.cursor.Err()
+}
+
+// Close closes the cursor.
+func (fc *FileCursor) Close(ctx context.Context) error {
+	return fc.cursor.Close(ctx)
+}
+
+// FindFiles returns the files whose files collection documents match the given filter. Resumable uploads that have not
+// been closed are not returned.
+func (b *Bucket) FindFiles(filter interface{}, opts ...*options.GridFSFindOptions) (*FileCursor, error) {
+	ctx, cancel := deadlineContext(b.readDeadline)
+	if cancel != nil {
+		defer cancel()
+	}
+
+	return b.FindFilesContext(ctx, filter, opts...)
+}
+
+// FindFilesContext returns the files whose files collection documents match the given filter. The query is bound to
+// ctx. Resumable uploads that have not been closed are not returned.
+func (b *Bucket) FindFilesContext(ctx context.Context, filter interface{},
+	opts ...*options.GridFSFindOptions) (*FileCursor, error) {
+
+	// resumable uploads in progress are not files yet
+	notInProgress := bsonx.Doc{{"inProgress", bsonx.Document(bsonx.Doc{{"$ne", bsonx.Boolean(true)}})}}
+	if filter == nil {
+		filter = notInProgress
+	} else {
+		filter = bson.D{{"$and", bson.A{filter, notInProgress}}}
+	}
+	cursor, err := b.FindContext(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileCursor{cursor: cursor, registry: b.registry}, nil
+}
+
+// UpdateMetadata replaces the metadata of the file with the given file ID, marshalled with the bucket's registry. If
+// metadata is nil, the file's metadata is removed.
+func (b *Bucket) UpdateMetadata(fileID interface{}, metadata interface{}) error {
+	ctx, cancel := deadlineContext(b.writeDeadline)
+	if cancel != nil {
+		defer cancel()
+	}
+
+	return b.UpdateMetadataContext(ctx, fileID, metadata)
+}
+
+// UpdateMetadataContext replaces the metadata of the file with the given file ID. The update is bound to ctx. See
+// UpdateMetadata for details.
+func (b *Bucket) UpdateMetadataContext(ctx context.Context, fileID interface{}, metadata interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	id, err := convertFileID(fileID)
+	if err != nil {
+		return err
+	}
+
+	update := bsonx.Doc{{"$unset", bsonx.Document(bsonx.Doc{{"metadata", bsonx.String("")}})}}
+	if metadata != nil {
+		doc, err := marshalMetadata(b.registry, metadata)
+		if err != nil {
+			return err
+		}
+		update = bsonx.Doc{{"$set", bsonx.Document(bsonx.Doc{{"metadata", bsonx.Document(doc)}})}}
+	}
+
+	res, err := b.filesColl.UpdateOne(ctx, bsonx.Doc{{"_id", id}}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrFileNotFound
+	}
+	return nil
+}
+
+// marshalMetadata converts metadata to a document for the files collection.
+func marshalMetadata(registry *bsoncodec.Registry, metadata interface{}) (bsonx.Doc, error) {
+	raw, err := bson.MarshalWithRegistry(registry, metadata)
+	if err != nil {
+		return nil, err
+	}
+	return bsonx.ReadDoc(raw)
+}
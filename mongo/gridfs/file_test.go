@@ -0,0 +1,37 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package gridfs
+
+import (
+	"testing"
+
+	"github.com/appveen/mongo-go-driver/bson"
+	"github.com/appveen/mongo-go-driver/internal/testutil/assert"
+)
+
+func TestFileDecodeMetadata(t *testing.T) {
+	type metadata struct {
+		Owner string `bson:"owner"`
+		Tags  []string
+	}
+
+	t.Run("decode", func(t *testing.T) {
+		expected := metadata{Owner: "alice", Tags: []string{"a", "b"}}
+		raw, err := bson.Marshal(expected)
+		assert.Nil(t, err, "Marshal error: %v", err)
+
+		var got metadata
+		err = (&File{Metadata: raw}).DecodeMetadata(&got)
+		assert.Nil(t, err, "DecodeMetadata error: %v", err)
+		assert.Equal(t, expected, got, "expected metadata %v, got %v", expected, got)
+	})
+	t.Run("no metadata", func(t *testing.T) {
+		var got metadata
+		err := (&File{}).DecodeMetadata(&got)
+		assert.Equal(t, ErrNoMetadata, err, "expected error %v, got %v", ErrNoMetadata, err)
+	})
+}
@@ -0,0 +1,369 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package gridfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/appveen/mongo-go-driver/bson"
+	"github.com/appveen/mongo-go-driver/mongo/options"
+	"github.com/appveen/mongo-go-driver/x/bsonx"
+)
+
+var errIsDirectory = errors.New("is a directory")
+
+var errNotDirectory = errors.New("not a directory")
+
+// FileSystem is a read-only http.FileSystem over the files of a bucket. Filenames are split at "/" separators into
+// virtual directories, so the file "images/logo.png" is served at "/images/logo.png" and listed in the directory
+// "/images". A directory exists as long as a file below it exists.
+//
+// Files are selected among the revisions of a filename according to the options.NameOptions passed to
+// NewFileSystem, and directory listings contain the same revisions. Resumable uploads in progress are not visible.
+type FileSystem struct {
+	bucket   *Bucket
+	revision int32
+	verify   bool
+}
+
+var _ http.FileSystem = (*FileSystem)(nil)
+
+// NewFileSystem returns a FileSystem over the given bucket. The revision of each filename that is served is selected
+// with options.NameOptions.SetRevision and defaults to the most recent one. Opening a file fails if it is not
+// available in the selected revision.
+func NewFileSystem(bucket *Bucket, opts ...*options.NameOptions) *FileSystem {
+	fs := &FileSystem{bucket: bucket, revision: -1}
+
+	nameOpts := options.MergeNameOptions(opts...)
+	if nameOpts.Revision != nil {
+		fs.revision = *nameOpts.Revision
+	}
+	fs.verify = nameOpts.VerifyHash != nil && *nameOpts.VerifyHash
+	return fs
+}
+
+// Open opens the file or virtual directory with the given name. It implements the http.FileSystem interface. If
+// neither exists, the error satisfies os.IsNotExist. The queries are bound to the bucket's read deadline.
+func (fs *FileSystem) Open(name string) (http.File, error) {
+	ctx, cancel := deadlineContext(fs.bucket.readDeadline)
+	if cancel != nil {
+		defer cancel()
+	}
+
+	return fs.OpenContext(ctx, name)
+}
+
+// OpenContext opens the file or virtual directory with the given name. The queries are bound to ctx. See Open for
+// details.
+func (fs *FileSystem) OpenContext(ctx context.Context, name string) (http.File, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	filename := cleanFilename(name)
+	if filename != "" {
+		ds, info, err := fs.bucket.openDownloadStreamByName(ctx, filename, fs.revision, fs.verify)
+		switch err {
+		case nil:
+			return &file{ds: ds, stat: newFileStat(info)}, nil
+		case ErrFileNotFound, ErrUploadInProgress:
+		default:
+			return nil, &os.PathError{Op: "open", Path: name, Err: err}
+		}
+
+		exists, err := fs.dirExists(ctx, filename)
+		if err != nil {
+			return nil, &os.PathError{Op: "open", Path: name, Err: err}
+		}
+		if !exists {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+	}
+
+	return &dir{fs: fs, filename: filename}, nil
+}
+
+// Stat returns the os.FileInfo of the file or virtual directory with the given name. The queries are bound to ctx.
+func (fs *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	f, err := fs.OpenContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	return f.Stat()
+}
+
+// ReadDir returns the entries of the virtual directory with the given name, sorted by name. The queries are bound to
+// ctx.
+func (fs *FileSystem) ReadDir(ctx context.Context, name string) ([]os.FileInfo, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	filename := cleanFilename(name)
+	if filename != "" {
+		exists, err := fs.dirExists(ctx, filename)
+		if err != nil {
+			return nil, &os.PathError{Op: "readdir", Path: name, Err: err}
+		}
+		if !exists {
+			return nil, &os.PathError{Op: "readdir", Path: name, Err: os.ErrNotExist}
+		}
+	}
+
+	return fs.list(ctx, filename)
+}
+
+// cleanFilename returns the filename for a slash-separated path, which is relative to the root of the bucket.
+func cleanFilename(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// prefixFilter returns a filter for the files below the virtual directory with the given filename.
+func prefixFilter(filename string) bsonx.Doc {
+	filter := bsonx.Doc{{"inProgress", bsonx.Document(bsonx.Doc{{"$ne", bsonx.Boolean(true)}})}}
+	if filename == "" {
+		return filter
+	}
+	return append(filter, bsonx.Elem{"filename", bsonx.Regex("^"+regexp.QuoteMeta(filename+"/"), "")})
+}
+
+func (fs *FileSystem) dirExists(ctx context.Context, filename string) (bool, error) {
+	cursor, err := fs.bucket.filesColl.Find(ctx, prefixFilter(filename),
+		options.Find().SetLimit(1).SetProjection(bsonx.Doc{{"_id", bsonx.Int32(1)}}))
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = cursor.Close(ctx)
+	}()
+
+	if cursor.Next(ctx) {
+		return true, nil
+	}
+	return false, cursor.Err()
+}
+
+// list returns the entries of the virtual directory with the given filename, sorted by name. Files below a
+// subdirectory are listed as the subdirectory, and each filename is listed with the revision selected by the file
+// system.
+func (fs *FileSystem) list(ctx context.Context, filename string) ([]os.FileInfo, error) {
+	prefix := ""
+	if filename != "" {
+		prefix = filename + "/"
+	}
+
+	// filenames sharing a prefix are adjacent, so the files of a subdirectory are listed one after another
+	findOpts := options.Find().
+		SetSort(bsonx.Doc{{"filename", bsonx.Int32(1)}, {"uploadDate", bsonx.Int32(1)}}).
+		SetProjection(bsonx.Doc{
+			{"filename", bsonx.Int32(1)},
+			{"length", bsonx.Int32(1)},
+			{"chunkSize", bsonx.Int32(1)},
+			{"uploadDate", bsonx.Int32(1)},
+			{"metadata", bsonx.Int32(1)},
+		})
+	cursor, err := fs.bucket.filesColl.Find(ctx, prefixFilter(filename), findOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = cursor.Close(ctx)
+	}()
+
+	var entries []os.FileInfo
+	var revisions []fileInfo // revisions of the current filename, oldest first
+	flush := func() {
+		if info, ok := selectRevision(revisions, fs.revision); ok {
+			entries = append(entries, newFileStat(info))
+		}
+		revisions = revisions[:0]
+	}
+	lastDir := ""
+	for cursor.Next(ctx) {
+		info, err := fs.bucket.parseFileInfo(cursor.Current)
+		if err != nil {
+			return nil, err
+		}
+		// the cursor's batch is reused
+		info.metadata = append(bson.Raw(nil), info.metadata...)
+
+		rest := strings.TrimPrefix(info.filename, prefix)
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			if subdir := rest[:i]; subdir != lastDir {
+				lastDir = subdir
+				entries = append(entries, dirStat{name: subdir})
+			}
+			continue
+		}
+
+		if len(revisions) > 0 && revisions[0].filename != info.filename {
+			flush()
+		}
+		revisions = append(revisions, info)
+	}
+	if err = cursor.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// selectRevision returns the revision of a filename selected like by OpenDownloadStreamByName.
+func selectRevision(revisions []fileInfo, revision int32) (fileInfo, bool) {
+	i := int(revision)
+	if i < 0 {
+		i += len(revisions)
+	}
+	if i < 0 || i >= len(revisions) {
+		return fileInfo{}, false
+	}
+	return revisions[i], true
+}
+
+// fileStat is the os.FileInfo of a file. Sys returns the file's metadata as a bson.Raw, or nil if it has none.
+type fileStat struct {
+	name       string
+	length     int64
+	uploadDate time.Time
+	metadata   bson.Raw
+}
+
+func newFileStat(info fileInfo) fileStat {
+	return fileStat{
+		name:       path.Base(info.filename),
+		length:     info.length,
+		uploadDate: info.uploadDate,
+		metadata:   info.metadata,
+	}
+}
+
+func (fs fileStat) Name() string       { return fs.name }
+func (fs fileStat) Size() int64        { return fs.length }
+func (fs fileStat) Mode() os.FileMode  { return 0444 }
+func (fs fileStat) ModTime() time.Time { return fs.uploadDate }
+func (fs fileStat) IsDir() bool        { return false }
+func (fs fileStat) Sys() interface{}   { return fs.metadata }
+
+// dirStat is the os.FileInfo of a virtual directory.
+type dirStat struct {
+	name string
+}
+
+func (ds dirStat) Name() string       { return ds.name }
+func (ds dirStat) Size() int64        { return 0 }
+func (ds dirStat) Mode() os.FileMode  { return os.ModeDir | 0555 }
+func (ds dirStat) ModTime() time.Time { return time.Time{} }
+func (ds dirStat) IsDir() bool        { return true }
+func (ds dirStat) Sys() interface{}   { return nil }
+
+// file is an http.File backed by a download stream.
+type file struct {
+	ds   *DownloadStream
+	stat fileStat
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	return f.ds.Read(p)
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	return f.ds.Seek(offset, whence)
+}
+
+func (f *file) Close() error {
+	return f.ds.Close()
+}
+
+func (f *file) Readdir(int) ([]os.FileInfo, error) {
+	return nil, &os.PathError{Op: "readdir", Path: f.stat.name, Err: errNotDirectory}
+}
+
+func (f *file) Stat() (os.FileInfo, error) {
+	return f.stat, nil
+}
+
+// dir is an http.File for a virtual directory. Its entries are listed by the first call to Readdir.
+type dir struct {
+	fs       *FileSystem
+	filename string
+	entries  []os.FileInfo
+	listed   bool
+	offset   int
+}
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &os.PathError{Op: "read", Path: "/" + d.filename, Err: errIsDirectory}
+}
+
+func (d *dir) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekStart {
+		d.offset = 0
+		return 0, nil
+	}
+	return 0, &os.PathError{Op: "seek", Path: "/" + d.filename, Err: errIsDirectory}
+}
+
+func (d *dir) Close() error {
+	return nil
+}
+
+// Readdir returns the next count entries of the directory, or all remaining entries if count is not positive. It
+// implements the http.File interface.
+func (d *dir) Readdir(count int) ([]os.FileInfo, error) {
+	if !d.listed {
+		ctx, cancel := deadlineContext(d.fs.bucket.readDeadline)
+		if cancel != nil {
+			defer cancel()
+		}
+
+		entries, err := d.fs.list(ctx, d.filename)
+		if err != nil {
+			return nil, &os.PathError{Op: "readdir", Path: "/" + d.filename, Err: err}
+		}
+		d.entries, d.listed = entries, true
+	}
+
+	remaining := d.entries[d.offset:]
+	if count <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(remaining) {
+		count = len(remaining)
+	}
+	d.offset += count
+	return remaining[:count], nil
+}
+
+func (d *dir) Stat() (os.FileInfo, error) {
+	name := path.Base("/" + d.filename)
+	return dirStat{name: name}, nil
+}
@@ -0,0 +1,49 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package gridfs
+
+import (
+	"testing"
+
+	"github.com/appveen/mongo-go-driver/internal/testutil/assert"
+)
+
+func TestFileSystemNames(t *testing.T) {
+	t.Run("clean filename", func(t *testing.T) {
+		testCases := map[string]string{
+			"/":                 "",
+			"":                  "",
+			"/images/logo.png":  "images/logo.png",
+			"images//logo.png":  "images/logo.png",
+			"/images/../a.txt":  "a.txt",
+			"/../../etc/passwd": "etc/passwd",
+		}
+		for name, expected := range testCases {
+			got := cleanFilename(name)
+			assert.Equal(t, expected, got, "expected filename %q for %q, got %q", expected, name, got)
+		}
+	})
+	t.Run("select revision", func(t *testing.T) {
+		revisions := []fileInfo{{filename: "v0"}, {filename: "v1"}, {filename: "v2"}}
+		testCases := []struct {
+			revision int32
+			expected string
+		}{
+			{0, "v0"},
+			{2, "v2"},
+			{-1, "v2"},
+			{-3, "v0"},
+			{3, ""},
+			{-4, ""},
+		}
+		for _, tc := range testCases {
+			info, ok := selectRevision(revisions, tc.revision)
+			assert.Equal(t, tc.expected != "", ok, "revision %d: expected found %v, got %v", tc.revision, tc.expected != "", ok)
+			assert.Equal(t, tc.expected, info.filename, "revision %d: expected %q, got %q", tc.revision, tc.expected, info.filename)
+		}
+	})
+}
@@ -8,14 +8,20 @@ package gridfs
 
 import (
 	"bytes"
+	"compress/gzip"
+	"io"
 	"math"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"runtime"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/appveen/mongo-go-driver/bson/primitive"
 	"github.com/stretchr/testify/require"
 	"github.com/appveen/mongo-go-driver/internal/testutil"
 	"github.com/appveen/mongo-go-driver/internal/testutil/helpers"
@@ -279,6 +285,505 @@ func TestGridFS(t *testing.T) {
 
 	})
 
+	t.Run("Context", func(t *testing.T) {
+		bucket, err := NewBucket(db)
+		testhelpers.RequireNil(t, err, "error creating bucket: %s", err)
+
+		opCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		err = bucket.DropContext(opCtx)
+		testhelpers.RequireNil(t, err, "DropContext error: %s", err)
+
+		p := []byte("context aware upload")
+		fileID, err := bucket.UploadFromStreamContext(opCtx, "filename", bytes.NewReader(p))
+		testhelpers.RequireNil(t, err, "UploadFromStreamContext error: %s", err)
+
+		w := bytes.NewBuffer(nil)
+		_, err = bucket.DownloadToStreamContext(opCtx, fileID, w)
+		testhelpers.RequireNil(t, err, "DownloadToStreamContext error: %s", err)
+		if !bytes.Equal(p, w.Bytes()) {
+			t.Errorf("Downloaded file did not match p.")
+		}
+
+		cancelled, cancelNow := context.WithCancel(ctx)
+		cancelNow()
+		_, err = bucket.DownloadToStreamContext(cancelled, fileID, bytes.NewBuffer(nil))
+		if err == nil {
+			t.Errorf("expected error downloading with a cancelled context, got nil")
+		}
+
+		err = bucket.RenameContext(opCtx, fileID, "renamed")
+		testhelpers.RequireNil(t, err, "RenameContext error: %s", err)
+		err = bucket.DeleteContext(opCtx, fileID)
+		testhelpers.RequireNil(t, err, "DeleteContext error: %s", err)
+		err = bucket.DeleteContext(opCtx, fileID)
+		if err != ErrFileNotFound {
+			t.Errorf("expected error %v, got %v", ErrFileNotFound, err)
+		}
+	})
+
+	t.Run("RandomAccess", func(t *testing.T) {
+		bucket, err := NewBucket(db, options.GridFSBucket().SetChunkSizeBytes(1024))
+		testhelpers.RequireNil(t, err, "error creating bucket: %s", err)
+
+		opCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		err = bucket.DropContext(opCtx)
+		testhelpers.RequireNil(t, err, "DropContext error: %s", err)
+
+		p := make([]byte, 10*1024+100)
+		for i := range p {
+			p[i] = byte(rand.Intn(100))
+		}
+		fileID, err := bucket.UploadFromStreamContext(opCtx, "filename", bytes.NewReader(p))
+		testhelpers.RequireNil(t, err, "UploadFromStreamContext error: %s", err)
+
+		ds, err := bucket.OpenDownloadStreamContext(opCtx, fileID)
+		testhelpers.RequireNil(t, err, "OpenDownloadStreamContext error: %s", err)
+		defer func() {
+			_ = ds.CloseContext(opCtx)
+		}()
+
+		seeks := []struct {
+			offset int64
+			whence int
+			pos    int64
+		}{
+			{3000, io.SeekStart, 3000},
+			{-500, io.SeekCurrent, 3100},
+			{-50, io.SeekEnd, int64(len(p)) - 50},
+			{10, io.SeekStart, 10},
+		}
+		for _, s := range seeks {
+			pos, err := ds.Seek(s.offset, s.whence)
+			testhelpers.RequireNil(t, err, "Seek error: %s", err)
+			if pos != s.pos {
+				t.Fatalf("expected position %d, got %d", s.pos, pos)
+			}
+
+			buf := make([]byte, 600)
+			n, err := io.ReadFull(ds, buf)
+			if err != nil && err != io.ErrUnexpectedEOF {
+				t.Fatalf("Read error: %v", err)
+			}
+			if !bytes.Equal(p[pos:pos+int64(n)], buf[:n]) {
+				t.Errorf("data read after seeking to %d did not match", pos)
+			}
+		}
+
+		buf := make([]byte, 2500)
+		n, err := ds.ReadAtContext(opCtx, buf, 1000)
+		testhelpers.RequireNil(t, err, "ReadAtContext error: %s", err)
+		if !bytes.Equal(p[1000:1000+n], buf) {
+			t.Errorf("data returned by ReadAt did not match")
+		}
+
+		n, err = ds.ReadAtContext(opCtx, buf, int64(len(p))-100)
+		if err != io.EOF || n != 100 {
+			t.Errorf("expected 100 bytes and io.EOF, got %d bytes and %v", n, err)
+		}
+		if !bytes.Equal(p[len(p)-100:], buf[:n]) {
+			t.Errorf("data returned by ReadAt at the end of the file did not match")
+		}
+	})
+
+	t.Run("Integrity", func(t *testing.T) {
+		bucket, err := NewBucket(db, options.GridFSBucket().SetChunkSizeBytes(1024))
+		testhelpers.RequireNil(t, err, "error creating bucket: %s", err)
+
+		opCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		err = bucket.DropContext(opCtx)
+		testhelpers.RequireNil(t, err, "DropContext error: %s", err)
+
+		p := bytes.Repeat([]byte("integrity"), 500)
+		fileID, err := bucket.UploadFromStreamContext(opCtx, "filename", bytes.NewReader(p),
+			options.GridFSUpload().SetHash(options.SHA256Hash()))
+		testhelpers.RequireNil(t, err, "UploadFromStreamContext error: %s", err)
+
+		err = bucket.VerifyContext(opCtx, fileID)
+		testhelpers.RequireNil(t, err, "VerifyContext error: %s", err)
+		w := bytes.NewBuffer(nil)
+		_, err = bucket.DownloadToStreamContext(opCtx, fileID, w, options.GridFSDownload().SetVerifyHash(true))
+		testhelpers.RequireNil(t, err, "DownloadToStreamContext error: %s", err)
+
+		// flip the first byte of the second chunk
+		data := bytes.Repeat([]byte("integrity"), 500)[1024:2048]
+		data[0]++
+		_, err = bucket.chunksColl.UpdateOne(opCtx,
+			bsonx.Doc{{"files_id", bsonx.ObjectID(fileID)}, {"n", bsonx.Int32(1)}},
+			bsonx.Doc{{"$set", bsonx.Document(bsonx.Doc{{"data", bsonx.Binary(0x00, data)}})}})
+		testhelpers.RequireNil(t, err, "UpdateOne error: %s", err)
+
+		_, err = bucket.DownloadToStreamContext(opCtx, fileID, bytes.NewBuffer(nil),
+			options.GridFSDownload().SetVerifyHash(true))
+		if ce, ok := err.(*CorruptionError); !ok || ce.Err != ErrHashMismatch {
+			t.Errorf("expected hash mismatch, got %v", err)
+		}
+		err = bucket.VerifyContext(opCtx, fileID)
+		if ce, ok := err.(*CorruptionError); !ok || ce.Err != ErrHashMismatch {
+			t.Errorf("expected hash mismatch, got %v", err)
+		}
+
+		_, err = bucket.chunksColl.DeleteOne(opCtx, bsonx.Doc{{"files_id", bsonx.ObjectID(fileID)}, {"n", bsonx.Int32(4)}})
+		testhelpers.RequireNil(t, err, "DeleteOne error: %s", err)
+		err = bucket.VerifyContext(opCtx, fileID)
+		if ce, ok := err.(*CorruptionError); !ok || ce.Err != ErrMissingChunk || ce.Chunk != 4 {
+			t.Errorf("expected chunk 4 to be missing, got %v", err)
+		}
+
+		noHashID, err := bucket.UploadFromStreamContext(opCtx, "nohash", bytes.NewReader(p))
+		testhelpers.RequireNil(t, err, "UploadFromStreamContext error: %s", err)
+		_, err = bucket.OpenDownloadStreamContext(opCtx, noHashID, options.GridFSDownload().SetVerifyHash(true))
+		if err != ErrNoHash {
+			t.Errorf("expected error %v, got %v", ErrNoHash, err)
+		}
+	})
+
+	t.Run("Transformer", func(t *testing.T) {
+		encrypt, err := NewAESGCMTransformer("aes-gcm:test", bytes.Repeat([]byte{1}, 32))
+		testhelpers.RequireNil(t, err, "NewAESGCMTransformer error: %s", err)
+		bucket, err := NewBucket(db, options.GridFSBucket().SetChunkSizeBytes(1024).SetTransformer(encrypt))
+		testhelpers.RequireNil(t, err, "error creating bucket: %s", err)
+
+		opCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		err = bucket.DropContext(opCtx)
+		testhelpers.RequireNil(t, err, "DropContext error: %s", err)
+
+		gz, err := GzipTransformer(gzip.DefaultCompression)
+		testhelpers.RequireNil(t, err, "GzipTransformer error: %s", err)
+		p := bytes.Repeat([]byte("log line\n"), 1000)
+		for _, opts := range []*options.UploadOptions{nil, options.GridFSUpload().SetTransformer(gz)} {
+			fileID, err := bucket.UploadFromStreamContext(opCtx, "filename", bytes.NewReader(p), opts)
+			testhelpers.RequireNil(t, err, "UploadFromStreamContext error: %s", err)
+
+			ds, err := bucket.OpenDownloadStreamContext(opCtx, fileID)
+			testhelpers.RequireNil(t, err, "OpenDownloadStreamContext error: %s", err)
+			_, err = ds.Seek(2000, io.SeekStart)
+			testhelpers.RequireNil(t, err, "Seek error: %s", err)
+			buf := make([]byte, 3000)
+			_, err = io.ReadFull(ds, buf)
+			testhelpers.RequireNil(t, err, "Read error: %s", err)
+			if !bytes.Equal(p[2000:5000], buf) {
+				t.Errorf("data read from transformed file did not match")
+			}
+			_ = ds.CloseContext(opCtx)
+
+			err = bucket.VerifyContext(opCtx, fileID)
+			testhelpers.RequireNil(t, err, "VerifyContext error: %s", err)
+		}
+	})
+
+	t.Run("Parallel", func(t *testing.T) {
+		bucket, err := NewBucket(db, options.GridFSBucket().SetUploadConcurrency(3).SetDownloadPrefetch(4))
+		testhelpers.RequireNil(t, err, "error creating bucket: %s", err)
+
+		opCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		err = bucket.DropContext(opCtx)
+		testhelpers.RequireNil(t, err, "DropContext error: %s", err)
+
+		// several upload batches, the last one partial
+		p := make([]byte, 3*UploadBufferSize+12345)
+		for i := range p {
+			p[i] = byte(i / 7)
+		}
+		fileID, err := bucket.UploadFromStreamContext(opCtx, "filename", bytes.NewReader(p),
+			options.GridFSUpload().SetHash(options.SHA256Hash()))
+		testhelpers.RequireNil(t, err, "UploadFromStreamContext error: %s", err)
+
+		err = bucket.VerifyContext(opCtx, fileID)
+		testhelpers.RequireNil(t, err, "VerifyContext error: %s", err)
+
+		ds, err := bucket.OpenDownloadStreamContext(opCtx, fileID, options.GridFSDownload().SetVerifyHash(true))
+		testhelpers.RequireNil(t, err, "OpenDownloadStreamContext error: %s", err)
+		w := bytes.NewBuffer(nil)
+		_, err = io.Copy(w, ds)
+		testhelpers.RequireNil(t, err, "Read error: %s", err)
+		if !bytes.Equal(p, w.Bytes()) {
+			t.Errorf("data downloaded with prefetching did not match")
+		}
+
+		off := int64(UploadBufferSize + 1000)
+		_, err = ds.Seek(off, io.SeekStart)
+		testhelpers.RequireNil(t, err, "Seek error: %s", err)
+		buf := make([]byte, 3*DefaultChunkSize)
+		_, err = io.ReadFull(ds, buf)
+		testhelpers.RequireNil(t, err, "Read error: %s", err)
+		if !bytes.Equal(p[off:off+int64(len(buf))], buf) {
+			t.Errorf("data read after seek did not match")
+		}
+		_ = ds.CloseContext(opCtx)
+	})
+
+	t.Run("ParallelSession", func(t *testing.T) {
+		bucket, err := NewBucket(db, options.GridFSBucket().SetUploadConcurrency(3))
+		testhelpers.RequireNil(t, err, "error creating bucket: %s", err)
+
+		opCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		err = bucket.DropContext(opCtx)
+		testhelpers.RequireNil(t, err, "DropContext error: %s", err)
+
+		p := bytes.Repeat([]byte("session"), UploadBufferSize/2)
+		upload := func(sc mongo.SessionContext) (interface{}, error) {
+			return bucket.UploadFromStreamContext(sc, "filename", bytes.NewReader(p))
+		}
+		check := func(fileID interface{}) {
+			w := bytes.NewBuffer(nil)
+			_, err := bucket.DownloadToStreamContext(opCtx, fileID, w)
+			testhelpers.RequireNil(t, err, "DownloadToStreamContext error: %s", err)
+			if !bytes.Equal(p, w.Bytes()) {
+				t.Errorf("data uploaded with a session did not match")
+			}
+		}
+
+		sess, err := client.StartSession()
+		testhelpers.RequireNil(t, err, "StartSession error: %s", err)
+		defer sess.EndSession(ctx)
+
+		var fileID interface{}
+		err = mongo.WithSession(opCtx, sess, func(sc mongo.SessionContext) error {
+			fileID, err = upload(sc)
+			return err
+		})
+		testhelpers.RequireNil(t, err, "WithSession error: %s", err)
+		check(fileID)
+
+		if os.Getenv("TOPOLOGY") != "replica_set" {
+			t.Skip("transactions require a replica set")
+		}
+		fileID, err = sess.WithTransaction(opCtx, upload)
+		testhelpers.RequireNil(t, err, "WithTransaction error: %s", err)
+		check(fileID)
+	})
+
+	t.Run("Resumable", func(t *testing.T) {
+		bucket, err := NewBucket(db, options.GridFSBucket().SetChunkSizeBytes(1024))
+		testhelpers.RequireNil(t, err, "error creating bucket: %s", err)
+
+		opCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		err = bucket.DropContext(opCtx)
+		testhelpers.RequireNil(t, err, "DropContext error: %s", err)
+
+		p := bytes.Repeat([]byte("resumable"), 1000)
+		us, err := bucket.OpenUploadStreamContext(opCtx, "filename",
+			options.GridFSUpload().SetResumable(true).SetHash(options.SHA256Hash()))
+		testhelpers.RequireNil(t, err, "OpenUploadStreamContext error: %s", err)
+		_, err = us.WriteContext(opCtx, p[:5000])
+		testhelpers.RequireNil(t, err, "WriteContext error: %s", err)
+		// the stream is abandoned without being closed
+
+		_, err = bucket.OpenDownloadStreamContext(opCtx, us.FileID)
+		if err != ErrUploadInProgress {
+			t.Errorf("expected error %v, got %v", ErrUploadInProgress, err)
+		}
+		_, err = bucket.OpenDownloadStreamByNameContext(opCtx, "filename")
+		if err != ErrFileNotFound {
+			t.Errorf("expected error %v, got %v", ErrFileNotFound, err)
+		}
+
+		resumed, err := bucket.ResumeUploadStreamContext(opCtx, us.FileID)
+		testhelpers.RequireNil(t, err, "ResumeUploadStreamContext error: %s", err)
+		if resumed.Offset() != 4096 {
+			t.Fatalf("expected offset 4096, got %d", resumed.Offset())
+		}
+		_, err = resumed.WriteContext(opCtx, p[resumed.Offset():])
+		testhelpers.RequireNil(t, err, "WriteContext error: %s", err)
+		err = resumed.CloseContext(opCtx)
+		testhelpers.RequireNil(t, err, "CloseContext error: %s", err)
+
+		w := bytes.NewBuffer(nil)
+		_, err = bucket.DownloadToStreamContext(opCtx, us.FileID, w, options.GridFSDownload().SetVerifyHash(true))
+		testhelpers.RequireNil(t, err, "DownloadToStreamContext error: %s", err)
+		if !bytes.Equal(p, w.Bytes()) {
+			t.Errorf("data of resumed upload did not match")
+		}
+
+		_, err = bucket.ResumeUploadStreamContext(opCtx, us.FileID)
+		if err != ErrUploadNotResumable {
+			t.Errorf("expected error %v, got %v", ErrUploadNotResumable, err)
+		}
+	})
+
+	t.Run("Vacuum", func(t *testing.T) {
+		bucket, err := NewBucket(db, options.GridFSBucket().SetChunkSizeBytes(1024))
+		testhelpers.RequireNil(t, err, "error creating bucket: %s", err)
+
+		opCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		err = bucket.DropContext(opCtx)
+		testhelpers.RequireNil(t, err, "DropContext error: %s", err)
+
+		p := bytes.Repeat([]byte("vacuum"), 500)
+		var revisions []primitive.ObjectID
+		for i := 0; i < 3; i++ {
+			fileID, err := bucket.UploadFromStreamContext(opCtx, "revised", bytes.NewReader(p))
+			testhelpers.RequireNil(t, err, "UploadFromStreamContext error: %s", err)
+			revisions = append(revisions, fileID)
+			time.Sleep(5 * time.Millisecond) // distinct upload dates
+		}
+		incompleteID, err := bucket.UploadFromStreamContext(opCtx, "incomplete", bytes.NewReader(p))
+		testhelpers.RequireNil(t, err, "UploadFromStreamContext error: %s", err)
+		_, err = bucket.chunksColl.DeleteOne(opCtx,
+			bsonx.Doc{{"files_id", bsonx.ObjectID(incompleteID)}, {"n", bsonx.Int32(1)}})
+		testhelpers.RequireNil(t, err, "DeleteOne error: %s", err)
+
+		// chunks of a crashed upload, and of one that may still be running
+		orphanID, recentID := primitive.NewObjectID(), primitive.NewObjectID()
+		for i, chunkID := range []primitive.ObjectID{
+			primitive.NewObjectIDFromTimestamp(time.Now().Add(-2 * time.Hour)),
+			primitive.NewObjectIDFromTimestamp(time.Now().Add(-3 * time.Hour)),
+		} {
+			_, err = bucket.chunksColl.InsertOne(opCtx, bsonx.Doc{
+				{"_id", bsonx.ObjectID(chunkID)},
+				{"files_id", bsonx.ObjectID(orphanID)},
+				{"n", bsonx.Int32(int32(i))},
+				{"data", bsonx.Binary(0x00, []byte("orphan"))},
+			})
+			testhelpers.RequireNil(t, err, "InsertOne error: %s", err)
+		}
+		_, err = bucket.chunksColl.InsertOne(opCtx, bsonx.Doc{
+			{"files_id", bsonx.ObjectID(recentID)},
+			{"n", bsonx.Int32(0)},
+			{"data", bsonx.Binary(0x00, []byte("recent"))},
+		})
+		testhelpers.RequireNil(t, err, "InsertOne error: %s", err)
+
+		countChunks := func() int64 {
+			count, err := bucket.chunksColl.CountDocuments(opCtx, bsonx.Doc{})
+			testhelpers.RequireNil(t, err, "CountDocuments error: %s", err)
+			return count
+		}
+		before := countChunks()
+
+		vacuumOpts := options.GridFSVacuum().SetKeepRevisions(2)
+		report, err := bucket.VacuumContext(opCtx, vacuumOpts, options.GridFSVacuum().SetDryRun(true))
+		testhelpers.RequireNil(t, err, "VacuumContext error: %s", err)
+		if len(report.Orphans) != 1 || report.Orphans[0].FileID != orphanID || report.Orphans[0].Chunks != 2 {
+			t.Errorf("expected orphaned chunks of %v, got %v", orphanID, report.Orphans)
+		}
+		if len(report.IncompleteFiles) != 1 || report.IncompleteFiles[0] != incompleteID {
+			t.Errorf("expected incomplete file %v, got %v", incompleteID, report.IncompleteFiles)
+		}
+		if len(report.PrunedRevisions) != 1 || report.PrunedRevisions[0] != revisions[0] {
+			t.Errorf("expected pruned revision %v, got %v", revisions[0], report.PrunedRevisions)
+		}
+		if after := countChunks(); after != before {
+			t.Errorf("dry run deleted %d chunks", before-after)
+		}
+
+		_, err = bucket.VacuumContext(opCtx, vacuumOpts)
+		testhelpers.RequireNil(t, err, "VacuumContext error: %s", err)
+		// 3 chunks of the pruned revision and 2 orphaned chunks
+		if after := countChunks(); after != before-5 {
+			t.Errorf("expected %d chunks after vacuum, got %d", before-5, after)
+		}
+		_, err = bucket.OpenDownloadStreamContext(opCtx, revisions[0])
+		if err != ErrFileNotFound {
+			t.Errorf("expected error %v, got %v", ErrFileNotFound, err)
+		}
+	})
+
+	t.Run("FileSystem", func(t *testing.T) {
+		bucket, err := NewBucket(db, options.GridFSBucket().SetChunkSizeBytes(1024))
+		testhelpers.RequireNil(t, err, "error creating bucket: %s", err)
+
+		opCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		err = bucket.DropContext(opCtx)
+		testhelpers.RequireNil(t, err, "DropContext error: %s", err)
+
+		files := []struct {
+			filename string
+			data     string
+		}{
+			{"docs/a.txt", "first revision"},
+			{"docs/a.txt", strings.Repeat("latest revision\n", 200)},
+			{"docs/sub/b.txt", "b"},
+			{"root.txt", "root"},
+		}
+		for _, f := range files {
+			_, err = bucket.UploadFromStreamContext(opCtx, f.filename, strings.NewReader(f.data))
+			testhelpers.RequireNil(t, err, "UploadFromStreamContext error: %s", err)
+			time.Sleep(5 * time.Millisecond) // distinct upload dates
+		}
+
+		fs := NewFileSystem(bucket)
+		server := http.FileServer(fs)
+		req := httptest.NewRequest("GET", "/docs/a.txt", nil)
+		req.Header.Set("Range", "bytes=16-31")
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		if rec.Code != http.StatusPartialContent || rec.Body.String() != "latest revision\n" {
+			t.Errorf("expected partial content of latest revision, got %d %q", rec.Code, rec.Body.String())
+		}
+
+		entries, err := fs.ReadDir(opCtx, "/docs")
+		testhelpers.RequireNil(t, err, "ReadDir error: %s", err)
+		if len(entries) != 2 || entries[0].Name() != "a.txt" || entries[0].Size() != int64(len(files[1].data)) ||
+			entries[1].Name() != "sub" || !entries[1].IsDir() {
+			t.Errorf("unexpected entries of /docs: %v", entries)
+		}
+
+		original := NewFileSystem(bucket, options.GridFSName().SetRevision(0))
+		fi, err := original.Stat(opCtx, "/docs/a.txt")
+		testhelpers.RequireNil(t, err, "Stat error: %s", err)
+		if fi.Size() != int64(len(files[0].data)) {
+			t.Errorf("expected size of first revision %d, got %d", len(files[0].data), fi.Size())
+		}
+
+		_, err = fs.Open("/docs/missing.txt")
+		if !os.IsNotExist(err) {
+			t.Errorf("expected not exist error, got %v", err)
+		}
+	})
+
+	t.Run("FindFiles", func(t *testing.T) {
+		bucket, err := NewBucket(db)
+		testhelpers.RequireNil(t, err, "error creating bucket: %s", err)
+
+		opCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		err = bucket.DropContext(opCtx)
+		testhelpers.RequireNil(t, err, "DropContext error: %s", err)
+
+		type owner struct {
+			Owner string `bson:"owner"`
+		}
+		fileID, err := bucket.UploadFromStreamContext(opCtx, "typed", strings.NewReader("typed file"),
+			options.GridFSUpload().SetMetadata(owner{Owner: "alice"}))
+		testhelpers.RequireNil(t, err, "UploadFromStreamContext error: %s", err)
+
+		err = bucket.UpdateMetadataContext(opCtx, fileID, owner{Owner: "bob"})
+		testhelpers.RequireNil(t, err, "UpdateMetadataContext error: %s", err)
+		err = bucket.UpdateMetadataContext(opCtx, primitive.NewObjectID(), owner{})
+		if err != ErrFileNotFound {
+			t.Errorf("expected error %v, got %v", ErrFileNotFound, err)
+		}
+
+		cursor, err := bucket.FindFilesContext(opCtx, bsonx.Doc{{"filename", bsonx.String("typed")}})
+		testhelpers.RequireNil(t, err, "FindFilesContext error: %s", err)
+		files, err := cursor.All(opCtx)
+		testhelpers.RequireNil(t, err, "All error: %s", err)
+		if len(files) != 1 {
+			t.Fatalf("expected 1 file, got %d", len(files))
+		}
+		f := files[0]
+		if f.ID != fileID || f.Length != int64(len("typed file")) || f.ChunkSize != DefaultChunkSize ||
+			f.Filename != "typed" || f.UploadDate.IsZero() {
+			t.Errorf("unexpected file %+v", f)
+		}
+		var got owner
+		err = f.DecodeMetadata(&got)
+		testhelpers.RequireNil(t, err, "DecodeMetadata error: %s", err)
+		if got.Owner != "bob" {
+			t.Errorf("expected updated owner bob, got %q", got.Owner)
+		}
+	})
+
 	err = client.Disconnect(ctx)
 	if err != nil {
 		t.Fatalf("Problem disconnecting from client: %v", err)
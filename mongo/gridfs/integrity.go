@@ -0,0 +1,237 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package gridfs
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"time"
+
+	"github.com/appveen/mongo-go-driver/bson"
+	"github.com/appveen/mongo-go-driver/bson/bsontype"
+	"github.com/appveen/mongo-go-driver/x/bsonx"
+)
+
+// ErrHashMismatch is used when the digest of a file's contents does not match the digest stored in its files
+// collection document.
+var ErrHashMismatch = errors.New("file digest does not match stored digest")
+
+// ErrMissingChunk is used when a file has fewer chunks than its length requires.
+var ErrMissingChunk = errors.New("chunk is missing")
+
+// ErrNoHash is used when a download requests hash verification for a file that was uploaded without a digest.
+var ErrNoHash = errors.New("file has no stored digest")
+
+// CorruptionError is returned when the chunks of a file do not match its files collection document. Err is one of
+// ErrWrongIndex, ErrWrongSize, ErrMissingChunk or ErrHashMismatch, or the error returned by the file's chunk
+// transformer if a chunk could not be reversed.
+type CorruptionError struct {
+	FileID interface{}
+	Chunk  int32 // The index of the offending chunk, or -1 if the error concerns the whole file.
+	Err    error
+}
+
+// Error implements the error interface.
+func (e *CorruptionError) Error() string {
+	if e.Chunk < 0 {
+		return fmt.Sprintf("gridfs: file %v is corrupt: %v", e.FileID, e.Err)
+	}
+	return fmt.Sprintf("gridfs: file %v is corrupt: chunk %d: %v", e.FileID, e.Chunk, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *CorruptionError) Unwrap() error {
+	return e.Err
+}
+
+// fileInfo holds the fields of a files collection document needed to download or verify a file.
+type fileInfo struct {
+	id            bson.RawValue
+	length        int64
+	chunkSize     int32
+	hashAlgorithm string
+	hashDigest    string
+	transformer   string
+	inProgress    bool // the file is a resumable upload that has not been closed
+
+	filename   string
+	uploadDate time.Time
+	metadata   bson.Raw
+}
+
+// parseFileInfo reads a files collection document. Files may have been uploaded with a chunk size other than the
+// bucket's, so the bucket's chunk size is only used if the document has none.
+func (b *Bucket) parseFileInfo(doc bson.Raw) (fileInfo, error) {
+	info := fileInfo{chunkSize: b.chunkSize}
+
+	fileLenElem, err := doc.LookupErr("length")
+	if err != nil {
+		return info, err
+	}
+	info.id, err = doc.LookupErr("_id")
+	if err != nil {
+		return info, err
+	}
+
+	switch fileLenElem.Type {
+	case bsontype.Int32:
+		info.length = int64(fileLenElem.Int32())
+	default:
+		info.length = fileLenElem.Int64()
+	}
+
+	if chunkSizeElem, err := doc.LookupErr("chunkSize"); err == nil {
+		switch chunkSizeElem.Type {
+		case bsontype.Int32:
+			info.chunkSize = chunkSizeElem.Int32()
+		case bsontype.Int64:
+			info.chunkSize = int32(chunkSizeElem.Int64())
+		}
+	}
+
+	if hashDoc, ok := doc.Lookup("hash").DocumentOK(); ok {
+		info.hashAlgorithm, _ = hashDoc.Lookup("algorithm").StringValueOK()
+		info.hashDigest, _ = hashDoc.Lookup("digest").StringValueOK()
+	}
+
+	info.transformer, _ = doc.Lookup("transformer").StringValueOK()
+	info.inProgress, _ = doc.Lookup("inProgress").BooleanOK()
+	info.filename, _ = doc.Lookup("filename").StringValueOK()
+	info.uploadDate, _ = doc.Lookup("uploadDate").TimeOK()
+	info.metadata, _ = doc.Lookup("metadata").DocumentOK()
+
+	return info, nil
+}
+
+// newDownloadStream returns a download stream for the described file. It fails if the file's chunks were transformed
+// by a transformer the bucket does not know.
+func (b *Bucket) newDownloadStream(info fileInfo) (*DownloadStream, error) {
+	ds := newDownloadStream(b.chunksColl, info.id, info.chunkSize, info.length)
+	ds.prefetch = b.downloadPrefetch
+	if info.transformer != "" {
+		t, err := b.chunkTransformer(info.transformer)
+		if err != nil {
+			return nil, err
+		}
+		ds.transformer = t
+		ds.chunkFileID = append([]byte{byte(info.id.Type)}, info.id.Value...)
+	}
+	return ds, nil
+}
+
+// newHash returns a new hash.Hash for the algorithm that computed the file's digest.
+func (b *Bucket) newHash(info fileInfo) (hash.Hash, error) {
+	if info.hashAlgorithm == "" || info.hashDigest == "" {
+		return nil, ErrNoHash
+	}
+
+	newHash, ok := b.hashes[info.hashAlgorithm]
+	if !ok {
+		return nil, fmt.Errorf("gridfs: unknown hash algorithm %q", info.hashAlgorithm)
+	}
+	return newHash(), nil
+}
+
+// hashDoc returns the files collection document field that stores a digest.
+func hashDoc(algorithm string, h hash.Hash) bsonx.Doc {
+	return bsonx.Doc{
+		{"algorithm", bsonx.String(algorithm)},
+		{"digest", bsonx.String(hex.EncodeToString(h.Sum(nil)))},
+	}
+}
+
+// Verify checks that the file with the given file ID is intact. It downloads every chunk and checks the chunks'
+// ordering and lengths against the files collection document. If the file was uploaded with a digest, the digest is
+// verified as well. A *CorruptionError is returned if the file is damaged.
+func (b *Bucket) Verify(fileID interface{}) error {
+	ctx, cancel := deadlineContext(b.readDeadline)
+	if cancel != nil {
+		defer cancel()
+	}
+
+	return b.VerifyContext(ctx, fileID)
+}
+
+// VerifyContext checks that the file with the given file ID is intact. The queries are bound to ctx. See Verify for
+// details.
+func (b *Bucket) VerifyContext(ctx context.Context, fileID interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	id, err := convertFileID(fileID)
+	if err != nil {
+		return err
+	}
+	cursor, err := b.findFile(ctx, bsonx.Doc{{"_id", id}})
+	if err != nil {
+		return err
+	}
+	info, err := b.parseFileInfo(cursor.Current)
+	_ = cursor.Close(ctx)
+	if err != nil {
+		return err
+	}
+	if info.inProgress {
+		return ErrUploadInProgress
+	}
+
+	var h hash.Hash
+	if info.hashAlgorithm != "" {
+		if h, err = b.newHash(info); err != nil {
+			return err
+		}
+	}
+
+	ds, err := b.newDownloadStream(info)
+	if err != nil {
+		return err
+	}
+	chunks, err := ds.findChunks(ctx, 0, -1)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = chunks.Close(ctx)
+	}()
+
+	var n int32
+	for ; chunks.Next(ctx); n++ {
+		if n >= ds.numChunks {
+			return &CorruptionError{FileID: fileID, Chunk: n, Err: ErrWrongIndex}
+		}
+
+		data, err := ds.chunkData(chunks.Current, n)
+		switch err {
+		case nil:
+		case ErrWrongIndex, ErrWrongSize:
+			return &CorruptionError{FileID: fileID, Chunk: n, Err: err}
+		default:
+			if ce, ok := err.(*CorruptionError); ok {
+				ce.FileID = fileID
+			}
+			return err
+		}
+		if h != nil {
+			_, _ = h.Write(data)
+		}
+	}
+	if err = chunks.Err(); err != nil {
+		return err
+	}
+	if n < ds.numChunks {
+		return &CorruptionError{FileID: fileID, Chunk: n, Err: ErrMissingChunk}
+	}
+
+	if h != nil && hex.EncodeToString(h.Sum(nil)) != info.hashDigest {
+		return &CorruptionError{FileID: fileID, Chunk: -1, Err: ErrHashMismatch}
+	}
+	return nil
+}
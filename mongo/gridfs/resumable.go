@@ -0,0 +1,180 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package gridfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/appveen/mongo-go-driver/mongo/options"
+	"github.com/appveen/mongo-go-driver/x/bsonx"
+)
+
+// ErrUploadInProgress is used when a file is downloaded or verified before its resumable upload was closed.
+var ErrUploadInProgress = errors.New("file upload is in progress")
+
+// ErrUploadNotResumable is used when an upload is resumed or closed but the file is not a resumable upload in
+// progress, e.g. because it has already been closed or was deleted.
+var ErrUploadNotResumable = errors.New("file is not a resumable upload in progress")
+
+// insertMarker inserts the files collection document of a resumable upload, marked as in progress.
+func (us *UploadStream) insertMarker(ctx context.Context) error {
+	id, err := convertFileID(us.FileID)
+	if err != nil {
+		return err
+	}
+
+	_, err = us.filesColl.InsertOne(ctx, us.filesCollDoc(id, true))
+	return err
+}
+
+// Offset returns the number of bytes of the file written to this upload stream, including the bytes written before
+// the upload was resumed. After ResumeUploadStream, it is the position in the file from which to continue writing.
+func (us *UploadStream) Offset() int64 {
+	return us.fileLen + int64(us.bufferIndex)
+}
+
+// ResumeUploadStream reopens the resumable upload of the file with the given file ID. The chunks written before the
+// upload failed are kept up to the last complete chunk in sequence; any later chunks are deleted. The returned stream
+// continues at Offset, using the chunk size, metadata, transformer and hash algorithm of the original upload, and
+// completes the files collection document when it is closed.
+func (b *Bucket) ResumeUploadStream(fileID interface{}) (*UploadStream, error) {
+	ctx, cancel := deadlineContext(b.writeDeadline)
+	if cancel != nil {
+		defer cancel()
+	}
+
+	return b.ResumeUploadStreamContext(ctx, fileID)
+}
+
+// ResumeUploadStreamContext reopens the resumable upload of the file with the given file ID. The queries are bound to
+// ctx. See ResumeUploadStream for details.
+func (b *Bucket) ResumeUploadStreamContext(ctx context.Context, fileID interface{}) (*UploadStream, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if err := b.checkFirstWrite(ctx); err != nil {
+		return nil, err
+	}
+
+	id, err := convertFileID(fileID)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := b.findFile(ctx, bsonx.Doc{{"_id", id}})
+	if err == ErrFileNotFound {
+		return nil, ErrUploadNotResumable
+	}
+	if err != nil {
+		return nil, err
+	}
+	doc := cursor.Current
+	_ = cursor.Close(ctx)
+
+	info, err := b.parseFileInfo(doc)
+	if err != nil {
+		return nil, err
+	}
+	if !info.inProgress {
+		return nil, ErrUploadNotResumable
+	}
+
+	upload := &Upload{
+		chunkSize:   info.chunkSize,
+		concurrency: b.uploadConcurrency,
+		resumable:   true,
+	}
+	if info.transformer != "" {
+		t, err := b.chunkTransformer(info.transformer)
+		if err != nil {
+			return nil, err
+		}
+		upload.transformer = t
+	}
+	if info.hashAlgorithm != "" {
+		newHash, ok := b.hashes[info.hashAlgorithm]
+		if !ok {
+			return nil, fmt.Errorf("gridfs: unknown hash algorithm %q", info.hashAlgorithm)
+		}
+		upload.hash = &options.GridFSHash{Name: info.hashAlgorithm, New: newHash}
+	}
+	if metadata, ok := doc.Lookup("metadata").DocumentOK(); ok {
+		if upload.metadata, err = bsonx.ReadDoc(metadata); err != nil {
+			return nil, err
+		}
+	}
+	filename, _ := doc.Lookup("filename").StringValueOK()
+
+	us := newUploadStream(upload, fileID, filename, b.chunksColl, b.filesColl)
+	if err = us.restoreChunks(ctx, id); err != nil {
+		return nil, err
+	}
+	return us, nil
+}
+
+// restoreChunks positions the stream after the last complete chunk of an earlier upload that is preceded by all other
+// chunks, feeding the kept chunks to the stream's hash. The remaining chunks are deleted.
+func (us *UploadStream) restoreChunks(ctx context.Context, id bsonx.Val) error {
+	cursor, err := us.chunksColl.Find(ctx, bsonx.Doc{{"files_id", id}},
+		options.Find().SetSort(bsonx.Doc{{"n", bsonx.Int32(1)}}))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = cursor.Close(ctx)
+	}()
+
+	var chunkFileID []byte
+	if us.transformer != nil {
+		if chunkFileID, err = transformerFileID(id); err != nil {
+			return err
+		}
+	}
+
+	var kept int32
+	for cursor.Next(ctx) {
+		if n, ok := cursor.Current.Lookup("n").Int32OK(); !ok || n != kept {
+			break
+		}
+		_, data, ok := cursor.Current.Lookup("data").BinaryOK()
+		if !ok {
+			break
+		}
+		if us.transformer != nil {
+			chunk := options.ChunkInfo{FileID: chunkFileID, N: kept, ChunkSize: us.chunkSize}
+			if data, err = us.transformer.Reverse(chunk, data); err != nil {
+				break
+			}
+		}
+		if int32(len(data)) != us.chunkSize {
+			// the final chunk written by a failed Close
+			break
+		}
+
+		if us.hasher != nil {
+			_, _ = us.hasher.Write(data)
+		}
+		kept++
+	}
+	if err = cursor.Err(); err != nil {
+		return err
+	}
+
+	_, err = us.chunksColl.DeleteMany(ctx, bsonx.Doc{
+		{"files_id", id},
+		{"n", bsonx.Document(bsonx.Doc{{"$gte", bsonx.Int32(kept)}})},
+	})
+	if err != nil {
+		return err
+	}
+
+	us.chunkIndex = int(kept)
+	us.fileLen = int64(kept) * int64(us.chunkSize)
+	return nil
+}
@@ -0,0 +1,144 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package gridfs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/appveen/mongo-go-driver/mongo/options"
+)
+
+// GzipTransformerName is the name of the transformer returned by GzipTransformer.
+const GzipTransformerName = "gzip"
+
+// ErrChunkAuthentication is returned when an encrypted chunk cannot be decrypted, either because it was modified or
+// because the wrong key was used.
+var ErrChunkAuthentication = errors.New("gridfs: chunk authentication failed")
+
+// ErrChunkTooLarge is returned when a compressed chunk decompresses to more than the file's chunk size.
+var ErrChunkTooLarge = errors.New("gridfs: decompressed chunk is larger than the chunk size")
+
+type gzipTransformer struct {
+	level int
+}
+
+// GzipTransformer returns an options.ChunkTransformer that compresses each chunk with gzip at the given compression
+// level. Every bucket can reverse it, regardless of the level.
+func GzipTransformer(level int) (options.ChunkTransformer, error) {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		return nil, fmt.Errorf("gridfs: invalid gzip compression level %d", level)
+	}
+	return gzipTransformer{level: level}, nil
+}
+
+func (gzipTransformer) Name() string {
+	return GzipTransformerName
+}
+
+func (gt gzipTransformer) Transform(_ options.ChunkInfo, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, gt.level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipTransformer) Reverse(chunk options.ChunkInfo, data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	// a chunk is never larger than the chunk size, so anything more is not a chunk this transformer compressed
+	out, err := ioutil.ReadAll(io.LimitReader(r, int64(chunk.ChunkSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > int(chunk.ChunkSize) {
+		return nil, ErrChunkTooLarge
+	}
+	return out, nil
+}
+
+type aesGCMTransformer struct {
+	name string
+	aead cipher.AEAD
+}
+
+// NewAESGCMTransformer returns an options.ChunkTransformer that encrypts each chunk with AES-GCM. The key must be
+// 16, 24 or 32 bytes long to select AES-128, AES-192 or AES-256. Each chunk is sealed with a random nonce, which is
+// stored in front of the ciphertext, and the chunk's files_id and index as additional data, so chunks cannot be
+// reordered within a file or moved to another file encrypted with the same key without detection.
+//
+// The name is stored in the files collection document; use a different name for every key, e.g.
+// "aes-gcm:tenant-42:v2", so that files encrypted with retired keys can still be read by registering their
+// transformers with options.BucketOptions.SetTransformers.
+func NewAESGCMTransformer(name string, key []byte) (options.ChunkTransformer, error) {
+	if name == "" {
+		return nil, errors.New("gridfs: AES-GCM transformer requires a name")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return aesGCMTransformer{name: name, aead: aead}, nil
+}
+
+func (at aesGCMTransformer) Name() string {
+	return at.name
+}
+
+func (at aesGCMTransformer) Transform(chunk options.ChunkInfo, data []byte) ([]byte, error) {
+	nonceSize := at.aead.NonceSize()
+	out := make([]byte, nonceSize, nonceSize+len(data)+at.aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, out); err != nil {
+		return nil, err
+	}
+	return at.aead.Seal(out, out, data, chunkAdditionalData(chunk)), nil
+}
+
+func (at aesGCMTransformer) Reverse(chunk options.ChunkInfo, data []byte) ([]byte, error) {
+	nonceSize := at.aead.NonceSize()
+	if len(data) < nonceSize {
+		return nil, ErrChunkAuthentication
+	}
+	plain, err := at.aead.Open(nil, data[:nonceSize], data[nonceSize:], chunkAdditionalData(chunk))
+	if err != nil {
+		return nil, ErrChunkAuthentication
+	}
+	return plain, nil
+}
+
+// chunkAdditionalData returns the chunk's index followed by its files_id.
+func chunkAdditionalData(chunk options.ChunkInfo) []byte {
+	ad := make([]byte, 4, 4+len(chunk.FileID))
+	binary.BigEndian.PutUint32(ad, uint32(chunk.N))
+	return append(ad, chunk.FileID...)
+}
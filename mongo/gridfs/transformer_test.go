@@ -0,0 +1,93 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package gridfs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/appveen/mongo-go-driver/internal/testutil/assert"
+	"github.com/appveen/mongo-go-driver/mongo/options"
+	"github.com/appveen/mongo-go-driver/x/bsonx"
+)
+
+func testChunk(t *testing.T, fileID bsonx.Val, n int32) options.ChunkInfo {
+	t.Helper()
+	id, err := transformerFileID(fileID)
+	assert.Nil(t, err, "transformerFileID error: %v", err)
+	return options.ChunkInfo{FileID: id, N: n, ChunkSize: DefaultChunkSize}
+}
+
+func TestChunkTransformers(t *testing.T) {
+	data := bytes.Repeat([]byte("compressible log line\n"), 100)
+	fileID := bsonx.Int32(1)
+
+	t.Run("gzip round trip", func(t *testing.T) {
+		gt, err := GzipTransformer(gzip.BestSpeed)
+		assert.Nil(t, err, "GzipTransformer error: %v", err)
+
+		stored, err := gt.Transform(testChunk(t, fileID, 3), data)
+		assert.Nil(t, err, "Transform error: %v", err)
+		assert.True(t, len(stored) < len(data), "expected compressed chunk to be smaller, got %d bytes", len(stored))
+
+		got, err := gt.Reverse(testChunk(t, fileID, 3), stored)
+		assert.Nil(t, err, "Reverse error: %v", err)
+		assert.Equal(t, data, got, "expected reversed chunk to match original data")
+	})
+	t.Run("gzip chunk larger than the chunk size", func(t *testing.T) {
+		gt, err := GzipTransformer(gzip.BestCompression)
+		assert.Nil(t, err, "GzipTransformer error: %v", err)
+
+		chunk := testChunk(t, fileID, 0)
+		stored, err := gt.Transform(chunk, make([]byte, chunk.ChunkSize+1))
+		assert.Nil(t, err, "Transform error: %v", err)
+
+		_, err = gt.Reverse(chunk, stored)
+		assert.Equal(t, ErrChunkTooLarge, err, "expected error %v, got %v", ErrChunkTooLarge, err)
+	})
+	t.Run("invalid gzip level", func(t *testing.T) {
+		_, err := GzipTransformer(42)
+		assert.NotNil(t, err, "expected error, got nil")
+	})
+	t.Run("AES-GCM", func(t *testing.T) {
+		key := bytes.Repeat([]byte{7}, 32)
+		at, err := NewAESGCMTransformer("aes-gcm:test", key)
+		assert.Nil(t, err, "NewAESGCMTransformer error: %v", err)
+		assert.Equal(t, "aes-gcm:test", at.Name(), "expected name %q, got %q", "aes-gcm:test", at.Name())
+
+		stored, err := at.Transform(testChunk(t, fileID, 5), data)
+		assert.Nil(t, err, "Transform error: %v", err)
+		assert.False(t, bytes.Contains(stored, data[:20]), "expected encrypted chunk not to contain plaintext")
+
+		got, err := at.Reverse(testChunk(t, fileID, 5), stored)
+		assert.Nil(t, err, "Reverse error: %v", err)
+		assert.Equal(t, data, got, "expected decrypted chunk to match original data")
+
+		// a chunk moved to a different index fails authentication
+		_, err = at.Reverse(testChunk(t, fileID, 6), stored)
+		assert.Equal(t, ErrChunkAuthentication, err, "expected error %v, got %v", ErrChunkAuthentication, err)
+
+		// a chunk moved to another file encrypted with the same key fails authentication
+		_, err = at.Reverse(testChunk(t, bsonx.Int32(2), 5), stored)
+		assert.Equal(t, ErrChunkAuthentication, err, "expected error %v, got %v", ErrChunkAuthentication, err)
+
+		tampered := append([]byte(nil), stored...)
+		tampered[len(tampered)-1]++
+		_, err = at.Reverse(testChunk(t, fileID, 5), tampered)
+		assert.Equal(t, ErrChunkAuthentication, err, "expected error %v, got %v", ErrChunkAuthentication, err)
+
+		other, err := NewAESGCMTransformer("aes-gcm:other", bytes.Repeat([]byte{8}, 32))
+		assert.Nil(t, err, "NewAESGCMTransformer error: %v", err)
+		_, err = other.Reverse(testChunk(t, fileID, 5), stored)
+		assert.Equal(t, ErrChunkAuthentication, err, "expected error %v, got %v", ErrChunkAuthentication, err)
+	})
+	t.Run("AES-GCM invalid key", func(t *testing.T) {
+		_, err := NewAESGCMTransformer("aes-gcm:test", []byte("short"))
+		assert.NotNil(t, err, "expected error, got nil")
+	})
+}
@@ -10,12 +10,15 @@ import (
 	"errors"
 
 	"context"
+	"hash"
 	"time"
 
 	"math"
+	"sync"
 
 	"github.com/appveen/mongo-go-driver/bson/primitive"
 	"github.com/appveen/mongo-go-driver/mongo"
+	"github.com/appveen/mongo-go-driver/mongo/options"
 	"github.com/appveen/mongo-go-driver/x/bsonx"
 )
 
@@ -40,11 +43,20 @@ type UploadStream struct {
 	bufferIndex   int
 	fileLen       int64
 	writeDeadline time.Time
+	hasher        hash.Hash // computes the digest stored in the files collection document, if requested
+	resumable     bool      // the files collection document was inserted as an in-progress marker
+
+	// concurrent batch inserts, used if the upload's concurrency is greater than 1
+	inFlight   chan struct{} // holds one token per batch being inserted
+	batches    sync.WaitGroup
+	batchMu    sync.Mutex
+	batchErr   error                // first error returned by a batch insert
+	batchCtxes []context.CancelFunc // cancel funcs of write deadlines still used by batch inserts
 }
 
 // NewUploadStream creates a new upload stream.
 func newUploadStream(upload *Upload, fileID interface{}, filename string, chunks, files *mongo.Collection) *UploadStream {
-	return &UploadStream{
+	us := &UploadStream{
 		Upload: upload,
 		FileID: fileID,
 
@@ -53,6 +65,14 @@ func newUploadStream(upload *Upload, fileID interface{}, filename string, chunks
 		filesColl:  files,
 		buffer:     make([]byte, UploadBufferSize),
 	}
+	if upload.hash != nil {
+		us.hasher = upload.hash.New()
+	}
+	if upload.concurrency > 1 {
+		us.inFlight = make(chan struct{}, upload.concurrency)
+	}
+	us.resumable = upload.resumable
+	return us
 }
 
 // Close closes this upload stream.
@@ -66,11 +86,24 @@ func (us *UploadStream) Close() error {
 		defer cancel()
 	}
 
+	return us.CloseContext(ctx)
+}
+
+// CloseContext uploads the remaining buffered data and the files collection document and closes this upload stream.
+// The inserts are bound to ctx.
+func (us *UploadStream) CloseContext(ctx context.Context) error {
+	if us.closed {
+		return ErrStreamClosed
+	}
+
 	if us.bufferIndex != 0 {
 		if err := us.uploadChunks(ctx, true); err != nil {
 			return err
 		}
 	}
+	if err := us.waitForBatches(); err != nil {
+		return err
+	}
 
 	if err := us.createFilesCollDoc(ctx); err != nil {
 		return err
@@ -97,11 +130,23 @@ func (us *UploadStream) Write(p []byte) (int, error) {
 		return 0, ErrStreamClosed
 	}
 
-	var ctx context.Context
-
 	ctx, cancel := deadlineContext(us.writeDeadline)
+	n, err := us.WriteContext(ctx, p)
 	if cancel != nil {
-		defer cancel()
+		us.releaseContext(cancel)
+	}
+	return n, err
+}
+
+// WriteContext transfers the contents of a byte slice into this upload stream. If the stream's underlying buffer
+// fills up, the buffer will be uploaded as chunks to the server. The uploads are bound to ctx.
+//
+// If the bucket uploads batches concurrently, WriteContext may return while batches are still being inserted with
+// ctx, so ctx should not be cancelled before the stream is closed or aborted. An error from a concurrent insert is
+// returned by a later write or by Close.
+func (us *UploadStream) WriteContext(ctx context.Context, p []byte) (int, error) {
+	if us.closed {
+		return 0, ErrStreamClosed
 	}
 
 	origLen := len(p)
@@ -111,10 +156,14 @@ func (us *UploadStream) Write(p []byte) (int, error) {
 		}
 
 		n := copy(us.buffer[us.bufferIndex:], p) // copy as much as possible
+		if us.hasher != nil {
+			_, _ = us.hasher.Write(p[:n])
+		}
 		p = p[n:]
 		us.bufferIndex += n
 
-		if us.bufferIndex == UploadBufferSize {
+		// resumable uploads write every complete chunk so that it survives a failure
+		if us.bufferIndex == UploadBufferSize || (us.resumable && us.bufferIndex >= int(us.chunkSize)) {
 			err := us.uploadChunks(ctx, false)
 			if err != nil {
 				return 0, err
@@ -135,6 +184,19 @@ func (us *UploadStream) Abort() error {
 		defer cancel()
 	}
 
+	return us.AbortContext(ctx)
+}
+
+// AbortContext closes the stream and deletes all file chunks that have already been written. The delete is bound to
+// ctx.
+func (us *UploadStream) AbortContext(ctx context.Context) error {
+	if us.closed {
+		return ErrStreamClosed
+	}
+
+	// wait for concurrent inserts so that no chunk is written after the delete
+	_ = us.waitForBatches()
+
 	id, err := convertFileID(us.FileID)
 	if err != nil {
 		return err
@@ -143,6 +205,11 @@ func (us *UploadStream) Abort() error {
 	if err != nil {
 		return err
 	}
+	if us.resumable {
+		if _, err = us.filesColl.DeleteOne(ctx, bsonx.Doc{{"_id", id}}); err != nil {
+			return err
+		}
+	}
 
 	us.closed = true
 	return nil
@@ -158,6 +225,9 @@ func (us *UploadStream) uploadChunks(ctx context.Context, uploadPartial bool) er
 	if !uploadPartial {
 		numChunks = int(math.Floor(chunks))
 	}
+	if numChunks == 0 {
+		return nil
+	}
 
 	docs := make([]interface{}, int(numChunks))
 
@@ -165,6 +235,12 @@ func (us *UploadStream) uploadChunks(ctx context.Context, uploadPartial bool) er
 	if err != nil {
 		return err
 	}
+	var chunkFileID []byte
+	if us.transformer != nil {
+		if chunkFileID, err = transformerFileID(id); err != nil {
+			return err
+		}
+	}
 	begChunkIndex := us.chunkIndex
 	for i := 0; i < us.bufferIndex; i += int(us.chunkSize) {
 		endIndex := i + int(us.chunkSize)
@@ -176,35 +252,139 @@ func (us *UploadStream) uploadChunks(ctx context.Context, uploadPartial bool) er
 			endIndex = us.bufferIndex
 		}
 		chunkData := us.buffer[i:endIndex]
+		storedData := chunkData
+		if us.transformer != nil {
+			chunk := options.ChunkInfo{FileID: chunkFileID, N: int32(us.chunkIndex), ChunkSize: us.chunkSize}
+			if storedData, err = us.transformer.Transform(chunk, chunkData); err != nil {
+				return err
+			}
+		}
+		if us.inFlight != nil {
+			// the buffer is reused before the batch is inserted
+			storedData = append([]byte(nil), storedData...)
+		}
 		docs[us.chunkIndex-begChunkIndex] = bsonx.Doc{
 			{"_id", bsonx.ObjectID(primitive.NewObjectID())},
 			{"files_id", id},
 			{"n", bsonx.Int32(int32(us.chunkIndex))},
-			{"data", bsonx.Binary(0x00, chunkData)},
+			{"data", bsonx.Binary(0x00, storedData)},
 		}
 		us.chunkIndex++
 		us.fileLen += int64(len(chunkData))
 	}
 
-	_, err = us.chunksColl.InsertMany(ctx, docs)
-	if err != nil {
+	if !us.concurrent(ctx) {
+		if _, err = us.chunksColl.InsertMany(ctx, docs); err != nil {
+			return err
+		}
+	} else if err = us.insertBatch(ctx, docs); err != nil {
 		return err
 	}
 
+	if uploadPartial {
+		us.bufferIndex = 0
+		return nil
+	}
+
 	// copy any remaining bytes to beginning of buffer and set buffer index
 	bytesUploaded := numChunks * int(us.chunkSize)
-	if bytesUploaded != UploadBufferSize && !uploadPartial {
-		copy(us.buffer[0:], us.buffer[bytesUploaded:us.bufferIndex])
+	copy(us.buffer[0:], us.buffer[bytesUploaded:us.bufferIndex])
+	us.bufferIndex -= bytesUploaded
+	return nil
+}
+
+// concurrent reports whether chunks written with ctx are inserted in concurrent batches. A session must not be used
+// concurrently, so chunks written with a context carrying a session are inserted serially.
+func (us *UploadStream) concurrent(ctx context.Context) bool {
+	return us.inFlight != nil && mongo.SessionFromContext(ctx) == nil
+}
+
+// insertBatch inserts a batch of chunks in the background once fewer than the upload's concurrency batches are being
+// inserted. The chunks' indexes were assigned when the batch was built, so batches may complete in any order.
+func (us *UploadStream) insertBatch(ctx context.Context, docs []interface{}) error {
+	if err := us.batchError(); err != nil {
+		return err
+	}
+
+	select {
+	case us.inFlight <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	us.bufferIndex = UploadBufferSize - bytesUploaded
+
+	us.batches.Add(1)
+	go func() {
+		defer us.batches.Done()
+		defer func() {
+			<-us.inFlight
+		}()
+
+		if _, err := us.chunksColl.InsertMany(ctx, docs); err != nil {
+			us.batchMu.Lock()
+			if us.batchErr == nil {
+				us.batchErr = err
+			}
+			us.batchMu.Unlock()
+		}
+	}()
 	return nil
 }
 
+func (us *UploadStream) batchError() error {
+	us.batchMu.Lock()
+	defer us.batchMu.Unlock()
+	return us.batchErr
+}
+
+// releaseContext cancels the context of a Write once no batch insert may be using it.
+func (us *UploadStream) releaseContext(cancel context.CancelFunc) {
+	if len(us.inFlight) == 0 {
+		cancel()
+		return
+	}
+	us.batchCtxes = append(us.batchCtxes, cancel)
+}
+
+// waitForBatches waits for every concurrent batch insert and returns the first error.
+func (us *UploadStream) waitForBatches() error {
+	us.batches.Wait()
+	for _, cancel := range us.batchCtxes {
+		cancel()
+	}
+	us.batchCtxes = nil
+	return us.batchError()
+}
+
 func (us *UploadStream) createFilesCollDoc(ctx context.Context) error {
 	id, err := convertFileID(us.FileID)
 	if err != nil {
 		return err
 	}
+	doc := us.filesCollDoc(id, false)
+
+	if us.resumable {
+		// replace the in-progress marker
+		res, err := us.filesColl.ReplaceOne(ctx, bsonx.Doc{{"_id", id}, {"inProgress", bsonx.Boolean(true)}}, doc)
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return ErrUploadNotResumable
+		}
+		return nil
+	}
+
+	_, err = us.filesColl.InsertOne(ctx, doc)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// filesCollDoc returns the files collection document for the upload. The document of an upload in progress does not
+// have a digest yet.
+func (us *UploadStream) filesCollDoc(id bsonx.Val, inProgress bool) bsonx.Doc {
 	doc := bsonx.Doc{
 		{"_id", id},
 		{"length", bsonx.Int64(us.fileLen)},
@@ -216,11 +396,18 @@ func (us *UploadStream) createFilesCollDoc(ctx context.Context) error {
 	if us.metadata != nil {
 		doc = append(doc, bsonx.Elem{"metadata", bsonx.Document(us.metadata)})
 	}
-
-	_, err = us.filesColl.InsertOne(ctx, doc)
-	if err != nil {
-		return err
+	if us.transformer != nil {
+		doc = append(doc, bsonx.Elem{"transformer", bsonx.String(us.transformer.Name())})
+	}
+	switch {
+	case us.hasher != nil && inProgress:
+		doc = append(doc, bsonx.Elem{"hash", bsonx.Document(bsonx.Doc{{"algorithm", bsonx.String(us.Upload.hash.Name)}})})
+	case us.hasher != nil:
+		doc = append(doc, bsonx.Elem{"hash", bsonx.Document(hashDoc(us.Upload.hash.Name, us.hasher))})
+	}
+	if inProgress {
+		doc = append(doc, bsonx.Elem{"inProgress", bsonx.Boolean(true)})
 	}
 
-	return nil
+	return doc
 }
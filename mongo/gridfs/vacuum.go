@@ -0,0 +1,231 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package gridfs
+
+import (
+	"context"
+	"time"
+
+	"github.com/appveen/mongo-go-driver/bson/primitive"
+	"github.com/appveen/mongo-go-driver/mongo/options"
+	"github.com/appveen/mongo-go-driver/x/bsonx"
+)
+
+// defaultGracePeriod is the minimum age of orphaned chunks deleted by Vacuum if no grace period is specified.
+const defaultGracePeriod = time.Hour
+
+// VacuumReport describes the orphaned chunks, incomplete files and old revisions found by Vacuum. Unless DryRun is
+// true, the orphaned chunks and old revisions have been deleted, as well as the incomplete files if requested.
+type VacuumReport struct {
+	DryRun          bool
+	Orphans         []OrphanedFile // chunks without a files collection document, by file ID
+	IncompleteFiles []interface{}  // IDs of files with missing chunks
+	PrunedRevisions []interface{}  // IDs of files that are older than the revisions kept for their filename
+}
+
+// OrphanedFile holds the number of chunks stored for a file ID that has no files collection document.
+type OrphanedFile struct {
+	FileID interface{}
+	Chunks int64
+}
+
+// vacuumFile holds the fields of a files collection document read by Vacuum.
+type vacuumFile struct {
+	ID         interface{} `bson:"_id"`
+	Filename   string      `bson:"filename"`
+	Length     int64       `bson:"length"`
+	ChunkSize  int32       `bson:"chunkSize"`
+	InProgress bool        `bson:"inProgress"`
+}
+
+// chunkGroup holds the chunks stored for a file ID without a files collection document.
+type chunkGroup struct {
+	ID     interface{} `bson:"_id"`
+	Count  int64       `bson:"count"`
+	Newest interface{} `bson:"newest"`
+}
+
+// Vacuum cleans up the bucket. It finds chunks whose file has no files collection document, e.g. because an upload
+// crashed before it was closed, files with missing chunks and, if a number of revisions to keep is specified, the
+// revisions of each filename beyond that number. Orphaned chunks and old revisions are deleted unless the vacuum is a
+// dry run; incomplete files are only deleted if requested. Resumable uploads in progress are left alone.
+func (b *Bucket) Vacuum(opts ...*options.VacuumOptions) (*VacuumReport, error) {
+	ctx, cancel := deadlineContext(b.writeDeadline)
+	if cancel != nil {
+		defer cancel()
+	}
+
+	return b.VacuumContext(ctx, opts...)
+}
+
+// VacuumContext cleans up the bucket. The queries and deletes are bound to ctx. See Vacuum for details.
+func (b *Bucket) VacuumContext(ctx context.Context, opts ...*options.VacuumOptions) (*VacuumReport, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	vo := options.MergeVacuumOptions(opts...)
+	report := &VacuumReport{DryRun: vo.DryRun != nil && *vo.DryRun}
+	var keep int32
+	if vo.KeepRevisions != nil {
+		keep = *vo.KeepRevisions
+	}
+	grace := defaultGracePeriod
+	if vo.GracePeriod != nil {
+		grace = *vo.GracePeriod
+	}
+
+	if err := b.scanFiles(ctx, keep, report); err != nil {
+		return nil, err
+	}
+	if !report.DryRun {
+		for _, id := range report.PrunedRevisions {
+			if err := b.DeleteContext(ctx, id); err != nil && err != ErrFileNotFound {
+				return nil, err
+			}
+		}
+		if vo.DeleteIncomplete != nil && *vo.DeleteIncomplete {
+			for _, id := range report.IncompleteFiles {
+				if err := b.DeleteContext(ctx, id); err != nil && err != ErrFileNotFound {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if err := b.findOrphans(ctx, time.Now().Add(-grace), report); err != nil {
+		return nil, err
+	}
+	if !report.DryRun {
+		for _, orphan := range report.Orphans {
+			if err := b.deleteChunks(ctx, orphan.FileID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// scanFiles reports the revisions beyond the most recent keep revisions of each filename and the remaining files
+// that have missing chunks.
+func (b *Bucket) scanFiles(ctx context.Context, keep int32, report *VacuumReport) error {
+	// the order is served by the filename and uploadDate index in reverse
+	findOpts := options.Find().
+		SetSort(bsonx.Doc{{"filename", bsonx.Int32(-1)}, {"uploadDate", bsonx.Int32(-1)}}).
+		SetProjection(bsonx.Doc{
+			{"filename", bsonx.Int32(1)},
+			{"length", bsonx.Int32(1)},
+			{"chunkSize", bsonx.Int32(1)},
+			{"inProgress", bsonx.Int32(1)},
+		})
+	cursor, err := b.filesColl.Find(ctx, bsonx.Doc{}, findOpts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = cursor.Close(ctx)
+	}()
+
+	var filename string
+	var revisions int32
+	for cursor.Next(ctx) {
+		var file vacuumFile
+		if err = cursor.Decode(&file); err != nil {
+			return err
+		}
+		if file.InProgress {
+			continue
+		}
+
+		if revisions == 0 || file.Filename != filename {
+			filename, revisions = file.Filename, 0
+		}
+		revisions++
+		if keep > 0 && revisions > keep {
+			report.PrunedRevisions = append(report.PrunedRevisions, file.ID)
+			continue
+		}
+
+		complete, err := b.hasAllChunks(ctx, file)
+		if err != nil {
+			return err
+		}
+		if !complete {
+			report.IncompleteFiles = append(report.IncompleteFiles, file.ID)
+		}
+	}
+
+	return cursor.Err()
+}
+
+// hasAllChunks reports whether every chunk required by the file's length is stored. It relies on the unique index on
+// files_id and n, so it only counts the chunks.
+func (b *Bucket) hasAllChunks(ctx context.Context, file vacuumFile) (bool, error) {
+	if file.Length == 0 {
+		return true, nil
+	}
+	chunkSize := int64(file.ChunkSize)
+	if chunkSize <= 0 {
+		return false, nil
+	}
+	numChunks := (file.Length + chunkSize - 1) / chunkSize
+
+	id, err := convertFileID(file.ID)
+	if err != nil {
+		return false, err
+	}
+	count, err := b.chunksColl.CountDocuments(ctx, bsonx.Doc{
+		{"files_id", id},
+		{"n", bsonx.Document(bsonx.Doc{{"$gte", bsonx.Int32(0)}, {"$lt", bsonx.Int64(numChunks)}})},
+	})
+	if err != nil {
+		return false, err
+	}
+	return count == numChunks, nil
+}
+
+// findOrphans reports the file IDs that have chunks but no files collection document, ignoring those whose newest
+// chunk was inserted after cutoff.
+func (b *Bucket) findOrphans(ctx context.Context, cutoff time.Time, report *VacuumReport) error {
+	pipeline := []bsonx.Doc{
+		{{"$group", bsonx.Document(bsonx.Doc{
+			{"_id", bsonx.String("$files_id")},
+			{"count", bsonx.Document(bsonx.Doc{{"$sum", bsonx.Int32(1)}})},
+			{"newest", bsonx.Document(bsonx.Doc{{"$max", bsonx.String("$_id")}})},
+		})}},
+		{{"$lookup", bsonx.Document(bsonx.Doc{
+			{"from", bsonx.String(b.filesColl.Name())},
+			{"localField", bsonx.String("_id")},
+			{"foreignField", bsonx.String("_id")},
+			{"as", bsonx.String("file")},
+		})}},
+		{{"$match", bsonx.Document(bsonx.Doc{{"file", bsonx.Document(bsonx.Doc{{"$size", bsonx.Int32(0)}})}})}},
+		{{"$project", bsonx.Document(bsonx.Doc{{"count", bsonx.Int32(1)}, {"newest", bsonx.Int32(1)}})}},
+	}
+	cursor, err := b.chunksColl.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = cursor.Close(ctx)
+	}()
+
+	for cursor.Next(ctx) {
+		var group chunkGroup
+		if err = cursor.Decode(&group); err != nil {
+			return err
+		}
+		if oid, ok := group.Newest.(primitive.ObjectID); ok && oid.Timestamp().After(cutoff) {
+			// the upload may still be running
+			continue
+		}
+		report.Orphans = append(report.Orphans, OrphanedFile{FileID: group.ID, Chunks: group.Count})
+	}
+
+	return cursor.Err()
+}
@@ -0,0 +1,579 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongo
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/appveen/mongo-go-driver/bson/bsontype"
+	"github.com/appveen/mongo-go-driver/x/bsonx/bsoncore"
+)
+
+// matcher evaluates a query filter against a document on the client.
+type matcher interface {
+	match(doc bsoncore.Document) bool
+}
+
+// compileMatchPipeline compiles an aggregation pipeline array that consists only of $match stages into a single
+// matcher.
+func compileMatchPipeline(pipeline bsoncore.Document) (matcher, error) {
+	stages, err := pipeline.Values()
+	if err != nil {
+		return nil, err
+	}
+
+	all := make(andMatcher, 0, len(stages))
+	for _, val := range stages {
+		stage, ok := val.DocumentOK()
+		if !ok {
+			return nil, fmt.Errorf("pipeline stages must be documents, got %s", val.Type)
+		}
+		elems, err := stage.Elements()
+		if err != nil {
+			return nil, err
+		}
+		if len(elems) != 1 || elems[0].Key() != "$match" {
+			return nil, fmt.Errorf("only $match stages can be evaluated on the client, got %v", stage)
+		}
+		filter, ok := elems[0].Value().DocumentOK()
+		if !ok {
+			return nil, fmt.Errorf("$match stage must be a document, got %s", elems[0].Value().Type)
+		}
+		m, err := compileMatch(filter)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, m)
+	}
+	return all, nil
+}
+
+// compileMatch compiles a query filter into a matcher. It supports field equality, dotted paths, the comparison
+// operators $eq, $ne, $gt, $gte, $lt, $lte, $in and $nin, and $exists, $regex, $not, $and, $or and $nor.
+func compileMatch(filter bsoncore.Document) (matcher, error) {
+	elems, err := filter.Elements()
+	if err != nil {
+		return nil, err
+	}
+
+	all := make(andMatcher, 0, len(elems))
+	for _, elem := range elems {
+		key, val := elem.Key(), elem.Value()
+		switch key {
+		case "$and", "$or", "$nor":
+			arr, ok := val.ArrayOK()
+			if !ok {
+				return nil, fmt.Errorf("%s must be an array, got %s", key, val.Type)
+			}
+			vals, err := arr.Values()
+			if err != nil {
+				return nil, err
+			}
+			if len(vals) == 0 {
+				return nil, fmt.Errorf("%s must be a non-empty array", key)
+			}
+			subs := make([]matcher, 0, len(vals))
+			for _, v := range vals {
+				doc, ok := v.DocumentOK()
+				if !ok {
+					return nil, fmt.Errorf("%s elements must be documents, got %s", key, v.Type)
+				}
+				m, err := compileMatch(doc)
+				if err != nil {
+					return nil, err
+				}
+				subs = append(subs, m)
+			}
+			switch key {
+			case "$and":
+				all = append(all, andMatcher(subs))
+			case "$or":
+				all = append(all, orMatcher(subs))
+			default:
+				all = append(all, notMatcher{orMatcher(subs)})
+			}
+			continue
+		}
+		if strings.HasPrefix(key, "$") {
+			return nil, fmt.Errorf("unsupported top-level operator %s", key)
+		}
+
+		m, err := compileFieldMatch(strings.Split(key, "."), val)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, m)
+	}
+	return all, nil
+}
+
+// compileFieldMatch compiles the condition val for the field at path. The condition is either a document of
+// operators or a value the field must equal.
+func compileFieldMatch(path []string, val bsoncore.Value) (matcher, error) {
+	doc, ok := val.DocumentOK()
+	if !ok || !isOperatorDocument(doc) {
+		pred, err := eqPredicate(val)
+		if err != nil {
+			return nil, err
+		}
+		return fieldMatcher{path: path, pred: pred}, nil
+	}
+
+	elems, err := doc.Elements()
+	if err != nil {
+		return nil, err
+	}
+
+	all := make(andMatcher, 0, len(elems))
+	var regexOptions string
+	if opts, err := doc.LookupErr("$options"); err == nil {
+		if regexOptions, ok = opts.StringValueOK(); !ok {
+			return nil, fmt.Errorf("$options must be a string, got %s", opts.Type)
+		}
+	}
+	for _, elem := range elems {
+		op, arg := elem.Key(), elem.Value()
+		var pred valuePredicate
+		switch op {
+		case "$eq":
+			if pred, err = eqPredicate(arg); err != nil {
+				return nil, err
+			}
+		case "$ne":
+			ne, err := eqPredicate(arg)
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, notMatcher{fieldMatcher{path: path, pred: ne}})
+			continue
+		case "$gt", "$gte", "$lt", "$lte":
+			pred = comparePredicate(op, arg)
+		case "$in", "$nin":
+			arr, ok := arg.ArrayOK()
+			if !ok {
+				return nil, fmt.Errorf("%s must be an array, got %s", op, arg.Type)
+			}
+			vals, err := arr.Values()
+			if err != nil {
+				return nil, err
+			}
+			preds := make([]valuePredicate, 0, len(vals))
+			for _, v := range vals {
+				p, err := eqPredicate(v)
+				if err != nil {
+					return nil, err
+				}
+				preds = append(preds, p)
+			}
+			pred = func(v bsoncore.Value, missing bool) bool {
+				for _, p := range preds {
+					if p(v, missing) {
+						return true
+					}
+				}
+				return false
+			}
+			if op == "$nin" {
+				all = append(all, notMatcher{fieldMatcher{path: path, pred: pred}})
+				continue
+			}
+		case "$exists":
+			exists := isTruthy(arg)
+			all = append(all, existsMatcher{path: path, exists: exists})
+			continue
+		case "$regex":
+			pattern, options, ok := arg.RegexOK()
+			if !ok {
+				if pattern, ok = arg.StringValueOK(); !ok {
+					return nil, fmt.Errorf("$regex must be a string or regular expression, got %s", arg.Type)
+				}
+			}
+			if regexOptions != "" {
+				options = regexOptions
+			}
+			re, err := compileRegex(pattern, options)
+			if err != nil {
+				return nil, err
+			}
+			pred = func(v bsoncore.Value, _ bool) bool {
+				s, ok := v.StringValueOK()
+				return ok && re.MatchString(s)
+			}
+		case "$options":
+			continue
+		case "$not":
+			m, err := compileFieldMatch(path, arg)
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, notMatcher{m})
+			continue
+		default:
+			return nil, fmt.Errorf("unsupported query operator %s", op)
+		}
+		all = append(all, fieldMatcher{path: path, pred: pred})
+	}
+	return all, nil
+}
+
+func isOperatorDocument(doc bsoncore.Document) bool {
+	elem, err := doc.IndexErr(0)
+	return err == nil && strings.HasPrefix(elem.Key(), "$")
+}
+
+func isTruthy(v bsoncore.Value) bool {
+	switch v.Type {
+	case bsontype.Boolean:
+		return v.Boolean()
+	case bsontype.Null, bsontype.Undefined:
+		return false
+	}
+	if f, ok := numberAsFloat64(v); ok {
+		return f != 0
+	}
+	return true
+}
+
+// compileRegex compiles a regular expression with the given options. It returns an error for options the server
+// supports differently or not at all, so a filter is not evaluated differently than by the server.
+func compileRegex(pattern, options string) (*regexp.Regexp, error) {
+	var flags string
+	var extended bool
+	for _, o := range options {
+		switch o {
+		case 'i', 'm', 's':
+			flags += string(o)
+		case 'x':
+			extended = true
+		case 'u':
+			// Go regular expressions always match UTF-8
+		default:
+			return nil, fmt.Errorf("unsupported regular expression option %q", o)
+		}
+	}
+	if extended {
+		pattern = stripExtendedRegex(pattern)
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// stripExtendedRegex removes the unescaped whitespace outside of character classes and the comments from "#" to the
+// end of the line from a pattern with the extended option. Escaped whitespace is kept unescaped.
+func stripExtendedRegex(pattern string) string {
+	var sb strings.Builder
+	inClass := false
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			if !isRegexSpace(pattern[i]) {
+				sb.WriteByte(c)
+			}
+			c = pattern[i]
+		case inClass:
+			inClass = c != ']'
+		case c == '[':
+			inClass = true
+			// a "]" at the start of a character class is a literal
+			if strings.HasPrefix(pattern[i+1:], "^]") {
+				sb.WriteString("[^]")
+				i += 2
+				continue
+			}
+			if strings.HasPrefix(pattern[i+1:], "]") {
+				sb.WriteString("[]")
+				i++
+				continue
+			}
+		case isRegexSpace(c):
+			continue
+		case c == '#':
+			for i+1 < len(pattern) && pattern[i+1] != '\n' {
+				i++
+			}
+			continue
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+func isRegexSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return true
+	}
+	return false
+}
+
+type andMatcher []matcher
+
+func (am andMatcher) match(doc bsoncore.Document) bool {
+	for _, m := range am {
+		if !m.match(doc) {
+			return false
+		}
+	}
+	return true
+}
+
+type orMatcher []matcher
+
+func (om orMatcher) match(doc bsoncore.Document) bool {
+	for _, m := range om {
+		if m.match(doc) {
+			return true
+		}
+	}
+	return false
+}
+
+type notMatcher struct {
+	m matcher
+}
+
+func (nm notMatcher) match(doc bsoncore.Document) bool {
+	return !nm.m.match(doc)
+}
+
+// valuePredicate tests a single value. The missing parameter is true if the field does not exist in the document.
+type valuePredicate func(v bsoncore.Value, missing bool) bool
+
+// fieldMatcher matches if the value at path, or any element of it if it is an array, satisfies pred.
+type fieldMatcher struct {
+	path []string
+	pred valuePredicate
+}
+
+func (fm fieldMatcher) match(doc bsoncore.Document) bool {
+	vals := lookupPath(doc, fm.path)
+	if len(vals) == 0 {
+		return fm.pred(bsoncore.Value{}, true)
+	}
+	for _, val := range vals {
+		if fm.pred(val, false) {
+			return true
+		}
+		if arr, ok := val.ArrayOK(); ok {
+			elems, err := arr.Values()
+			if err != nil {
+				continue
+			}
+			for _, v := range elems {
+				if fm.pred(v, false) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+type existsMatcher struct {
+	path   []string
+	exists bool
+}
+
+func (em existsMatcher) match(doc bsoncore.Document) bool {
+	return (len(lookupPath(doc, em.path)) > 0) == em.exists
+}
+
+// lookupPath returns the values at the dotted path in doc. Like on the server, a path component applied to an array is
+// applied to each of its embedded documents, so {"a.b": x} matches {a: [{b: x}]}, and numeric path components also
+// index into the array.
+func lookupPath(doc bsoncore.Document, path []string) []bsoncore.Value {
+	val, err := doc.LookupErr(path[0])
+	if err != nil {
+		return nil
+	}
+	return appendPathValues(nil, val, path[1:])
+}
+
+// appendPathValues appends the values at the path below val to vals.
+func appendPathValues(vals []bsoncore.Value, val bsoncore.Value, path []string) []bsoncore.Value {
+	if len(path) == 0 {
+		return append(vals, val)
+	}
+
+	switch val.Type {
+	case bsontype.EmbeddedDocument:
+		if v, err := val.Document().LookupErr(path[0]); err == nil {
+			vals = appendPathValues(vals, v, path[1:])
+		}
+	case bsontype.Array:
+		arr := val.Array()
+		if _, err := strconv.Atoi(path[0]); err == nil {
+			if v, err := arr.LookupErr(path[0]); err == nil {
+				vals = appendPathValues(vals, v, path[1:])
+			}
+		}
+		elems, err := arr.Values()
+		if err != nil {
+			return vals
+		}
+		for _, elem := range elems {
+			// arrays nested directly in arrays are not traversed
+			if elem.Type == bsontype.EmbeddedDocument {
+				vals = appendPathValues(vals, elem, path)
+			}
+		}
+	}
+	return vals
+}
+
+func eqPredicate(want bsoncore.Value) (valuePredicate, error) {
+	if want.Type == bsontype.Null {
+		return func(v bsoncore.Value, missing bool) bool {
+			return missing || v.Type == bsontype.Null
+		}, nil
+	}
+	if want.Type == bsontype.Regex {
+		pattern, options := want.Regex()
+		re, err := compileRegex(pattern, options)
+		if err != nil {
+			return nil, err
+		}
+		return func(v bsoncore.Value, missing bool) bool {
+			if s, ok := v.StringValueOK(); ok {
+				return re.MatchString(s)
+			}
+			return !missing && valuesEqual(v, want)
+		}, nil
+	}
+	return func(v bsoncore.Value, missing bool) bool {
+		return !missing && valuesEqual(v, want)
+	}, nil
+}
+
+func comparePredicate(op string, want bsoncore.Value) valuePredicate {
+	return func(v bsoncore.Value, missing bool) bool {
+		if missing {
+			return false
+		}
+		cmp, ok := compareMatchValues(v, want)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "$gt":
+			return cmp > 0
+		case "$gte":
+			return cmp >= 0
+		case "$lt":
+			return cmp < 0
+		default:
+			return cmp <= 0
+		}
+	}
+}
+
+func valuesEqual(a, b bsoncore.Value) bool {
+	if cmp, ok := compareMatchValues(a, b); ok {
+		return cmp == 0
+	}
+	return a.Type == b.Type && bytes.Equal(a.Data, b.Data)
+}
+
+// compareMatchValues compares two values of the same kind. Numbers of any numeric type are compared by value. It returns
+// false if the values cannot be ordered relative to each other.
+func compareMatchValues(a, b bsoncore.Value) (int, bool) {
+	if a.IsNumber() && b.IsNumber() {
+		ai, aInt := integerValue(a)
+		bi, bInt := integerValue(b)
+		if aInt && bInt {
+			return compareInt64(ai, bi), true
+		}
+		af, aok := numberAsFloat64(a)
+		bf, bok := numberAsFloat64(b)
+		if !aok || !bok || math.IsNaN(af) || math.IsNaN(bf) {
+			return 0, false
+		}
+		switch {
+		case af < bf:
+			return -1, true
+		case af > bf:
+			return 1, true
+		}
+		return 0, true
+	}
+	if a.Type != b.Type {
+		return 0, false
+	}
+
+	switch a.Type {
+	case bsontype.String:
+		return strings.Compare(a.StringValue(), b.StringValue()), true
+	case bsontype.Boolean:
+		ab, bb := a.Boolean(), b.Boolean()
+		switch {
+		case ab == bb:
+			return 0, true
+		case !ab:
+			return -1, true
+		}
+		return 1, true
+	case bsontype.DateTime:
+		return compareInt64(a.DateTime(), b.DateTime()), true
+	case bsontype.Timestamp:
+		at, ai := a.Timestamp()
+		bt, bi := b.Timestamp()
+		if at != bt {
+			return compareInt64(int64(at), int64(bt)), true
+		}
+		return compareInt64(int64(ai), int64(bi)), true
+	case bsontype.ObjectID:
+		ao, bo := a.ObjectID(), b.ObjectID()
+		return bytes.Compare(ao[:], bo[:]), true
+	case bsontype.Null, bsontype.MinKey, bsontype.MaxKey, bsontype.Undefined:
+		return 0, true
+	}
+	return 0, false
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func integerValue(v bsoncore.Value) (int64, bool) {
+	switch v.Type {
+	case bsontype.Int32:
+		return int64(v.Int32()), true
+	case bsontype.Int64:
+		return v.Int64(), true
+	}
+	return 0, false
+}
+
+func numberAsFloat64(v bsoncore.Value) (float64, bool) {
+	switch v.Type {
+	case bsontype.Double:
+		return v.Double(), true
+	case bsontype.Int32:
+		return float64(v.Int32()), true
+	case bsontype.Int64:
+		return float64(v.Int64()), true
+	case bsontype.Decimal128:
+		f, err := strconv.ParseFloat(v.Decimal128().String(), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
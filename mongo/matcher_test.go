@@ -0,0 +1,122 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongo
+
+import (
+	"testing"
+
+	"github.com/appveen/mongo-go-driver/bson"
+	"github.com/appveen/mongo-go-driver/bson/primitive"
+	"github.com/appveen/mongo-go-driver/internal/testutil/assert"
+	"github.com/appveen/mongo-go-driver/x/bsonx/bsoncore"
+)
+
+func TestMatcher(t *testing.T) {
+	doc, err := bson.Marshal(bson.D{
+		{"operationType", "update"},
+		{"ns", bson.D{{"db", "db"}, {"coll", "orders"}}},
+		{"fullDocument", bson.D{
+			{"qty", int32(5)},
+			{"price", 2.5},
+			{"tags", bson.A{"a", "b"}},
+			{"status", nil},
+			{"items", bson.A{
+				bson.D{{"sku", "x1"}, {"qty", int32(2)}},
+				bson.D{{"sku", "y2"}, {"qty", int32(7)}, {"tags", bson.A{"gift"}}},
+			}},
+		}},
+	})
+	assert.Nil(t, err, "Marshal error: %v", err)
+
+	testCases := []struct {
+		name   string
+		filter bson.D
+		match  bool
+	}{
+		{"empty filter", bson.D{}, true},
+		{"equality", bson.D{{"operationType", "update"}}, true},
+		{"equality mismatch", bson.D{{"operationType", "insert"}}, false},
+		{"dotted path", bson.D{{"ns.coll", "orders"}}, true},
+		{"embedded document equality", bson.D{{"ns", bson.D{{"db", "db"}, {"coll", "orders"}}}}, true},
+		{"numeric types compare by value", bson.D{{"fullDocument.qty", int64(5)}}, true},
+		{"$gt", bson.D{{"fullDocument.qty", bson.D{{"$gt", 4.5}}}}, true},
+		{"$lte", bson.D{{"fullDocument.price", bson.D{{"$lte", int32(2)}}}}, false},
+		{"range", bson.D{{"fullDocument.qty", bson.D{{"$gte", 1}, {"$lt", 10}}}}, true},
+		{"$ne", bson.D{{"operationType", bson.D{{"$ne", "delete"}}}}, true},
+		{"$in", bson.D{{"operationType", bson.D{{"$in", bson.A{"insert", "update"}}}}}, true},
+		{"$nin", bson.D{{"operationType", bson.D{{"$nin", bson.A{"insert", "update"}}}}}, false},
+		{"array contains", bson.D{{"fullDocument.tags", "b"}}, true},
+		{"array $ne", bson.D{{"fullDocument.tags", bson.D{{"$ne", "b"}}}}, false},
+		{"array index", bson.D{{"fullDocument.tags.0", "a"}}, true},
+		{"array of documents", bson.D{{"fullDocument.items.sku", "y2"}}, true},
+		{"array of documents mismatch", bson.D{{"fullDocument.items.sku", "z3"}}, false},
+		{"array of documents $gt", bson.D{{"fullDocument.items.qty", bson.D{{"$gt", 5}}}}, true},
+		{"array of documents $ne", bson.D{{"fullDocument.items.sku", bson.D{{"$ne", "x1"}}}}, false},
+		{"array of documents nested array", bson.D{{"fullDocument.items.tags", "gift"}}, true},
+		{"array of documents index", bson.D{{"fullDocument.items.1.sku", "y2"}}, true},
+		{"array of documents $exists", bson.D{{"fullDocument.items.tags", bson.D{{"$exists", true}}}}, true},
+		{"array of documents missing", bson.D{{"fullDocument.items.color", bson.D{{"$exists", true}}}}, false},
+		{"$exists true", bson.D{{"fullDocument.qty", bson.D{{"$exists", true}}}}, true},
+		{"$exists false", bson.D{{"fullDocument.missing", bson.D{{"$exists", false}}}}, true},
+		{"null matches missing", bson.D{{"fullDocument.missing", nil}}, true},
+		{"null matches null", bson.D{{"fullDocument.status", nil}}, true},
+		{"$regex", bson.D{{"ns.coll", bson.D{{"$regex", "^ORD"}, {"$options", "i"}}}}, true},
+		{"regex value", bson.D{{"ns.coll", primitive.Regex{Pattern: "ders$"}}}, true},
+		{"$regex extended", bson.D{{"ns.coll", bson.D{
+			{"$regex", "^ or  # the prefix\n d [e] \\ ? rs $"}, {"$options", "x"},
+		}}}, true},
+		{"$regex extended keeps escaped whitespace", bson.D{{"ns.coll", bson.D{
+			{"$regex", "^or\\ ders$"}, {"$options", "x"},
+		}}}, false},
+		{"regex value extended", bson.D{{"ns.coll", primitive.Regex{Pattern: "ord ers", Options: "ix"}}}, true},
+		{"$not", bson.D{{"fullDocument.qty", bson.D{{"$not", bson.D{{"$gt", 3}}}}}}, false},
+		{"$or", bson.D{{"$or", bson.A{
+			bson.D{{"operationType", "insert"}},
+			bson.D{{"fullDocument.qty", 5}},
+		}}}, true},
+		{"$and", bson.D{{"$and", bson.A{
+			bson.D{{"operationType", "update"}},
+			bson.D{{"fullDocument.qty", 6}},
+		}}}, false},
+		{"$nor", bson.D{{"$nor", bson.A{bson.D{{"operationType", "delete"}}}}}, true},
+		{"mismatched types do not compare", bson.D{{"fullDocument.qty", bson.D{{"$gt", "1"}}}}, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, err := bson.Marshal(tc.filter)
+			assert.Nil(t, err, "Marshal error: %v", err)
+
+			m, err := compileMatch(bsoncore.Document(filter))
+			assert.Nil(t, err, "compileMatch error: %v", err)
+			got := m.match(bsoncore.Document(doc))
+			assert.Equal(t, tc.match, got, "expected match %v, got %v", tc.match, got)
+		})
+	}
+
+	t.Run("unsupported operator", func(t *testing.T) {
+		filter, _ := bson.Marshal(bson.D{{"a", bson.D{{"$where", "true"}}}})
+		_, err := compileMatch(bsoncore.Document(filter))
+		assert.NotNil(t, err, "expected error, got nil")
+	})
+	t.Run("unsupported regex option", func(t *testing.T) {
+		for _, filter := range []bson.D{
+			{{"ns.coll", bson.D{{"$regex", "^ord"}, {"$options", "l"}}}},
+			{{"ns.coll", primitive.Regex{Pattern: "^ord", Options: "q"}}},
+			{{"ns.coll", bson.D{{"$in", bson.A{primitive.Regex{Pattern: "^ord", Options: "l"}}}}}},
+		} {
+			doc, _ := bson.Marshal(filter)
+			_, err := compileMatch(bsoncore.Document(doc))
+			assert.NotNil(t, err, "expected error for filter %v, got nil", filter)
+		}
+	})
+	t.Run("pipeline with non-$match stage", func(t *testing.T) {
+		pipeline, _, err := transformAggregatePipelinev2(bson.DefaultRegistry, Pipeline{{{"$project", bson.D{{"a", 1}}}}})
+		assert.Nil(t, err, "transformAggregatePipelinev2 error: %v", err)
+		_, err = compileMatchPipeline(pipeline)
+		assert.NotNil(t, err, "expected error, got nil")
+	})
+}
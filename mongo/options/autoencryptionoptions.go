@@ -6,6 +6,14 @@
 
 package options
 
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/appveen/mongo-go-driver/event"
+	"github.com/appveen/mongo-go-driver/x/mongo/driver"
+)
+
 // AutoEncryptionOptions represents options used to configure auto encryption/decryption behavior for a mongo.Client
 // instance.
 //
@@ -27,6 +35,12 @@ type AutoEncryptionOptions struct {
 	KeyVaultClientOptions *ClientOptions
 	KeyVaultNamespace     string
 	KmsProviders          map[string]map[string]interface{}
+	CustomKmsProviders    map[string]driver.KmsProvider
+	KmsEndpoints          map[string]string
+	TLSConfig             map[string]*tls.Config
+	KeyCacheTTL           *time.Duration
+	KeyCacheMaxSize       *int
+	Monitor               *event.EncryptionMonitor
 	SchemaMap             map[string]interface{}
 	BypassAutoEncryption  *bool
 	ExtraOptions          map[string]interface{}
@@ -80,6 +94,53 @@ func (a *AutoEncryptionOptions) SetExtraOptions(extraOpts map[string]interface{}
 	return a
 }
 
+// SetCustomKmsProviders specifies KMS providers implemented in Go, by provider name. Data keys are created for a
+// custom KMS provider by passing its name to ClientEncryption.CreateDataKey, and the master key given in
+// DataKeyOptions.SetMasterKey is passed to the provider. The names "aws" and "local" are reserved.
+func (a *AutoEncryptionOptions) SetCustomKmsProviders(providers map[string]driver.KmsProvider) *AutoEncryptionOptions {
+	a.CustomKmsProviders = providers
+	return a
+}
+
+// SetKmsEndpoints specifies the "host" or "host:port" to send the requests for a KMS provider to instead of the
+// endpoint chosen by libmongocrypt, by provider name. This can be used to reach a KMS through a proxy or to use a
+// local stand-in for testing.
+func (a *AutoEncryptionOptions) SetKmsEndpoints(endpoints map[string]string) *AutoEncryptionOptions {
+	a.KmsEndpoints = endpoints
+	return a
+}
+
+// SetTLSConfig specifies the TLS configuration used to connect to the KMS of a provider, by provider name. If no
+// configuration is specified for a provider, the system's root certificates are used.
+func (a *AutoEncryptionOptions) SetTLSConfig(tlsConfigs map[string]*tls.Config) *AutoEncryptionOptions {
+	a.TLSConfig = tlsConfigs
+	return a
+}
+
+// SetKeyCacheTTL enables a cache of the data keys retrieved from the key vault collection and specifies how long
+// data keys are cached. Cached data keys are handed to libmongocrypt when its own cache misses, which avoids the key
+// vault query and the KMS round trip: AWS data keys and data keys of custom KMS providers are decrypted with their KMS
+// once when they are cached, and cached wrapped with the local master key, which is generated if no local KMS provider
+// is configured. Changes to data keys in the key vault, e.g. by RewrapManyDataKey or DeleteKey, are not seen until
+// the cached data keys expire. The cache is disabled by default.
+func (a *AutoEncryptionOptions) SetKeyCacheTTL(ttl time.Duration) *AutoEncryptionOptions {
+	a.KeyCacheTTL = &ttl
+	return a
+}
+
+// SetKeyCacheMaxSize specifies the maximum number of data keys in the cache enabled with SetKeyCacheTTL. The least
+// recently used data keys are evicted when the cache is full. The default is 0, which means there is no limit.
+func (a *AutoEncryptionOptions) SetKeyCacheMaxSize(size int) *AutoEncryptionOptions {
+	a.KeyCacheMaxSize = &size
+	return a
+}
+
+// SetMonitor specifies a monitor that receives data key cache hits and misses and KMS round trips.
+func (a *AutoEncryptionOptions) SetMonitor(monitor *event.EncryptionMonitor) *AutoEncryptionOptions {
+	a.Monitor = monitor
+	return a
+}
+
 // MergeAutoEncryptionOptions combines the argued AutoEncryptionOptions in a last-one wins fashion.
 func MergeAutoEncryptionOptions(opts ...*AutoEncryptionOptions) *AutoEncryptionOptions {
 	aeo := AutoEncryption()
@@ -97,6 +158,24 @@ func MergeAutoEncryptionOptions(opts ...*AutoEncryptionOptions) *AutoEncryptionO
 		if opt.KmsProviders != nil {
 			aeo.KmsProviders = opt.KmsProviders
 		}
+		if opt.CustomKmsProviders != nil {
+			aeo.CustomKmsProviders = opt.CustomKmsProviders
+		}
+		if opt.KmsEndpoints != nil {
+			aeo.KmsEndpoints = opt.KmsEndpoints
+		}
+		if opt.TLSConfig != nil {
+			aeo.TLSConfig = opt.TLSConfig
+		}
+		if opt.KeyCacheTTL != nil {
+			aeo.KeyCacheTTL = opt.KeyCacheTTL
+		}
+		if opt.KeyCacheMaxSize != nil {
+			aeo.KeyCacheMaxSize = opt.KeyCacheMaxSize
+		}
+		if opt.Monitor != nil {
+			aeo.Monitor = opt.Monitor
+		}
 		if opt.SchemaMap != nil {
 			aeo.SchemaMap = opt.SchemaMap
 		}
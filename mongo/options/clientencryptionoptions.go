@@ -6,10 +6,24 @@
 
 package options
 
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/appveen/mongo-go-driver/event"
+	"github.com/appveen/mongo-go-driver/x/mongo/driver"
+)
+
 // ClientEncryptionOptions represents all possible options used to configure a ClientEncryption instance.
 type ClientEncryptionOptions struct {
-	KeyVaultNamespace string
-	KmsProviders      map[string]map[string]interface{}
+	KeyVaultNamespace  string
+	KmsProviders       map[string]map[string]interface{}
+	CustomKmsProviders map[string]driver.KmsProvider
+	KmsEndpoints       map[string]string
+	TLSConfig          map[string]*tls.Config
+	KeyCacheTTL        *time.Duration
+	KeyCacheMaxSize    *int
+	Monitor            *event.EncryptionMonitor
 }
 
 // ClientEncryption creates a new ClientEncryptionOptions instance.
@@ -29,6 +43,53 @@ func (c *ClientEncryptionOptions) SetKmsProviders(providers map[string]map[strin
 	return c
 }
 
+// SetCustomKmsProviders specifies KMS providers implemented in Go, by provider name. Data keys are created for a
+// custom KMS provider by passing its name to ClientEncryption.CreateDataKey, and the master key given in
+// DataKeyOptions.SetMasterKey is passed to the provider. The names "aws" and "local" are reserved.
+func (c *ClientEncryptionOptions) SetCustomKmsProviders(providers map[string]driver.KmsProvider) *ClientEncryptionOptions {
+	c.CustomKmsProviders = providers
+	return c
+}
+
+// SetKmsEndpoints specifies the "host" or "host:port" to send the requests for a KMS provider to instead of the
+// endpoint chosen by libmongocrypt, by provider name. This can be used to reach a KMS through a proxy or to use a
+// local stand-in for testing.
+func (c *ClientEncryptionOptions) SetKmsEndpoints(endpoints map[string]string) *ClientEncryptionOptions {
+	c.KmsEndpoints = endpoints
+	return c
+}
+
+// SetTLSConfig specifies the TLS configuration used to connect to the KMS of a provider, by provider name. If no
+// configuration is specified for a provider, the system's root certificates are used.
+func (c *ClientEncryptionOptions) SetTLSConfig(tlsConfigs map[string]*tls.Config) *ClientEncryptionOptions {
+	c.TLSConfig = tlsConfigs
+	return c
+}
+
+// SetKeyCacheTTL enables a cache of the data keys retrieved from the key vault collection and specifies how long
+// data keys are cached. Cached data keys are handed to libmongocrypt when its own cache misses, which avoids the key
+// vault query and the KMS round trip: AWS data keys and data keys of custom KMS providers are decrypted with their KMS
+// once when they are cached, and cached wrapped with the local master key, which is generated if no local KMS provider
+// is configured. Data keys changed by this ClientEncryption are removed from its cache, but other changes to data keys
+// in the key vault are not seen until the cached data keys expire. The cache is disabled by default.
+func (c *ClientEncryptionOptions) SetKeyCacheTTL(ttl time.Duration) *ClientEncryptionOptions {
+	c.KeyCacheTTL = &ttl
+	return c
+}
+
+// SetKeyCacheMaxSize specifies the maximum number of data keys in the cache enabled with SetKeyCacheTTL. The least
+// recently used data keys are evicted when the cache is full. The default is 0, which means there is no limit.
+func (c *ClientEncryptionOptions) SetKeyCacheMaxSize(size int) *ClientEncryptionOptions {
+	c.KeyCacheMaxSize = &size
+	return c
+}
+
+// SetMonitor specifies a monitor that receives data key cache hits and misses and KMS round trips.
+func (c *ClientEncryptionOptions) SetMonitor(monitor *event.EncryptionMonitor) *ClientEncryptionOptions {
+	c.Monitor = monitor
+	return c
+}
+
 // MergeClientEncryptionOptions combines the argued ClientEncryptionOptions in a last-one wins fashion.
 func MergeClientEncryptionOptions(opts ...*ClientEncryptionOptions) *ClientEncryptionOptions {
 	ceo := ClientEncryption()
@@ -43,6 +104,24 @@ func MergeClientEncryptionOptions(opts ...*ClientEncryptionOptions) *ClientEncry
 		if opt.KmsProviders != nil {
 			ceo.KmsProviders = opt.KmsProviders
 		}
+		if opt.CustomKmsProviders != nil {
+			ceo.CustomKmsProviders = opt.CustomKmsProviders
+		}
+		if opt.KmsEndpoints != nil {
+			ceo.KmsEndpoints = opt.KmsEndpoints
+		}
+		if opt.TLSConfig != nil {
+			ceo.TLSConfig = opt.TLSConfig
+		}
+		if opt.KeyCacheTTL != nil {
+			ceo.KeyCacheTTL = opt.KeyCacheTTL
+		}
+		if opt.KeyCacheMaxSize != nil {
+			ceo.KeyCacheMaxSize = opt.KeyCacheMaxSize
+		}
+		if opt.Monitor != nil {
+			ceo.Monitor = opt.Monitor
+		}
 	}
 
 	return ceo
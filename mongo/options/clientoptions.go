@@ -26,6 +26,7 @@ import (
 	"github.com/appveen/mongo-go-driver/mongo/writeconcern"
 	"github.com/appveen/mongo-go-driver/tag"
 	"github.com/appveen/mongo-go-driver/x/mongo/driver"
+	"github.com/appveen/mongo-go-driver/x/mongo/driver/auth"
 	"github.com/appveen/mongo-go-driver/x/mongo/driver/connstring"
 )
 
@@ -37,16 +38,24 @@ type ContextDialer interface {
 // Credential holds auth options.
 //
 // AuthMechanism indicates the mechanism to use for authentication.
-// Supported values include "SCRAM-SHA-256", "SCRAM-SHA-1", "MONGODB-CR", "PLAIN", "GSSAPI", and "MONGODB-X509".
+// Supported values include "SCRAM-SHA-256", "SCRAM-SHA-1", "MONGODB-CR", "PLAIN", "GSSAPI", "MONGODB-X509",
+// "MONGODB-AWS", and "MONGODB-OIDC".
+//
+// GSSAPI uses a Kerberos client written in Go that reads the Kerberos configuration (KRB5_CONFIG or /etc/krb5.conf)
+// and authenticates with the password if it is set, or else with the credential cache (KRB5CCNAME) or the client
+// keytab (KRB5_CLIENT_KTNAME). Builds with the gssapi tag use the system's GSSAPI library through cgo instead.
 //
 // AuthMechanismProperties specifies additional configuration options which may be used by certain
 // authentication mechanisms. Supported properties are:
 // SERVICE_NAME: Specifies the name of the service. Defaults to mongodb.
 // CANONICALIZE_HOST_NAME: If true, tells the driver to canonicalize the given hostname. Defaults to false. This
-// property may not be used on Linux and Darwin systems and may not be used at the same time as SERVICE_HOST.
-// SERVICE_REALM: Specifies the realm of the service.
+// property may not be used at the same time as SERVICE_HOST, or on Linux and Darwin systems in builds with the gssapi
+// tag.
+// SERVICE_REALM: Specifies the realm of the service. Defaults to the realm of the host in the Kerberos configuration.
+// SERVICE_REALM may not be used on Linux and Darwin systems in builds with the gssapi tag.
 // SERVICE_HOST: Specifies a hostname for GSSAPI authentication if it is different from the server's address. For
 // authentication mechanisms besides GSSAPI, this property is ignored.
+// AWS_SESSION_TOKEN: Specifies the session token of temporary AWS credentials for MONGODB-AWS.
 //
 // AuthSource specifies the database to authenticate against.
 //
@@ -62,12 +71,38 @@ type Credential struct {
 	Username                string
 	Password                string
 	PasswordSet             bool
+
+	// AWSCredentialProvider provides the AWS credentials for MONGODB-AWS if Username and Password are not set.
+	AWSCredentialProvider auth.AWSCredentialProvider
+
+	// OIDCCallback returns the access tokens for MONGODB-OIDC, which is required for that mechanism. Tokens are cached
+	// and shared by all connections of the client. OIDCRefreshCallback, if set, is called with the refresh token of
+	// a cached access token shortly before it expires.
+	OIDCCallback        auth.OIDCCallback
+	OIDCRefreshCallback auth.OIDCCallback
+}
+
+// CredentialProvider provides the credential used to authenticate connections, for credentials that change during the
+// lifetime of a client such as passwords rotated by a secrets manager. Credential is called every time a new connection
+// authenticates. If the server rejects the returned credential, Credential is called again and, if it returns a
+// different credential, authentication is retried once with it.
+type CredentialProvider interface {
+	Credential(ctx context.Context) (Credential, error)
+}
+
+// CredentialProviderFunc is a function that implements CredentialProvider.
+type CredentialProviderFunc func(ctx context.Context) (Credential, error)
+
+// Credential implements the CredentialProvider interface.
+func (f CredentialProviderFunc) Credential(ctx context.Context) (Credential, error) {
+	return f(ctx)
 }
 
 // ClientOptions represents all possible options to configure a client.
 type ClientOptions struct {
 	AppName                *string
 	Auth                   *Credential
+	CredentialProvider     CredentialProvider
 	ConnectTimeout         *time.Duration
 	Compressors            []string
 	Dialer                 ContextDialer
@@ -300,6 +335,13 @@ func (c *ClientOptions) SetAuth(auth Credential) *ClientOptions {
 	return c
 }
 
+// SetCredentialProvider specifies a provider for the credential used to authenticate connections. It takes precedence
+// over the credential set by SetAuth or ApplyURI.
+func (c *ClientOptions) SetCredentialProvider(provider CredentialProvider) *ClientOptions {
+	c.CredentialProvider = provider
+	return c
+}
+
 // SetCompressors sets the compressors that can be used when communicating with a server.
 func (c *ClientOptions) SetCompressors(comps []string) *ClientOptions {
 	c.Compressors = comps
@@ -482,6 +524,9 @@ func MergeClientOptions(opts ...*ClientOptions) *ClientOptions {
 		if opt.AuthenticateToAnything != nil {
 			c.AuthenticateToAnything = opt.AuthenticateToAnything
 		}
+		if opt.CredentialProvider != nil {
+			c.CredentialProvider = opt.CredentialProvider
+		}
 		if opt.Compressors != nil {
 			c.Compressors = opt.Compressors
 		}
@@ -55,6 +55,7 @@ func TestClientOptions(t *testing.T) {
 			{"AppName", (*ClientOptions).SetAppName, "example-application", "AppName", true},
 			{"Auth", (*ClientOptions).SetAuth, Credential{Username: "foo", Password: "bar"}, "Auth", true},
 			{"Compressors", (*ClientOptions).SetCompressors, []string{"zstd", "snappy", "zlib"}, "Compressors", true},
+			{"CredentialProvider", (*ClientOptions).SetCredentialProvider, testCredentialProvider{Num: 24}, "CredentialProvider", true},
 			{"ConnectTimeout", (*ClientOptions).SetConnectTimeout, 5 * time.Second, "ConnectTimeout", true},
 			{"Dialer", (*ClientOptions).SetDialer, testDialer{Num: 12345}, "Dialer", true},
 			{"HeartbeatInterval", (*ClientOptions).SetHeartbeatInterval, 5 * time.Second, "HeartbeatInterval", true},
@@ -432,6 +433,14 @@ func (testDialer) DialContext(ctx context.Context, network, address string) (net
 	return nil, nil
 }
 
+type testCredentialProvider struct {
+	Num int
+}
+
+func (testCredentialProvider) Credential(context.Context) (Credential, error) {
+	return Credential{}, nil
+}
+
 func compareTLSConfig(cfg1, cfg2 *tls.Config) bool {
 	if cfg1 == nil && cfg2 == nil {
 		return true
@@ -26,6 +26,7 @@ type FindOptions struct {
 	NoCursorTimeout     *bool          // If true, prevents cursors from timing out after an inactivity period.
 	OplogReplay         *bool          // Adds an option for internal use only and should not be set.
 	Projection          interface{}    // Limits the fields returned for all documents.
+	Resumable           *bool          // If true, the cursor transparently re-issues the query after a retryable error.
 	ReturnKey           *bool          // If true, only returns index keys for all result documents.
 	ShowRecordID        *bool          // If true, a $recordId field with the record identifier will be added to the returned documents.
 	Skip                *int64         // Specifies the number of documents to skip before returning
@@ -129,6 +130,15 @@ func (f *FindOptions) SetProjection(projection interface{}) *FindOptions {
 	return f
 }
 
+// SetResumable sets whether the returned cursor resumes iteration after a retryable error, such as a network error
+// during a getMore. When resuming, the query is re-issued with a filter that only matches documents after the last
+// document returned, according to the sort order. An _id key is appended to the sort to make the order total, so the
+// projection must include every sort key and _id. Resumable cannot be used with tailable cursors or with a $meta sort.
+func (f *FindOptions) SetResumable(b bool) *FindOptions {
+	f.Resumable = &b
+	return f
+}
+
 // SetReturnKey adds an option to only return index keys for all result documents.
 func (f *FindOptions) SetReturnKey(b bool) *FindOptions {
 	f.ReturnKey = &b
@@ -210,6 +220,9 @@ func MergeFindOptions(opts ...*FindOptions) *FindOptions {
 		if opt.Projection != nil {
 			fo.Projection = opt.Projection
 		}
+		if opt.Resumable != nil {
+			fo.Resumable = opt.Resumable
+		}
 		if opt.ReturnKey != nil {
 			fo.ReturnKey = opt.ReturnKey
 		}
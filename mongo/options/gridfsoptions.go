@@ -7,6 +7,8 @@
 package options
 
 import (
+	"crypto/sha256"
+	"hash"
 	"time"
 
 	"github.com/appveen/mongo-go-driver/bson"
@@ -25,6 +27,38 @@ var DefaultChunkSize int32 = 255 * 1024 // 255 KiB
 // DefaultRevision is the default revision number for a download by name operation.
 var DefaultRevision int32 = -1
 
+// GridFSHash is a hash algorithm used to compute the digest of a GridFS file's contents. Name is stored in the files
+// collection document next to the digest and is used to find the algorithm again when the file is verified.
+type GridFSHash struct {
+	Name string
+	New  func() hash.Hash
+}
+
+// SHA256Hash returns the GridFSHash for SHA-256. A GridFS bucket always knows this algorithm.
+func SHA256Hash() GridFSHash {
+	return GridFSHash{Name: "sha256", New: sha256.New}
+}
+
+// ChunkTransformer transforms the data of each GridFS chunk before it is stored and reverses the transformation after
+// it is read, e.g. to compress or encrypt files at rest. Name is stored in the files collection document so downloads
+// can find the transformer again; transformers with different behavior must have different names. The chunk being
+// transformed is described to both methods. Transformers must be safe for concurrent use.
+//
+// The length and chunkSize fields of the files collection document describe the untransformed data, so reads and
+// seeks on download streams behave the same with and without a transformer.
+type ChunkTransformer interface {
+	Name() string
+	Transform(chunk ChunkInfo, data []byte) ([]byte, error)
+	Reverse(chunk ChunkInfo, data []byte) ([]byte, error)
+}
+
+// ChunkInfo describes the GridFS chunk passed to a ChunkTransformer.
+type ChunkInfo struct {
+	FileID    []byte // The files_id of the chunk as a BSON value: its type byte followed by its data.
+	N         int32  // The index of the chunk in the file.
+	ChunkSize int32  // The chunk size of the file. Untransformed chunks are never larger.
+}
+
 // BucketOptions represents all possible options to configure a GridFS bucket.
 type BucketOptions struct {
 	Name           *string                    // The bucket name. Defaults to "fs".
@@ -32,6 +66,18 @@ type BucketOptions struct {
 	WriteConcern   *writeconcern.WriteConcern // The write concern for the bucket. Defaults to the write concern of the database.
 	ReadConcern    *readconcern.ReadConcern   // The read concern for the bucket. Defaults to the read concern of the database.
 	ReadPreference *readpref.ReadPref         // The read preference for the bucket. Defaults to the read preference of the database.
+	Hashes         []GridFSHash               // Hash algorithms other than SHA-256 the bucket can verify file digests with.
+	Transformer    ChunkTransformer           // The chunk transformer for uploads that do not specify one. Defaults to none.
+	Transformers   []ChunkTransformer         // Additional chunk transformers the bucket can reverse when downloading.
+
+	// The registry used to decode and encode the metadata of files. Defaults to bson.DefaultRegistry.
+	Registry *bsoncodec.Registry
+
+	// The number of chunk batches an upload stream inserts concurrently. Defaults to 1.
+	UploadConcurrency *int
+	// The number of chunks a download stream fetches concurrently ahead of the reader. Defaults to 0, which reads the
+	// chunks through a single cursor.
+	DownloadPrefetch *int
 }
 
 // GridFSBucket creates a new *BucketOptions
@@ -72,6 +118,52 @@ func (b *BucketOptions) SetReadPreference(rp *readpref.ReadPref) *BucketOptions
 	return b
 }
 
+// SetHashes specifies hash algorithms other than SHA-256 that the bucket uses to verify the digests of downloaded
+// files. Files uploaded with an algorithm the bucket does not know cannot be verified.
+func (b *BucketOptions) SetHashes(hashes ...GridFSHash) *BucketOptions {
+	b.Hashes = hashes
+	return b
+}
+
+// SetTransformer specifies the chunk transformer applied to uploads that do not specify their own. The bucket can
+// also reverse it when downloading.
+func (b *BucketOptions) SetTransformer(t ChunkTransformer) *BucketOptions {
+	b.Transformer = t
+	return b
+}
+
+// SetTransformers specifies additional chunk transformers the bucket can reverse when downloading files, e.g.
+// transformers with retired encryption keys. The gzip transformer is always known.
+func (b *BucketOptions) SetTransformers(transformers ...ChunkTransformer) *BucketOptions {
+	b.Transformers = transformers
+	return b
+}
+
+// SetRegistry specifies the registry used by gridfs.File.DecodeMetadata and gridfs.Bucket.UpdateMetadata. Defaults to
+// bson.DefaultRegistry.
+func (b *BucketOptions) SetRegistry(r *bsoncodec.Registry) *BucketOptions {
+	b.Registry = r
+	return b
+}
+
+// SetUploadConcurrency specifies how many batches of chunks an upload stream inserts concurrently. A batch holds up to
+// gridfs.UploadBufferSize bytes, so an upload stream uses up to n+1 times that much memory. Chunk indexes are
+// assigned in order regardless of the order in which batches complete, and the files collection document is only
+// inserted after every batch succeeded. Sessions are not safe for concurrent use, so chunks written with a context
+// carrying a session, including inside a transaction, are inserted one batch at a time. Defaults to 1.
+func (b *BucketOptions) SetUploadConcurrency(n int) *BucketOptions {
+	b.UploadConcurrency = &n
+	return b
+}
+
+// SetDownloadPrefetch specifies how many chunks a download stream fetches concurrently ahead of the chunk being read.
+// Each chunk is fetched by its own query, and at most n+1 chunks are held in memory. Defaults to 0, which reads the
+// chunks in order through a single cursor.
+func (b *BucketOptions) SetDownloadPrefetch(n int) *BucketOptions {
+	b.DownloadPrefetch = &n
+	return b
+}
+
 // MergeBucketOptions combines the given *BucketOptions into a single *BucketOptions.
 // If the name or chunk size is not set in any of the given *BucketOptions, the resulting *BucketOptions will have
 // name "fs" and chunk size 255KB.
@@ -97,6 +189,24 @@ func MergeBucketOptions(opts ...*BucketOptions) *BucketOptions {
 		if opt.ReadPreference != nil {
 			b.ReadPreference = opt.ReadPreference
 		}
+		if opt.Hashes != nil {
+			b.Hashes = opt.Hashes
+		}
+		if opt.Transformer != nil {
+			b.Transformer = opt.Transformer
+		}
+		if opt.Transformers != nil {
+			b.Transformers = opt.Transformers
+		}
+		if opt.Registry != nil {
+			b.Registry = opt.Registry
+		}
+		if opt.UploadConcurrency != nil {
+			b.UploadConcurrency = opt.UploadConcurrency
+		}
+		if opt.DownloadPrefetch != nil {
+			b.DownloadPrefetch = opt.DownloadPrefetch
+		}
 	}
 
 	return b
@@ -108,6 +218,9 @@ type UploadOptions struct {
 	ChunkSizeBytes *int32              // Chunk size in bytes. Defaults to the chunk size of the bucket.
 	Metadata       interface{}         // User data for the 'metadata' field of the files collection document.
 	Registry       *bsoncodec.Registry // The registry to use for converting filters. Defaults to bson.DefaultRegistry.
+	Hash           *GridFSHash         // The algorithm used to compute the digest of the file. Defaults to no digest.
+	Transformer    ChunkTransformer    // The transformer applied to each chunk. Defaults to the bucket's transformer.
+	Resumable      *bool               // Whether the upload can be resumed after a failure. Defaults to false.
 }
 
 // GridFSUpload creates a new *UploadOptions
@@ -127,6 +240,29 @@ func (u *UploadOptions) SetMetadata(doc interface{}) *UploadOptions {
 	return u
 }
 
+// SetHash specifies the algorithm used to compute the digest of the file's contents while it is uploaded. The digest
+// is stored in the files collection document.
+func (u *UploadOptions) SetHash(h GridFSHash) *UploadOptions {
+	u.Hash = &h
+	return u
+}
+
+// SetTransformer specifies the transformer applied to each chunk of the upload. The bucket used to download the file
+// must know a transformer with the same name.
+func (u *UploadOptions) SetTransformer(t ChunkTransformer) *UploadOptions {
+	u.Transformer = t
+	return u
+}
+
+// SetResumable specifies whether the upload can be resumed with gridfs.Bucket.ResumeUploadStream if it fails. A
+// resumable upload inserts its files collection document, marked as in progress, when the stream is opened, and
+// writes every complete chunk as soon as it has been written to the stream. The document is completed when the
+// stream is closed. Defaults to false.
+func (u *UploadOptions) SetResumable(b bool) *UploadOptions {
+	u.Resumable = &b
+	return u
+}
+
 // MergeUploadOptions combines the given *UploadOptions into a single *UploadOptions.
 // If the chunk size is not set in any of the given *UploadOptions, the resulting *UploadOptions will have chunk size
 // 255KB.
@@ -146,14 +282,57 @@ func MergeUploadOptions(opts ...*UploadOptions) *UploadOptions {
 		if opt.Registry != nil {
 			u.Registry = opt.Registry
 		}
+		if opt.Hash != nil {
+			u.Hash = opt.Hash
+		}
+		if opt.Transformer != nil {
+			u.Transformer = opt.Transformer
+		}
+		if opt.Resumable != nil {
+			u.Resumable = opt.Resumable
+		}
 	}
 
 	return u
 }
 
+// DownloadOptions represents all possible options for a GridFS download by file ID operation.
+type DownloadOptions struct {
+	VerifyHash *bool // Whether the digest stored for the file is verified. Defaults to false.
+}
+
+// GridFSDownload creates a new *DownloadOptions
+func GridFSDownload() *DownloadOptions {
+	return &DownloadOptions{}
+}
+
+// SetVerifyHash specifies whether the digest stored in the files collection document is verified against the
+// downloaded contents. Opening the download fails if the file has no digest. Defaults to false.
+func (d *DownloadOptions) SetVerifyHash(b bool) *DownloadOptions {
+	d.VerifyHash = &b
+	return d
+}
+
+// MergeDownloadOptions combines the given *DownloadOptions into a single *DownloadOptions in a last one wins fashion.
+func MergeDownloadOptions(opts ...*DownloadOptions) *DownloadOptions {
+	d := GridFSDownload()
+
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if opt.VerifyHash != nil {
+			d.VerifyHash = opt.VerifyHash
+		}
+	}
+
+	return d
+}
+
 // NameOptions represents all options that can be used for a GridFS download by name operation.
 type NameOptions struct {
-	Revision *int32 // Which revision (documents with the same filename and different uploadDate). Defaults to -1 (the most recent revision).
+	Revision   *int32 // Which revision (documents with the same filename and different uploadDate). Defaults to -1 (the most recent revision).
+	VerifyHash *bool  // Whether the digest stored for the file is verified. Defaults to false.
 }
 
 // GridFSName creates a new *NameOptions
@@ -174,6 +353,13 @@ func (n *NameOptions) SetRevision(r int32) *NameOptions {
 	return n
 }
 
+// SetVerifyHash specifies whether the digest stored in the files collection document is verified against the
+// downloaded contents. Opening the download fails if the file has no digest. Defaults to false.
+func (n *NameOptions) SetVerifyHash(b bool) *NameOptions {
+	n.VerifyHash = &b
+	return n
+}
+
 // MergeNameOptions combines the given *NameOptions into a single *NameOptions in a last one wins fashion.
 func MergeNameOptions(opts ...*NameOptions) *NameOptions {
 	n := GridFSName()
@@ -186,6 +372,9 @@ func MergeNameOptions(opts ...*NameOptions) *NameOptions {
 		if opt.Revision != nil {
 			n.Revision = opt.Revision
 		}
+		if opt.VerifyHash != nil {
+			n.VerifyHash = opt.VerifyHash
+		}
 	}
 
 	return n
@@ -272,3 +461,70 @@ func MergeGridFSFindOptions(opts ...*GridFSFindOptions) *GridFSFindOptions {
 
 	return fo
 }
+
+// VacuumOptions represents all options for a GridFS vacuum operation.
+type VacuumOptions struct {
+	DryRun           *bool          // Only report what would be deleted. Defaults to false.
+	KeepRevisions    *int32         // The number of most recent revisions kept per filename. Defaults to 0, keeping all.
+	DeleteIncomplete *bool          // Whether files with missing chunks are deleted. Defaults to false.
+	GracePeriod      *time.Duration // The minimum age of orphaned chunks before they are deleted. Defaults to 1 hour.
+}
+
+// GridFSVacuum creates a new *VacuumOptions
+func GridFSVacuum() *VacuumOptions {
+	return &VacuumOptions{}
+}
+
+// SetDryRun specifies whether the vacuum only reports the orphaned chunks, incomplete files and revisions it would
+// delete, without deleting anything. Defaults to false.
+func (v *VacuumOptions) SetDryRun(b bool) *VacuumOptions {
+	v.DryRun = &b
+	return v
+}
+
+// SetKeepRevisions specifies how many revisions of each filename are kept. Revisions are ordered by upload date, as
+// for OpenDownloadStreamByName, and all but the n most recent ones are deleted. If n is 0, all revisions are kept.
+// Defaults to 0.
+func (v *VacuumOptions) SetKeepRevisions(n int32) *VacuumOptions {
+	v.KeepRevisions = &n
+	return v
+}
+
+// SetDeleteIncomplete specifies whether files with missing chunks are deleted. Such files are always reported.
+// Defaults to false.
+func (v *VacuumOptions) SetDeleteIncomplete(b bool) *VacuumOptions {
+	v.DeleteIncomplete = &b
+	return v
+}
+
+// SetGracePeriod specifies how long chunks without a files collection document are left alone, because the chunks
+// of an upload are written before its files collection document. Chunks are only considered orphaned if the newest
+// chunk of their file is older than d, based on the timestamp of its ObjectID. Defaults to 1 hour.
+func (v *VacuumOptions) SetGracePeriod(d time.Duration) *VacuumOptions {
+	v.GracePeriod = &d
+	return v
+}
+
+// MergeVacuumOptions combines the given *VacuumOptions into a single *VacuumOptions in a last-one-wins fashion.
+func MergeVacuumOptions(opts ...*VacuumOptions) *VacuumOptions {
+	v := GridFSVacuum()
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if opt.DryRun != nil {
+			v.DryRun = opt.DryRun
+		}
+		if opt.KeepRevisions != nil {
+			v.KeepRevisions = opt.KeepRevisions
+		}
+		if opt.DeleteIncomplete != nil {
+			v.DeleteIncomplete = opt.DeleteIncomplete
+		}
+		if opt.GracePeriod != nil {
+			v.GracePeriod = opt.GracePeriod
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,51 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package options
+
+// RewrapManyDataKeyOptions represents all possible options used to re-encrypt data keys.
+type RewrapManyDataKeyOptions struct {
+	Provider  *string
+	MasterKey interface{}
+}
+
+// RewrapManyDataKey creates a new RewrapManyDataKeyOptions instance.
+func RewrapManyDataKey() *RewrapManyDataKeyOptions {
+	return &RewrapManyDataKeyOptions{}
+}
+
+// SetProvider specifies the KMS provider used to encrypt the data keys. If it is not specified, each data key is
+// re-encrypted with its current master key.
+func (rmdko *RewrapManyDataKeyOptions) SetProvider(provider string) *RewrapManyDataKeyOptions {
+	rmdko.Provider = &provider
+	return rmdko
+}
+
+// SetMasterKey specifies a KMS-specific key used to encrypt the data keys. It has the format described in
+// DataKeyOptions.SetMasterKey and requires a provider to be specified.
+func (rmdko *RewrapManyDataKeyOptions) SetMasterKey(masterKey interface{}) *RewrapManyDataKeyOptions {
+	rmdko.MasterKey = masterKey
+	return rmdko
+}
+
+// MergeRewrapManyDataKeyOptions combines the argued RewrapManyDataKeyOptions in a last-one wins fashion.
+func MergeRewrapManyDataKeyOptions(opts ...*RewrapManyDataKeyOptions) *RewrapManyDataKeyOptions {
+	rmdko := RewrapManyDataKey()
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+
+		if opt.Provider != nil {
+			rmdko.Provider = opt.Provider
+		}
+		if opt.MasterKey != nil {
+			rmdko.MasterKey = opt.MasterKey
+		}
+	}
+
+	return rmdko
+}
@@ -0,0 +1,72 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package options
+
+// DefaultSubscriberBufferSize is the number of events buffered for a change stream subscriber if no buffer size is
+// specified.
+const DefaultSubscriberBufferSize = 128
+
+// BackpressurePolicy specifies what a change stream dispatcher does when a subscriber's buffer is full.
+type BackpressurePolicy uint8
+
+// These constants are the valid values for BackpressurePolicy.
+const (
+	// BackpressureBlock blocks the dispatcher until the subscriber has room for the event. A slow subscriber with this
+	// policy slows down every other subscriber of the dispatcher.
+	BackpressureBlock BackpressurePolicy = iota
+	// BackpressureDropNewest discards the event that does not fit into the subscriber's buffer.
+	BackpressureDropNewest
+	// BackpressureDropOldest discards the oldest buffered event to make room for the new one.
+	BackpressureDropOldest
+	// BackpressureDisconnect closes the subscription. The subscription's Err method returns an error describing that
+	// the subscriber fell behind.
+	BackpressureDisconnect
+)
+
+// SubscriberOptions represents all possible options for subscribing to a change stream dispatcher.
+type SubscriberOptions struct {
+	BufferSize   *int                // The maximum number of events buffered for the subscriber.
+	Backpressure *BackpressurePolicy // What to do when the subscriber's buffer is full.
+}
+
+// Subscriber returns a pointer to a new SubscriberOptions.
+func Subscriber() *SubscriberOptions {
+	return &SubscriberOptions{}
+}
+
+// SetBufferSize specifies the maximum number of events buffered for the subscriber. The default is
+// DefaultSubscriberBufferSize.
+func (so *SubscriberOptions) SetBufferSize(i int) *SubscriberOptions {
+	so.BufferSize = &i
+	return so
+}
+
+// SetBackpressure specifies what the dispatcher does when the subscriber's buffer is full. The default is
+// BackpressureBlock.
+func (so *SubscriberOptions) SetBackpressure(bp BackpressurePolicy) *SubscriberOptions {
+	so.Backpressure = &bp
+	return so
+}
+
+// MergeSubscriberOptions combines the given *SubscriberOptions into a single *SubscriberOptions in a last one wins
+// fashion.
+func MergeSubscriberOptions(opts ...*SubscriberOptions) *SubscriberOptions {
+	so := Subscriber()
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if opt.BufferSize != nil {
+			so.BufferSize = opt.BufferSize
+		}
+		if opt.Backpressure != nil {
+			so.Backpressure = opt.Backpressure
+		}
+	}
+
+	return so
+}
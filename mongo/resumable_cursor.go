@@ -0,0 +1,220 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/appveen/mongo-go-driver/x/bsonx/bsoncore"
+	"github.com/appveen/mongo-go-driver/x/mongo/driver"
+)
+
+// reissueFindFn re-runs a find with the given filter and limit and returns the batch cursor for the new query. A nil
+// filter re-runs the original query and a limit of zero means no limit.
+type reissueFindFn func(ctx context.Context, filter bsoncore.Document, limit int64) (batchCursor, error)
+
+// resumableBatchCursor wraps the batch cursor of a sorted find. When fetching a batch fails with a retryable error,
+// it re-issues the query with a filter that only matches documents after the last document returned, so iteration
+// continues where it left off.
+type resumableBatchCursor struct {
+	batchCursor
+
+	filter   bsoncore.Document
+	sort     bsoncore.Document
+	limit    int64
+	returned int64
+	last     bsoncore.Document
+	reissue  reissueFindFn
+	err      error
+}
+
+func newResumableBatchCursor(bc batchCursor, filter, sort bsoncore.Document, limit int64,
+	reissue reissueFindFn) *resumableBatchCursor {
+
+	return &resumableBatchCursor{
+		batchCursor: bc,
+		filter:      filter,
+		sort:        sort,
+		limit:       limit,
+		reissue:     reissue,
+	}
+}
+
+// Next returns true if there is a batch available, resuming the query once if the underlying batch cursor fails with
+// a retryable error.
+func (rbc *resumableBatchCursor) Next(ctx context.Context) bool {
+	if rbc.err != nil {
+		return false
+	}
+	if rbc.batchCursor.Next(ctx) {
+		rbc.err = rbc.recordBatch()
+		return rbc.err == nil
+	}
+
+	if !isResumableFindError(rbc.batchCursor.Err()) {
+		return false
+	}
+	if rbc.limit > 0 && rbc.returned >= rbc.limit {
+		return false
+	}
+
+	// ignore the error from closing the old cursor because its server may no longer be reachable
+	_ = rbc.batchCursor.Close(ctx)
+	if rbc.err = rbc.resume(ctx); rbc.err != nil {
+		return false
+	}
+	if !rbc.batchCursor.Next(ctx) {
+		return false
+	}
+	rbc.err = rbc.recordBatch()
+	return rbc.err == nil
+}
+
+// Err returns the last error encountered.
+func (rbc *resumableBatchCursor) Err() error {
+	if rbc.err != nil {
+		return rbc.err
+	}
+	return rbc.batchCursor.Err()
+}
+
+func (rbc *resumableBatchCursor) resume(ctx context.Context) error {
+	var filter bsoncore.Document
+	if rbc.last != nil {
+		var err error
+		if filter, err = resumeFindFilter(rbc.filter, rbc.sort, rbc.last); err != nil {
+			return err
+		}
+	}
+
+	var limit int64
+	if rbc.limit > 0 {
+		limit = rbc.limit - rbc.returned
+	}
+
+	bc, err := rbc.reissue(ctx, filter, limit)
+	if err != nil {
+		return err
+	}
+	rbc.batchCursor = bc
+	return nil
+}
+
+// recordBatch counts the documents in the current batch and keeps a copy of the last one as the resume point.
+func (rbc *resumableBatchCursor) recordBatch() error {
+	docs, err := rbc.batchCursor.Batch().Documents()
+	if err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+
+	rbc.returned += int64(len(docs))
+	last := docs[len(docs)-1]
+	rbc.last = append(rbc.last[:0], last...)
+	return nil
+}
+
+// isResumableFindError returns true if a resumable find cursor should re-issue its query after err.
+func isResumableFindError(err error) bool {
+	switch e := err.(type) {
+	case driver.Error:
+		return e.Retryable()
+	case CommandError:
+		return driver.Error{Code: e.Code, Message: e.Message, Labels: e.Labels}.Retryable()
+	}
+	return false
+}
+
+// resumableFindSort validates a sort document for a resumable find and returns it with an ascending _id key appended
+// if the sort does not already include _id, so documents have a total order. A nil sort results in {_id: 1}.
+func resumableFindSort(sort bsoncore.Document) (bsoncore.Document, error) {
+	idx, doc := bsoncore.AppendDocumentStart(nil)
+	var hasID bool
+	if sort != nil {
+		elems, err := sort.Elements()
+		if err != nil {
+			return nil, err
+		}
+		for _, elem := range elems {
+			if !elem.Value().IsNumber() {
+				return nil, fmt.Errorf("resumable find requires numeric sort directions, but key %q has type %s",
+					elem.Key(), elem.Value().Type)
+			}
+			if elem.Key() == "_id" {
+				hasID = true
+			}
+			doc = append(doc, elem...)
+		}
+	}
+	if !hasID {
+		doc = bsoncore.AppendInt32Element(doc, "_id", 1)
+	}
+	return bsoncore.AppendDocumentEnd(doc, idx)
+}
+
+// resumeFindFilter returns a filter that matches the documents of filter that sort after last according to sort.
+// For a sort of {a: 1, b: -1} the resulting filter is
+// {$and: [filter, {$or: [{a: {$gt: last.a}}, {a: last.a, b: {$lt: last.b}}]}]}.
+func resumeFindFilter(filter, sort, last bsoncore.Document) (bsoncore.Document, error) {
+	elems, err := sort.Elements()
+	if err != nil {
+		return nil, err
+	}
+
+	vals := make([]bsoncore.Value, 0, len(elems))
+	for _, elem := range elems {
+		val, err := last.LookupErr(strings.Split(elem.Key(), ".")...)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resume find: last document is missing sort key %q", elem.Key())
+		}
+		vals = append(vals, val)
+	}
+
+	orIdx, orArr := bsoncore.AppendArrayStart(nil)
+	for i, elem := range elems {
+		op := "$gt"
+		if elem.Value().AsInt64() < 0 {
+			op = "$lt"
+		}
+
+		var clauseIdx int32
+		clauseIdx, orArr = bsoncore.AppendDocumentElementStart(orArr, strconv.Itoa(i))
+		for j := 0; j < i; j++ {
+			orArr = bsoncore.AppendValueElement(orArr, elems[j].Key(), vals[j])
+		}
+		var cmpIdx int32
+		cmpIdx, orArr = bsoncore.AppendDocumentElementStart(orArr, elem.Key())
+		orArr = bsoncore.AppendValueElement(orArr, op, vals[i])
+		if orArr, err = bsoncore.AppendDocumentEnd(orArr, cmpIdx); err != nil {
+			return nil, err
+		}
+		if orArr, err = bsoncore.AppendDocumentEnd(orArr, clauseIdx); err != nil {
+			return nil, err
+		}
+	}
+	if orArr, err = bsoncore.AppendArrayEnd(orArr, orIdx); err != nil {
+		return nil, err
+	}
+
+	if len(filter) <= 5 {
+		return bsoncore.BuildDocumentFromElements(nil, bsoncore.AppendArrayElement(nil, "$or", orArr)), nil
+	}
+
+	andIdx, andArr := bsoncore.AppendArrayStart(nil)
+	andArr = bsoncore.AppendDocumentElement(andArr, "0", filter)
+	andArr = bsoncore.AppendDocumentElement(andArr, "1",
+		bsoncore.BuildDocumentFromElements(nil, bsoncore.AppendArrayElement(nil, "$or", orArr)))
+	if andArr, err = bsoncore.AppendArrayEnd(andArr, andIdx); err != nil {
+		return nil, err
+	}
+	return bsoncore.BuildDocumentFromElements(nil, bsoncore.AppendArrayElement(nil, "$and", andArr)), nil
+}
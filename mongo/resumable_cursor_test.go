@@ -0,0 +1,174 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/appveen/mongo-go-driver/bson"
+	"github.com/appveen/mongo-go-driver/internal/testutil/assert"
+	"github.com/appveen/mongo-go-driver/x/bsonx/bsoncore"
+	"github.com/appveen/mongo-go-driver/x/mongo/driver"
+)
+
+// failingBatchCursor returns the batches of a testBatchCursor and then fails with err instead of reporting exhaustion.
+type failingBatchCursor struct {
+	*testBatchCursor
+	err    error
+	failed bool
+}
+
+func (fbc *failingBatchCursor) ID() int64 { return 10 }
+
+func (fbc *failingBatchCursor) Next(ctx context.Context) bool {
+	if fbc.testBatchCursor.Next(ctx) {
+		return true
+	}
+	fbc.failed = true
+	return false
+}
+
+func (fbc *failingBatchCursor) Err() error {
+	if fbc.failed {
+		return fbc.err
+	}
+	return nil
+}
+
+func TestResumableFindSort(t *testing.T) {
+	testCases := []struct {
+		name     string
+		sort     bsoncore.Document
+		expected bsoncore.Document
+	}{
+		{"nil sort", nil, bsoncore.BuildDocumentFromElements(nil, bsoncore.AppendInt32Element(nil, "_id", 1))},
+		{
+			"appends _id",
+			bsoncore.BuildDocumentFromElements(nil, bsoncore.AppendInt32Element(nil, "a", -1)),
+			bsoncore.BuildDocumentFromElements(nil,
+				bsoncore.AppendInt32Element(nil, "a", -1),
+				bsoncore.AppendInt32Element(nil, "_id", 1),
+			),
+		},
+		{
+			"keeps existing _id",
+			bsoncore.BuildDocumentFromElements(nil, bsoncore.AppendInt64Element(nil, "_id", -1)),
+			bsoncore.BuildDocumentFromElements(nil, bsoncore.AppendInt64Element(nil, "_id", -1)),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := resumableFindSort(tc.sort)
+			assert.Nil(t, err, "resumableFindSort error: %v", err)
+			assert.Equal(t, tc.expected, got, "expected sort %v, got %v", tc.expected, got)
+		})
+	}
+	t.Run("rejects $meta sort", func(t *testing.T) {
+		meta := bsoncore.BuildDocumentFromElements(nil, bsoncore.AppendStringElement(nil, "$meta", "textScore"))
+		sort := bsoncore.BuildDocumentFromElements(nil, bsoncore.AppendDocumentElement(nil, "score", meta))
+		_, err := resumableFindSort(sort)
+		assert.NotNil(t, err, "expected error, got nil")
+	})
+}
+
+func TestResumeFindFilter(t *testing.T) {
+	sort := bsoncore.BuildDocumentFromElements(nil,
+		bsoncore.AppendInt32Element(nil, "a", 1),
+		bsoncore.AppendInt32Element(nil, "_id", -1),
+	)
+	last := bsoncore.BuildDocumentFromElements(nil,
+		bsoncore.AppendInt32Element(nil, "_id", 7),
+		bsoncore.AppendStringElement(nil, "a", "x"),
+	)
+	or := bson.A{
+		bson.D{{"a", bson.D{{"$gt", "x"}}}},
+		bson.D{{"a", "x"}, {"_id", bson.D{{"$lt", int32(7)}}}},
+	}
+
+	t.Run("empty filter", func(t *testing.T) {
+		filter := bsoncore.BuildDocumentFromElements(nil)
+		got, err := resumeFindFilter(filter, sort, last)
+		assert.Nil(t, err, "resumeFindFilter error: %v", err)
+
+		expected, _ := bson.Marshal(bson.D{{"$or", or}})
+		assert.Equal(t, bson.Raw(expected), bson.Raw(got), "expected filter %v, got %v", bson.Raw(expected), bson.Raw(got))
+	})
+	t.Run("combines with filter", func(t *testing.T) {
+		filter := bsoncore.BuildDocumentFromElements(nil, bsoncore.AppendBooleanElement(nil, "b", true))
+		got, err := resumeFindFilter(filter, sort, last)
+		assert.Nil(t, err, "resumeFindFilter error: %v", err)
+
+		expected, _ := bson.Marshal(bson.D{{"$and", bson.A{bson.D{{"b", true}}, bson.D{{"$or", or}}}}})
+		assert.Equal(t, bson.Raw(expected), bson.Raw(got), "expected filter %v, got %v", bson.Raw(expected), bson.Raw(got))
+	})
+	t.Run("missing sort key", func(t *testing.T) {
+		missing := bsoncore.BuildDocumentFromElements(nil, bsoncore.AppendInt32Element(nil, "_id", 7))
+		_, err := resumeFindFilter(nil, sort, missing)
+		assert.NotNil(t, err, "expected error, got nil")
+	})
+}
+
+func TestResumableBatchCursor(t *testing.T) {
+	sort := bsoncore.BuildDocumentFromElements(nil, bsoncore.AppendInt32Element(nil, "foo", 1))
+	networkErr := driver.Error{Message: "connection reset", Labels: []string{driver.NetworkError}}
+
+	t.Run("resumes after retryable error", func(t *testing.T) {
+		first := &failingBatchCursor{testBatchCursor: newTestBatchCursor(2, 3), err: networkErr}
+		var gotFilter bsoncore.Document
+		var gotLimit int64
+		reissue := func(_ context.Context, filter bsoncore.Document, limit int64) (batchCursor, error) {
+			gotFilter, gotLimit = filter, limit
+			return newTestBatchCursor(1, 2), nil
+		}
+
+		cursor, err := newCursor(newResumableBatchCursor(first, nil, sort, 10, reissue), nil)
+		assert.Nil(t, err, "newCursor error: %v", err)
+
+		var docs []bson.D
+		err = cursor.All(context.Background(), &docs)
+		assert.Nil(t, err, "All error: %v", err)
+		assert.Equal(t, 8, len(docs), "expected 8 documents, got %v", len(docs))
+		assert.Equal(t, int64(4), gotLimit, "expected remaining limit 4, got %v", gotLimit)
+
+		expected, _ := bson.Marshal(bson.D{{"$or", bson.A{bson.D{{"foo", bson.D{{"$gt", int32(5)}}}}}}})
+		assert.Equal(t, bson.Raw(expected), bson.Raw(gotFilter), "expected filter %v, got %v",
+			bson.Raw(expected), bson.Raw(gotFilter))
+	})
+	t.Run("does not resume after non-retryable error", func(t *testing.T) {
+		first := &failingBatchCursor{testBatchCursor: newTestBatchCursor(1, 3), err: errors.New("boom")}
+		reissue := func(context.Context, bsoncore.Document, int64) (batchCursor, error) {
+			t.Fatal("unexpected reissue")
+			return nil, nil
+		}
+
+		cursor, err := newCursor(newResumableBatchCursor(first, nil, sort, 0, reissue), nil)
+		assert.Nil(t, err, "newCursor error: %v", err)
+
+		var count int
+		for cursor.Next(context.Background()) {
+			count++
+		}
+		assert.Equal(t, 3, count, "expected 3 documents, got %v", count)
+		assert.Equal(t, first.err, cursor.Err(), "expected error %v, got %v", first.err, cursor.Err())
+	})
+	t.Run("reissues original query if nothing was returned", func(t *testing.T) {
+		first := &failingBatchCursor{testBatchCursor: newTestBatchCursor(0, 0), err: networkErr}
+		var called bool
+		reissue := func(_ context.Context, filter bsoncore.Document, _ int64) (batchCursor, error) {
+			called = true
+			assert.Nil(t, filter, "expected nil filter, got %v", filter)
+			return newTestBatchCursor(1, 1), nil
+		}
+
+		cursor, err := newCursor(newResumableBatchCursor(first, nil, sort, 0, reissue), nil)
+		assert.Nil(t, err, "newCursor error: %v", err)
+		assert.True(t, cursor.Next(context.Background()), "expected a document after resuming")
+		assert.True(t, called, "expected query to be reissued")
+	})
+}
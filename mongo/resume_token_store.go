@@ -0,0 +1,230 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/appveen/mongo-go-driver/bson"
+	"github.com/appveen/mongo-go-driver/mongo/options"
+)
+
+// ResumeTokenStore persists change stream resume tokens so a change stream can be resumed by a later process.
+// Implementations must be safe for concurrent use.
+type ResumeTokenStore interface {
+	// LoadResumeToken returns the resume token stored under key. If no token is stored, it returns a nil token and a
+	// nil error.
+	LoadResumeToken(ctx context.Context, key string) (bson.Raw, error)
+
+	// SaveResumeToken stores token under key, replacing any previously stored token.
+	SaveResumeToken(ctx context.Context, key string, token bson.Raw) error
+}
+
+// MemoryResumeTokenStore is a ResumeTokenStore that keeps tokens in memory. It is useful for tests and for resuming
+// change streams that are restarted within the same process.
+type MemoryResumeTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]bson.Raw
+}
+
+// NewMemoryResumeTokenStore creates an empty MemoryResumeTokenStore.
+func NewMemoryResumeTokenStore() *MemoryResumeTokenStore {
+	return &MemoryResumeTokenStore{
+		tokens: make(map[string]bson.Raw),
+	}
+}
+
+// LoadResumeToken implements the ResumeTokenStore interface.
+func (m *MemoryResumeTokenStore) LoadResumeToken(_ context.Context, key string) (bson.Raw, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.tokens[key], nil
+}
+
+// SaveResumeToken implements the ResumeTokenStore interface.
+func (m *MemoryResumeTokenStore) SaveResumeToken(_ context.Context, key string, token bson.Raw) error {
+	cp := make(bson.Raw, len(token))
+	copy(cp, token)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.tokens[key] = cp
+	return nil
+}
+
+// CollectionResumeTokenStore is a ResumeTokenStore that keeps tokens in a MongoDB collection. Each token is stored in
+// a document of the form {_id: <key>, resumeToken: <token>, updatedAt: <date>}.
+type CollectionResumeTokenStore struct {
+	coll *Collection
+}
+
+// NewCollectionResumeTokenStore creates a CollectionResumeTokenStore that stores tokens in coll. The collection should
+// use a write concern that is durable enough for the application, because a lost checkpoint causes events to be
+// replayed.
+func NewCollectionResumeTokenStore(coll *Collection) *CollectionResumeTokenStore {
+	return &CollectionResumeTokenStore{coll: coll}
+}
+
+type storedResumeToken struct {
+	Key         string    `bson:"_id"`
+	ResumeToken bson.Raw  `bson:"resumeToken"`
+	UpdatedAt   time.Time `bson:"updatedAt"`
+}
+
+// LoadResumeToken implements the ResumeTokenStore interface.
+func (c *CollectionResumeTokenStore) LoadResumeToken(ctx context.Context, key string) (bson.Raw, error) {
+	var stored storedResumeToken
+	err := c.coll.FindOne(ctx, bson.D{{Key: "_id", Value: key}}).Decode(&stored)
+	if err == ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stored.ResumeToken, nil
+}
+
+// SaveResumeToken implements the ResumeTokenStore interface.
+func (c *CollectionResumeTokenStore) SaveResumeToken(ctx context.Context, key string, token bson.Raw) error {
+	stored := storedResumeToken{
+		Key:         key,
+		ResumeToken: token,
+		UpdatedAt:   time.Now(),
+	}
+	_, err := c.coll.ReplaceOne(ctx, bson.D{{Key: "_id", Value: key}}, stored, options.Replace().SetUpsert(true))
+	return err
+}
+
+// ChangeStreamCheckpoint configures how a change stream created by WatchWithCheckpoint saves its resume token.
+type ChangeStreamCheckpoint struct {
+	// Store is the store the resume token is saved to and loaded from. It must not be nil.
+	Store ResumeTokenStore
+	// Key identifies the change stream in the store, e.g. the name of the consumer.
+	Key string
+	// Events is the number of processed events after which the resume token is saved. If both Events and Interval
+	// are zero, the token is saved after every event.
+	Events int
+	// Interval is the minimum time between saves. When it elapses, the token is saved at the next call to Next even
+	// if fewer than Events events were processed.
+	Interval time.Duration
+	// UseStartAfter makes the change stream resume from a stored token with the StartAfter option instead of
+	// ResumeAfter. StartAfter requires server version 4.2 or later and can resume after an invalidate event.
+	UseStartAfter bool
+}
+
+// Watcher is implemented by the types that can open a change stream: *Client, *Database and *Collection.
+type Watcher interface {
+	Watch(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (*ChangeStream, error)
+}
+
+// WatchWithCheckpoint opens a change stream on w that saves its resume token to checkpoint.Store and resumes from the
+// token stored under checkpoint.Key, if there is one. A stored token is only used if none of the ResumeAfter,
+// StartAfter or StartAtOperationTime options are set in opts.
+//
+// An event is considered processed once Next is called again or the change stream is closed, so the saved token
+// always belongs to an event the application has finished with. Close saves the token of the last processed event
+// regardless of Events and Interval. An error returned by the store stops the change stream and is returned by Err.
+func WatchWithCheckpoint(ctx context.Context, w Watcher, checkpoint ChangeStreamCheckpoint, pipeline interface{},
+	opts ...*options.ChangeStreamOptions) (*ChangeStream, error) {
+
+	if checkpoint.Store == nil {
+		return nil, errors.New("checkpoint store must not be nil")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	csOpts := options.MergeChangeStreamOptions(opts...)
+	if csOpts.ResumeAfter == nil && csOpts.StartAfter == nil && csOpts.StartAtOperationTime == nil {
+		token, err := checkpoint.Store.LoadResumeToken(ctx, checkpoint.Key)
+		if err != nil {
+			return nil, fmt.Errorf("error loading resume token: %v", err)
+		}
+		if token != nil {
+			if checkpoint.UseStartAfter {
+				csOpts.SetStartAfter(token)
+			} else {
+				csOpts.SetResumeAfter(token)
+			}
+		}
+	}
+
+	cs, err := w.Watch(ctx, pipeline, csOpts)
+	if err != nil {
+		return nil, err
+	}
+	cs.checkpointer = &resumeTokenCheckpointer{
+		ChangeStreamCheckpoint: checkpoint,
+		lastSave:               time.Now(),
+	}
+	return cs, nil
+}
+
+// resumeTokenCheckpointer tracks processed events for a change stream and saves its resume token when the
+// checkpoint is due.
+type resumeTokenCheckpointer struct {
+	ChangeStreamCheckpoint
+
+	returned bool // true if an event was returned by Next and has not been counted as processed yet
+	pending  int
+	lastSave time.Time
+}
+
+// next is called at the start of ChangeStream.Next. It counts the previously returned event as processed and saves
+// token, the resume token of that event, if the checkpoint is due.
+func (rtc *resumeTokenCheckpointer) next(ctx context.Context, token bson.Raw) error {
+	if !rtc.returned {
+		return nil
+	}
+	rtc.returned = false
+	rtc.pending++
+	if !rtc.due() {
+		return nil
+	}
+	return rtc.save(ctx, token)
+}
+
+func (rtc *resumeTokenCheckpointer) due() bool {
+	if rtc.Events == 0 && rtc.Interval == 0 {
+		return true
+	}
+	if rtc.Events > 0 && rtc.pending >= rtc.Events {
+		return true
+	}
+	return rtc.Interval > 0 && time.Since(rtc.lastSave) >= rtc.Interval
+}
+
+// flush is called when the change stream is closed. It counts the previously returned event as processed and saves
+// token if any processed events have not been saved yet.
+func (rtc *resumeTokenCheckpointer) flush(ctx context.Context, token bson.Raw) error {
+	if rtc.returned {
+		rtc.returned = false
+		rtc.pending++
+	}
+	if rtc.pending == 0 {
+		return nil
+	}
+	return rtc.save(ctx, token)
+}
+
+func (rtc *resumeTokenCheckpointer) save(ctx context.Context, token bson.Raw) error {
+	if token == nil {
+		return nil
+	}
+	if err := rtc.Store.SaveResumeToken(ctx, rtc.Key, token); err != nil {
+		return fmt.Errorf("error saving resume token: %v", err)
+	}
+	rtc.pending = 0
+	rtc.lastSave = time.Now()
+	return nil
+}
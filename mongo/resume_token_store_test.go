@@ -0,0 +1,122 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/appveen/mongo-go-driver/bson"
+	"github.com/appveen/mongo-go-driver/internal/testutil/assert"
+	"github.com/appveen/mongo-go-driver/x/bsonx/bsoncore"
+)
+
+// testChangeStreamCursor is a changeStreamCursor that has no further batches and reports errExhausted, so iteration
+// stops once the change stream's current batch is consumed.
+type testChangeStreamCursor struct {
+	*testBatchCursor
+}
+
+var errExhausted = CommandError{Code: errorCursorKilled, Message: "exhausted"}
+
+func (tcsc *testChangeStreamCursor) Err() error { return errExhausted }
+
+func (tcsc *testChangeStreamCursor) PostBatchResumeToken() bsoncore.Document { return nil }
+
+func (tcsc *testChangeStreamCursor) KillCursor(context.Context) error { return nil }
+
+type failingResumeTokenStore struct {
+	err error
+}
+
+func (f failingResumeTokenStore) LoadResumeToken(context.Context, string) (bson.Raw, error) {
+	return nil, nil
+}
+
+func (f failingResumeTokenStore) SaveResumeToken(context.Context, string, bson.Raw) error {
+	return f.err
+}
+
+func changeEventToken(i int) bson.Raw {
+	return bson.Raw(bsoncore.BuildDocumentFromElements(nil, bsoncore.AppendInt32Element(nil, "_data", int32(i))))
+}
+
+// newCheckpointedTestStream returns a ChangeStream over numEvents change events that checkpoints to cp.
+func newCheckpointedTestStream(numEvents int, cp ChangeStreamCheckpoint) *ChangeStream {
+	batch := make([]bsoncore.Document, 0, numEvents)
+	for i := 0; i < numEvents; i++ {
+		batch = append(batch, bsoncore.BuildDocumentFromElements(nil,
+			bsoncore.AppendDocumentElement(nil, "_id", changeEventToken(i)),
+			bsoncore.AppendStringElement(nil, "operationType", "insert"),
+		))
+	}
+	return &ChangeStream{
+		cursor:       &testChangeStreamCursor{newTestBatchCursor(0, 0)},
+		batch:        batch,
+		registry:     bson.DefaultRegistry,
+		checkpointer: &resumeTokenCheckpointer{ChangeStreamCheckpoint: cp, lastSave: time.Now()},
+	}
+}
+
+func TestMemoryResumeTokenStore(t *testing.T) {
+	store := NewMemoryResumeTokenStore()
+	token, err := store.LoadResumeToken(bgCtx, "key")
+	assert.Nil(t, err, "LoadResumeToken error: %v", err)
+	assert.Nil(t, token, "expected nil token, got %v", token)
+
+	saved := changeEventToken(1)
+	err = store.SaveResumeToken(bgCtx, "key", saved)
+	assert.Nil(t, err, "SaveResumeToken error: %v", err)
+	saved[len(saved)-2] = 0xFF // the store must keep its own copy
+
+	token, err = store.LoadResumeToken(bgCtx, "key")
+	assert.Nil(t, err, "LoadResumeToken error: %v", err)
+	assert.Equal(t, changeEventToken(1), token, "expected token %v, got %v", changeEventToken(1), token)
+}
+
+func TestChangeStreamCheckpoint(t *testing.T) {
+	t.Run("saves after every N processed events", func(t *testing.T) {
+		store := NewMemoryResumeTokenStore()
+		cs := newCheckpointedTestStream(5, ChangeStreamCheckpoint{Store: store, Key: "key", Events: 2})
+
+		var saved []bson.Raw
+		for cs.Next(bgCtx) {
+			token, _ := store.LoadResumeToken(bgCtx, "key")
+			saved = append(saved, token)
+		}
+		assert.Equal(t, errExhausted, cs.Err(), "expected error %v, got %v", errExhausted, cs.Err())
+		// the token of an event is only saved once Next is called again
+		expected := []bson.Raw{nil, nil, changeEventToken(1), changeEventToken(1), changeEventToken(3)}
+		assert.Equal(t, expected, saved, "expected saved tokens %v, got %v", expected, saved)
+	})
+	t.Run("close saves last processed event", func(t *testing.T) {
+		store := NewMemoryResumeTokenStore()
+		cs := newCheckpointedTestStream(3, ChangeStreamCheckpoint{Store: store, Key: "key", Events: 10})
+
+		assert.True(t, cs.Next(bgCtx), "expected an event")
+		assert.True(t, cs.Next(bgCtx), "expected an event")
+		err := cs.Close(bgCtx)
+		assert.Nil(t, err, "Close error: %v", err)
+
+		token, _ := store.LoadResumeToken(bgCtx, "key")
+		assert.Equal(t, changeEventToken(1), token, "expected token %v, got %v", changeEventToken(1), token)
+	})
+	t.Run("store errors stop the stream", func(t *testing.T) {
+		storeErr := errors.New("store unavailable")
+		cs := newCheckpointedTestStream(3, ChangeStreamCheckpoint{Store: failingResumeTokenStore{storeErr}})
+
+		assert.True(t, cs.Next(bgCtx), "expected an event")
+		assert.False(t, cs.Next(bgCtx), "expected Next to fail")
+		assert.NotNil(t, cs.Err(), "expected error, got nil")
+	})
+	t.Run("WatchWithCheckpoint requires a store", func(t *testing.T) {
+		_, err := WatchWithCheckpoint(bgCtx, nil, ChangeStreamCheckpoint{}, []bson.D{})
+		assert.NotNil(t, err, "expected error, got nil")
+	})
+}
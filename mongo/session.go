@@ -290,6 +290,16 @@ func sessionFromContext(ctx context.Context) *session.Client {
 	return nil
 }
 
+// SessionFromContext returns the Session stored in ctx by UseSession, UseSessionWithOptions or WithTransaction, or
+// nil if ctx does not carry a session.
+func SessionFromContext(ctx context.Context) Session {
+	if sess, ok := ctx.Value(sessionKey{}).(Session); ok {
+		return sess
+	}
+
+	return nil
+}
+
 func contextWithSession(ctx context.Context, sess Session) SessionContext {
 	return &sessionContext{
 		Context: context.WithValue(ctx, sessionKey{}, sess),
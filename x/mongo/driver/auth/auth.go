@@ -10,6 +10,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/appveen/mongo-go-driver/x/bsonx/bsoncore"
 	"github.com/appveen/mongo-go-driver/x/mongo/driver"
 	"github.com/appveen/mongo-go-driver/x/mongo/driver/address"
 	"github.com/appveen/mongo-go-driver/x/mongo/driver/description"
@@ -29,6 +30,8 @@ func init() {
 	RegisterAuthenticatorFactory(PLAIN, newPlainAuthenticator)
 	RegisterAuthenticatorFactory(GSSAPI, newGSSAPIAuthenticator)
 	RegisterAuthenticatorFactory(MongoDBX509, newMongoDBX509Authenticator)
+	RegisterAuthenticatorFactory(MongoDBAWS, newMongoDBAWSAuthenticator)
+	RegisterAuthenticatorFactory(MongoDBOIDC, newOIDCAuthenticator)
 }
 
 // CreateAuthenticator creates an authenticator.
@@ -48,48 +51,142 @@ func RegisterAuthenticatorFactory(name string, factory AuthenticatorFactory) {
 // HandshakeOptions packages options that can be passed to the Handshaker()
 // function.  DBUser is optional but must be of the form <dbname.username>;
 // if non-empty, then the connection will do SASL mechanism negotiation.
+//
+// If Credentials is set, it provides the authenticator for each connection instead of Authenticator, and DBUser is
+// derived from the provided credential when it uses the default mechanism.
 type HandshakeOptions struct {
 	AppName               string
 	Authenticator         Authenticator
+	Credentials           *ProvidedCredentials
 	Compressors           []string
 	DBUser                string
 	PerformAuthentication func(description.Server) bool
 }
 
-// Handshaker creates a connection handshaker for the given authenticator.
+// Handshaker creates a connection handshaker for the given authenticator. The handshaker implements
+// driver.AuthHandshaker, so connections can authenticate again when the server requires it.
 func Handshaker(h driver.Handshaker, options *HandshakeOptions) driver.Handshaker {
-	return driver.HandshakerFunc(func(ctx context.Context, addr address.Address, conn driver.Connection) (description.Server, error) {
-		desc, err := operation.NewIsMaster().
-			AppName(options.AppName).
-			Compressors(options.Compressors).
-			SASLSupportedMechs(options.DBUser).
-			Handshake(ctx, addr, conn)
+	return &authHandshaker{wrapped: h, options: options}
+}
+
+type authHandshaker struct {
+	wrapped driver.Handshaker
+	options *HandshakeOptions
+}
+
+var _ driver.AuthHandshaker = (*authHandshaker)(nil)
 
+// Handshake implements the driver.Handshaker interface.
+func (ah *authHandshaker) Handshake(ctx context.Context, addr address.Address, conn driver.Connection) (description.Server, error) {
+	options := ah.options
+	authenticator, dbUser := options.Authenticator, options.DBUser
+	if options.Credentials != nil {
+		mechanism, cred, provided, err := options.Credentials.get(ctx)
 		if err != nil {
-			return description.Server{}, newAuthError("handshake failure", err)
+			return description.Server{}, err
 		}
+		authenticator = provided
+		if mechanism == "" {
+			// Required for SASL mechanism negotiation during handshake
+			dbUser = cred.Source + "." + cred.Username
+		}
+	}
+
+	im := operation.NewIsMaster().
+		AppName(options.AppName).
+		Compressors(options.Compressors).
+		SASLSupportedMechs(dbUser)
 
-		performAuth := options.PerformAuthentication
-		if performAuth == nil {
-			performAuth = func(serv description.Server) bool {
-				return serv.Kind == description.RSPrimary ||
-					serv.Kind == description.RSSecondary ||
-					serv.Kind == description.Mongos ||
-					serv.Kind == description.Standalone
-			}
+	// run the first step of the authentication conversation with the handshake if the authenticator supports it
+	var conversation SpeculativeConversation
+	if sa, ok := authenticator.(SpeculativeAuthenticator); ok {
+		var err error
+		conversation, err = sa.CreateSpeculativeConversation()
+		if err != nil {
+			return description.Server{}, newAuthError("failed to create speculative conversation", err)
+		}
+	}
+	if conversation != nil {
+		firstMsg, err := conversation.FirstMessage()
+		if err != nil {
+			return description.Server{}, newAuthError("failed to create speculative authentication message", err)
 		}
-		if performAuth(desc) && options.Authenticator != nil {
-			err = options.Authenticator.Auth(ctx, desc, conn)
-			if err != nil {
-				return description.Server{}, newAuthError("auth error", err)
-			}
+		im.SpeculativeAuthenticate(firstMsg)
+	}
+
+	desc, err := im.Handshake(ctx, addr, conn)
+	if err != nil {
+		return description.Server{}, newAuthError("handshake failure", err)
+	}
 
+	performAuth := options.PerformAuthentication
+	if performAuth == nil {
+		performAuth = func(serv description.Server) bool {
+			return serv.Kind == description.RSPrimary ||
+				serv.Kind == description.RSSecondary ||
+				serv.Kind == description.Mongos ||
+				serv.Kind == description.Standalone
+		}
+	}
+	if performAuth(desc) && authenticator != nil {
+		// servers that do not support speculative authentication, or could not authenticate with the speculative
+		// mechanism, reply without a speculativeAuthenticate document, so the regular conversation runs instead
+		if speculativeResponse := im.SpeculativeAuthenticateResponse(); conversation != nil && speculativeResponse != nil {
+			err = conversation.Finish(ctx, conn, speculativeResponse)
+		} else {
+			err = authenticator.Auth(ctx, desc, conn)
+		}
+		if err != nil && options.Credentials != nil {
+			err = ah.retryWithProvidedCredentials(ctx, desc, conn, authenticator, err)
+		}
+		if err != nil {
+			return description.Server{}, newAuthError("auth error", err)
 		}
-		if h == nil {
-			return desc, nil
+
+	}
+	if ah.wrapped == nil {
+		return desc, nil
+	}
+	return ah.wrapped.Handshake(ctx, addr, conn)
+}
+
+// Reauthenticate implements the driver.AuthHandshaker interface.
+func (ah *authHandshaker) Reauthenticate(ctx context.Context, desc description.Server, conn driver.Connection) error {
+	authenticator := ah.options.Authenticator
+	if ah.options.Credentials != nil {
+		var err error
+		if _, _, authenticator, err = ah.options.Credentials.get(ctx); err != nil {
+			return err
 		}
-		return h.Handshake(ctx, addr, conn)
-	})
+	}
+	if authenticator == nil {
+		return newAuthError("reauthentication requires an authenticator", nil)
+	}
+
+	err := authenticator.Auth(ctx, desc, conn)
+	if err != nil && ah.options.Credentials != nil {
+		err = ah.retryWithProvidedCredentials(ctx, desc, conn, authenticator, err)
+	}
+	if err != nil {
+		return newAuthError("auth error", err)
+	}
+	return nil
+}
+
+// retryWithProvidedCredentials authenticates the connection again if the server rejected the provided credential and
+// the provider now returns a different one, which happens when the password was rotated after it was fetched. It
+// returns the error of the failed attempt otherwise.
+func (ah *authHandshaker) retryWithProvidedCredentials(ctx context.Context, desc description.Server,
+	conn driver.Connection, failed Authenticator, err error) error {
+
+	if !isAuthenticationFailure(err) {
+		return err
+	}
+	_, _, authenticator, providerErr := ah.options.Credentials.get(ctx)
+	if providerErr != nil || authenticator == failed {
+		return err
+	}
+	return authenticator.Auth(ctx, desc, conn)
 }
 
 // Authenticator handles authenticating a connection.
@@ -98,6 +195,24 @@ type Authenticator interface {
 	Auth(context.Context, description.Server, driver.Connection) error
 }
 
+// SpeculativeAuthenticator is an Authenticator that can send the first message of its conversation with the
+// connection handshake, saving round trips on servers that support speculative authentication.
+type SpeculativeAuthenticator interface {
+	Authenticator
+
+	// CreateSpeculativeConversation returns a new conversation for one connection, or nil if the connection cannot
+	// authenticate speculatively.
+	CreateSpeculativeConversation() (SpeculativeConversation, error)
+}
+
+// SpeculativeConversation is an authentication conversation that starts in the connection handshake.
+type SpeculativeConversation interface {
+	// FirstMessage returns the document sent as speculativeAuthenticate in the handshake.
+	FirstMessage() (bsoncore.Document, error)
+	// Finish completes the conversation from the server's speculativeAuthenticate reply.
+	Finish(ctx context.Context, conn driver.Connection, firstResponse bsoncore.Document) error
+}
+
 func newAuthError(msg string, inner error) error {
 	return &Error{
 		message: msg,
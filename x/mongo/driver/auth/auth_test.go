@@ -29,6 +29,7 @@ func TestCreateAuthenticator(t *testing.T) {
 		{name: "MONGODB-CR", auther: &MongoDBCRAuthenticator{}},
 		{name: "PLAIN", auther: &PlainAuthenticator{}},
 		{name: "MONGODB-X509", auther: &MongoDBX509Authenticator{}},
+		{name: "MONGODB-AWS", auther: &MongoDBAWSAuthenticator{}},
 	}
 
 	for _, test := range tests {
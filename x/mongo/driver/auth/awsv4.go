@@ -0,0 +1,94 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	awsSigningAlgorithm = "AWS4-HMAC-SHA256"
+	awsDateFormat       = "20060102T150405Z"
+)
+
+// awsRequest is an HTTP request to be signed with AWS Signature Version 4.
+type awsRequest struct {
+	method  string
+	path    string
+	query   string            // the canonical query string
+	headers map[string]string // by lower case header name, including host and x-amz-date
+	body    []byte
+}
+
+// signAWSRequest returns the Authorization header for the request signed with the given credentials. The request's
+// x-amz-date header must hold t formatted with awsDateFormat.
+func signAWSRequest(req awsRequest, creds AWSCredentials, region, service string, t time.Time) string {
+	names := make([]string, 0, len(req.headers))
+	for name := range req.headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	signedHeaders := strings.Join(names, ";")
+
+	var canonical strings.Builder
+	canonical.WriteString(req.method + "\n")
+	canonical.WriteString(req.path + "\n")
+	canonical.WriteString(req.query + "\n")
+	for _, name := range names {
+		canonical.WriteString(name + ":" + strings.TrimSpace(req.headers[name]) + "\n")
+	}
+	canonical.WriteString("\n" + signedHeaders + "\n")
+	canonical.WriteString(hexSHA256(req.body))
+
+	date := t.UTC().Format("20060102")
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+	stringToSign := strings.Join([]string{
+		awsSigningAlgorithm,
+		t.UTC().Format(awsDateFormat),
+		scope,
+		hexSHA256([]byte(canonical.String())),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	return fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsSigningAlgorithm, creds.AccessKeyID, scope, signedHeaders, signature)
+}
+
+// awsRegion returns the region of an STS host, e.g. "us-west-2" for "sts.us-west-2.amazonaws.com". The global
+// endpoint "sts.amazonaws.com" and single label hosts are in us-east-1.
+func awsRegion(host string) string {
+	if host == "sts.amazonaws.com" {
+		return "us-east-1"
+	}
+	labels := strings.Split(host, ".")
+	if len(labels) < 2 {
+		return "us-east-1"
+	}
+	return labels[1]
+}
+
+func hexSHA256(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -13,4 +13,12 @@ type Cred struct {
 	Password    string
 	PasswordSet bool
 	Props       map[string]string
+
+	// AWSCredentialProvider provides the credentials for MONGODB-AWS if Username and Password are empty.
+	AWSCredentialProvider AWSCredentialProvider
+
+	// OIDCCallback provides the access tokens for MONGODB-OIDC. OIDCRefreshCallback optionally refreshes them before
+	// they expire.
+	OIDCCallback        OIDCCallback
+	OIDCRefreshCallback OIDCCallback
 }
@@ -8,6 +8,7 @@ package auth
 
 import (
 	"context"
+	"sync"
 
 	"github.com/appveen/mongo-go-driver/x/mongo/driver"
 	"github.com/appveen/mongo-go-driver/x/mongo/driver/description"
@@ -23,6 +24,23 @@ func newDefaultAuthenticator(cred *Cred) (Authenticator, error) {
 // on the server version.
 type DefaultAuthenticator struct {
 	Cred *Cred
+
+	mu    sync.Mutex
+	scram map[string]Authenticator // by mechanism, shared by all connections to reuse the keys they cache
+}
+
+var _ SpeculativeAuthenticator = (*DefaultAuthenticator)(nil)
+
+// CreateSpeculativeConversation creates a speculative conversation for SCRAM-SHA-256, which every server that
+// supports speculative authentication supports. If the user has no SCRAM-SHA-256 credentials, the server does not
+// reply to the speculative conversation and Auth negotiates the mechanism instead.
+func (a *DefaultAuthenticator) CreateSpeculativeConversation() (SpeculativeConversation, error) {
+	actual, err := a.scramAuthenticator(SCRAMSHA256)
+	if err != nil {
+		// the password cannot be used with SCRAM-SHA-256, but may be used with the negotiated mechanism
+		return nil, nil
+	}
+	return actual.(*ScramAuthenticator).CreateSpeculativeConversation()
 }
 
 // Auth authenticates the connection.
@@ -32,9 +50,9 @@ func (a *DefaultAuthenticator) Auth(ctx context.Context, desc description.Server
 
 	switch chooseAuthMechanism(desc) {
 	case SCRAMSHA256:
-		actual, err = newScramSHA256Authenticator(a.Cred)
+		actual, err = a.scramAuthenticator(SCRAMSHA256)
 	case SCRAMSHA1:
-		actual, err = newScramSHA1Authenticator(a.Cred)
+		actual, err = a.scramAuthenticator(SCRAMSHA1)
 	default:
 		actual, err = newMongoDBCRAuthenticator(a.Cred)
 	}
@@ -46,6 +64,33 @@ func (a *DefaultAuthenticator) Auth(ctx context.Context, desc description.Server
 	return actual.Auth(ctx, desc, conn)
 }
 
+// scramAuthenticator returns the SCRAM authenticator for the mechanism, creating it on first use.
+func (a *DefaultAuthenticator) scramAuthenticator(mechanism string) (Authenticator, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if actual, ok := a.scram[mechanism]; ok {
+		return actual, nil
+	}
+
+	var actual Authenticator
+	var err error
+	switch mechanism {
+	case SCRAMSHA256:
+		actual, err = newScramSHA256Authenticator(a.Cred)
+	default:
+		actual, err = newScramSHA1Authenticator(a.Cred)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if a.scram == nil {
+		a.scram = make(map[string]Authenticator)
+	}
+	a.scram[mechanism] = actual
+	return actual, nil
+}
+
 // If a server provides a list of supported mechanisms, we choose
 // SCRAM-SHA-256 if it exists or else MUST use SCRAM-SHA-1.
 // Otherwise, we decide based on what is supported.
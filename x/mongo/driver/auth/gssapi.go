@@ -4,8 +4,7 @@
 // not use this file except in compliance with the License. You may obtain
 // a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
 
-//+build gssapi
-//+build windows linux darwin
+//+build !gssapi windows linux darwin
 
 package auth
 
@@ -0,0 +1,206 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+//+build !gssapi
+
+package gssapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/appveen/mongo-go-driver/x/mongo/driver/auth/internal/kerberos"
+)
+
+// clientKey identifies the credentials of a Kerberos client, including the environment variables that select the
+// configuration, credential cache and keytab.
+type clientKey struct {
+	username    string
+	password    string
+	passwordSet bool
+	config      string
+	ccache      string
+	keytab      string
+}
+
+// clients are shared by all connections with the same credentials, so a service ticket is requested once for all of
+// them.
+var (
+	clientsMu sync.Mutex
+	clients   = make(map[clientKey]*kerberos.Client)
+)
+
+// The DNS lookups used to canonicalize host names are replaced in tests.
+var (
+	lookupCNAME = net.LookupCNAME
+	lookupHost  = net.LookupHost
+	lookupAddr  = net.LookupAddr
+)
+
+// New creates a new SaslClient. The target parameter should be a hostname with no port.
+func New(target, username, password string, passwordSet bool, props map[string]string) (*SaslClient, error) {
+	serviceName := "mongodb"
+	var serviceRealm string
+	var canonicalize, serviceHostSet bool
+
+	for key, value := range props {
+		switch strings.ToUpper(key) {
+		case "CANONICALIZE_HOST_NAME":
+			var err error
+			if canonicalize, err = strconv.ParseBool(value); err != nil {
+				return nil, fmt.Errorf("invalid CANONICALIZE_HOST_NAME %s", value)
+			}
+		case "SERVICE_REALM":
+			serviceRealm = value
+		case "SERVICE_NAME":
+			serviceName = value
+		case "SERVICE_HOST":
+			target = value
+			serviceHostSet = true
+		default:
+			return nil, fmt.Errorf("unknown mechanism property %s", key)
+		}
+	}
+	if canonicalize && serviceHostSet {
+		return nil, errors.New("CANONICALIZE_HOST_NAME and SERVICE_HOST cannot both be specified")
+	}
+	if canonicalize {
+		var err error
+		if target, err = canonicalizeHostName(target); err != nil {
+			return nil, err
+		}
+	}
+
+	config, err := kerberos.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the Kerberos configuration: %v", err)
+	}
+	client, err := getClient(config, username, password, passwordSet && username != "")
+	if err != nil {
+		return nil, err
+	}
+	_, clientRealm := client.Principal()
+	if serviceRealm == "" {
+		serviceRealm = config.HostRealm(target, clientRealm)
+	}
+
+	return &SaslClient{
+		client:       client,
+		service:      kerberos.NewPrincipalName(kerberos.NameTypeSrvHost, serviceName, target),
+		serviceRealm: serviceRealm,
+		username:     username,
+	}, nil
+}
+
+func getClient(config *kerberos.Config, username, password string, passwordSet bool) (*kerberos.Client, error) {
+	key := clientKey{
+		username:    username,
+		password:    password,
+		passwordSet: passwordSet,
+		config:      os.Getenv("KRB5_CONFIG"),
+		ccache:      config.CCacheName(),
+		keytab:      config.ClientKeytabName(),
+	}
+
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	if client, ok := clients[key]; ok {
+		return client, nil
+	}
+	client, err := kerberos.NewClient(config, username, password, passwordSet)
+	if err != nil {
+		return nil, err
+	}
+	clients[key] = client
+	return client, nil
+}
+
+// canonicalizeHostName resolves the host name to its canonical name and then to the name of its address.
+func canonicalizeHostName(host string) (string, error) {
+	cname, err := lookupCNAME(host)
+	if err != nil {
+		return "", fmt.Errorf("unable to canonicalize host name %s: %v", host, err)
+	}
+	canonical := cname
+	if addrs, err := lookupHost(cname); err == nil && len(addrs) > 0 {
+		if names, err := lookupAddr(addrs[0]); err == nil && len(names) > 0 {
+			canonical = names[0]
+		}
+	}
+	return strings.ToLower(strings.TrimSuffix(canonical, ".")), nil
+}
+
+// SaslClient authenticates with the GSSAPI mechanism using the Kerberos implementation of this module, which does not
+// need cgo or the system's Kerberos libraries.
+type SaslClient struct {
+	client       *kerberos.Client
+	service      kerberos.PrincipalName
+	serviceRealm string
+	username     string
+
+	// state
+	ctx  *kerberos.InitiatorContext
+	done bool
+}
+
+// Start gets a ticket for the service and returns the initial context token.
+func (sc *SaslClient) Start() (string, []byte, error) {
+	const mechName = "GSSAPI"
+
+	cred, err := sc.client.ServiceTicket(context.Background(), sc.service, sc.serviceRealm)
+	if err != nil {
+		return mechName, nil, fmt.Errorf("unable to get a ticket for %s@%s: %v", sc.service, sc.serviceRealm, err)
+	}
+	ctx, token, err := kerberos.NewInitiatorContext(cred)
+	if err != nil {
+		return mechName, nil, fmt.Errorf("unable to initialize client: %v", err)
+	}
+	sc.ctx = ctx
+	return mechName, token, nil
+}
+
+// Next processes a challenge from the server.
+func (sc *SaslClient) Next(challenge []byte) ([]byte, error) {
+	if !sc.ctx.Established() {
+		if err := sc.ctx.Step(challenge); err != nil {
+			return nil, fmt.Errorf("unable to negotiate with server: %v", err)
+		}
+		return []byte{}, nil
+	}
+
+	// the server offers the security layers it supports and its maximum message size (RFC 4752)
+	offer, err := sc.ctx.Unwrap(challenge)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unwrap server message: %v", err)
+	}
+	if len(offer) != 4 || offer[0]&1 == 0 {
+		return nil, errors.New("server does not support authentication without a security layer")
+	}
+
+	username := sc.username
+	if username == "" {
+		name, realm := sc.client.Principal()
+		username = name.String() + "@" + realm
+	}
+	payload, err := sc.ctx.Wrap(append([]byte{1, 0, 0, 0}, username...))
+	if err != nil {
+		return nil, fmt.Errorf("unable to wrap authz: %v", err)
+	}
+	sc.done = true
+	return payload, nil
+}
+
+// Completed returns true once the client has sent its authorization identity.
+func (sc *SaslClient) Completed() bool {
+	return sc.done
+}
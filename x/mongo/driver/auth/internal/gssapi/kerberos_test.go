@@ -0,0 +1,259 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+//+build !gssapi
+
+package gssapi
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/appveen/mongo-go-driver/x/mongo/driver/auth/internal/kerberos"
+	"github.com/appveen/mongo-go-driver/x/mongo/driver/auth/internal/kerberos/kerberostest"
+	"github.com/stretchr/testify/require"
+)
+
+type testEnv struct {
+	kdc         *kerberostest.KDC
+	dir         string
+	serviceKeys map[string]kerberos.EncryptionKey
+	restore     map[string]*string
+}
+
+// newTestEnv starts a KDC for EXAMPLE.COM and OTHER.COM and points the Kerberos environment variables at its
+// configuration and at credential files in a new directory.
+func newTestEnv(t *testing.T) *testEnv {
+	kdc, err := kerberostest.NewKDC("EXAMPLE.COM", "OTHER.COM")
+	require.NoError(t, err)
+	dir, err := ioutil.TempDir("", "gssapi")
+	require.NoError(t, err)
+	env := &testEnv{
+		kdc:         kdc,
+		dir:         dir,
+		serviceKeys: make(map[string]kerberos.EncryptionKey),
+		restore:     make(map[string]*string),
+	}
+
+	require.NoError(t, kdc.AddPassword("user@EXAMPLE.COM", "pencil"))
+	for _, service := range []string{
+		"mongodb/db.example.com@EXAMPLE.COM",
+		"mongodb/db.other.com@OTHER.COM",
+		"mongodb/db.example.com@OTHER.COM",
+		"custom/alias.example.com@EXAMPLE.COM",
+	} {
+		if env.serviceKeys[service], err = kdc.AddKey(service); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := filepath.Join(dir, "krb5.conf")
+	require.NoError(t, ioutil.WriteFile(config,
+		[]byte(kdc.Config()+"\n[domain_realm]\n\t.other.com = OTHER.COM\n"), 0600))
+	env.setenv("KRB5_CONFIG", config)
+	env.setenv("KRB5CCNAME", filepath.Join(dir, "ccache"))
+	env.setenv("KRB5_CLIENT_KTNAME", filepath.Join(dir, "client.keytab"))
+	return env
+}
+
+func (env *testEnv) setenv(key, value string) {
+	if _, ok := env.restore[key]; !ok {
+		if old, ok := os.LookupEnv(key); ok {
+			env.restore[key] = &old
+		} else {
+			env.restore[key] = nil
+		}
+	}
+	_ = os.Setenv(key, value)
+}
+
+func (env *testEnv) close() {
+	for key, value := range env.restore {
+		if value != nil {
+			_ = os.Setenv(key, *value)
+		} else {
+			_ = os.Unsetenv(key)
+		}
+	}
+	_ = env.kdc.Close()
+	_ = os.RemoveAll(env.dir)
+}
+
+// conversation runs the SASL conversation of the client with the service and returns the authorization identity the
+// client sent.
+func (env *testEnv) conversation(t *testing.T, sc *SaslClient, service string) string {
+	mech, token, err := sc.Start()
+	require.NoError(t, err)
+	require.Equal(t, "GSSAPI", mech)
+
+	key, ok := env.serviceKeys[service]
+	require.True(t, ok, "unknown service %s", service)
+	ac, reply, err := kerberostest.Accept(key, token, true)
+	require.NoError(t, err)
+	require.Equal(t, "user@EXAMPLE.COM", ac.Client)
+
+	payload, err := sc.Next(reply)
+	require.NoError(t, err)
+	require.Empty(t, payload)
+	require.False(t, sc.Completed())
+
+	// the service supports no security layer and messages of up to 64 KiB
+	offer, err := ac.Wrap([]byte{1, 1, 0, 0}, false)
+	require.NoError(t, err)
+	payload, err = sc.Next(offer)
+	require.NoError(t, err)
+	require.True(t, sc.Completed())
+
+	msg, err := ac.Unwrap(payload)
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 0, 0, 0}, msg[:4])
+	return string(msg[4:])
+}
+
+func TestSaslClient(t *testing.T) {
+	t.Run("password", func(t *testing.T) {
+		env := newTestEnv(t)
+		defer env.close()
+
+		sc, err := New("db.example.com", "user@EXAMPLE.COM", "pencil", true, nil)
+		require.NoError(t, err)
+		require.Equal(t, "user@EXAMPLE.COM", env.conversation(t, sc, "mongodb/db.example.com@EXAMPLE.COM"))
+	})
+	t.Run("clients are shared", func(t *testing.T) {
+		env := newTestEnv(t)
+		defer env.close()
+
+		for i := 0; i < 3; i++ {
+			sc, err := New("db.example.com", "user@EXAMPLE.COM", "pencil", true, nil)
+			require.NoError(t, err)
+			env.conversation(t, sc, "mongodb/db.example.com@EXAMPLE.COM")
+		}
+		as, tgs := env.kdc.Requests()
+		require.Equal(t, 1, as)
+		require.Equal(t, 1, tgs)
+	})
+	t.Run("keytab", func(t *testing.T) {
+		env := newTestEnv(t)
+		defer env.close()
+
+		key, err := env.kdc.AddKey("user@EXAMPLE.COM")
+		require.NoError(t, err)
+		kt := &kerberos.Keytab{Entries: []kerberos.KeytabEntry{{
+			Principal: kerberos.NewPrincipalName(kerberos.NameTypePrincipal, "user"),
+			Realm:     "EXAMPLE.COM",
+			KVNO:      1,
+			Key:       key,
+		}}}
+		require.NoError(t, ioutil.WriteFile(filepath.Join(env.dir, "client.keytab"), kt.Marshal(), 0600))
+
+		// without a username, the principal of the credentials is the authorization identity
+		sc, err := New("db.example.com", "", "", false, nil)
+		require.NoError(t, err)
+		require.Equal(t, "user@EXAMPLE.COM", env.conversation(t, sc, "mongodb/db.example.com@EXAMPLE.COM"))
+	})
+	t.Run("service realm of the host", func(t *testing.T) {
+		env := newTestEnv(t)
+		defer env.close()
+
+		sc, err := New("db.other.com", "user@EXAMPLE.COM", "pencil", true, nil)
+		require.NoError(t, err)
+		env.conversation(t, sc, "mongodb/db.other.com@OTHER.COM")
+	})
+	t.Run("SERVICE_REALM", func(t *testing.T) {
+		env := newTestEnv(t)
+		defer env.close()
+
+		sc, err := New("db.example.com", "user@EXAMPLE.COM", "pencil", true,
+			map[string]string{"SERVICE_REALM": "OTHER.COM"})
+		require.NoError(t, err)
+		env.conversation(t, sc, "mongodb/db.example.com@OTHER.COM")
+	})
+	t.Run("SERVICE_NAME and SERVICE_HOST", func(t *testing.T) {
+		env := newTestEnv(t)
+		defer env.close()
+
+		sc, err := New("db.example.com", "user@EXAMPLE.COM", "pencil", true,
+			map[string]string{"SERVICE_NAME": "custom", "service_host": "alias.example.com"})
+		require.NoError(t, err)
+		env.conversation(t, sc, "custom/alias.example.com@EXAMPLE.COM")
+	})
+	t.Run("CANONICALIZE_HOST_NAME", func(t *testing.T) {
+		env := newTestEnv(t)
+		defer env.close()
+		defer func(cname func(string) (string, error), host, addr func(string) ([]string, error)) {
+			lookupCNAME, lookupHost, lookupAddr = cname, host, addr
+		}(lookupCNAME, lookupHost, lookupAddr)
+		lookupCNAME = func(host string) (string, error) {
+			if host != "alias" {
+				return "", errors.New("no such host")
+			}
+			return "alias.example.com.", nil
+		}
+		lookupHost = func(host string) ([]string, error) {
+			if host != "alias.example.com." {
+				return nil, errors.New("no such host")
+			}
+			return []string{"10.0.0.1"}, nil
+		}
+		lookupAddr = func(addr string) ([]string, error) {
+			if addr != "10.0.0.1" {
+				return nil, errors.New("no such host")
+			}
+			return []string{"DB.EXAMPLE.COM."}, nil
+		}
+
+		sc, err := New("alias", "user@EXAMPLE.COM", "pencil", true,
+			map[string]string{"CANONICALIZE_HOST_NAME": "true"})
+		require.NoError(t, err)
+		env.conversation(t, sc, "mongodb/db.example.com@EXAMPLE.COM")
+
+		_, err = New("unknown", "user@EXAMPLE.COM", "pencil", true,
+			map[string]string{"CANONICALIZE_HOST_NAME": "true"})
+		require.Error(t, err)
+	})
+	t.Run("invalid properties", func(t *testing.T) {
+		for _, props := range []map[string]string{
+			{"CANONICALIZE_HOST_NAME": "true", "SERVICE_HOST": "localhost"},
+			{"CANONICALIZE_HOST_NAME": "maybe"},
+			{"UNKNOWN": "value"},
+		} {
+			_, err := New("db.example.com", "user@EXAMPLE.COM", "pencil", true, props)
+			require.Error(t, err, "expected an error for %v", props)
+		}
+	})
+	t.Run("unknown service", func(t *testing.T) {
+		env := newTestEnv(t)
+		defer env.close()
+
+		sc, err := New("unknown.example.com", "user@EXAMPLE.COM", "pencil", true, nil)
+		require.NoError(t, err)
+		_, _, err = sc.Start()
+		require.Error(t, err)
+	})
+	t.Run("security layer required", func(t *testing.T) {
+		env := newTestEnv(t)
+		defer env.close()
+
+		sc, err := New("db.example.com", "user@EXAMPLE.COM", "pencil", true, nil)
+		require.NoError(t, err)
+		_, token, err := sc.Start()
+		require.NoError(t, err)
+		ac, reply, err := kerberostest.Accept(env.serviceKeys["mongodb/db.example.com@EXAMPLE.COM"], token, false)
+		require.NoError(t, err)
+		_, err = sc.Next(reply)
+		require.NoError(t, err)
+
+		// the service supports only the confidentiality security layer
+		offer, err := ac.Wrap([]byte{4, 1, 0, 0}, true)
+		require.NoError(t, err)
+		_, err = sc.Next(offer)
+		require.Error(t, err)
+		require.False(t, sc.Completed())
+	})
+}
@@ -0,0 +1,187 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package kerberos
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// configRealm is the realm of the configuration entries MIT Kerberos stores in credential caches.
+const configRealm = "X-CACHECONF:"
+
+// Credential is a ticket and its session key.
+type Credential struct {
+	Client      PrincipalName
+	ClientRealm string
+	Server      PrincipalName
+	ServerRealm string
+	Key         EncryptionKey
+	AuthTime    time.Time
+	StartTime   time.Time
+	EndTime     time.Time
+	RenewTill   time.Time
+	Flags       uint32
+	Ticket      []byte // the encoded ticket
+}
+
+// Valid returns true if the credential is valid at the given time.
+func (c *Credential) Valid(now time.Time) bool {
+	return now.Before(c.EndTime) && (c.StartTime.IsZero() || !now.Before(c.StartTime))
+}
+
+// CCache is a credential cache, in the format used by MIT Kerberos.
+type CCache struct {
+	Principal   PrincipalName
+	Realm       string
+	Credentials []*Credential
+}
+
+// LoadCCache reads a credential cache file. name may have a FILE: prefix, which is the only supported cache type.
+func LoadCCache(name string) (*CCache, error) {
+	path, err := filePath(name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := ParseCCache(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credential cache %s: %v", path, err)
+	}
+	return cc, nil
+}
+
+// ParseCCache parses the contents of a credential cache file.
+func ParseCCache(b []byte) (*CCache, error) {
+	if len(b) < 2 || b[0] != 5 {
+		return nil, errors.New("not a credential cache")
+	}
+	// versions 1 and 2 use the native byte order and are not written by current implementations
+	version := b[1]
+	if version != 3 && version != 4 {
+		return nil, fmt.Errorf("unsupported credential cache version %d", version)
+	}
+
+	r := &reader{b: b[2:], order: binary.BigEndian}
+	if version == 4 {
+		r.bytes(int(r.uint16())) // header fields, such as the KDC time offset
+	}
+
+	cc := &CCache{}
+	cc.Principal, cc.Realm = r.principal()
+	for len(r.b) > 0 && r.err == nil {
+		cred := &Credential{}
+		cred.Client, cred.ClientRealm = r.principal()
+		cred.Server, cred.ServerRealm = r.principal()
+		cred.Key.KeyType = int32(r.uint16())
+		if version == 3 {
+			r.uint16() // the encryption type is repeated
+		}
+		cred.Key.KeyValue = r.bytes(int(r.uint32()))
+		cred.AuthTime = r.time()
+		cred.StartTime = r.time()
+		cred.EndTime = r.time()
+		cred.RenewTill = r.time()
+		r.uint8() // whether the ticket is encrypted in another ticket's session key
+		cred.Flags = r.uint32()
+		for i, n := 0, int(r.uint32()); i < n && r.err == nil; i++ {
+			r.uint16()
+			r.bytes(int(r.uint32())) // addresses
+		}
+		for i, n := 0, int(r.uint32()); i < n && r.err == nil; i++ {
+			r.uint16()
+			r.bytes(int(r.uint32())) // authorization data
+		}
+		cred.Ticket = r.bytes(int(r.uint32()))
+		r.bytes(int(r.uint32())) // the second ticket for user-to-user authentication
+
+		if cred.ServerRealm != configRealm {
+			cc.Credentials = append(cc.Credentials, cred)
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return cc, nil
+}
+
+// Credential returns a valid credential for the server, or nil if there is none.
+func (cc *CCache) Credential(server PrincipalName, realm string, now time.Time) *Credential {
+	for _, cred := range cc.Credentials {
+		if cred.ServerRealm == realm && cred.Server.Equal(server) && cred.ClientRealm == cc.Realm &&
+			cred.Client.Equal(cc.Principal) && cred.Valid(now) {
+			return cred
+		}
+	}
+	return nil
+}
+
+// Marshal encodes the credential cache in version 4 of the format.
+func (cc *CCache) Marshal() []byte {
+	w := &writer{b: []byte{5, 4}, order: binary.BigEndian}
+	w.uint16(0)
+	w.principal(cc.Principal, cc.Realm)
+	for _, cred := range cc.Credentials {
+		w.principal(cred.Client, cred.ClientRealm)
+		w.principal(cred.Server, cred.ServerRealm)
+		w.uint16(uint16(cred.Key.KeyType))
+		w.string32(cred.Key.KeyValue)
+		for _, t := range []time.Time{cred.AuthTime, cred.StartTime, cred.EndTime, cred.RenewTill} {
+			w.time(t)
+		}
+		w.uint8(0)
+		w.uint32(cred.Flags)
+		w.uint32(0)
+		w.uint32(0)
+		w.string32(cred.Ticket)
+		w.string32(nil)
+	}
+	return w.b
+}
+
+func (r *reader) principal() (PrincipalName, string) {
+	nameType := int32(r.uint32())
+	count := int(r.uint32())
+	realm := string(r.bytes(int(r.uint32())))
+	var components []string
+	for i := 0; i < count && r.err == nil; i++ {
+		components = append(components, string(r.bytes(int(r.uint32()))))
+	}
+	return NewPrincipalName(nameType, components...), realm
+}
+
+func (r *reader) time() time.Time {
+	t := r.uint32()
+	if t == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(t), 0).UTC()
+}
+
+func (w *writer) principal(pn PrincipalName, realm string) {
+	components := pn.NameString
+	w.uint32(uint32(pn.NameType))
+	w.uint32(uint32(len(components)))
+	w.string32([]byte(realm))
+	for _, c := range components {
+		w.string32([]byte(c))
+	}
+}
+
+func (w *writer) time(t time.Time) {
+	if t.IsZero() {
+		w.uint32(0)
+		return
+	}
+	w.uint32(uint32(t.Unix()))
+}
@@ -0,0 +1,98 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package kerberos
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCCache(t *testing.T) {
+	now := time.Unix(time.Now().Unix(), 0).UTC()
+	user := NewPrincipalName(NameTypePrincipal, "user")
+	krbtgt := NewPrincipalName(NameTypeSrvInst, "krbtgt", "EXAMPLE.COM")
+	cred := func(server PrincipalName, endTime time.Time) *Credential {
+		return &Credential{
+			Client:      user,
+			ClientRealm: "EXAMPLE.COM",
+			Server:      server,
+			ServerRealm: "EXAMPLE.COM",
+			Key:         EncryptionKey{KeyType: 18, KeyValue: []byte("session key")},
+			AuthTime:    now.Add(-time.Hour),
+			StartTime:   now.Add(-time.Hour),
+			EndTime:     endTime,
+			Flags:       0x40e10000,
+			Ticket:      []byte("ticket"),
+		}
+	}
+	cc := &CCache{
+		Principal: user,
+		Realm:     "EXAMPLE.COM",
+		Credentials: []*Credential{
+			cred(krbtgt, now.Add(-time.Minute)),
+			cred(krbtgt, now.Add(time.Hour)),
+		},
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		parsed, err := ParseCCache(cc.Marshal())
+		require.NoError(t, err)
+		require.Equal(t, cc, parsed)
+	})
+	t.Run("configuration entries", func(t *testing.T) {
+		withConfig := *cc
+		config := cred(NewPrincipalName(NameTypePrincipal, "krb5_ccache_conf_data", "pa_type"), time.Time{})
+		config.ServerRealm = configRealm
+		withConfig.Credentials = append([]*Credential{config}, cc.Credentials...)
+
+		parsed, err := ParseCCache(withConfig.Marshal())
+		require.NoError(t, err)
+		require.Equal(t, cc, parsed)
+	})
+	t.Run("version 3", func(t *testing.T) {
+		// version 3 has no header and repeats the encryption type of keys
+		w := &writer{b: []byte{5, 3}, order: binary.BigEndian}
+		w.principal(cc.Principal, cc.Realm)
+		for _, cred := range cc.Credentials {
+			w.principal(cred.Client, cred.ClientRealm)
+			w.principal(cred.Server, cred.ServerRealm)
+			w.uint16(uint16(cred.Key.KeyType))
+			w.uint16(uint16(cred.Key.KeyType))
+			w.string32(cred.Key.KeyValue)
+			for _, t := range []time.Time{cred.AuthTime, cred.StartTime, cred.EndTime, cred.RenewTill} {
+				w.time(t)
+			}
+			w.uint8(0)
+			w.uint32(cred.Flags)
+			w.uint32(0)
+			w.uint32(0)
+			w.string32(cred.Ticket)
+			w.string32(nil)
+		}
+
+		parsed, err := ParseCCache(w.b)
+		require.NoError(t, err)
+		require.Equal(t, cc, parsed)
+	})
+	t.Run("unsupported version", func(t *testing.T) {
+		_, err := ParseCCache([]byte{5, 2})
+		require.Error(t, err)
+	})
+	t.Run("truncated", func(t *testing.T) {
+		b := cc.Marshal()
+		_, err := ParseCCache(b[:len(b)-1])
+		require.Error(t, err)
+	})
+	t.Run("credential", func(t *testing.T) {
+		require.Equal(t, cc.Credentials[1], cc.Credential(krbtgt, "EXAMPLE.COM", now))
+		require.Nil(t, cc.Credential(krbtgt, "EXAMPLE.COM", now.Add(2*time.Hour)))
+		require.Nil(t, cc.Credential(krbtgt, "OTHER.COM", now))
+	})
+}
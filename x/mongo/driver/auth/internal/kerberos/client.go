@@ -0,0 +1,568 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// Package kerberos is a Kerberos 5 client (RFC 4120) with the GSS-API mechanism (RFC 4121) that authenticates with a
+// password, a keytab, or a credential cache. It supports the AES encryption types.
+package kerberos
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ticketLifetime = 24 * time.Hour
+	// expiryMargin is how long before its expiration a ticket is no longer used, so it does not expire while a
+	// service authenticates it.
+	expiryMargin = time.Minute
+	// kdcTimeout limits each KDC request if the context has no deadline.
+	kdcTimeout = 10 * time.Second
+	// maxKDCReplySize is the largest KDC reply accepted over TCP.
+	maxKDCReplySize = 1 << 20
+)
+
+// Client gets service tickets for a principal. Tickets are cached until they expire.
+type Client struct {
+	config   *Config
+	username PrincipalName
+	realm    string
+
+	password    string
+	usePassword bool
+	ccacheName  string
+	keytabName  string
+
+	mu      sync.Mutex
+	tickets map[string]*Credential // tickets, including ticket-granting tickets, by service principal and realm
+}
+
+// NewClient creates a client for the user. The password is used if it is set. Otherwise, tickets are taken from
+// the default credential cache, and new ones are requested with the default client keytab. If username is empty,
+// the principal of the credential cache or, if there is none, the first principal of the keytab is used. If
+// username does not include a realm, the default realm is used.
+func NewClient(config *Config, username, password string, passwordSet bool) (*Client, error) {
+	c := &Client{
+		config:     config,
+		ccacheName: config.CCacheName(),
+		keytabName: config.ClientKeytabName(),
+		tickets:    make(map[string]*Credential),
+	}
+
+	if username != "" {
+		c.username, c.realm = ParsePrincipal(username)
+		if c.realm == "" {
+			c.realm = config.DefaultRealm
+		}
+		if c.realm == "" {
+			return nil, fmt.Errorf("principal %s has no realm and there is no default realm", username)
+		}
+	}
+	if passwordSet {
+		if username == "" {
+			return nil, errors.New("a password requires a username")
+		}
+		c.password, c.usePassword = password, true
+		return c, nil
+	}
+	if username != "" {
+		return c, nil
+	}
+
+	if cc, err := LoadCCache(c.ccacheName); err == nil {
+		c.username, c.realm = cc.Principal, cc.Realm
+		return c, nil
+	}
+	kt, err := LoadKeytab(c.keytabName)
+	if err != nil {
+		return nil, fmt.Errorf("no Kerberos credentials found in the credential cache %s or the keytab %s", c.ccacheName,
+			c.keytabName)
+	}
+	principals := kt.Principals()
+	if len(principals) == 0 {
+		return nil, fmt.Errorf("keytab %s is empty", c.keytabName)
+	}
+	c.username, c.realm = principals[0].Principal, principals[0].Realm
+	return c, nil
+}
+
+// Principal returns the principal of the client.
+func (c *Client) Principal() (PrincipalName, string) {
+	return c.username, c.realm
+}
+
+// ServiceTicket returns a ticket for the service, requesting one through the service's realm if needed.
+func (c *Client) ServiceTicket(ctx context.Context, service PrincipalName, realm string) (*Credential, error) {
+	if cred := c.cachedTicket(service, realm); cred != nil {
+		return cred, nil
+	}
+
+	tgt, err := c.tgt(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if realm != c.realm {
+		// get a cross-realm ticket-granting ticket for the service's realm from the client's realm
+		krbtgt := NewPrincipalName(NameTypeSrvInst, "krbtgt", realm)
+		if cross := c.cachedTicket(krbtgt, c.realm); cross != nil {
+			tgt = cross
+		} else if tgt, err = c.tgsExchange(ctx, tgt, krbtgt, c.realm); err != nil {
+			return nil, err
+		} else {
+			c.cacheTicket(tgt)
+		}
+	}
+
+	cred, err := c.tgsExchange(ctx, tgt, service, realm)
+	if err != nil {
+		return nil, err
+	}
+	c.cacheTicket(cred)
+	return cred, nil
+}
+
+// tgt returns a ticket-granting ticket for the client's realm.
+func (c *Client) tgt(ctx context.Context) (*Credential, error) {
+	krbtgt := NewPrincipalName(NameTypeSrvInst, "krbtgt", c.realm)
+	if cred := c.cachedTicket(krbtgt, c.realm); cred != nil {
+		return cred, nil
+	}
+
+	if !c.usePassword {
+		// the credential cache is read again every time, so tickets from a new kinit are used
+		if cc, err := LoadCCache(c.ccacheName); err == nil && cc.Realm == c.realm && cc.Principal.Equal(c.username) {
+			if cred := cc.Credential(krbtgt, c.realm, time.Now().Add(expiryMargin)); cred != nil {
+				c.cacheTicket(cred)
+				return cred, nil
+			}
+		}
+	}
+
+	cred, err := c.asExchange(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.cacheTicket(cred)
+	return cred, nil
+}
+
+func (c *Client) cachedTicket(service PrincipalName, realm string) *Credential {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := service.String() + "@" + realm
+	cred, ok := c.tickets[key]
+	if !ok {
+		return nil
+	}
+	if !cred.Valid(time.Now().Add(expiryMargin)) {
+		delete(c.tickets, key)
+		return nil
+	}
+	return cred
+}
+
+func (c *Client) cacheTicket(cred *Credential) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.tickets[cred.Server.String()+"@"+cred.ServerRealm] = cred
+}
+
+// clientKeys returns the long-term keys of the client.
+type clientKeys interface {
+	// etypes returns the encryption types the client has keys for, in order of preference.
+	etypes() []int32
+	// key returns the key for the encryption type, salt and string-to-key parameters.
+	key(etype int32, salt string, params []byte) (EncryptionKey, error)
+}
+
+type passwordKeys struct {
+	password string
+}
+
+func (pk passwordKeys) etypes() []int32 {
+	return SupportedETypes
+}
+
+func (pk passwordKeys) key(etype int32, salt string, params []byte) (EncryptionKey, error) {
+	return StringToKey(etype, pk.password, salt, params)
+}
+
+type keytabKeys struct {
+	keytab    *Keytab
+	principal PrincipalName
+	realm     string
+}
+
+func (kk keytabKeys) etypes() []int32 {
+	var etypes []int32
+	for _, etype := range SupportedETypes {
+		if _, _, ok := kk.keytab.Key(kk.principal, kk.realm, etype); ok {
+			etypes = append(etypes, etype)
+		}
+	}
+	return etypes
+}
+
+func (kk keytabKeys) key(etype int32, _ string, _ []byte) (EncryptionKey, error) {
+	key, _, ok := kk.keytab.Key(kk.principal, kk.realm, etype)
+	if !ok {
+		return EncryptionKey{}, fmt.Errorf("keytab has no key of type %d for %s@%s", etype, kk.principal, kk.realm)
+	}
+	return key, nil
+}
+
+func (c *Client) keys() (clientKeys, error) {
+	if c.usePassword {
+		return passwordKeys{password: c.password}, nil
+	}
+	kt, err := LoadKeytab(c.keytabName)
+	if err != nil {
+		return nil, fmt.Errorf("no valid ticket in the credential cache %s and no keytab: %v", c.ccacheName, err)
+	}
+	keys := keytabKeys{keytab: kt, principal: c.username, realm: c.realm}
+	if len(keys.etypes()) == 0 {
+		return nil, fmt.Errorf("keytab %s has no supported keys for %s@%s", c.keytabName, c.username, c.realm)
+	}
+	return keys, nil
+}
+
+// asExchange gets a ticket-granting ticket with the client's long-term key.
+func (c *Client) asExchange(ctx context.Context) (*Credential, error) {
+	keys, err := c.keys()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := randomUint31()
+	if err != nil {
+		return nil, err
+	}
+	body := KDCReqBody{
+		KDCOptions: Flags(),
+		CName:      c.username,
+		Realm:      c.realm,
+		SName:      NewPrincipalName(NameTypeSrvInst, "krbtgt", c.realm),
+		Till:       KerberosTime(time.Now().Add(ticketLifetime)),
+		Nonce:      nonce,
+		EType:      keys.etypes(),
+	}
+
+	// the first request is sent without pre-authentication to learn how the KDC derives the client's key
+	rep, err := c.kdcRequest(ctx, c.realm, MsgTypeASReq, body, nil)
+	var key EncryptionKey
+	if krbErr, ok := err.(*KRBError); ok && krbErr.ErrorCode == ErrPreauthRequired {
+		var methods []PAData
+		if _, err = asn1.Unmarshal(krbErr.EData, &methods); err != nil {
+			return nil, fmt.Errorf("invalid pre-authentication methods: %v", err)
+		}
+		if key, err = c.preauthKey(keys, methods); err != nil {
+			return nil, err
+		}
+		padata, err := encTimestamp(key)
+		if err != nil {
+			return nil, err
+		}
+		rep, err = c.kdcRequest(ctx, c.realm, MsgTypeASReq, body, []PAData{padata})
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	} else if key, err = c.replyKey(keys, rep); err != nil {
+		return nil, err
+	}
+
+	return c.credential(rep, key, KeyUsageASRepEncPart, nonce)
+}
+
+// preauthKey returns the client's key for the first supported encryption type the KDC offers.
+func (c *Client) preauthKey(keys clientKeys, methods []PAData) (EncryptionKey, error) {
+	for _, method := range methods {
+		if method.PADataType != PADataETypeInfo2 {
+			continue
+		}
+		var entries []ETypeInfo2Entry
+		if _, err := asn1.Unmarshal(method.PADataValue, &entries); err != nil {
+			return EncryptionKey{}, fmt.Errorf("invalid ETYPE-INFO2: %v", err)
+		}
+		for _, entry := range entries {
+			if hasEType(keys.etypes(), entry.EType) {
+				return keys.key(entry.EType, c.salt(entry), entry.S2KParams)
+			}
+		}
+	}
+	// without ETYPE-INFO2, the key of the preferred encryption type with the default salt is used
+	etypes := keys.etypes()
+	return keys.key(etypes[0], c.salt(ETypeInfo2Entry{}), nil)
+}
+
+// replyKey returns the client's key for a reply that did not require pre-authentication.
+func (c *Client) replyKey(keys clientKeys, rep *KDCRep) (EncryptionKey, error) {
+	entry := ETypeInfo2Entry{EType: rep.EncPart.EType}
+	for _, padata := range rep.PAData {
+		if padata.PADataType != PADataETypeInfo2 {
+			continue
+		}
+		var entries []ETypeInfo2Entry
+		if _, err := asn1.Unmarshal(padata.PADataValue, &entries); err == nil && len(entries) > 0 {
+			entry = entries[0]
+		}
+	}
+	return keys.key(rep.EncPart.EType, c.salt(entry), entry.S2KParams)
+}
+
+// salt returns the salt of an ETYPE-INFO2 entry or, if it has none, the default salt.
+func (c *Client) salt(entry ETypeInfo2Entry) string {
+	if entry.Salt != "" {
+		return entry.Salt
+	}
+	return c.realm + strings.Join(c.username.NameString, "")
+}
+
+func hasEType(etypes []int32, etype int32) bool {
+	for _, e := range etypes {
+		if e == etype {
+			return true
+		}
+	}
+	return false
+}
+
+// encTimestamp returns the encrypted timestamp pre-authentication data.
+func encTimestamp(key EncryptionKey) (PAData, error) {
+	now := time.Now()
+	ts, err := MarshalValue(PAEncTimestamp{
+		PATimestamp: KerberosTime(now),
+		PAUSec:      int32(now.Nanosecond() / 1000),
+	})
+	if err != nil {
+		return PAData{}, err
+	}
+	encrypted, err := Encrypt(key, KeyUsageASReqTimestamp, ts)
+	if err != nil {
+		return PAData{}, err
+	}
+	value, err := MarshalValue(encrypted)
+	if err != nil {
+		return PAData{}, err
+	}
+	return PAData{PADataType: PADataEncTimestamp, PADataValue: value}, nil
+}
+
+// tgsExchange gets a ticket for the service with a ticket-granting ticket. realm is the realm of the KDC, which is
+// the realm of the ticket-granting ticket's service.
+func (c *Client) tgsExchange(ctx context.Context, tgt *Credential, service PrincipalName,
+	realm string) (*Credential, error) {
+
+	nonce, err := randomUint31()
+	if err != nil {
+		return nil, err
+	}
+	body := KDCReqBody{
+		KDCOptions: Flags(),
+		Realm:      realm,
+		SName:      service,
+		Till:       KerberosTime(time.Now().Add(ticketLifetime)),
+		Nonce:      nonce,
+		EType:      SupportedETypes,
+	}
+	encodedBody, err := MarshalValue(body)
+	if err != nil {
+		return nil, err
+	}
+	cksum, err := GetChecksum(tgt.Key, KeyUsageTGSReqAuthChecksum, encodedBody)
+	if err != nil {
+		return nil, err
+	}
+	apReq, err := c.apReq(tgt, Flags(), cksum, EncryptionKey{}, 0, KeyUsageTGSReqAuthenticator)
+	if err != nil {
+		return nil, err
+	}
+
+	rep, err := c.kdcRequest(ctx, realm, MsgTypeTGSReq, body, []PAData{{PADataType: PADataTGSReq, PADataValue: apReq}})
+	if err != nil {
+		return nil, err
+	}
+	return c.credential(rep, tgt.Key, KeyUsageTGSRepEncPartSession, nonce)
+}
+
+// apReq returns an encoded AP request for a ticket.
+func (c *Client) apReq(cred *Credential, options asn1.BitString, cksum Checksum, subkey EncryptionKey,
+	seqNumber int64, usage uint32) ([]byte, error) {
+
+	now := time.Now()
+	authenticator := Authenticator{
+		AuthenticatorVNO: protocolVersion,
+		CRealm:           c.realm,
+		CName:            c.username,
+		Cksum:            cksum,
+		CUSec:            int32(now.Nanosecond() / 1000),
+		CTime:            KerberosTime(now),
+		SubKey:           subkey,
+		SeqNumber:        seqNumber,
+	}
+	return newAPReq(cred, authenticator, options, usage)
+}
+
+func newAPReq(cred *Credential, authenticator Authenticator, options asn1.BitString, usage uint32) ([]byte, error) {
+	encoded, err := Marshal(TagAuthenticator, authenticator)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := Encrypt(cred.Key, usage, encoded)
+	if err != nil {
+		return nil, err
+	}
+	return Marshal(MsgTypeAPReq, APReq{
+		PVNO:          protocolVersion,
+		MsgType:       MsgTypeAPReq,
+		APOptions:     options,
+		Ticket:        Explicit(3, cred.Ticket),
+		Authenticator: encrypted,
+	})
+}
+
+// credential returns the credential of a KDC reply.
+func (c *Client) credential(rep *KDCRep, key EncryptionKey, usage uint32, nonce int64) (*Credential, error) {
+	decrypted, err := Decrypt(key, usage, rep.EncPart)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt KDC reply: %v", err)
+	}
+	var part EncKDCRepPart
+	// some KDCs tag the encrypted part of AS replies as the encrypted part of TGS replies
+	tag := MessageTag(decrypted)
+	if tag != TagEncASRepPart && tag != TagEncTGSRepPart {
+		return nil, errors.New("invalid encrypted part in KDC reply")
+	}
+	if err = Unmarshal(decrypted, tag, &part); err != nil {
+		return nil, fmt.Errorf("invalid encrypted part in KDC reply: %v", err)
+	}
+	if part.Nonce != nonce {
+		return nil, errors.New("KDC reply does not match the request")
+	}
+
+	return &Credential{
+		Client:      rep.CName,
+		ClientRealm: rep.CRealm,
+		Server:      part.SName,
+		ServerRealm: part.SRealm,
+		Key:         part.Key,
+		AuthTime:    part.AuthTime,
+		StartTime:   part.StartTime,
+		EndTime:     part.EndTime,
+		RenewTill:   part.RenewTill,
+		Ticket:      rep.Ticket.Bytes,
+	}, nil
+}
+
+// kdcRequest sends an AS or TGS request to a KDC of the realm and returns the reply.
+func (c *Client) kdcRequest(ctx context.Context, realm string, msgType int32, body KDCReqBody,
+	padata []PAData) (*KDCRep, error) {
+
+	req, err := Marshal(int(msgType), KDCReq{
+		PVNO:    protocolVersion,
+		MsgType: msgType,
+		PAData:  padata,
+		ReqBody: body,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := c.send(ctx, realm, req)
+	if err != nil {
+		return nil, err
+	}
+	switch MessageTag(b) {
+	case MsgTypeKRBError:
+		krbErr := &KRBError{}
+		if err = Unmarshal(b, MsgTypeKRBError, krbErr); err != nil {
+			return nil, fmt.Errorf("invalid KDC error: %v", err)
+		}
+		return nil, krbErr
+	case int(msgType) + 1:
+		rep := &KDCRep{}
+		if err = Unmarshal(b, int(msgType)+1, rep); err != nil {
+			return nil, fmt.Errorf("invalid KDC reply: %v", err)
+		}
+		return rep, nil
+	default:
+		return nil, errors.New("unexpected KDC reply")
+	}
+}
+
+// send sends a request to the KDCs of the realm over TCP until one replies.
+func (c *Client) send(ctx context.Context, realm string, req []byte) ([]byte, error) {
+	addrs, err := c.config.KDCAddrs(ctx, realm)
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		var b []byte
+		if b, err = sendTCP(ctx, addr, req); err == nil {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot reach a KDC for realm %s: %v", realm, err)
+}
+
+func sendTCP(ctx context.Context, addr string, req []byte) ([]byte, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, kdcTimeout)
+		defer cancel()
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	msg := make([]byte, 4+len(req))
+	binary.BigEndian.PutUint32(msg, uint32(len(req)))
+	copy(msg[4:], req)
+	if _, err = conn.Write(msg); err != nil {
+		return nil, err
+	}
+
+	size := make([]byte, 4)
+	if _, err = io.ReadFull(conn, size); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size)
+	if n > maxKDCReplySize {
+		return nil, fmt.Errorf("KDC reply of %d bytes is too large", n)
+	}
+	b := make([]byte, n)
+	if _, err = io.ReadFull(conn, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// randomUint31 returns a random positive number that fits in the UInt32 type of Kerberos on all implementations.
+func randomUint31() (int64, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint32(b)&0x7fffffff) | 1, nil
+}
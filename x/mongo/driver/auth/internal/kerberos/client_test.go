@@ -0,0 +1,215 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package kerberos_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/appveen/mongo-go-driver/x/mongo/driver/auth/internal/kerberos"
+	"github.com/appveen/mongo-go-driver/x/mongo/driver/auth/internal/kerberos/kerberostest"
+	"github.com/stretchr/testify/require"
+)
+
+// testKDC is a KDC for the realms EXAMPLE.COM and OTHER.COM with a user and a service in each realm.
+type testKDC struct {
+	*kerberostest.KDC
+	config      *Config
+	dir         string
+	serviceKeys map[string]EncryptionKey
+}
+
+func newTestKDC(t *testing.T) *testKDC {
+	kdc, err := kerberostest.NewKDC("EXAMPLE.COM", "OTHER.COM")
+	require.NoError(t, err)
+	config, err := ParseConfig(kdc.Config())
+	require.NoError(t, err)
+	dir, err := ioutil.TempDir("", "kerberos")
+	require.NoError(t, err)
+
+	tk := &testKDC{KDC: kdc, config: config, dir: dir, serviceKeys: make(map[string]EncryptionKey)}
+	for _, realm := range []string{"EXAMPLE.COM", "OTHER.COM"} {
+		require.NoError(t, kdc.AddPassword("user@"+realm, "pencil"))
+		service := "mongodb/db.example.com@" + realm
+		if tk.serviceKeys[service], err = kdc.AddKey(service); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// only the credential files of the test are used
+	tk.setenv(t, "KRB5CCNAME", filepath.Join(dir, "ccache"))
+	tk.setenv(t, "KRB5_CLIENT_KTNAME", filepath.Join(dir, "client.keytab"))
+	return tk
+}
+
+func (tk *testKDC) setenv(t *testing.T, key, value string) {
+	old, ok := os.LookupEnv(key)
+	require.NoError(t, os.Setenv(key, value))
+	t.Cleanup(func() {
+		if ok {
+			_ = os.Setenv(key, old)
+		} else {
+			_ = os.Unsetenv(key)
+		}
+	})
+}
+
+func (tk *testKDC) close() {
+	_ = tk.Close()
+	_ = os.RemoveAll(tk.dir)
+}
+
+// serviceTicket gets a ticket for the service in the realm and verifies it with the service's key.
+func (tk *testKDC) serviceTicket(t *testing.T, c *Client, realm string) *Credential {
+	service := NewPrincipalName(NameTypeSrvHost, "mongodb", "db.example.com")
+	cred, err := c.ServiceTicket(context.Background(), service, realm)
+	require.NoError(t, err)
+
+	part, err := kerberostest.DecryptTicket(tk.serviceKeys["mongodb/db.example.com@"+realm], cred.Ticket)
+	require.NoError(t, err)
+	require.Equal(t, part.Key, cred.Key)
+	require.Equal(t, "user", part.CName.String())
+	require.Equal(t, "EXAMPLE.COM", part.CRealm)
+	return cred
+}
+
+func TestClient(t *testing.T) {
+	t.Run("password", func(t *testing.T) {
+		tk := newTestKDC(t)
+		defer tk.close()
+
+		c, err := NewClient(tk.config, "user@EXAMPLE.COM", "pencil", true)
+		require.NoError(t, err)
+		tk.serviceTicket(t, c, "EXAMPLE.COM")
+		as, tgs := tk.Requests()
+		require.Equal(t, 1, as)
+		require.Equal(t, 1, tgs)
+
+		// the ticket is cached
+		tk.serviceTicket(t, c, "EXAMPLE.COM")
+		as, tgs = tk.Requests()
+		require.Equal(t, 1, as)
+		require.Equal(t, 1, tgs)
+	})
+	t.Run("default realm", func(t *testing.T) {
+		tk := newTestKDC(t)
+		defer tk.close()
+
+		c, err := NewClient(tk.config, "user", "pencil", true)
+		require.NoError(t, err)
+		name, realm := c.Principal()
+		require.Equal(t, "user", name.String())
+		require.Equal(t, "EXAMPLE.COM", realm)
+		tk.serviceTicket(t, c, "EXAMPLE.COM")
+	})
+	t.Run("wrong password", func(t *testing.T) {
+		tk := newTestKDC(t)
+		defer tk.close()
+
+		c, err := NewClient(tk.config, "user@EXAMPLE.COM", "pen", true)
+		require.NoError(t, err)
+		_, err = c.ServiceTicket(context.Background(), NewPrincipalName(NameTypeSrvHost, "mongodb", "db.example.com"),
+			"EXAMPLE.COM")
+		krbErr, ok := err.(*KRBError)
+		require.True(t, ok, "expected a KRBError, got %v", err)
+		require.Equal(t, int32(ErrPreauthFailed), krbErr.ErrorCode)
+	})
+	t.Run("unknown service", func(t *testing.T) {
+		tk := newTestKDC(t)
+		defer tk.close()
+
+		c, err := NewClient(tk.config, "user@EXAMPLE.COM", "pencil", true)
+		require.NoError(t, err)
+		_, err = c.ServiceTicket(context.Background(), NewPrincipalName(NameTypeSrvHost, "mongodb", "unknown"),
+			"EXAMPLE.COM")
+		krbErr, ok := err.(*KRBError)
+		require.True(t, ok, "expected a KRBError, got %v", err)
+		require.Equal(t, int32(ErrSPrincipalUnknown), krbErr.ErrorCode)
+	})
+	t.Run("cross-realm", func(t *testing.T) {
+		tk := newTestKDC(t)
+		defer tk.close()
+
+		c, err := NewClient(tk.config, "user@EXAMPLE.COM", "pencil", true)
+		require.NoError(t, err)
+		tk.serviceTicket(t, c, "OTHER.COM")
+		as, tgs := tk.Requests()
+		require.Equal(t, 1, as)
+		require.Equal(t, 2, tgs)
+	})
+	t.Run("keytab", func(t *testing.T) {
+		tk := newTestKDC(t)
+		defer tk.close()
+
+		key, err := tk.AddKey("user@EXAMPLE.COM")
+		require.NoError(t, err)
+		kt := &Keytab{Entries: []KeytabEntry{
+			{Principal: NewPrincipalName(NameTypePrincipal, "user"), Realm: "EXAMPLE.COM", KVNO: 2, Key: key},
+		}}
+		require.NoError(t, ioutil.WriteFile(filepath.Join(tk.dir, "client.keytab"), kt.Marshal(), 0600))
+
+		c, err := NewClient(tk.config, "", "", false)
+		require.NoError(t, err)
+		name, realm := c.Principal()
+		require.Equal(t, "user", name.String())
+		require.Equal(t, "EXAMPLE.COM", realm)
+		tk.serviceTicket(t, c, "EXAMPLE.COM")
+	})
+	t.Run("credential cache", func(t *testing.T) {
+		tk := newTestKDC(t)
+		defer tk.close()
+
+		// kinit with another client
+		kinit, err := NewClient(tk.config, "user@EXAMPLE.COM", "pencil", true)
+		require.NoError(t, err)
+		tgt, err := kinit.ServiceTicket(context.Background(), NewPrincipalName(NameTypeSrvInst, "krbtgt",
+			"EXAMPLE.COM"), "EXAMPLE.COM")
+		require.NoError(t, err)
+		cc := &CCache{
+			Principal:   NewPrincipalName(NameTypePrincipal, "user"),
+			Realm:       "EXAMPLE.COM",
+			Credentials: []*Credential{tgt},
+		}
+		require.NoError(t, ioutil.WriteFile(filepath.Join(tk.dir, "ccache"), cc.Marshal(), 0600))
+		_, tgsBefore := tk.Requests()
+
+		for _, username := range []string{"", "user@EXAMPLE.COM"} {
+			c, err := NewClient(tk.config, username, "", false)
+			require.NoError(t, err)
+			tk.serviceTicket(t, c, "EXAMPLE.COM")
+		}
+		as, tgs := tk.Requests()
+		require.Equal(t, 1, as, "the ticket-granting ticket of the credential cache should be used")
+		require.Equal(t, tgsBefore+2, tgs)
+	})
+	t.Run("no credentials", func(t *testing.T) {
+		tk := newTestKDC(t)
+		defer tk.close()
+
+		_, err := NewClient(tk.config, "", "", false)
+		require.Error(t, err)
+
+		c, err := NewClient(tk.config, "user@EXAMPLE.COM", "", false)
+		require.NoError(t, err)
+		_, err = c.ServiceTicket(context.Background(), NewPrincipalName(NameTypeSrvHost, "mongodb", "db.example.com"),
+			"EXAMPLE.COM")
+		require.Error(t, err)
+	})
+	t.Run("unreachable KDC", func(t *testing.T) {
+		tk := newTestKDC(t)
+		tk.close()
+
+		c, err := NewClient(tk.config, "user@EXAMPLE.COM", "pencil", true)
+		require.NoError(t, err)
+		_, err = c.ServiceTicket(context.Background(), NewPrincipalName(NameTypeSrvHost, "mongodb", "db.example.com"),
+			"EXAMPLE.COM")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,221 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package kerberos
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultConfigPath   = "/etc/krb5.conf"
+	defaultCCacheName   = "FILE:/tmp/krb5cc_%{uid}"
+	defaultClientKeytab = "FILE:/var/kerberos/krb5/user/%{euid}/client.keytab"
+	defaultKDCPort      = "88"
+)
+
+// Config is the part of the Kerberos configuration (krb5.conf) used by the client.
+type Config struct {
+	DefaultRealm            string
+	DefaultCCacheName       string
+	DefaultClientKeytabName string
+	DNSLookupKDC            bool
+	KDCs                    map[string][]string // KDC addresses by realm
+	DomainRealm             map[string]string   // realms by host name or domain, which starts with a dot
+}
+
+// LoadConfig reads the configuration files listed in the KRB5_CONFIG environment variable, or /etc/krb5.conf. Files
+// that do not exist are ignored.
+func LoadConfig() (*Config, error) {
+	paths := []string{defaultConfigPath}
+	if env := os.Getenv("KRB5_CONFIG"); env != "" {
+		paths = filepath.SplitList(env)
+	}
+
+	var contents []string
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		contents = append(contents, string(b))
+	}
+	return ParseConfig(strings.Join(contents, "\n"))
+}
+
+// ParseConfig parses a configuration in the krb5.conf format.
+func ParseConfig(s string) (*Config, error) {
+	c := &Config{
+		DNSLookupKDC: true,
+		KDCs:         make(map[string][]string),
+		DomainRealm:  make(map[string]string),
+	}
+
+	var section, realm string
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			end := strings.Index(line, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("krb5.conf line %d: invalid section", n)
+			}
+			section, realm = line[1:end], ""
+			continue
+		}
+		if line == "}" {
+			realm = ""
+			continue
+		}
+
+		i := strings.Index(line, "=")
+		if i < 0 {
+			// directives such as include are not supported
+			continue
+		}
+		key := strings.TrimSpace(line[:i])
+		value := strings.TrimSuffix(strings.TrimSpace(line[i+1:]), "*")
+		value = strings.TrimSpace(value)
+
+		switch {
+		case value == "{":
+			if section == "realms" {
+				realm = key
+			}
+		case section == "libdefaults":
+			switch key {
+			case "default_realm":
+				c.DefaultRealm = value
+			case "default_ccache_name":
+				c.DefaultCCacheName = value
+			case "default_client_keytab_name":
+				c.DefaultClientKeytabName = value
+			case "dns_lookup_kdc":
+				c.DNSLookupKDC = parseBool(value)
+			}
+		case section == "realms" && realm != "" && key == "kdc":
+			c.KDCs[realm] = append(c.KDCs[realm], value)
+		case section == "domain_realm":
+			c.DomainRealm[strings.ToLower(key)] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func parseBool(s string) bool {
+	switch strings.ToLower(s) {
+	case "true", "yes", "on", "1":
+		return true
+	default:
+		return false
+	}
+}
+
+// CCacheName returns the name of the default credential cache.
+func (c *Config) CCacheName() string {
+	if name := os.Getenv("KRB5CCNAME"); name != "" {
+		return name
+	}
+	if c.DefaultCCacheName != "" {
+		return expandName(c.DefaultCCacheName)
+	}
+	return expandName(defaultCCacheName)
+}
+
+// ClientKeytabName returns the name of the default client keytab.
+func (c *Config) ClientKeytabName() string {
+	if name := os.Getenv("KRB5_CLIENT_KTNAME"); name != "" {
+		return name
+	}
+	if c.DefaultClientKeytabName != "" {
+		return expandName(c.DefaultClientKeytabName)
+	}
+	return expandName(defaultClientKeytab)
+}
+
+// expandName expands the user ID parameters of credential names.
+func expandName(name string) string {
+	return strings.NewReplacer(
+		"%{uid}", strconv.Itoa(os.Getuid()),
+		"%{euid}", strconv.Itoa(os.Geteuid()),
+		"%{TEMP}", os.TempDir(),
+	).Replace(name)
+}
+
+// HostRealm returns the realm of a host from the domain_realm mappings, or fallback if none matches.
+func (c *Config) HostRealm(host, fallback string) string {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" {
+		return fallback
+	}
+	if realm, ok := c.DomainRealm[host]; ok {
+		return realm
+	}
+	for domain := host; ; {
+		i := strings.Index(domain[1:], ".")
+		if i < 0 {
+			return fallback
+		}
+		domain = domain[i+1:]
+		if realm, ok := c.DomainRealm[domain]; ok {
+			return realm
+		}
+	}
+}
+
+// lookupSRV is replaced in tests.
+var lookupSRV = net.DefaultResolver.LookupSRV
+
+// KDCAddrs returns the addresses of the KDCs of a realm from the configuration or, if there are none, from DNS.
+func (c *Config) KDCAddrs(ctx context.Context, realm string) ([]string, error) {
+	var addrs []string
+	for _, kdc := range c.KDCs[realm] {
+		if strings.Contains(kdc, "://") {
+			// KDC proxies are not supported
+			continue
+		}
+		kdc = strings.TrimPrefix(strings.TrimPrefix(kdc, "tcp/"), "udp/")
+		if _, _, err := net.SplitHostPort(kdc); err != nil {
+			kdc = net.JoinHostPort(strings.Trim(kdc, "[]"), defaultKDCPort)
+		}
+		addrs = append(addrs, kdc)
+	}
+	if len(addrs) > 0 || !c.DNSLookupKDC {
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("no KDC configured for realm %s", realm)
+		}
+		return addrs, nil
+	}
+
+	_, records, err := lookupSRV(ctx, "kerberos", "tcp", realm)
+	if err != nil {
+		return nil, fmt.Errorf("cannot locate a KDC for realm %s: %v", realm, err)
+	}
+	for _, record := range records {
+		addrs = append(addrs, net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port))))
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no KDC found for realm %s", realm)
+	}
+	return addrs, nil
+}
@@ -0,0 +1,125 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package kerberos
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `
+# comment
+[libdefaults]
+	default_realm = EXAMPLE.COM
+	default_ccache_name = FILE:/tmp/cc_%{uid}
+	dns_lookup_kdc = true
+
+[realms]
+	EXAMPLE.COM = {
+		kdc = kdc1.example.com
+		kdc = tcp/kdc2.example.com:8888
+		admin_server = kdc1.example.com
+	}
+	OTHER.COM = {
+		kdc = [::1]
+		kdc = https://kdc.other.com/KdcProxy
+	}
+
+[domain_realm]
+	.example.com = EXAMPLE.COM
+	db.Other.com = OTHER.COM
+	.sub.example.com = SUB.EXAMPLE.COM *
+`
+
+func TestConfig(t *testing.T) {
+	config, err := ParseConfig(testConfig)
+	require.NoError(t, err)
+
+	t.Run("parse", func(t *testing.T) {
+		require.Equal(t, "EXAMPLE.COM", config.DefaultRealm)
+		require.Equal(t, "FILE:/tmp/cc_%{uid}", config.DefaultCCacheName)
+		require.True(t, config.DNSLookupKDC)
+		require.Equal(t, []string{"kdc1.example.com", "tcp/kdc2.example.com:8888"}, config.KDCs["EXAMPLE.COM"])
+	})
+	t.Run("invalid section", func(t *testing.T) {
+		_, err := ParseConfig("[libdefaults\n")
+		require.Error(t, err)
+	})
+	t.Run("credential names", func(t *testing.T) {
+		ccname, ktname := os.Getenv("KRB5CCNAME"), os.Getenv("KRB5_CLIENT_KTNAME")
+		defer func() {
+			_ = os.Setenv("KRB5CCNAME", ccname)
+			_ = os.Setenv("KRB5_CLIENT_KTNAME", ktname)
+		}()
+		_ = os.Unsetenv("KRB5CCNAME")
+		_ = os.Unsetenv("KRB5_CLIENT_KTNAME")
+
+		require.Equal(t, "FILE:/tmp/cc_"+strconv.Itoa(os.Getuid()), config.CCacheName())
+		require.Equal(t, "FILE:/var/kerberos/krb5/user/"+strconv.Itoa(os.Geteuid())+"/client.keytab",
+			config.ClientKeytabName())
+
+		_ = os.Setenv("KRB5CCNAME", "FILE:/tmp/env_cc")
+		_ = os.Setenv("KRB5_CLIENT_KTNAME", "/tmp/env.keytab")
+		require.Equal(t, "FILE:/tmp/env_cc", config.CCacheName())
+		require.Equal(t, "/tmp/env.keytab", config.ClientKeytabName())
+	})
+	t.Run("host realm", func(t *testing.T) {
+		tests := []struct {
+			host  string
+			realm string
+		}{
+			{"db.example.com", "EXAMPLE.COM"},
+			{"DB.EXAMPLE.COM.", "EXAMPLE.COM"},
+			{"db.sub.example.com", "SUB.EXAMPLE.COM"},
+			{"db.other.com", "OTHER.COM"},
+			{"db2.other.com", "FALLBACK"},
+			{"localhost", "FALLBACK"},
+			{"", "FALLBACK"},
+		}
+		for _, tc := range tests {
+			require.Equal(t, tc.realm, config.HostRealm(tc.host, "FALLBACK"), tc.host)
+		}
+	})
+	t.Run("KDC addresses", func(t *testing.T) {
+		addrs, err := config.KDCAddrs(context.Background(), "EXAMPLE.COM")
+		require.NoError(t, err)
+		require.Equal(t, []string{"kdc1.example.com:88", "kdc2.example.com:8888"}, addrs)
+
+		addrs, err = config.KDCAddrs(context.Background(), "OTHER.COM")
+		require.NoError(t, err)
+		require.Equal(t, []string{"[::1]:88"}, addrs)
+	})
+	t.Run("KDC addresses from DNS", func(t *testing.T) {
+		defer func(f func(context.Context, string, string, string) (string, []*net.SRV, error)) {
+			lookupSRV = f
+		}(lookupSRV)
+		lookupSRV = func(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+			if service != "kerberos" || proto != "tcp" || name != "DNS.COM" {
+				return "", nil, errors.New("no such host")
+			}
+			return "", []*net.SRV{{Target: "kdc.dns.com.", Port: 750}}, nil
+		}
+
+		addrs, err := config.KDCAddrs(context.Background(), "DNS.COM")
+		require.NoError(t, err)
+		require.Equal(t, []string{"kdc.dns.com:750"}, addrs)
+
+		_, err = config.KDCAddrs(context.Background(), "UNKNOWN.COM")
+		require.Error(t, err)
+
+		config.DNSLookupKDC = false
+		defer func() { config.DNSLookupKDC = true }()
+		_, err = config.KDCAddrs(context.Background(), "DNS.COM")
+		require.Error(t, err)
+	})
+}
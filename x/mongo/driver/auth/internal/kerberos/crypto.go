@@ -0,0 +1,415 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package kerberos
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Supported encryption types.
+const (
+	AES128CTSHMACSHA196 int32 = 17
+	AES256CTSHMACSHA196 int32 = 18
+)
+
+// Checksum types of the supported encryption types.
+const (
+	HMACSHA196AES128 int32 = 15
+	HMACSHA196AES256 int32 = 16
+)
+
+// Key usage numbers (RFC 4120 section 7.5.1 and RFC 4121 section 2).
+const (
+	KeyUsageASReqTimestamp       uint32 = 1
+	KeyUsageKDCRepTicket         uint32 = 2
+	KeyUsageASRepEncPart         uint32 = 3
+	KeyUsageTGSReqAuthChecksum   uint32 = 6
+	KeyUsageTGSReqAuthenticator  uint32 = 7
+	KeyUsageTGSRepEncPartSession uint32 = 8
+	KeyUsageAPReqAuthenticator   uint32 = 11
+	KeyUsageAPRepEncPart         uint32 = 12
+	KeyUsageAcceptorSeal         uint32 = 22
+	KeyUsageAcceptorSign         uint32 = 23
+	KeyUsageInitiatorSeal        uint32 = 24
+	KeyUsageInitiatorSign        uint32 = 25
+)
+
+const (
+	aesBlockSize     = aes.BlockSize
+	hmacSize         = 12 // the truncated HMAC-SHA1 size of the AES encryption types
+	defaultS2KParams = 4096
+)
+
+// SupportedETypes are the supported encryption types, in order of preference.
+var SupportedETypes = []int32{AES256CTSHMACSHA196, AES128CTSHMACSHA196}
+
+// ErrIntegrity is returned when decrypted data or a checksum fails verification.
+var ErrIntegrity = errors.New("integrity check failed")
+
+// keySize returns the key size of an encryption type.
+func keySize(etype int32) (int, error) {
+	switch etype {
+	case AES128CTSHMACSHA196:
+		return 16, nil
+	case AES256CTSHMACSHA196:
+		return 32, nil
+	default:
+		return 0, fmt.Errorf("unsupported encryption type %d", etype)
+	}
+}
+
+// ChecksumType returns the checksum type of an encryption type.
+func ChecksumType(etype int32) (int32, error) {
+	switch etype {
+	case AES128CTSHMACSHA196:
+		return HMACSHA196AES128, nil
+	case AES256CTSHMACSHA196:
+		return HMACSHA196AES256, nil
+	default:
+		return 0, fmt.Errorf("unsupported encryption type %d", etype)
+	}
+}
+
+// SupportedEType returns true if the encryption type is supported.
+func SupportedEType(etype int32) bool {
+	_, err := keySize(etype)
+	return err == nil
+}
+
+// StringToKey derives a key from a password (RFC 3962 section 4). params are the s2kparams from the KDC, which
+// contain the PBKDF2 iteration count, or nil for the default.
+func StringToKey(etype int32, password, salt string, params []byte) (EncryptionKey, error) {
+	size, err := keySize(etype)
+	if err != nil {
+		return EncryptionKey{}, err
+	}
+	iterations := uint32(defaultS2KParams)
+	if len(params) > 0 {
+		if len(params) != 4 {
+			return EncryptionKey{}, fmt.Errorf("invalid s2kparams length %d", len(params))
+		}
+		iterations = binary.BigEndian.Uint32(params)
+		if iterations == 0 {
+			// an iteration count of 0 stands for 2^32, which is an impractical cost
+			return EncryptionKey{}, errors.New("unsupported s2kparams iteration count")
+		}
+	}
+
+	tkey := pbkdf2.Key([]byte(password), []byte(salt), int(iterations), size, sha1.New)
+	key, err := deriveKey(tkey, []byte("kerberos"))
+	if err != nil {
+		return EncryptionKey{}, err
+	}
+	return EncryptionKey{KeyType: etype, KeyValue: key}, nil
+}
+
+// RandomKey returns a new random key.
+func RandomKey(etype int32) (EncryptionKey, error) {
+	size, err := keySize(etype)
+	if err != nil {
+		return EncryptionKey{}, err
+	}
+	key := make([]byte, size)
+	if _, err = rand.Read(key); err != nil {
+		return EncryptionKey{}, err
+	}
+	return EncryptionKey{KeyType: etype, KeyValue: key}, nil
+}
+
+// Encrypt encrypts plaintext with the key for the usage (RFC 3961 section 5.3).
+func Encrypt(key EncryptionKey, usage uint32, plaintext []byte) (EncryptedData, error) {
+	ciphertext, err := encrypt(key, usage, plaintext)
+	if err != nil {
+		return EncryptedData{}, err
+	}
+	return EncryptedData{EType: key.KeyType, Cipher: ciphertext}, nil
+}
+
+// Decrypt decrypts data encrypted with the key for the usage.
+func Decrypt(key EncryptionKey, usage uint32, data EncryptedData) ([]byte, error) {
+	if data.EType != key.KeyType {
+		return nil, fmt.Errorf("data encrypted with type %d cannot be decrypted with a key of type %d", data.EType,
+			key.KeyType)
+	}
+	return decrypt(key, usage, data.Cipher)
+}
+
+func encrypt(key EncryptionKey, usage uint32, plaintext []byte) ([]byte, error) {
+	ke, ki, err := usageKeys(key, usage)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, aesBlockSize+len(plaintext))
+	if _, err = rand.Read(data[:aesBlockSize]); err != nil {
+		return nil, err
+	}
+	copy(data[aesBlockSize:], plaintext)
+
+	ciphertext, err := encryptCTS(ke, data)
+	if err != nil {
+		return nil, err
+	}
+	return append(ciphertext, hmacSHA1(ki, data)[:hmacSize]...), nil
+}
+
+func decrypt(key EncryptionKey, usage uint32, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < aesBlockSize+hmacSize {
+		return nil, errors.New("ciphertext is too short")
+	}
+	ke, ki, err := usageKeys(key, usage)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := ciphertext[len(ciphertext)-hmacSize:]
+	data, err := decryptCTS(ke, ciphertext[:len(ciphertext)-hmacSize])
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(mac, hmacSHA1(ki, data)[:hmacSize]) {
+		return nil, ErrIntegrity
+	}
+	return data[aesBlockSize:], nil
+}
+
+// GetChecksum returns the keyed checksum of data for the usage.
+func GetChecksum(key EncryptionKey, usage uint32, data []byte) (Checksum, error) {
+	sum, err := checksum(key, usage, data)
+	if err != nil {
+		return Checksum{}, err
+	}
+	cksumType, err := ChecksumType(key.KeyType)
+	if err != nil {
+		return Checksum{}, err
+	}
+	return Checksum{CksumType: cksumType, Checksum: sum}, nil
+}
+
+// VerifyChecksum verifies the keyed checksum of data for the usage.
+func VerifyChecksum(key EncryptionKey, usage uint32, data []byte, cksum Checksum) error {
+	cksumType, err := ChecksumType(key.KeyType)
+	if err != nil {
+		return err
+	}
+	if cksum.CksumType != cksumType {
+		return fmt.Errorf("unexpected checksum type %d", cksum.CksumType)
+	}
+	sum, err := checksum(key, usage, data)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(sum, cksum.Checksum) {
+		return ErrIntegrity
+	}
+	return nil
+}
+
+func checksum(key EncryptionKey, usage uint32, data []byte) ([]byte, error) {
+	kc, err := deriveKey(key.KeyValue, usageConstant(usage, 0x99))
+	if err != nil {
+		return nil, err
+	}
+	return hmacSHA1(kc, data)[:hmacSize], nil
+}
+
+// usageKeys returns the encryption and integrity keys for the usage.
+func usageKeys(key EncryptionKey, usage uint32) ([]byte, []byte, error) {
+	size, err := keySize(key.KeyType)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(key.KeyValue) != size {
+		return nil, nil, fmt.Errorf("invalid key length %d for encryption type %d", len(key.KeyValue), key.KeyType)
+	}
+	ke, err := deriveKey(key.KeyValue, usageConstant(usage, 0xAA))
+	if err != nil {
+		return nil, nil, err
+	}
+	ki, err := deriveKey(key.KeyValue, usageConstant(usage, 0x55))
+	if err != nil {
+		return nil, nil, err
+	}
+	return ke, ki, nil
+}
+
+func usageConstant(usage uint32, kind byte) []byte {
+	constant := make([]byte, 5)
+	binary.BigEndian.PutUint32(constant, usage)
+	constant[4] = kind
+	return constant
+}
+
+// deriveKey is DK(key, constant) for the AES encryption types, whose random-to-key is the identity (RFC 3961
+// section 5.1).
+func deriveKey(key, constant []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	derived := make([]byte, 0, len(key)+aesBlockSize)
+	in := nfold(constant, aesBlockSize)
+	for len(derived) < len(key) {
+		out := make([]byte, aesBlockSize)
+		block.Encrypt(out, in)
+		derived = append(derived, out...)
+		in = out
+	}
+	return derived[:len(key)], nil
+}
+
+// nfold stretches or shrinks in to size bytes (RFC 3961 section 5.1).
+func nfold(in []byte, size int) []byte {
+	inBits := len(in) * 8
+	outBits := size * 8
+	lcm := inBits * outBits / gcd(inBits, outBits)
+
+	// the input is repeated with a 13 bit right rotation for each repetition, and the repetitions are added in
+	// size byte chunks with one's complement addition
+	buf := make([]byte, lcm/8)
+	for i := 0; i < lcm/inBits; i++ {
+		rotated := rotateRight(in, 13*i)
+		copy(buf[i*len(in):], rotated)
+	}
+
+	out := make([]byte, size)
+	for i := 0; i < len(buf); i += size {
+		out = onesComplementAdd(out, buf[i:i+size])
+	}
+	return out
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func rotateRight(in []byte, n int) []byte {
+	bits := len(in) * 8
+	n %= bits
+	out := make([]byte, len(in))
+	for i := 0; i < bits; i++ {
+		src := (i - n + bits) % bits
+		if in[src/8]&(0x80>>uint(src%8)) != 0 {
+			out[i/8] |= 0x80 >> uint(i%8)
+		}
+	}
+	return out
+}
+
+func onesComplementAdd(a, b []byte) []byte {
+	out := make([]byte, len(a))
+	carry := 0
+	for i := len(a) - 1; i >= 0; i-- {
+		sum := int(a[i]) + int(b[i]) + carry
+		out[i] = byte(sum)
+		carry = sum >> 8
+	}
+	// the end-around carry may carry again, so it is added until there is none left
+	for carry != 0 {
+		for i := len(out) - 1; i >= 0 && carry != 0; i-- {
+			sum := int(out[i]) + carry
+			out[i] = byte(sum)
+			carry = sum >> 8
+		}
+	}
+	return out
+}
+
+// encryptCTS encrypts data with AES in CBC mode with ciphertext stealing and a zero initial vector, swapping the last
+// two blocks even when data is a multiple of the block size (RFC 3962 section 5).
+func encryptCTS(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aesBlockSize {
+		return nil, errors.New("data is shorter than a block")
+	}
+	iv := make([]byte, aesBlockSize)
+	if len(data) == aesBlockSize {
+		out := make([]byte, aesBlockSize)
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, data)
+		return out, nil
+	}
+
+	padded := make([]byte, (len(data)+aesBlockSize-1)/aesBlockSize*aesBlockSize)
+	copy(padded, data)
+	out := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, padded)
+
+	n := len(out)
+	last := len(data) - (n - aesBlockSize) // the length of the last, possibly partial, block
+	result := make([]byte, 0, len(data))
+	result = append(result, out[:n-2*aesBlockSize]...)
+	result = append(result, out[n-aesBlockSize:]...)
+	result = append(result, out[n-2*aesBlockSize:n-2*aesBlockSize+last]...)
+	return result, nil
+}
+
+// decryptCTS reverses encryptCTS.
+func decryptCTS(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aesBlockSize {
+		return nil, errors.New("ciphertext is shorter than a block")
+	}
+	iv := make([]byte, aesBlockSize)
+	if len(data) == aesBlockSize {
+		out := make([]byte, aesBlockSize)
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+		return out, nil
+	}
+
+	full := (len(data) - 1) / aesBlockSize * aesBlockSize // the length up to the last, possibly partial, block
+	last := len(data) - full
+	head := full - aesBlockSize // the length of the blocks before the swapped ones
+
+	out := make([]byte, len(data))
+	prev := iv
+	if head > 0 {
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(out[:head], data[:head])
+		prev = data[head-aesBlockSize : head]
+	}
+
+	// the second to last ciphertext block is the encryption of the padded last plaintext block, whose padding
+	// recovers the stolen part of the block before it
+	d := make([]byte, aesBlockSize)
+	block.Decrypt(d, data[head:full])
+	stolen := make([]byte, aesBlockSize)
+	copy(stolen, data[full:])
+	copy(stolen[last:], d[last:])
+	for i := 0; i < last; i++ {
+		out[full+i] = d[i] ^ stolen[i]
+	}
+
+	p := make([]byte, aesBlockSize)
+	block.Decrypt(p, stolen)
+	for i := range p {
+		out[head+i] = p[i] ^ prev[i]
+	}
+	return out, nil
+}
+
+func hmacSHA1(key, data []byte) []byte {
+	mac := hmac.New(sha1.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
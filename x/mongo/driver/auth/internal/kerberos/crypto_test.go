@@ -0,0 +1,140 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package kerberos
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+func TestNFold(t *testing.T) {
+	// test vectors from RFC 3961 appendix A.1
+	tests := []struct {
+		in   string
+		bits int
+		out  string
+	}{
+		{"012345", 64, "be072631276b1955"},
+		{"password", 56, "78a07b6caf85fa"},
+		{"Rough Consensus, and Running Code", 64, "bb6ed30870b7f0e0"},
+		{"password", 168, "59e4a8ca7c0385c3c37b3f6d2000247cb6e6bd5b3e"},
+		{"kerberos", 128, "6b65726265726f737b9b5b2b93132b93"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.in, func(t *testing.T) {
+			require.Equal(t, tc.out, hex.EncodeToString(nfold([]byte(tc.in), tc.bits/8)))
+		})
+	}
+}
+
+func TestStringToKey(t *testing.T) {
+	// test vectors from RFC 3962 appendix B
+	tests := []struct {
+		name       string
+		etype      int32
+		iterations []byte
+		key        string
+	}{
+		{"aes128 1 iteration", AES128CTSHMACSHA196, []byte{0, 0, 0, 1}, "42263c6e89f4fc28b8df68ee09799f15"},
+		{"aes256 1 iteration", AES256CTSHMACSHA196, []byte{0, 0, 0, 1},
+			"fe697b52bc0d3ce14432ba036a92e65bbb52280990a2fa27883998d72af30161"},
+		{"aes128 1200 iterations", AES128CTSHMACSHA196, []byte{0, 0, 0x04, 0xb0}, "4c01cd46d632d01e6dbe230a01ed642a"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			key, err := StringToKey(tc.etype, "password", "ATHENA.MIT.EDUraeburn", tc.iterations)
+			require.NoError(t, err)
+			require.Equal(t, tc.etype, key.KeyType)
+			require.Equal(t, tc.key, hex.EncodeToString(key.KeyValue))
+		})
+	}
+	t.Run("unsupported encryption type", func(t *testing.T) {
+		_, err := StringToKey(23, "password", "salt", nil)
+		require.Error(t, err)
+	})
+}
+
+func TestCTS(t *testing.T) {
+	// test vectors from RFC 3962 appendix B
+	key := []byte("chicken teriyaki")
+	tests := []struct {
+		plaintext  string
+		ciphertext string
+	}{
+		{"4920776f756c64206c696b652074686520", "c6353568f2bf8cb4d8a580362da7ff7f97"},
+		{"4920776f756c64206c696b65207468652047656e6572616c20476175277320",
+			"fc00783e0efdb2c1d445d4c8eff7ed2297687268d6ecccc0c07b25e25ecfe5"},
+		{"4920776f756c64206c696b65207468652047656e6572616c2047617527732043",
+			"39312523a78662d5be7fcbcc98ebf5a897687268d6ecccc0c07b25e25ecfe584"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.ciphertext[:8], func(t *testing.T) {
+			plaintext := unhex(t, tc.plaintext)
+			ciphertext, err := encryptCTS(key, plaintext)
+			require.NoError(t, err)
+			require.Equal(t, tc.ciphertext, hex.EncodeToString(ciphertext))
+
+			decrypted, err := decryptCTS(key, ciphertext)
+			require.NoError(t, err)
+			require.Equal(t, plaintext, decrypted)
+		})
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	for _, etype := range SupportedETypes {
+		key, err := RandomKey(etype)
+		require.NoError(t, err)
+
+		for _, size := range []int{0, 1, 16, 17, 100} {
+			plaintext := make([]byte, size)
+			for i := range plaintext {
+				plaintext[i] = byte(i)
+			}
+			encrypted, err := Encrypt(key, KeyUsageAPReqAuthenticator, plaintext)
+			require.NoError(t, err)
+			require.Equal(t, etype, encrypted.EType)
+
+			decrypted, err := Decrypt(key, KeyUsageAPReqAuthenticator, encrypted)
+			require.NoError(t, err)
+			require.Equal(t, plaintext, decrypted)
+
+			_, err = Decrypt(key, KeyUsageAPRepEncPart, encrypted)
+			require.Equal(t, ErrIntegrity, err, "decrypting with another key usage should fail")
+
+			encrypted.Cipher[len(encrypted.Cipher)-1] ^= 1
+			_, err = Decrypt(key, KeyUsageAPReqAuthenticator, encrypted)
+			require.Equal(t, ErrIntegrity, err, "decrypting modified data should fail")
+		}
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	for _, etype := range SupportedETypes {
+		key, err := RandomKey(etype)
+		require.NoError(t, err)
+
+		cksum, err := GetChecksum(key, KeyUsageTGSReqAuthChecksum, []byte("data"))
+		require.NoError(t, err)
+		cksumType, err := ChecksumType(etype)
+		require.NoError(t, err)
+		require.Equal(t, cksumType, cksum.CksumType)
+		require.Len(t, cksum.Checksum, 12)
+
+		require.NoError(t, VerifyChecksum(key, KeyUsageTGSReqAuthChecksum, []byte("data"), cksum))
+		require.Error(t, VerifyChecksum(key, KeyUsageTGSReqAuthChecksum, []byte("other data"), cksum))
+		require.Error(t, VerifyChecksum(key, KeyUsageAcceptorSign, []byte("data"), cksum))
+	}
+}
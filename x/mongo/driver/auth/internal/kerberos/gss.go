@@ -0,0 +1,262 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package kerberos
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Token identifiers of the Kerberos GSS-API mechanism.
+var (
+	tokenAPReq    = []byte{0x01, 0x00}
+	tokenAPRep    = []byte{0x02, 0x00}
+	tokenKRBError = []byte{0x03, 0x00}
+	tokenWrap     = []byte{0x05, 0x04}
+)
+
+// mechOID is the DER encoding of the Kerberos GSS-API mechanism OID 1.2.840.113554.1.2.2.
+var mechOID = []byte{0x06, 0x09, 0x2a, 0x86, 0x48, 0x86, 0xf7, 0x12, 0x01, 0x02, 0x02}
+
+// Context flags of the authenticator checksum.
+const (
+	gssMutualFlag   = 2
+	gssSequenceFlag = 8
+	gssConfFlag     = 16
+	gssIntegFlag    = 32
+)
+
+// checksumTypeGSS is the type of the authenticator checksum that carries the GSS-API context flags.
+const checksumTypeGSS = 0x8003
+
+// Flags of wrap tokens.
+const (
+	wrapSentByAcceptor = 1
+	wrapSealed         = 2
+	wrapAcceptorSubkey = 4
+)
+
+const wrapHeaderSize = 16
+
+// InitiatorContext is the security context of a client that authenticates to a service with the Kerberos GSS-API
+// mechanism.
+type InitiatorContext struct {
+	cred           *Credential
+	ctime          time.Time
+	cusec          int32
+	subkey         EncryptionKey
+	acceptorSubkey EncryptionKey
+	seqNumber      uint64
+	established    bool
+}
+
+// NewInitiatorContext creates a security context for a service ticket and returns the initial context token, which
+// requests mutual authentication.
+func NewInitiatorContext(cred *Credential) (*InitiatorContext, []byte, error) {
+	subkey, err := RandomKey(cred.Key.KeyType)
+	if err != nil {
+		return nil, nil, err
+	}
+	seqNumber, err := randomUint31()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the channel bindings are left empty
+	cksum := make([]byte, 24)
+	binary.LittleEndian.PutUint32(cksum, 16)
+	binary.LittleEndian.PutUint32(cksum[20:], gssMutualFlag|gssSequenceFlag|gssConfFlag|gssIntegFlag)
+
+	now := time.Now()
+	ic := &InitiatorContext{
+		cred:      cred,
+		ctime:     KerberosTime(now),
+		cusec:     int32(now.Nanosecond() / 1000),
+		subkey:    subkey,
+		seqNumber: uint64(seqNumber),
+	}
+	apReq, err := newAPReq(cred, Authenticator{
+		AuthenticatorVNO: protocolVersion,
+		CRealm:           cred.ClientRealm,
+		CName:            cred.Client,
+		Cksum:            Checksum{CksumType: checksumTypeGSS, Checksum: cksum},
+		CUSec:            ic.cusec,
+		CTime:            ic.ctime,
+		SubKey:           subkey,
+		SeqNumber:        seqNumber,
+	}, Flags(APOptionMutualRequired), KeyUsageAPReqAuthenticator)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ic, FrameToken(tokenAPReq, apReq), nil
+}
+
+// Established returns true once the service has authenticated itself.
+func (ic *InitiatorContext) Established() bool {
+	return ic.established
+}
+
+// Step processes the reply of the service to the initial context token.
+func (ic *InitiatorContext) Step(token []byte) error {
+	if ic.established {
+		return errors.New("security context is already established")
+	}
+	tokenID, msg, err := ParseToken(token)
+	if err != nil {
+		return err
+	}
+	switch {
+	case bytes.Equal(tokenID, tokenKRBError):
+		krbErr := &KRBError{}
+		if err = Unmarshal(msg, MsgTypeKRBError, krbErr); err != nil {
+			return fmt.Errorf("invalid Kerberos error token: %v", err)
+		}
+		return krbErr
+	case !bytes.Equal(tokenID, tokenAPRep):
+		return errors.New("unexpected context token")
+	}
+
+	var rep APRep
+	if err = Unmarshal(msg, MsgTypeAPRep, &rep); err != nil {
+		return fmt.Errorf("invalid AP reply: %v", err)
+	}
+	decrypted, err := Decrypt(ic.cred.Key, KeyUsageAPRepEncPart, rep.EncPart)
+	if err != nil {
+		return fmt.Errorf("cannot decrypt AP reply: %v", err)
+	}
+	var part EncAPRepPart
+	if err = Unmarshal(decrypted, TagEncAPRepPart, &part); err != nil {
+		return fmt.Errorf("invalid AP reply: %v", err)
+	}
+	if !part.CTime.Equal(ic.ctime) || part.CUSec != ic.cusec {
+		return errors.New("AP reply does not match the request")
+	}
+	ic.acceptorSubkey = part.SubKey
+	ic.established = true
+	return nil
+}
+
+// Wrap returns a wrap token with the integrity-protected message.
+func (ic *InitiatorContext) Wrap(msg []byte) ([]byte, error) {
+	if !ic.established {
+		return nil, errors.New("security context is not established")
+	}
+
+	header := make([]byte, wrapHeaderSize)
+	copy(header, tokenWrap)
+	key := ic.subkey
+	if ic.acceptorSubkey.KeyValue != nil {
+		key = ic.acceptorSubkey
+		header[2] = wrapAcceptorSubkey
+	}
+	header[3] = 0xff
+	binary.BigEndian.PutUint64(header[8:], ic.seqNumber)
+	ic.seqNumber++
+
+	// the checksum covers the header with the extra count and rotation count set to zero
+	cksum, err := checksum(key, KeyUsageInitiatorSign, append(append([]byte{}, msg...), header...))
+	if err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint16(header[4:], uint16(len(cksum)))
+
+	token := append(header, msg...)
+	return append(token, cksum...), nil
+}
+
+// Unwrap returns the message of a wrap token from the service, verifying its integrity and decrypting it if it is
+// sealed.
+func (ic *InitiatorContext) Unwrap(token []byte) ([]byte, error) {
+	if !ic.established {
+		return nil, errors.New("security context is not established")
+	}
+	if len(token) < wrapHeaderSize || !bytes.Equal(token[:2], tokenWrap) || token[3] != 0xff {
+		return nil, errors.New("invalid wrap token")
+	}
+
+	flags := token[2]
+	if flags&wrapSentByAcceptor == 0 {
+		return nil, errors.New("wrap token was not sent by the service")
+	}
+	key := ic.subkey
+	if flags&wrapAcceptorSubkey != 0 {
+		if ic.acceptorSubkey.KeyValue == nil {
+			return nil, errors.New("wrap token uses an unknown acceptor subkey")
+		}
+		key = ic.acceptorSubkey
+	}
+
+	header := append([]byte{}, token[:wrapHeaderSize]...)
+	ec := int(binary.BigEndian.Uint16(header[4:]))
+	rrc := int(binary.BigEndian.Uint16(header[6:]))
+	data := rotateLeft(token[wrapHeaderSize:], rrc)
+
+	if flags&wrapSealed != 0 {
+		decrypted, err := decrypt(key, KeyUsageAcceptorSeal, data)
+		if err != nil {
+			return nil, err
+		}
+		// the encrypted data ends with the filler and a copy of the header with the rotation count set to zero
+		if len(decrypted) < ec+wrapHeaderSize {
+			return nil, errors.New("invalid wrap token")
+		}
+		binary.BigEndian.PutUint16(header[6:], 0)
+		if !bytes.Equal(decrypted[len(decrypted)-wrapHeaderSize:], header) {
+			return nil, ErrIntegrity
+		}
+		return decrypted[:len(decrypted)-wrapHeaderSize-ec], nil
+	}
+
+	if len(data) < ec {
+		return nil, errors.New("invalid wrap token")
+	}
+	msg, cksum := data[:len(data)-ec], data[len(data)-ec:]
+	binary.BigEndian.PutUint16(header[4:], 0)
+	binary.BigEndian.PutUint16(header[6:], 0)
+	expected, err := checksum(key, KeyUsageAcceptorSign, append(append([]byte{}, msg...), header...))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(cksum, expected) {
+		return nil, ErrIntegrity
+	}
+	return msg, nil
+}
+
+// rotateLeft undoes the right rotation of the data of a wrap token.
+func rotateLeft(b []byte, n int) []byte {
+	if len(b) == 0 {
+		return nil
+	}
+	n %= len(b)
+	return append(append([]byte{}, b[n:]...), b[:n]...)
+}
+
+// FrameToken returns an initial context token with the mechanism OID, or another context token of the mechanism.
+func FrameToken(tokenID, msg []byte) []byte {
+	inner := append(append(append([]byte{}, mechOID...), tokenID...), msg...)
+	token, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassApplication, Tag: 0, IsCompound: true, Bytes: inner})
+	return token
+}
+
+// ParseToken returns the token identifier and message of a context token framed with the mechanism OID.
+func ParseToken(token []byte) ([]byte, []byte, error) {
+	var raw asn1.RawValue
+	rest, err := asn1.Unmarshal(token, &raw)
+	if err != nil || len(rest) > 0 || raw.Class != asn1.ClassApplication || raw.Tag != 0 {
+		return nil, nil, errors.New("invalid context token")
+	}
+	if !bytes.HasPrefix(raw.Bytes, mechOID) || len(raw.Bytes) < len(mechOID)+2 {
+		return nil, nil, errors.New("context token is not for the Kerberos mechanism")
+	}
+	inner := raw.Bytes[len(mechOID):]
+	return inner[:2], inner[2:], nil
+}
@@ -0,0 +1,94 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package kerberos_test
+
+import (
+	"testing"
+
+	. "github.com/appveen/mongo-go-driver/x/mongo/driver/auth/internal/kerberos"
+	"github.com/appveen/mongo-go-driver/x/mongo/driver/auth/internal/kerberos/kerberostest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitiatorContext(t *testing.T) {
+	tk := newTestKDC(t)
+	defer tk.close()
+	c, err := NewClient(tk.config, "user@EXAMPLE.COM", "pencil", true)
+	require.NoError(t, err)
+	cred := tk.serviceTicket(t, c, "EXAMPLE.COM")
+	serviceKey := tk.serviceKeys["mongodb/db.example.com@EXAMPLE.COM"]
+
+	for _, acceptorSubkey := range []bool{false, true} {
+		ic, token, err := NewInitiatorContext(cred)
+		require.NoError(t, err)
+		require.False(t, ic.Established())
+		_, err = ic.Wrap([]byte("message"))
+		require.Error(t, err, "wrapping before the context is established should fail")
+
+		ac, reply, err := kerberostest.Accept(serviceKey, token, acceptorSubkey)
+		require.NoError(t, err)
+		require.Equal(t, "user@EXAMPLE.COM", ac.Client)
+		require.NoError(t, ic.Step(reply))
+		require.True(t, ic.Established())
+
+		for _, rrc := range []uint16{0, 5, 28} {
+			for _, sealed := range []bool{false, true} {
+				ac.RRC = rrc
+				wrapped, err := ac.Wrap([]byte("message from the service"), sealed)
+				require.NoError(t, err)
+				msg, err := ic.Unwrap(wrapped)
+				require.NoError(t, err)
+				require.Equal(t, "message from the service", string(msg))
+
+				wrapped[len(wrapped)-1] ^= 1
+				_, err = ic.Unwrap(wrapped)
+				require.Equal(t, ErrIntegrity, err)
+			}
+		}
+
+		for i := 0; i < 2; i++ {
+			wrapped, err := ic.Wrap([]byte("message from the client"))
+			require.NoError(t, err)
+			msg, err := ac.Unwrap(wrapped)
+			require.NoError(t, err)
+			require.Equal(t, "message from the client", string(msg))
+		}
+	}
+
+	t.Run("wrong service key", func(t *testing.T) {
+		_, token, err := NewInitiatorContext(cred)
+		require.NoError(t, err)
+		_, _, err = kerberostest.Accept(tk.serviceKeys["mongodb/db.example.com@OTHER.COM"], token, false)
+		require.Error(t, err)
+	})
+	t.Run("reply for another context", func(t *testing.T) {
+		ic, _, err := NewInitiatorContext(cred)
+		require.NoError(t, err)
+		_, token, err := NewInitiatorContext(cred)
+		require.NoError(t, err)
+		_, reply, err := kerberostest.Accept(serviceKey, token, false)
+		require.NoError(t, err)
+		require.Error(t, ic.Step(reply))
+	})
+	t.Run("error token", func(t *testing.T) {
+		ic, _, err := NewInitiatorContext(cred)
+		require.NoError(t, err)
+		krbErr, err := Marshal(MsgTypeKRBError, KRBError{
+			PVNO:      5,
+			MsgType:   MsgTypeKRBError,
+			STime:     KerberosTime(cred.AuthTime),
+			ErrorCode: ErrAPSkew,
+			Realm:     "EXAMPLE.COM",
+			SName:     cred.Server,
+		})
+		require.NoError(t, err)
+
+		err = ic.Step(FrameToken([]byte{0x03, 0x00}, krbErr))
+		require.Error(t, err)
+		require.Equal(t, int32(ErrAPSkew), err.(*KRBError).ErrorCode)
+	})
+}
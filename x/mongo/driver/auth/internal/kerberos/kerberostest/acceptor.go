@@ -0,0 +1,202 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package kerberostest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/appveen/mongo-go-driver/x/mongo/driver/auth/internal/kerberos"
+)
+
+// Identifiers of the context tokens of the Kerberos GSS-API mechanism used by the acceptor.
+var (
+	tokenAPReq = []byte{0x01, 0x00}
+	tokenAPRep = []byte{0x02, 0x00}
+	tokenWrap  = []byte{0x05, 0x04}
+)
+
+const checksumTypeGSS = 0x8003
+
+// AcceptorContext is the security context of a service that accepted a client with the Kerberos GSS-API mechanism.
+type AcceptorContext struct {
+	// Client is the authenticated client principal with its realm.
+	Client string
+	// RRC is the rotation count of the wrap tokens the service sends.
+	RRC uint16
+
+	key          kerberos.EncryptionKey
+	acceptorKey  bool
+	seqNumber    uint64
+	initiatorSeq uint64
+}
+
+// Accept verifies an initial context token for the service with the service's key and returns the context and the
+// reply token. If acceptorSubkey is true, the reply sets a subkey that protects the messages of the context.
+func Accept(serviceKey kerberos.EncryptionKey, token []byte, acceptorSubkey bool) (*AcceptorContext, []byte, error) {
+	tokenID, msg, err := kerberos.ParseToken(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(tokenID, tokenAPReq) {
+		return nil, nil, errors.New("not an AP request token")
+	}
+	var apReq kerberos.APReq
+	if err = kerberos.Unmarshal(msg, kerberos.MsgTypeAPReq, &apReq); err != nil {
+		return nil, nil, err
+	}
+	ticket, err := DecryptTicket(serviceKey, apReq.Ticket.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot decrypt ticket: %v", err)
+	}
+
+	decrypted, err := kerberos.Decrypt(ticket.Key, kerberos.KeyUsageAPReqAuthenticator, apReq.Authenticator)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot decrypt authenticator: %v", err)
+	}
+	var authenticator kerberos.Authenticator
+	if err = kerberos.Unmarshal(decrypted, kerberos.TagAuthenticator, &authenticator); err != nil {
+		return nil, nil, err
+	}
+	if !authenticator.CName.Equal(ticket.CName) {
+		return nil, nil, errors.New("authenticator does not match the ticket")
+	}
+	cksum := authenticator.Cksum
+	if cksum.CksumType != checksumTypeGSS || len(cksum.Checksum) < 24 ||
+		binary.LittleEndian.Uint32(cksum.Checksum) != 16 || binary.LittleEndian.Uint32(cksum.Checksum[20:])&2 == 0 {
+		return nil, nil, errors.New("authenticator does not request mutual authentication")
+	}
+
+	ctx := &AcceptorContext{
+		Client:       ticket.CName.String() + "@" + ticket.CRealm,
+		key:          authenticator.SubKey,
+		initiatorSeq: uint64(authenticator.SeqNumber),
+	}
+	if ctx.key.KeyValue == nil {
+		ctx.key = ticket.Key
+	}
+	seqNumber, err := randomUint32()
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx.seqNumber = uint64(seqNumber)
+
+	part := kerberos.EncAPRepPart{
+		CTime:     authenticator.CTime,
+		CUSec:     authenticator.CUSec,
+		SeqNumber: int64(seqNumber),
+	}
+	if acceptorSubkey {
+		if ctx.key, err = kerberos.RandomKey(ticket.Key.KeyType); err != nil {
+			return nil, nil, err
+		}
+		ctx.acceptorKey = true
+		part.SubKey = ctx.key
+	}
+	encPart, err := kerberos.Marshal(kerberos.TagEncAPRepPart, part)
+	if err != nil {
+		return nil, nil, err
+	}
+	encrypted, err := kerberos.Encrypt(ticket.Key, kerberos.KeyUsageAPRepEncPart, encPart)
+	if err != nil {
+		return nil, nil, err
+	}
+	rep, err := kerberos.Marshal(kerberos.MsgTypeAPRep, kerberos.APRep{
+		PVNO:    5,
+		MsgType: kerberos.MsgTypeAPRep,
+		EncPart: encrypted,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return ctx, kerberos.FrameToken(tokenAPRep, rep), nil
+}
+
+// Wrap returns a wrap token with the message, which is encrypted if sealed is true.
+func (ac *AcceptorContext) Wrap(msg []byte, sealed bool) ([]byte, error) {
+	header := make([]byte, 16)
+	copy(header, tokenWrap)
+	header[2] = 1 // sent by the acceptor
+	if sealed {
+		header[2] |= 2
+	}
+	if ac.acceptorKey {
+		header[2] |= 4
+	}
+	header[3] = 0xff
+	binary.BigEndian.PutUint64(header[8:], ac.seqNumber)
+	ac.seqNumber++
+
+	var data []byte
+	if sealed {
+		encrypted, err := kerberos.Encrypt(ac.key, kerberos.KeyUsageAcceptorSeal, append(append([]byte{}, msg...),
+			header...))
+		if err != nil {
+			return nil, err
+		}
+		data = encrypted.Cipher
+	} else {
+		cksum, err := kerberos.GetChecksum(ac.key, kerberos.KeyUsageAcceptorSign, append(append([]byte{}, msg...),
+			header...))
+		if err != nil {
+			return nil, err
+		}
+		binary.BigEndian.PutUint16(header[4:], uint16(len(cksum.Checksum)))
+		data = append(append([]byte{}, msg...), cksum.Checksum...)
+	}
+
+	binary.BigEndian.PutUint16(header[6:], ac.RRC)
+	if n := int(ac.RRC) % len(data); n > 0 {
+		data = append(append([]byte{}, data[len(data)-n:]...), data[:len(data)-n]...)
+	}
+	return append(header, data...), nil
+}
+
+// Unwrap verifies a wrap token with integrity protection from the client and returns its message.
+func (ac *AcceptorContext) Unwrap(token []byte) ([]byte, error) {
+	if len(token) < 16 || !bytes.Equal(token[:2], tokenWrap) {
+		return nil, errors.New("invalid wrap token")
+	}
+	flags := token[2]
+	if flags&1 != 0 || flags&2 != 0 || (flags&4 != 0) != ac.acceptorKey {
+		return nil, fmt.Errorf("unexpected wrap token flags %x", flags)
+	}
+	if seqNumber := binary.BigEndian.Uint64(token[8:]); seqNumber != ac.initiatorSeq {
+		return nil, fmt.Errorf("wrap token has sequence number %d, expected %d", seqNumber, ac.initiatorSeq)
+	}
+	ac.initiatorSeq++
+
+	ec := int(binary.BigEndian.Uint16(token[4:]))
+	data := token[16:]
+	if binary.BigEndian.Uint16(token[6:]) != 0 || len(data) < ec {
+		return nil, errors.New("invalid wrap token")
+	}
+	header := append([]byte{}, token[:16]...)
+	binary.BigEndian.PutUint16(header[4:], 0)
+	msg := data[:len(data)-ec]
+	cksumType, err := kerberos.ChecksumType(ac.key.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	err = kerberos.VerifyChecksum(ac.key, kerberos.KeyUsageInitiatorSign, append(append([]byte{}, msg...), header...),
+		kerberos.Checksum{CksumType: cksumType, Checksum: data[len(data)-ec:]})
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func randomUint32() (uint32, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b) & 0x3fffffff, nil
+}
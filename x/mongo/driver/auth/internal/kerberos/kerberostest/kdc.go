@@ -0,0 +1,440 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// Package kerberostest provides a KDC and a service that run in the test process.
+package kerberostest
+
+import (
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appveen/mongo-go-driver/x/mongo/driver/auth/internal/kerberos"
+)
+
+const (
+	errGeneric     = 60
+	errBadOption   = 13
+	errETypeNoSupp = 14
+	errClockSkew   = 37
+)
+
+// KDC is a KDC for tests that serves several realms over TCP. It requires pre-authentication and trusts every pair
+// of its realms for cross-realm authentication.
+type KDC struct {
+	// TicketLifetime is the lifetime of issued tickets. The default is one hour.
+	TicketLifetime time.Duration
+
+	listener net.Listener
+	realms   []string
+
+	mu          sync.Mutex
+	keys        map[string]kerberos.EncryptionKey // long-term keys by principal
+	asRequests  int
+	tgsRequests int
+}
+
+// NewKDC starts a KDC for the realms.
+func NewKDC(realms ...string) (*KDC, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	k := &KDC{
+		TicketLifetime: time.Hour,
+		listener:       listener,
+		realms:         realms,
+		keys:           make(map[string]kerberos.EncryptionKey),
+	}
+	for _, realm := range realms {
+		for _, other := range realms {
+			if _, err = k.AddKey(fmt.Sprintf("krbtgt/%s@%s", other, realm)); err != nil {
+				_ = listener.Close()
+				return nil, err
+			}
+		}
+	}
+	go k.serve()
+	return k, nil
+}
+
+// Addr returns the address of the KDC.
+func (k *KDC) Addr() string {
+	return k.listener.Addr().String()
+}
+
+// Close stops the KDC.
+func (k *KDC) Close() error {
+	return k.listener.Close()
+}
+
+// Config returns a krb5.conf that uses the KDC for all its realms. The first realm is the default realm.
+func (k *KDC) Config() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[libdefaults]\n\tdefault_realm = %s\n\tdns_lookup_kdc = false\n\n[realms]\n", k.realms[0])
+	for _, realm := range k.realms {
+		fmt.Fprintf(&b, "\t%s = {\n\t\tkdc = %s\n\t}\n", realm, k.Addr())
+	}
+	return b.String()
+}
+
+// AddPassword adds a principal with the key derived from a password with the default salt.
+func (k *KDC) AddPassword(principal, password string) error {
+	name, realm := kerberos.ParsePrincipal(principal)
+	key, err := kerberos.StringToKey(kerberos.AES256CTSHMACSHA196, password,
+		realm+strings.Join(name.NameString, ""), nil)
+	if err != nil {
+		return err
+	}
+	k.mu.Lock()
+	k.keys[principal] = key
+	k.mu.Unlock()
+	return nil
+}
+
+// AddKey adds a principal with a random key and returns the key.
+func (k *KDC) AddKey(principal string) (kerberos.EncryptionKey, error) {
+	key, err := kerberos.RandomKey(kerberos.AES256CTSHMACSHA196)
+	if err != nil {
+		return kerberos.EncryptionKey{}, err
+	}
+	k.mu.Lock()
+	k.keys[principal] = key
+	k.mu.Unlock()
+	return key, nil
+}
+
+// Requests returns the numbers of AS and TGS requests the KDC has answered.
+func (k *KDC) Requests() (int, int) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.asRequests, k.tgsRequests
+}
+
+func (k *KDC) key(name kerberos.PrincipalName, realm string) (kerberos.EncryptionKey, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	key, ok := k.keys[name.String()+"@"+realm]
+	return key, ok
+}
+
+func (k *KDC) serve() {
+	for {
+		conn, err := k.listener.Accept()
+		if err != nil {
+			return
+		}
+		go k.handle(conn)
+	}
+}
+
+func (k *KDC) handle(conn net.Conn) {
+	defer conn.Close()
+
+	size := make([]byte, 4)
+	if _, err := io.ReadFull(conn, size); err != nil {
+		return
+	}
+	req := make([]byte, binary.BigEndian.Uint32(size))
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return
+	}
+
+	rep := k.reply(req)
+	binary.BigEndian.PutUint32(size, uint32(len(rep)))
+	_, _ = conn.Write(append(size, rep...))
+}
+
+// kdcError is an error that is returned to the client as a KRB-ERROR message.
+type kdcError struct {
+	code int32
+	data []byte
+}
+
+func (e *kdcError) Error() string {
+	return fmt.Sprintf("KDC error %d", e.code)
+}
+
+func (k *KDC) reply(b []byte) []byte {
+	tag := kerberos.MessageTag(b)
+	var req kerberos.KDCReq
+	err := kerberos.Unmarshal(b, tag, &req)
+	body := &req.ReqBody
+
+	var rep []byte
+	switch {
+	case err != nil:
+		err = &kdcError{code: errGeneric}
+	case tag == kerberos.MsgTypeASReq:
+		rep, err = k.asReply(&req)
+	case tag == kerberos.MsgTypeTGSReq:
+		rep, err = k.tgsReply(&req)
+	default:
+		err = &kdcError{code: errGeneric}
+	}
+	if err == nil {
+		return rep
+	}
+
+	krbErr, ok := err.(*kdcError)
+	if !ok {
+		krbErr = &kdcError{code: errGeneric}
+	}
+	now := time.Now()
+	b, _ = kerberos.Marshal(kerberos.MsgTypeKRBError, kerberos.KRBError{
+		PVNO:      5,
+		MsgType:   kerberos.MsgTypeKRBError,
+		STime:     kerberos.KerberosTime(now),
+		SUSec:     int32(now.Nanosecond() / 1000),
+		ErrorCode: krbErr.code,
+		Realm:     body.Realm,
+		SName:     body.SName,
+		EData:     krbErr.data,
+	})
+	return b
+}
+
+func (k *KDC) asReply(req *kerberos.KDCReq) ([]byte, error) {
+	body := &req.ReqBody
+	realm := body.Realm
+	clientKey, ok := k.key(body.CName, realm)
+	if !ok {
+		return nil, &kdcError{code: kerberos.ErrCPrincipalUnknown}
+	}
+	if !hasEType(body.EType, clientKey.KeyType) {
+		return nil, &kdcError{code: errETypeNoSupp}
+	}
+	serverKey, ok := k.key(body.SName, realm)
+	if !ok {
+		return nil, &kdcError{code: kerberos.ErrSPrincipalUnknown}
+	}
+
+	if err := k.verifyPreauth(req, clientKey); err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	k.asRequests++
+	k.mu.Unlock()
+	return k.issue(kerberos.MsgTypeASRep, body, body.CName, realm, serverKey, clientKey,
+		kerberos.KeyUsageASRepEncPart, kerberos.TagEncASRepPart)
+}
+
+func (k *KDC) verifyPreauth(req *kerberos.KDCReq, clientKey kerberos.EncryptionKey) error {
+	for _, padata := range req.PAData {
+		if padata.PADataType != kerberos.PADataEncTimestamp {
+			continue
+		}
+		var encrypted kerberos.EncryptedData
+		if _, err := asn1.Unmarshal(padata.PADataValue, &encrypted); err != nil {
+			return &kdcError{code: kerberos.ErrPreauthFailed}
+		}
+		decrypted, err := kerberos.Decrypt(clientKey, kerberos.KeyUsageASReqTimestamp, encrypted)
+		if err != nil {
+			return &kdcError{code: kerberos.ErrPreauthFailed}
+		}
+		var ts kerberos.PAEncTimestamp
+		if _, err = asn1.Unmarshal(decrypted, &ts); err != nil {
+			return &kdcError{code: kerberos.ErrPreauthFailed}
+		}
+		if skew := time.Since(ts.PATimestamp); skew > 5*time.Minute || skew < -5*time.Minute {
+			return &kdcError{code: errClockSkew}
+		}
+		return nil
+	}
+
+	salt := req.ReqBody.Realm + strings.Join(req.ReqBody.CName.NameString, "")
+	info, _ := kerberos.MarshalValue([]kerberos.ETypeInfo2Entry{{EType: clientKey.KeyType, Salt: salt}})
+	methods, _ := kerberos.MarshalValue([]kerberos.PAData{
+		{PADataType: kerberos.PADataETypeInfo2, PADataValue: info},
+		{PADataType: kerberos.PADataEncTimestamp, PADataValue: []byte{}},
+	})
+	return &kdcError{code: kerberos.ErrPreauthRequired, data: methods}
+}
+
+func (k *KDC) tgsReply(req *kerberos.KDCReq) ([]byte, error) {
+	body := &req.ReqBody
+	var apReqData []byte
+	for _, padata := range req.PAData {
+		if padata.PADataType == kerberos.PADataTGSReq {
+			apReqData = padata.PADataValue
+		}
+	}
+	var apReq kerberos.APReq
+	if err := kerberos.Unmarshal(apReqData, kerberos.MsgTypeAPReq, &apReq); err != nil {
+		return nil, &kdcError{code: errBadOption}
+	}
+
+	realm := body.Realm
+	ticket, err := k.decryptTicket(apReq.Ticket.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if components := ticket.SName.NameString; len(components) != 2 || components[0] != "krbtgt" ||
+		components[1] != realm {
+		return nil, &kdcError{code: errBadOption}
+	}
+
+	decrypted, err := kerberos.Decrypt(ticket.Key, kerberos.KeyUsageTGSReqAuthenticator, apReq.Authenticator)
+	if err != nil {
+		return nil, &kdcError{code: kerberos.ErrAPBadIntegrity}
+	}
+	var authenticator kerberos.Authenticator
+	if err = kerberos.Unmarshal(decrypted, kerberos.TagAuthenticator, &authenticator); err != nil {
+		return nil, &kdcError{code: errGeneric}
+	}
+	if !authenticator.CName.Equal(ticket.CName) ||
+		authenticator.CRealm != ticket.CRealm {
+		return nil, &kdcError{code: errBadOption}
+	}
+	// the checksum covers the encoding of the body, which is the same when it is encoded again
+	encodedBody, err := kerberos.MarshalValue(*body)
+	if err != nil {
+		return nil, err
+	}
+	if err = kerberos.VerifyChecksum(ticket.Key, kerberos.KeyUsageTGSReqAuthChecksum, encodedBody,
+		authenticator.Cksum); err != nil {
+		return nil, &kdcError{code: kerberos.ErrAPModified}
+	}
+
+	serverKey, ok := k.key(body.SName, realm)
+	if !ok {
+		return nil, &kdcError{code: kerberos.ErrSPrincipalUnknown}
+	}
+
+	k.mu.Lock()
+	k.tgsRequests++
+	k.mu.Unlock()
+	body.CName = ticket.CName
+	return k.issue(kerberos.MsgTypeTGSRep, body, ticket.CName, ticket.CRealm, serverKey, ticket.Key,
+		kerberos.KeyUsageTGSRepEncPartSession, kerberos.TagEncTGSRepPart)
+}
+
+// ticket is the decrypted part of a ticket with the ticket's service.
+type ticket struct {
+	kerberos.EncTicketPart
+	SName kerberos.PrincipalName
+}
+
+func (k *KDC) decryptTicket(b []byte) (*ticket, error) {
+	var t kerberos.Ticket
+	if err := kerberos.Unmarshal(b, kerberos.TagTicket, &t); err != nil {
+		return nil, &kdcError{code: errGeneric}
+	}
+	key, ok := k.key(t.SName, t.Realm)
+	if !ok {
+		return nil, &kdcError{code: kerberos.ErrSPrincipalUnknown}
+	}
+	part, err := DecryptTicket(key, b)
+	if err != nil {
+		return nil, &kdcError{code: kerberos.ErrAPBadIntegrity}
+	}
+	if time.Now().After(part.EndTime) {
+		return nil, &kdcError{code: kerberos.ErrAPTicketExpired}
+	}
+	return &ticket{EncTicketPart: *part, SName: t.SName}, nil
+}
+
+// issue returns a reply with a ticket for the service of the request.
+func (k *KDC) issue(msgType int32, body *kerberos.KDCReqBody, client kerberos.PrincipalName, clientRealm string,
+	serverKey, replyKey kerberos.EncryptionKey, usage uint32, tag int) ([]byte, error) {
+
+	sessionKey, err := kerberos.RandomKey(serverKey.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	now := kerberos.KerberosTime(time.Now())
+	endTime := now.Add(k.TicketLifetime)
+	if !body.Till.IsZero() && body.Till.Before(endTime) {
+		endTime = body.Till
+	}
+	realm := body.Realm
+
+	encTicket, err := kerberos.Marshal(kerberos.TagEncTicketPart, kerberos.EncTicketPart{
+		Flags:     kerberos.Flags(),
+		Key:       sessionKey,
+		CRealm:    clientRealm,
+		CName:     client,
+		Transited: kerberos.TransitedEncoding{TRType: 1, Contents: []byte{}},
+		AuthTime:  now,
+		StartTime: now,
+		EndTime:   endTime,
+	})
+	if err != nil {
+		return nil, err
+	}
+	encryptedTicket, err := kerberos.Encrypt(serverKey, kerberos.KeyUsageKDCRepTicket, encTicket)
+	if err != nil {
+		return nil, err
+	}
+	ticket, err := kerberos.Marshal(kerberos.TagTicket, kerberos.Ticket{
+		TktVNO:  5,
+		Realm:   realm,
+		SName:   body.SName,
+		EncPart: encryptedTicket,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	encPart, err := kerberos.Marshal(tag, kerberos.EncKDCRepPart{
+		Key:       sessionKey,
+		LastReq:   []kerberos.LastReq{{LRType: 0, LRValue: now}},
+		Nonce:     body.Nonce,
+		Flags:     kerberos.Flags(),
+		AuthTime:  now,
+		StartTime: now,
+		EndTime:   endTime,
+		SRealm:    realm,
+		SName:     body.SName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	encryptedPart, err := kerberos.Encrypt(replyKey, usage, encPart)
+	if err != nil {
+		return nil, err
+	}
+	return kerberos.Marshal(int(msgType), kerberos.KDCRep{
+		PVNO:    5,
+		MsgType: msgType,
+		CRealm:  clientRealm,
+		CName:   client,
+		Ticket:  kerberos.Explicit(5, ticket),
+		EncPart: encryptedPart,
+	})
+}
+
+// DecryptTicket returns the encrypted part of a ticket for a service with the service's key.
+func DecryptTicket(key kerberos.EncryptionKey, b []byte) (*kerberos.EncTicketPart, error) {
+	var t kerberos.Ticket
+	if err := kerberos.Unmarshal(b, kerberos.TagTicket, &t); err != nil {
+		return nil, err
+	}
+	decrypted, err := kerberos.Decrypt(key, kerberos.KeyUsageKDCRepTicket, t.EncPart)
+	if err != nil {
+		return nil, err
+	}
+	part := &kerberos.EncTicketPart{}
+	if err = kerberos.Unmarshal(decrypted, kerberos.TagEncTicketPart, part); err != nil {
+		return nil, err
+	}
+	return part, nil
+}
+
+func hasEType(etypes []int32, etype int32) bool {
+	for _, e := range etypes {
+		if e == etype {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,244 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package kerberos
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// KeytabEntry is a key in a keytab.
+type KeytabEntry struct {
+	Principal PrincipalName
+	Realm     string
+	KVNO      uint32
+	Key       EncryptionKey
+}
+
+// Keytab is a file of long-term keys, in the format used by MIT Kerberos.
+type Keytab struct {
+	Entries []KeytabEntry
+}
+
+// LoadKeytab reads a keytab file. name may have a FILE: prefix, which is the only supported keytab type.
+func LoadKeytab(name string) (*Keytab, error) {
+	path, err := filePath(name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	kt, err := ParseKeytab(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid keytab %s: %v", path, err)
+	}
+	return kt, nil
+}
+
+// ParseKeytab parses the contents of a keytab file.
+func ParseKeytab(b []byte) (*Keytab, error) {
+	if len(b) < 2 || b[0] != 5 {
+		return nil, errors.New("not a keytab")
+	}
+	// version 1 uses the native byte order and counts the realm as a component; it is not supported
+	if b[1] != 2 {
+		return nil, fmt.Errorf("unsupported keytab version %d", b[1])
+	}
+
+	kt := &Keytab{}
+	r := &reader{b: b[2:], order: binary.BigEndian}
+	for len(r.b) > 0 {
+		size := int32(r.uint32())
+		if r.err != nil {
+			return nil, r.err
+		}
+		if size < 0 {
+			// a deleted entry
+			r.bytes(int(-size))
+			continue
+		}
+
+		er := &reader{b: r.bytes(int(size)), order: binary.BigEndian}
+		if r.err != nil {
+			return nil, r.err
+		}
+		var entry KeytabEntry
+		count := int(er.uint16())
+		entry.Realm = string(er.bytes(int(er.uint16())))
+		components := make([]string, count)
+		for i := range components {
+			components[i] = string(er.bytes(int(er.uint16())))
+		}
+		entry.Principal = NewPrincipalName(int32(er.uint32()), components...)
+		er.uint32() // timestamp
+		entry.KVNO = uint32(er.uint8())
+		entry.Key.KeyType = int32(er.uint16())
+		entry.Key.KeyValue = er.bytes(int(er.uint16()))
+		// the 32 bit key version number that replaces the 8 bit one is optional
+		if len(er.b) >= 4 {
+			if kvno := er.uint32(); kvno != 0 {
+				entry.KVNO = kvno
+			}
+		}
+		if er.err != nil {
+			return nil, er.err
+		}
+		kt.Entries = append(kt.Entries, entry)
+	}
+	return kt, nil
+}
+
+// Key returns the key with the highest version number for the principal and encryption type.
+func (kt *Keytab) Key(principal PrincipalName, realm string, etype int32) (EncryptionKey, uint32, bool) {
+	var found *KeytabEntry
+	for i, entry := range kt.Entries {
+		if entry.Key.KeyType != etype || entry.Realm != realm || !entry.Principal.Equal(principal) {
+			continue
+		}
+		if found == nil || entry.KVNO > found.KVNO {
+			found = &kt.Entries[i]
+		}
+	}
+	if found == nil {
+		return EncryptionKey{}, 0, false
+	}
+	return found.Key, found.KVNO, true
+}
+
+// Principals returns the principals with keys, in the order in which they first appear.
+func (kt *Keytab) Principals() []KeytabEntry {
+	var principals []KeytabEntry
+	seen := make(map[string]bool)
+	for _, entry := range kt.Entries {
+		name := entry.Principal.String() + "@" + entry.Realm
+		if !seen[name] {
+			seen[name] = true
+			principals = append(principals, entry)
+		}
+	}
+	return principals
+}
+
+// Marshal encodes the keytab.
+func (kt *Keytab) Marshal() []byte {
+	b := []byte{5, 2}
+	for _, entry := range kt.Entries {
+		w := &writer{order: binary.BigEndian}
+		components := entry.Principal.NameString
+		w.uint16(uint16(len(components)))
+		w.string16(entry.Realm)
+		for _, c := range components {
+			w.string16(c)
+		}
+		w.uint32(uint32(entry.Principal.NameType))
+		w.uint32(0)
+		w.uint8(uint8(entry.KVNO))
+		w.uint16(uint16(entry.Key.KeyType))
+		w.uint16(uint16(len(entry.Key.KeyValue)))
+		w.b = append(w.b, entry.Key.KeyValue...)
+		w.uint32(entry.KVNO)
+
+		size := &writer{order: binary.BigEndian}
+		size.uint32(uint32(len(w.b)))
+		b = append(b, size.b...)
+		b = append(b, w.b...)
+	}
+	return b
+}
+
+// filePath returns the path of a file credential name, which may have a FILE: prefix.
+func filePath(name string) (string, error) {
+	if i := strings.Index(name, ":"); i > 1 {
+		if strings.ToUpper(name[:i]) != "FILE" {
+			return "", fmt.Errorf("unsupported credential type %s", name[:i])
+		}
+		return name[i+1:], nil
+	}
+	return name, nil
+}
+
+// reader reads the binary formats of keytabs and credential caches, recording the first error.
+type reader struct {
+	b     []byte
+	order binary.ByteOrder
+	err   error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.b) {
+		r.err = errors.New("unexpected end of data")
+		r.b = nil
+		return nil
+	}
+	b := r.b[:n:n]
+	r.b = r.b[n:]
+	return b
+}
+
+func (r *reader) uint8() uint8 {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *reader) uint16() uint16 {
+	b := r.bytes(2)
+	if b == nil {
+		return 0
+	}
+	return r.order.Uint16(b)
+}
+
+func (r *reader) uint32() uint32 {
+	b := r.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return r.order.Uint32(b)
+}
+
+// writer writes the binary formats of keytabs and credential caches.
+type writer struct {
+	b     []byte
+	order binary.ByteOrder
+}
+
+func (w *writer) uint8(v uint8) {
+	w.b = append(w.b, v)
+}
+
+func (w *writer) uint16(v uint16) {
+	b := make([]byte, 2)
+	w.order.PutUint16(b, v)
+	w.b = append(w.b, b...)
+}
+
+func (w *writer) uint32(v uint32) {
+	b := make([]byte, 4)
+	w.order.PutUint32(b, v)
+	w.b = append(w.b, b...)
+}
+
+func (w *writer) string16(s string) {
+	w.uint16(uint16(len(s)))
+	w.b = append(w.b, s...)
+}
+
+func (w *writer) string32(s []byte) {
+	w.uint32(uint32(len(s)))
+	w.b = append(w.b, s...)
+}
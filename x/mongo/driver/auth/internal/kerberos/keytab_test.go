@@ -0,0 +1,78 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package kerberos
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeytab(t *testing.T) {
+	user := NewPrincipalName(NameTypePrincipal, "user")
+	service := NewPrincipalName(NameTypeSrvHost, "mongodb", "db.example.com")
+	kt := &Keytab{Entries: []KeytabEntry{
+		{Principal: user, Realm: "EXAMPLE.COM", KVNO: 1, Key: EncryptionKey{KeyType: 18, KeyValue: []byte("old")}},
+		{Principal: user, Realm: "EXAMPLE.COM", KVNO: 300, Key: EncryptionKey{KeyType: 18, KeyValue: []byte("new")}},
+		{Principal: user, Realm: "EXAMPLE.COM", KVNO: 2, Key: EncryptionKey{KeyType: 17, KeyValue: []byte("aes128")}},
+		{Principal: service, Realm: "EXAMPLE.COM", KVNO: 1, Key: EncryptionKey{KeyType: 18, KeyValue: []byte("svc")}},
+	}}
+
+	t.Run("round trip", func(t *testing.T) {
+		parsed, err := ParseKeytab(kt.Marshal())
+		require.NoError(t, err)
+		require.Equal(t, kt, parsed)
+	})
+	t.Run("deleted entries", func(t *testing.T) {
+		b := kt.Marshal()
+		// a hole of 8 bytes between the header and the first entry
+		b = append([]byte{5, 2, 0xff, 0xff, 0xff, 0xf8, 0, 0, 0, 0, 0, 0, 0, 0}, b[2:]...)
+		parsed, err := ParseKeytab(b)
+		require.NoError(t, err)
+		require.Equal(t, kt, parsed)
+	})
+	t.Run("truncated", func(t *testing.T) {
+		b := kt.Marshal()
+		_, err := ParseKeytab(b[:len(b)-1])
+		require.Error(t, err)
+	})
+	t.Run("key", func(t *testing.T) {
+		key, kvno, ok := kt.Key(user, "EXAMPLE.COM", 18)
+		require.True(t, ok)
+		require.Equal(t, uint32(300), kvno)
+		require.Equal(t, []byte("new"), key.KeyValue)
+
+		_, _, ok = kt.Key(user, "OTHER.COM", 18)
+		require.False(t, ok)
+		_, _, ok = kt.Key(service, "EXAMPLE.COM", 17)
+		require.False(t, ok)
+	})
+	t.Run("principals", func(t *testing.T) {
+		principals := kt.Principals()
+		require.Len(t, principals, 2)
+		require.True(t, principals[0].Principal.Equal(user))
+		require.True(t, principals[1].Principal.Equal(service))
+	})
+	t.Run("load", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "keytab")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "client.keytab")
+		require.NoError(t, ioutil.WriteFile(path, kt.Marshal(), 0600))
+
+		for _, name := range []string{path, "FILE:" + path} {
+			loaded, err := LoadKeytab(name)
+			require.NoError(t, err)
+			require.Equal(t, kt, loaded)
+		}
+		_, err = LoadKeytab("KEYRING:persistent")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,389 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package kerberos
+
+import (
+	"encoding/asn1"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Message types.
+const (
+	MsgTypeASReq    = 10
+	MsgTypeASRep    = 11
+	MsgTypeTGSReq   = 12
+	MsgTypeTGSRep   = 13
+	MsgTypeAPReq    = 14
+	MsgTypeAPRep    = 15
+	MsgTypeKRBError = 30
+)
+
+// Application tags of the messages that are not identified by their message type.
+const (
+	TagTicket        = 1
+	TagAuthenticator = 2
+	TagEncTicketPart = 3
+	TagEncASRepPart  = 25
+	TagEncTGSRepPart = 26
+	TagEncAPRepPart  = 27
+)
+
+// Principal name types.
+const (
+	NameTypePrincipal = 1
+	NameTypeSrvInst   = 2
+	NameTypeSrvHost   = 3
+)
+
+// Pre-authentication data types.
+const (
+	PADataTGSReq       = 1
+	PADataEncTimestamp = 2
+	PADataETypeInfo2   = 19
+)
+
+// Error codes.
+const (
+	ErrCPrincipalUnknown = 6
+	ErrSPrincipalUnknown = 7
+	ErrPreauthFailed     = 24
+	ErrPreauthRequired   = 25
+	ErrAPBadIntegrity    = 31
+	ErrAPTicketExpired   = 32
+	ErrAPSkew            = 37
+	ErrAPModified        = 41
+)
+
+// KDC and AP options.
+const (
+	KDCOptionRenewableOK   = 27
+	APOptionMutualRequired = 2
+)
+
+const protocolVersion = 5
+
+// PrincipalName is a Kerberos principal name without its realm.
+type PrincipalName struct {
+	NameType   int32    `asn1:"explicit,tag:0"`
+	NameString []string `asn1:"explicit,tag:1"`
+}
+
+// NewPrincipalName creates a principal name from its components.
+func NewPrincipalName(nameType int32, components ...string) PrincipalName {
+	return PrincipalName{NameType: nameType, NameString: components}
+}
+
+// ParsePrincipal parses a principal of the form "component/component@REALM". The realm is empty if it is not
+// included.
+func ParsePrincipal(s string) (PrincipalName, string) {
+	var realm string
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		s, realm = s[:i], s[i+1:]
+	}
+	return NewPrincipalName(NameTypePrincipal, strings.Split(s, "/")...), realm
+}
+
+// Equal returns true if the names have the same components. Name types are not compared.
+func (pn PrincipalName) Equal(other PrincipalName) bool {
+	if len(pn.NameString) != len(other.NameString) {
+		return false
+	}
+	for i := range pn.NameString {
+		if pn.NameString[i] != other.NameString[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (pn PrincipalName) String() string {
+	return strings.Join(pn.NameString, "/")
+}
+
+// EncryptionKey is a key of an encryption type.
+type EncryptionKey struct {
+	KeyType  int32  `asn1:"explicit,tag:0"`
+	KeyValue []byte `asn1:"explicit,tag:1"`
+}
+
+// EncryptedData is data encrypted with a key.
+type EncryptedData struct {
+	EType  int32  `asn1:"explicit,tag:0"`
+	KVNO   int64  `asn1:"optional,explicit,tag:1"`
+	Cipher []byte `asn1:"explicit,tag:2"`
+}
+
+// Checksum is a keyed checksum.
+type Checksum struct {
+	CksumType int32  `asn1:"explicit,tag:0"`
+	Checksum  []byte `asn1:"explicit,tag:1"`
+}
+
+// PAData is pre-authentication data.
+type PAData struct {
+	PADataType  int32  `asn1:"explicit,tag:1"`
+	PADataValue []byte `asn1:"explicit,tag:2"`
+}
+
+// PAEncTimestamp is the timestamp encrypted with the client's key for pre-authentication.
+type PAEncTimestamp struct {
+	PATimestamp time.Time `asn1:"generalized,explicit,tag:0"`
+	PAUSec      int32     `asn1:"optional,explicit,tag:1"`
+}
+
+// ETypeInfo2Entry describes how the client's key is derived for an encryption type.
+type ETypeInfo2Entry struct {
+	EType     int32  `asn1:"explicit,tag:0"`
+	Salt      string `asn1:"optional,explicit,tag:1"`
+	S2KParams []byte `asn1:"optional,explicit,tag:2"`
+}
+
+// Ticket is a ticket for a service.
+type Ticket struct {
+	TktVNO  int32         `asn1:"explicit,tag:0"`
+	Realm   string        `asn1:"explicit,tag:1"`
+	SName   PrincipalName `asn1:"explicit,tag:2"`
+	EncPart EncryptedData `asn1:"explicit,tag:3"`
+}
+
+// TransitedEncoding lists the realms transited to get a ticket.
+type TransitedEncoding struct {
+	TRType   int32  `asn1:"explicit,tag:0"`
+	Contents []byte `asn1:"explicit,tag:1"`
+}
+
+// EncTicketPart is the part of a ticket encrypted with the service's key.
+type EncTicketPart struct {
+	Flags     asn1.BitString    `asn1:"explicit,tag:0"`
+	Key       EncryptionKey     `asn1:"explicit,tag:1"`
+	CRealm    string            `asn1:"explicit,tag:2"`
+	CName     PrincipalName     `asn1:"explicit,tag:3"`
+	Transited TransitedEncoding `asn1:"explicit,tag:4"`
+	AuthTime  time.Time         `asn1:"generalized,explicit,tag:5"`
+	StartTime time.Time         `asn1:"generalized,optional,explicit,tag:6"`
+	EndTime   time.Time         `asn1:"generalized,explicit,tag:7"`
+}
+
+// KDCReqBody is the body of AS and TGS requests.
+type KDCReqBody struct {
+	KDCOptions asn1.BitString `asn1:"explicit,tag:0"`
+	CName      PrincipalName  `asn1:"optional,explicit,tag:1"`
+	Realm      string         `asn1:"explicit,tag:2"`
+	SName      PrincipalName  `asn1:"optional,explicit,tag:3"`
+	Till       time.Time      `asn1:"generalized,explicit,tag:5"`
+	Nonce      int64          `asn1:"explicit,tag:7"`
+	EType      []int32        `asn1:"explicit,tag:8"`
+}
+
+// KDCReq is an AS or TGS request.
+type KDCReq struct {
+	PVNO    int32      `asn1:"explicit,tag:1"`
+	MsgType int32      `asn1:"explicit,tag:2"`
+	PAData  []PAData   `asn1:"optional,explicit,tag:3"`
+	ReqBody KDCReqBody `asn1:"explicit,tag:4"`
+}
+
+// KDCRep is an AS or TGS reply.
+type KDCRep struct {
+	PVNO    int32         `asn1:"explicit,tag:0"`
+	MsgType int32         `asn1:"explicit,tag:1"`
+	PAData  []PAData      `asn1:"optional,explicit,tag:2"`
+	CRealm  string        `asn1:"explicit,tag:3"`
+	CName   PrincipalName `asn1:"explicit,tag:4"`
+	Ticket  asn1.RawValue `asn1:"explicit,tag:5"` // the encoded ticket with its explicit tag; see Explicit
+	EncPart EncryptedData `asn1:"explicit,tag:6"`
+}
+
+// LastReq is an entry of the last request information in a KDC reply.
+type LastReq struct {
+	LRType  int32     `asn1:"explicit,tag:0"`
+	LRValue time.Time `asn1:"generalized,explicit,tag:1"`
+}
+
+// EncKDCRepPart is the part of a KDC reply encrypted with the client's key or session key.
+type EncKDCRepPart struct {
+	Key           EncryptionKey  `asn1:"explicit,tag:0"`
+	LastReq       []LastReq      `asn1:"explicit,tag:1"`
+	Nonce         int64          `asn1:"explicit,tag:2"`
+	KeyExpiration time.Time      `asn1:"generalized,optional,explicit,tag:3"`
+	Flags         asn1.BitString `asn1:"explicit,tag:4"`
+	AuthTime      time.Time      `asn1:"generalized,explicit,tag:5"`
+	StartTime     time.Time      `asn1:"generalized,optional,explicit,tag:6"`
+	EndTime       time.Time      `asn1:"generalized,explicit,tag:7"`
+	RenewTill     time.Time      `asn1:"generalized,optional,explicit,tag:8"`
+	SRealm        string         `asn1:"explicit,tag:9"`
+	SName         PrincipalName  `asn1:"explicit,tag:10"`
+}
+
+// APReq is a request to authenticate to a service.
+type APReq struct {
+	PVNO          int32          `asn1:"explicit,tag:0"`
+	MsgType       int32          `asn1:"explicit,tag:1"`
+	APOptions     asn1.BitString `asn1:"explicit,tag:2"`
+	Ticket        asn1.RawValue  `asn1:"explicit,tag:3"` // the encoded ticket with its explicit tag; see Explicit
+	Authenticator EncryptedData  `asn1:"explicit,tag:4"`
+}
+
+// Authenticator proves that the client of an AP request knows the ticket's session key.
+type Authenticator struct {
+	AuthenticatorVNO int32         `asn1:"explicit,tag:0"`
+	CRealm           string        `asn1:"explicit,tag:1"`
+	CName            PrincipalName `asn1:"explicit,tag:2"`
+	Cksum            Checksum      `asn1:"optional,explicit,tag:3"`
+	CUSec            int32         `asn1:"explicit,tag:4"`
+	CTime            time.Time     `asn1:"generalized,explicit,tag:5"`
+	SubKey           EncryptionKey `asn1:"optional,explicit,tag:6"`
+	SeqNumber        int64         `asn1:"optional,explicit,tag:7"`
+}
+
+// APRep is the reply to an AP request that requires mutual authentication.
+type APRep struct {
+	PVNO    int32         `asn1:"explicit,tag:0"`
+	MsgType int32         `asn1:"explicit,tag:1"`
+	EncPart EncryptedData `asn1:"explicit,tag:2"`
+}
+
+// EncAPRepPart is the part of an AP reply encrypted with the session key.
+type EncAPRepPart struct {
+	CTime     time.Time     `asn1:"generalized,explicit,tag:0"`
+	CUSec     int32         `asn1:"explicit,tag:1"`
+	SubKey    EncryptionKey `asn1:"optional,explicit,tag:2"`
+	SeqNumber int64         `asn1:"optional,explicit,tag:3"`
+}
+
+// KRBError is an error returned by a KDC or service.
+type KRBError struct {
+	PVNO      int32         `asn1:"explicit,tag:0"`
+	MsgType   int32         `asn1:"explicit,tag:1"`
+	CTime     time.Time     `asn1:"generalized,optional,explicit,tag:2"`
+	CUSec     int32         `asn1:"optional,explicit,tag:3"`
+	STime     time.Time     `asn1:"generalized,explicit,tag:4"`
+	SUSec     int32         `asn1:"explicit,tag:5"`
+	ErrorCode int32         `asn1:"explicit,tag:6"`
+	CRealm    string        `asn1:"optional,explicit,tag:7"`
+	CName     PrincipalName `asn1:"optional,explicit,tag:8"`
+	Realm     string        `asn1:"explicit,tag:9"`
+	SName     PrincipalName `asn1:"explicit,tag:10"`
+	EText     string        `asn1:"optional,explicit,tag:11"`
+	EData     []byte        `asn1:"optional,explicit,tag:12"`
+}
+
+var errorNames = map[int32]string{
+	ErrCPrincipalUnknown: "client not found in Kerberos database",
+	ErrSPrincipalUnknown: "server not found in Kerberos database",
+	ErrPreauthFailed:     "pre-authentication failed",
+	ErrPreauthRequired:   "additional pre-authentication required",
+	ErrAPBadIntegrity:    "integrity check on decrypted field failed",
+	ErrAPTicketExpired:   "ticket expired",
+	ErrAPSkew:            "clock skew too great",
+	ErrAPModified:        "message stream modified",
+}
+
+func (e *KRBError) Error() string {
+	msg := errorNames[e.ErrorCode]
+	if msg == "" {
+		msg = "Kerberos error"
+	}
+	if e.EText != "" {
+		msg += ": " + e.EText
+	}
+	return fmt.Sprintf("%s (%d)", msg, e.ErrorCode)
+}
+
+// MarshalValue encodes a value of a message. Every character string in a message is a KerberosString, which is a
+// GeneralString that encoding/asn1 cannot marshal, so the strings are marshaled as other string types and retagged.
+func MarshalValue(v interface{}) ([]byte, error) {
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err = generalStrings(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Marshal encodes a message with an application tag.
+func Marshal(tag int, msg interface{}) ([]byte, error) {
+	b, err := asn1.MarshalWithParams(msg, fmt.Sprintf("application,explicit,tag:%d", tag))
+	if err != nil {
+		return nil, err
+	}
+	if err = generalStrings(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// generalStrings changes the tags of the character strings in an encoding to GeneralString.
+func generalStrings(b []byte) error {
+	for len(b) > 0 {
+		var raw asn1.RawValue
+		rest, err := asn1.Unmarshal(b, &raw)
+		if err != nil {
+			return err
+		}
+		if raw.Class == asn1.ClassUniversal {
+			switch raw.Tag {
+			case asn1.TagPrintableString, asn1.TagUTF8String, asn1.TagIA5String:
+				b[0] = asn1.TagGeneralString
+			}
+		}
+		if raw.IsCompound {
+			// the contents are the end of the encoding of the element, so they are changed in place
+			if err = generalStrings(b[len(raw.FullBytes)-len(raw.Bytes) : len(raw.FullBytes)]); err != nil {
+				return err
+			}
+		}
+		b = rest
+	}
+	return nil
+}
+
+// Explicit returns an encoded value with an explicit context-specific tag. RawValue fields with an explicit tag hold
+// the tagged value, because encoding/asn1 does not add the tag when marshaling them and keeps it when unmarshaling
+// them.
+func Explicit(tag int, b []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, IsCompound: true, Bytes: b}
+}
+
+// Unmarshal decodes a message with an application tag.
+func Unmarshal(b []byte, tag int, msg interface{}) error {
+	rest, err := asn1.UnmarshalWithParams(b, msg, fmt.Sprintf("application,explicit,tag:%d", tag))
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("trailing data after message with tag %d", tag)
+	}
+	return nil
+}
+
+// MessageTag returns the application tag of an encoded message, or -1 if it does not have one.
+func MessageTag(b []byte) int {
+	var raw asn1.RawValue
+	if _, err := asn1.Unmarshal(b, &raw); err != nil || raw.Class != asn1.ClassApplication {
+		return -1
+	}
+	return raw.Tag
+}
+
+// KerberosTime returns t truncated to the precision of Kerberos times.
+func KerberosTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
+
+// Flags returns a 32 bit KerberosFlags with the given bits set.
+func Flags(bits ...int) asn1.BitString {
+	b := asn1.BitString{Bytes: make([]byte, 4), BitLength: 32}
+	for _, bit := range bits {
+		b.Bytes[bit/8] |= 0x80 >> uint(bit%8)
+	}
+	return b
+}
@@ -0,0 +1,444 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appveen/mongo-go-driver/x/bsonx/bsoncore"
+	"github.com/appveen/mongo-go-driver/x/mongo/driver"
+	"github.com/appveen/mongo-go-driver/x/mongo/driver/description"
+)
+
+// MongoDBAWS is the mechanism name for MONGODB-AWS.
+const MongoDBAWS = "MONGODB-AWS"
+
+// Default endpoints used to retrieve temporary AWS credentials.
+const (
+	DefaultAWSSTSEndpoint = "https://sts.amazonaws.com"
+	DefaultAWSECSEndpoint = "http://169.254.170.2"
+	DefaultAWSEC2Endpoint = "http://169.254.169.254"
+)
+
+const (
+	awsNonceLen           = 32
+	awsGS2CBFlag          = 'n' // the client does not support channel binding
+	awsSTSBody            = "Action=GetCallerIdentity&Version=2011-06-15"
+	awsCredentialsRefresh = 5 * time.Minute // temporary credentials are refreshed this long before they expire
+	awsRequestTimeout     = 10 * time.Second
+)
+
+// ErrNoAWSCredentials is returned when no AWS credentials were found for MONGODB-AWS authentication.
+var ErrNoAWSCredentials = errors.New("no AWS credentials found in the connection string, credential provider, " +
+	"environment, or ECS and EC2 metadata")
+
+// AWSCredentials are the credentials of an AWS IAM identity.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string    // the session token of temporary credentials
+	Expiration      time.Time // the expiration of temporary credentials, or the zero time
+}
+
+// AWSCredentialProvider provides AWS credentials for MONGODB-AWS authentication. Retrieve is called for each
+// connection that authenticates, so implementations should cache credentials as needed.
+type AWSCredentialProvider interface {
+	Retrieve(ctx context.Context) (AWSCredentials, error)
+}
+
+// AWSCredentialProviderFunc is a function that implements AWSCredentialProvider.
+type AWSCredentialProviderFunc func(ctx context.Context) (AWSCredentials, error)
+
+// Retrieve implements the AWSCredentialProvider interface.
+func (f AWSCredentialProviderFunc) Retrieve(ctx context.Context) (AWSCredentials, error) {
+	return f(ctx)
+}
+
+func newMongoDBAWSAuthenticator(cred *Cred) (Authenticator, error) {
+	if cred.Source != "" && cred.Source != "$external" {
+		return nil, newAuthError("MONGODB-AWS source must be empty or $external", nil)
+	}
+	return &MongoDBAWSAuthenticator{
+		Credentials: AWSCredentials{
+			AccessKeyID:     cred.Username,
+			SecretAccessKey: cred.Password,
+			SessionToken:    cred.Props["AWS_SESSION_TOKEN"],
+		},
+		Provider: cred.AWSCredentialProvider,
+	}, nil
+}
+
+// MongoDBAWSAuthenticator uses AWS IAM credentials over SASL to authenticate a connection. The credentials are taken
+// from the first of these sources that has them:
+//
+// 1. Credentials, which hold the username, password and AWS_SESSION_TOKEN mechanism property of the connection string.
+//
+// 2. Provider.
+//
+// 3. The AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+//
+// 4. An AssumeRoleWithWebIdentity request to STS, if the AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_ARN environment
+// variables are set.
+//
+// 5. The ECS container metadata, if the AWS_CONTAINER_CREDENTIALS_RELATIVE_URI environment variable is set.
+//
+// 6. The EC2 instance metadata.
+//
+// Temporary credentials from STS or the metadata endpoints are cached until shortly before they expire.
+type MongoDBAWSAuthenticator struct {
+	Credentials AWSCredentials
+	Provider    AWSCredentialProvider
+
+	// The endpoints used to retrieve temporary credentials. They default to DefaultAWSSTSEndpoint,
+	// DefaultAWSECSEndpoint and DefaultAWSEC2Endpoint.
+	STSEndpoint string
+	ECSEndpoint string
+	EC2Endpoint string
+	// HTTPClient is used for requests to the endpoints. It defaults to a client with a 10 second timeout.
+	HTTPClient *http.Client
+
+	mu     sync.Mutex
+	cached *AWSCredentials
+}
+
+// Auth authenticates the connection.
+func (a *MongoDBAWSAuthenticator) Auth(ctx context.Context, _ description.Server, conn driver.Connection) error {
+	creds, err := a.credentials(ctx)
+	if err != nil {
+		return newError(err, MongoDBAWS)
+	}
+
+	err = ConductSaslConversation(ctx, conn, "$external", &awsSaslClient{creds: creds})
+	if err != nil {
+		return newAuthError("sasl conversation error", err)
+	}
+	return nil
+}
+
+func (a *MongoDBAWSAuthenticator) credentials(ctx context.Context) (AWSCredentials, error) {
+	if a.Credentials.AccessKeyID != "" || a.Credentials.SecretAccessKey != "" {
+		return validAWSCredentials(a.Credentials)
+	}
+	if a.Provider != nil {
+		creds, err := a.Provider.Retrieve(ctx)
+		if err != nil {
+			return AWSCredentials{}, err
+		}
+		return validAWSCredentials(creds)
+	}
+	if creds := awsEnvCredentials(); creds.AccessKeyID != "" || creds.SecretAccessKey != "" {
+		return validAWSCredentials(creds)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.cached != nil && time.Now().Add(awsCredentialsRefresh).Before(a.cached.Expiration) {
+		return *a.cached, nil
+	}
+	creds, err := a.temporaryCredentials(ctx)
+	if err != nil {
+		return AWSCredentials{}, err
+	}
+	if creds, err = validAWSCredentials(creds); err != nil {
+		return AWSCredentials{}, err
+	}
+	if !creds.Expiration.IsZero() {
+		a.cached = &creds
+	}
+	return creds, nil
+}
+
+func validAWSCredentials(creds AWSCredentials) (AWSCredentials, error) {
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return AWSCredentials{}, errors.New("AWS credentials must have both an access key ID and a secret access key")
+	}
+	return creds, nil
+}
+
+func awsEnvCredentials() AWSCredentials {
+	return AWSCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// temporaryCredentials retrieves temporary credentials from STS or the ECS or EC2 metadata endpoints.
+func (a *MongoDBAWSAuthenticator) temporaryCredentials(ctx context.Context) (AWSCredentials, error) {
+	if tokenFile := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"); tokenFile != "" && os.Getenv("AWS_ROLE_ARN") != "" {
+		return a.webIdentityCredentials(ctx, tokenFile)
+	}
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		return a.ecsCredentials(ctx, uri)
+	}
+	return a.ec2Credentials(ctx)
+}
+
+func (a *MongoDBAWSAuthenticator) webIdentityCredentials(ctx context.Context, tokenFile string) (AWSCredentials, error) {
+	token, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return AWSCredentials{}, err
+	}
+	sessionName := os.Getenv("AWS_ROLE_SESSION_NAME")
+	if sessionName == "" {
+		sessionName = fmt.Sprintf("mongo-go-driver-%d", time.Now().UnixNano())
+	}
+
+	query := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"RoleArn":          {os.Getenv("AWS_ROLE_ARN")},
+		"RoleSessionName":  {sessionName},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+		"Version":          {"2011-06-15"},
+	}
+	req, err := http.NewRequest(http.MethodGet, endpoint(a.STSEndpoint, DefaultAWSSTSEndpoint)+"/?"+query.Encode(), nil)
+	if err != nil {
+		return AWSCredentials{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	var res struct {
+		Response struct {
+			Result struct {
+				Credentials awsTemporaryCredentials
+			} `json:"AssumeRoleWithWebIdentityResult"`
+		} `json:"AssumeRoleWithWebIdentityResponse"`
+	}
+	if err = a.doJSON(ctx, req, &res); err != nil {
+		return AWSCredentials{}, err
+	}
+	return res.Response.Result.Credentials.credentials()
+}
+
+func (a *MongoDBAWSAuthenticator) ecsCredentials(ctx context.Context, uri string) (AWSCredentials, error) {
+	req, err := http.NewRequest(http.MethodGet, endpoint(a.ECSEndpoint, DefaultAWSECSEndpoint)+uri, nil)
+	if err != nil {
+		return AWSCredentials{}, err
+	}
+
+	var creds awsTemporaryCredentials
+	if err = a.doJSON(ctx, req, &creds); err != nil {
+		return AWSCredentials{}, err
+	}
+	return creds.credentials()
+}
+
+func (a *MongoDBAWSAuthenticator) ec2Credentials(ctx context.Context) (AWSCredentials, error) {
+	base := endpoint(a.EC2Endpoint, DefaultAWSEC2Endpoint)
+
+	// IMDSv2 requires a session token
+	req, err := http.NewRequest(http.MethodPut, base+"/latest/api/token", nil)
+	if err != nil {
+		return AWSCredentials{}, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "30")
+	token, err := a.do(ctx, req)
+	if err != nil {
+		return AWSCredentials{}, fmt.Errorf("%v: %v", ErrNoAWSCredentials, err)
+	}
+
+	path := base + "/latest/meta-data/iam/security-credentials/"
+	if req, err = http.NewRequest(http.MethodGet, path, nil); err != nil {
+		return AWSCredentials{}, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", string(token))
+	role, err := a.do(ctx, req)
+	if err != nil {
+		return AWSCredentials{}, err
+	}
+
+	if req, err = http.NewRequest(http.MethodGet, path+strings.TrimSpace(string(role)), nil); err != nil {
+		return AWSCredentials{}, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", string(token))
+	var creds awsTemporaryCredentials
+	if err = a.doJSON(ctx, req, &creds); err != nil {
+		return AWSCredentials{}, err
+	}
+	return creds.credentials()
+}
+
+func (a *MongoDBAWSAuthenticator) do(ctx context.Context, req *http.Request) ([]byte, error) {
+	client := a.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: awsRequestTimeout}
+	}
+
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s returned %s", req.Method, req.URL.Path, res.Status)
+	}
+	return body, nil
+}
+
+func (a *MongoDBAWSAuthenticator) doJSON(ctx context.Context, req *http.Request, val interface{}) error {
+	body, err := a.do(ctx, req)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, val)
+}
+
+// awsTemporaryCredentials holds temporary credentials as returned by STS and the metadata endpoints.
+type awsTemporaryCredentials struct {
+	AccessKeyID     string      `json:"AccessKeyId"`
+	SecretAccessKey string      `json:"SecretAccessKey"`
+	SessionToken    string      `json:"SessionToken"`
+	Token           string      `json:"Token"`
+	Expiration      interface{} `json:"Expiration"` // an RFC 3339 string, or seconds since the epoch from STS
+}
+
+func (tc awsTemporaryCredentials) credentials() (AWSCredentials, error) {
+	creds := AWSCredentials{
+		AccessKeyID:     tc.AccessKeyID,
+		SecretAccessKey: tc.SecretAccessKey,
+		SessionToken:    tc.SessionToken,
+	}
+	if creds.SessionToken == "" {
+		creds.SessionToken = tc.Token
+	}
+
+	switch exp := tc.Expiration.(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339, exp)
+		if err != nil {
+			return AWSCredentials{}, err
+		}
+		creds.Expiration = t
+	case float64:
+		creds.Expiration = time.Unix(int64(exp), 0)
+	}
+	return creds, nil
+}
+
+func endpoint(configured, def string) string {
+	if configured == "" {
+		return def
+	}
+	return strings.TrimSuffix(configured, "/")
+}
+
+// awsSaslClient runs the MONGODB-AWS conversation: the client sends a nonce, the server answers with its nonce and
+// the STS host, and the client sends the headers of an sts:GetCallerIdentity request signed with its credentials,
+// which the server sends to STS to learn the client's identity.
+type awsSaslClient struct {
+	creds AWSCredentials
+	nonce []byte
+	step  int
+}
+
+var _ SaslClient = (*awsSaslClient)(nil)
+
+func (c *awsSaslClient) Start() (string, []byte, error) {
+	c.nonce = make([]byte, awsNonceLen)
+	if _, err := io.ReadFull(rand.Reader, c.nonce); err != nil {
+		return MongoDBAWS, nil, err
+	}
+
+	payload := bsoncore.BuildDocumentFromElements(nil,
+		bsoncore.AppendBinaryElement(nil, "r", 0x00, c.nonce),
+		bsoncore.AppendInt32Element(nil, "p", awsGS2CBFlag),
+	)
+	return MongoDBAWS, payload, nil
+}
+
+func (c *awsSaslClient) Next(challenge []byte) ([]byte, error) {
+	c.step++
+	if c.step != 1 {
+		return nil, newAuthError("unexpected server challenge", nil)
+	}
+
+	doc := bsoncore.Document(challenge)
+	if err := doc.Validate(); err != nil {
+		return nil, err
+	}
+	_, serverNonce, ok := doc.Lookup("s").BinaryOK()
+	if !ok {
+		return nil, newAuthError("server challenge has no nonce", nil)
+	}
+	host, ok := doc.Lookup("h").StringValueOK()
+	if !ok {
+		return nil, newAuthError("server challenge has no STS host", nil)
+	}
+	if len(serverNonce) != 2*awsNonceLen || !bytes.HasPrefix(serverNonce, c.nonce) {
+		return nil, newAuthError("server nonce does not extend the client nonce", nil)
+	}
+	if err := validateSTSHost(host); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	req := awsRequest{
+		method: http.MethodPost,
+		path:   "/",
+		headers: map[string]string{
+			"content-length":         fmt.Sprint(len(awsSTSBody)),
+			"content-type":           "application/x-www-form-urlencoded",
+			"host":                   host,
+			"x-amz-date":             now.Format(awsDateFormat),
+			"x-mongodb-gs2-cb-flag":  string(awsGS2CBFlag),
+			"x-mongodb-server-nonce": base64.StdEncoding.EncodeToString(serverNonce),
+		},
+		body: []byte(awsSTSBody),
+	}
+	if c.creds.SessionToken != "" {
+		req.headers["x-amz-security-token"] = c.creds.SessionToken
+	}
+	authorization := signAWSRequest(req, c.creds, awsRegion(host), "sts", now)
+
+	elems := [][]byte{
+		bsoncore.AppendStringElement(nil, "a", authorization),
+		bsoncore.AppendStringElement(nil, "d", req.headers["x-amz-date"]),
+	}
+	if c.creds.SessionToken != "" {
+		elems = append(elems, bsoncore.AppendStringElement(nil, "t", c.creds.SessionToken))
+	}
+	return bsoncore.BuildDocumentFromElements(nil, elems...), nil
+}
+
+func (c *awsSaslClient) Completed() bool {
+	return c.step == 1
+}
+
+// validateSTSHost checks the STS host sent by the server, which must be a valid host name.
+func validateSTSHost(host string) error {
+	if host == "" || len(host) > 255 {
+		return newAuthError(fmt.Sprintf("invalid STS host %q", host), nil)
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" {
+			return newAuthError(fmt.Sprintf("invalid STS host %q", host), nil)
+		}
+	}
+	return nil
+}
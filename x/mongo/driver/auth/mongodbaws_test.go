@@ -0,0 +1,332 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/appveen/mongo-go-driver/x/bsonx/bsoncore"
+)
+
+var testAWSCredentials = AWSCredentials{
+	AccessKeyID:     "AKIDEXAMPLE",
+	SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+}
+
+// setAWSEnv sets the given AWS environment variables and unsets the others. It returns a function that restores them.
+func setAWSEnv(t *testing.T, env map[string]string) func() {
+	names := []string{
+		"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_WEB_IDENTITY_TOKEN_FILE",
+		"AWS_ROLE_ARN", "AWS_ROLE_SESSION_NAME", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI",
+	}
+	old := make(map[string]string)
+	for _, name := range names {
+		if val, ok := os.LookupEnv(name); ok {
+			old[name] = val
+		}
+		require.NoError(t, os.Unsetenv(name))
+		if val, ok := env[name]; ok {
+			require.NoError(t, os.Setenv(name, val))
+		}
+	}
+	return func() {
+		for _, name := range names {
+			if val, ok := old[name]; ok {
+				_ = os.Setenv(name, val)
+			} else {
+				_ = os.Unsetenv(name)
+			}
+		}
+	}
+}
+
+func TestSignAWSRequest(t *testing.T) {
+	date, err := time.Parse(awsDateFormat, "20150830T123600Z")
+	require.NoError(t, err)
+
+	t.Run("get-vanilla", func(t *testing.T) {
+		req := awsRequest{
+			method: "GET",
+			path:   "/",
+			headers: map[string]string{
+				"host":       "example.amazonaws.com",
+				"x-amz-date": "20150830T123600Z",
+			},
+		}
+		expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+			"SignedHeaders=host;x-amz-date, " +
+			"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+		require.Equal(t, expected, signAWSRequest(req, testAWSCredentials, "us-east-1", "service", date))
+	})
+	t.Run("iam ListUsers", func(t *testing.T) {
+		req := awsRequest{
+			method: "GET",
+			path:   "/",
+			query:  "Action=ListUsers&Version=2010-05-08",
+			headers: map[string]string{
+				"content-type": "application/x-www-form-urlencoded; charset=utf-8",
+				"host":         "iam.amazonaws.com",
+				"x-amz-date":   "20150830T123600Z",
+			},
+		}
+		expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, " +
+			"SignedHeaders=content-type;host;x-amz-date, " +
+			"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+		require.Equal(t, expected, signAWSRequest(req, testAWSCredentials, "us-east-1", "iam", date))
+	})
+}
+
+func TestAWSRegion(t *testing.T) {
+	tests := map[string]string{
+		"sts.amazonaws.com":           "us-east-1",
+		"sts.us-west-2.amazonaws.com": "us-west-2",
+		"localhost":                   "us-east-1",
+	}
+	for host, region := range tests {
+		require.Equal(t, region, awsRegion(host), host)
+	}
+}
+
+func TestAWSSaslClient(t *testing.T) {
+	challenge := func(t *testing.T, c *awsSaslClient, host string) []byte {
+		_, payload, err := c.Start()
+		require.NoError(t, err)
+		_, nonce, ok := bsoncore.Document(payload).Lookup("r").BinaryOK()
+		require.True(t, ok)
+		require.Len(t, nonce, awsNonceLen)
+		require.Equal(t, int32('n'), bsoncore.Document(payload).Lookup("p").Int32())
+
+		serverNonce := append(append([]byte{}, nonce...), bytes.Repeat([]byte{0xab}, awsNonceLen)...)
+		return bsoncore.BuildDocumentFromElements(nil,
+			bsoncore.AppendBinaryElement(nil, "s", 0x00, serverNonce),
+			bsoncore.AppendStringElement(nil, "h", host),
+		)
+	}
+
+	t.Run("signed request", func(t *testing.T) {
+		creds := testAWSCredentials
+		creds.SessionToken = "token"
+		c := &awsSaslClient{creds: creds}
+
+		payload, err := c.Next(challenge(t, c, "sts.us-west-2.amazonaws.com"))
+		require.NoError(t, err)
+		require.True(t, c.Completed())
+
+		doc := bsoncore.Document(payload)
+		authorization := doc.Lookup("a").StringValue()
+		require.Equal(t, "token", doc.Lookup("t").StringValue())
+		date := doc.Lookup("d").StringValue()
+		require.True(t, strings.HasPrefix(authorization,
+			fmt.Sprintf("AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/%s/us-west-2/sts/aws4_request, ", date[:8])))
+		require.Contains(t, authorization, "SignedHeaders=content-length;content-type;host;x-amz-date;"+
+			"x-amz-security-token;x-mongodb-gs2-cb-flag;x-mongodb-server-nonce, ")
+	})
+	t.Run("server nonce must extend client nonce", func(t *testing.T) {
+		c := &awsSaslClient{creds: testAWSCredentials}
+		_, _, err := c.Start()
+		require.NoError(t, err)
+		_, err = c.Next(bsoncore.BuildDocumentFromElements(nil,
+			bsoncore.AppendBinaryElement(nil, "s", 0x00, make([]byte, 2*awsNonceLen)),
+			bsoncore.AppendStringElement(nil, "h", "sts.amazonaws.com"),
+		))
+		require.Error(t, err)
+	})
+	t.Run("invalid STS host", func(t *testing.T) {
+		c := &awsSaslClient{creds: testAWSCredentials}
+		_, err := c.Next(challenge(t, c, "sts..amazonaws.com"))
+		require.Error(t, err)
+	})
+}
+
+func TestMongoDBAWSCredentials(t *testing.T) {
+	ctx := context.Background()
+	expiration := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	t.Run("connection string", func(t *testing.T) {
+		defer setAWSEnv(t, map[string]string{"AWS_ACCESS_KEY_ID": "env", "AWS_SECRET_ACCESS_KEY": "env"})()
+		a, err := newMongoDBAWSAuthenticator(&Cred{
+			Username: "uri",
+			Password: "secret",
+			Props:    map[string]string{"AWS_SESSION_TOKEN": "token"},
+		})
+		require.NoError(t, err)
+
+		creds, err := a.(*MongoDBAWSAuthenticator).credentials(ctx)
+		require.NoError(t, err)
+		require.Equal(t, AWSCredentials{AccessKeyID: "uri", SecretAccessKey: "secret", SessionToken: "token"}, creds)
+	})
+	t.Run("provider", func(t *testing.T) {
+		defer setAWSEnv(t, map[string]string{"AWS_ACCESS_KEY_ID": "env", "AWS_SECRET_ACCESS_KEY": "env"})()
+		a := &MongoDBAWSAuthenticator{
+			Provider: AWSCredentialProviderFunc(func(context.Context) (AWSCredentials, error) {
+				return testAWSCredentials, nil
+			}),
+		}
+		creds, err := a.credentials(ctx)
+		require.NoError(t, err)
+		require.Equal(t, testAWSCredentials, creds)
+	})
+	t.Run("environment", func(t *testing.T) {
+		defer setAWSEnv(t, map[string]string{"AWS_ACCESS_KEY_ID": "id", "AWS_SECRET_ACCESS_KEY": "secret"})()
+		creds, err := (&MongoDBAWSAuthenticator{}).credentials(ctx)
+		require.NoError(t, err)
+		require.Equal(t, AWSCredentials{AccessKeyID: "id", SecretAccessKey: "secret"}, creds)
+	})
+	t.Run("incomplete credentials", func(t *testing.T) {
+		defer setAWSEnv(t, nil)()
+		a := &MongoDBAWSAuthenticator{Credentials: AWSCredentials{AccessKeyID: "id"}}
+		_, err := a.credentials(ctx)
+		require.Error(t, err)
+	})
+	t.Run("web identity", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "mongodbaws")
+		require.NoError(t, err)
+		defer func() {
+			_ = os.RemoveAll(dir)
+		}()
+		tokenFile := filepath.Join(dir, "token")
+		require.NoError(t, ioutil.WriteFile(tokenFile, []byte("web-token\n"), 0600))
+		defer setAWSEnv(t, map[string]string{
+			"AWS_WEB_IDENTITY_TOKEN_FILE": tokenFile,
+			"AWS_ROLE_ARN":                "arn:aws:iam::123456789012:role/test",
+		})()
+
+		sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			if query.Get("Action") != "AssumeRoleWithWebIdentity" || query.Get("WebIdentityToken") != "web-token" ||
+				query.Get("RoleArn") != "arn:aws:iam::123456789012:role/test" {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			_, _ = fmt.Fprintf(w, `{"AssumeRoleWithWebIdentityResponse": {"AssumeRoleWithWebIdentityResult": {
+				"Credentials": {"AccessKeyId": "sts", "SecretAccessKey": "secret", "SessionToken": "token",
+				"Expiration": %d}}}}`, time.Now().Add(time.Hour).Unix())
+		}))
+		defer sts.Close()
+
+		creds, err := (&MongoDBAWSAuthenticator{STSEndpoint: sts.URL}).credentials(ctx)
+		require.NoError(t, err)
+		require.Equal(t, "sts", creds.AccessKeyID)
+		require.Equal(t, "token", creds.SessionToken)
+		require.False(t, creds.Expiration.IsZero())
+	})
+	t.Run("ECS", func(t *testing.T) {
+		defer setAWSEnv(t, map[string]string{"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI": "/v2/credentials/test"})()
+
+		var requests int
+		ecs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if r.URL.Path != "/v2/credentials/test" {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = fmt.Fprintf(w, `{"AccessKeyId": "ecs", "SecretAccessKey": "secret", "Token": "token",
+				"Expiration": %q}`, expiration)
+		}))
+		defer ecs.Close()
+
+		a := &MongoDBAWSAuthenticator{ECSEndpoint: ecs.URL}
+		creds, err := a.credentials(ctx)
+		require.NoError(t, err)
+		require.Equal(t, "ecs", creds.AccessKeyID)
+		require.Equal(t, "token", creds.SessionToken)
+
+		_, err = a.credentials(ctx)
+		require.NoError(t, err)
+		require.Equal(t, 1, requests, "expected temporary credentials to be cached")
+	})
+	t.Run("EC2", func(t *testing.T) {
+		defer setAWSEnv(t, nil)()
+
+		ec2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+				_, _ = w.Write([]byte("imds-token"))
+			case r.Header.Get("X-aws-ec2-metadata-token") != "imds-token":
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+			case r.URL.Path == "/latest/meta-data/iam/security-credentials/":
+				_, _ = w.Write([]byte("role"))
+			case r.URL.Path == "/latest/meta-data/iam/security-credentials/role":
+				_, _ = fmt.Fprintf(w, `{"AccessKeyId": "ec2", "SecretAccessKey": "secret", "Token": "token",
+					"Expiration": %q}`, expiration)
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		defer ec2.Close()
+
+		creds, err := (&MongoDBAWSAuthenticator{EC2Endpoint: ec2.URL}).credentials(ctx)
+		require.NoError(t, err)
+		require.Equal(t, "ec2", creds.AccessKeyID)
+		require.Equal(t, "token", creds.SessionToken)
+	})
+	t.Run("expired credentials are refreshed", func(t *testing.T) {
+		defer setAWSEnv(t, map[string]string{"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI": "/creds"})()
+
+		var requests int
+		ecs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			// expires within the refresh window
+			exp := time.Now().Add(time.Minute).UTC().Format(time.RFC3339)
+			_, _ = fmt.Fprintf(w, `{"AccessKeyId": "ecs", "SecretAccessKey": "secret", "Expiration": %q}`, exp)
+		}))
+		defer ecs.Close()
+
+		a := &MongoDBAWSAuthenticator{ECSEndpoint: ecs.URL}
+		for i := 0; i < 2; i++ {
+			_, err := a.credentials(ctx)
+			require.NoError(t, err)
+		}
+		require.Equal(t, 2, requests)
+	})
+}
+
+func TestAWSSaslClientNonceEncoding(t *testing.T) {
+	c := &awsSaslClient{creds: testAWSCredentials}
+	_, payload, err := c.Start()
+	require.NoError(t, err)
+	_, nonce, _ := bsoncore.Document(payload).Lookup("r").BinaryOK()
+	serverNonce := append(append([]byte{}, nonce...), make([]byte, awsNonceLen)...)
+
+	// the signature covers the server nonce, so signing the same request must reproduce it
+	resp, err := c.Next(bsoncore.BuildDocumentFromElements(nil,
+		bsoncore.AppendBinaryElement(nil, "s", 0x00, serverNonce),
+		bsoncore.AppendStringElement(nil, "h", "sts.amazonaws.com"),
+	))
+	require.NoError(t, err)
+	date := bsoncore.Document(resp).Lookup("d").StringValue()
+	signedAt, err := time.Parse(awsDateFormat, date)
+	require.NoError(t, err)
+
+	req := awsRequest{
+		method: http.MethodPost,
+		path:   "/",
+		headers: map[string]string{
+			"content-length":         fmt.Sprint(len(awsSTSBody)),
+			"content-type":           "application/x-www-form-urlencoded",
+			"host":                   "sts.amazonaws.com",
+			"x-amz-date":             date,
+			"x-mongodb-gs2-cb-flag":  "n",
+			"x-mongodb-server-nonce": base64.StdEncoding.EncodeToString(serverNonce),
+		},
+		body: []byte(awsSTSBody),
+	}
+	require.Equal(t, signAWSRequest(req, testAWSCredentials, "us-east-1", "sts", signedAt),
+		bsoncore.Document(resp).Lookup("a").StringValue())
+}
@@ -0,0 +1,195 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/appveen/mongo-go-driver/x/bsonx/bsoncore"
+	"github.com/appveen/mongo-go-driver/x/mongo/driver"
+	"github.com/appveen/mongo-go-driver/x/mongo/driver/description"
+)
+
+// MongoDBOIDC is the mechanism name for MONGODB-OIDC.
+const MongoDBOIDC = "MONGODB-OIDC"
+
+// oidcRefreshWindow is how long before its expiration a cached access token is refreshed.
+const oidcRefreshWindow = 5 * time.Minute
+
+// authenticationFailedCode is the server error code for failed authentication.
+const authenticationFailedCode = 18
+
+// OIDCToken is an OIDC access token.
+type OIDCToken struct {
+	AccessToken  string
+	ExpiresAt    time.Time // the expiration of the access token, or the zero time if it is unknown
+	RefreshToken string    // a token the refresh callback can use to get a new access token, if any
+}
+
+// OIDCCallbackArgs are the arguments passed to OIDC callbacks.
+type OIDCCallbackArgs struct {
+	// Username is the username of the credential, which identifies the principal if the identity provider serves
+	// several of them.
+	Username string
+	// RefreshToken is the refresh token of the cached access token. It is only set for the refresh callback.
+	RefreshToken string
+}
+
+// OIDCCallback returns an OIDC access token for MONGODB-OIDC authentication.
+type OIDCCallback func(context.Context, *OIDCCallbackArgs) (*OIDCToken, error)
+
+func newOIDCAuthenticator(cred *Cred) (Authenticator, error) {
+	if cred.Source != "" && cred.Source != "$external" {
+		return nil, newAuthError("MONGODB-OIDC source must be empty or $external", nil)
+	}
+	if cred.Password != "" {
+		return nil, newAuthError("MONGODB-OIDC does not support a password", nil)
+	}
+	if cred.OIDCCallback == nil {
+		return nil, newAuthError("MONGODB-OIDC requires a token callback", nil)
+	}
+	return &OIDCAuthenticator{
+		Username:        cred.Username,
+		Callback:        cred.OIDCCallback,
+		RefreshCallback: cred.OIDCRefreshCallback,
+	}, nil
+}
+
+// OIDCAuthenticator uses OIDC access tokens over SASL to authenticate a connection. Access tokens are obtained from
+// Callback and cached across connections. When a cached token that has a refresh token is about to expire, it is
+// replaced by one from RefreshCallback, or from Callback if there is no RefreshCallback or it fails. If the server
+// rejects a cached token, the token is discarded and authentication is retried once with a new one.
+type OIDCAuthenticator struct {
+	Username        string
+	Callback        OIDCCallback
+	RefreshCallback OIDCCallback
+
+	mu    sync.Mutex
+	token *OIDCToken
+}
+
+// Auth authenticates the connection.
+func (a *OIDCAuthenticator) Auth(ctx context.Context, _ description.Server, conn driver.Connection) error {
+	token, err := a.getToken(ctx)
+	if err != nil {
+		return newError(err, MongoDBOIDC)
+	}
+
+	err = ConductSaslConversation(ctx, conn, "$external", &oidcSaslClient{token: token.AccessToken})
+	if err == nil {
+		return nil
+	}
+	if !isAuthenticationFailure(err) {
+		return newAuthError("sasl conversation error", err)
+	}
+
+	// the token may have expired or been revoked before its expiration
+	a.invalidate(token)
+	if token, err = a.getToken(ctx); err != nil {
+		return newError(err, MongoDBOIDC)
+	}
+	err = ConductSaslConversation(ctx, conn, "$external", &oidcSaslClient{token: token.AccessToken})
+	if err != nil {
+		return newAuthError("sasl conversation error", err)
+	}
+	return nil
+}
+
+// getToken returns the cached access token, refreshing or replacing it if it is about to expire.
+func (a *OIDCAuthenticator) getToken(ctx context.Context) (*OIDCToken, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token != nil {
+		if a.token.ExpiresAt.IsZero() || time.Now().Add(oidcRefreshWindow).Before(a.token.ExpiresAt) {
+			return a.token, nil
+		}
+		if a.RefreshCallback != nil && a.token.RefreshToken != "" {
+			token, err := a.RefreshCallback(ctx, &OIDCCallbackArgs{
+				Username:     a.Username,
+				RefreshToken: a.token.RefreshToken,
+			})
+			if err == nil && validOIDCToken(token) == nil {
+				a.token = token
+				return token, nil
+			}
+		}
+		a.token = nil
+	}
+
+	token, err := a.Callback(ctx, &OIDCCallbackArgs{Username: a.Username})
+	if err != nil {
+		return nil, err
+	}
+	if err = validOIDCToken(token); err != nil {
+		return nil, err
+	}
+	a.token = token
+	return token, nil
+}
+
+// invalidate discards the cached access token if it is the given one, which the server rejected. Another connection
+// may have replaced it already.
+func (a *OIDCAuthenticator) invalidate(token *OIDCToken) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token == token {
+		a.token = nil
+	}
+}
+
+func validOIDCToken(token *OIDCToken) error {
+	if token == nil || token.AccessToken == "" {
+		return errors.New("OIDC callback returned no access token")
+	}
+	return nil
+}
+
+// isAuthenticationFailure returns true if err was caused by the server rejecting the credentials.
+func isAuthenticationFailure(err error) bool {
+	de, ok := driverError(err)
+	return ok && de.Code == authenticationFailedCode
+}
+
+// driverError returns the server or network error that caused an authentication error.
+func driverError(err error) (driver.Error, bool) {
+	for err != nil {
+		switch e := err.(type) {
+		case *Error:
+			err = e.inner
+		case driver.Error:
+			return e, true
+		default:
+			return driver.Error{}, false
+		}
+	}
+	return driver.Error{}, false
+}
+
+// oidcSaslClient sends an access token in a single step.
+type oidcSaslClient struct {
+	token string
+}
+
+var _ SaslClient = (*oidcSaslClient)(nil)
+
+func (c *oidcSaslClient) Start() (string, []byte, error) {
+	payload := bsoncore.BuildDocumentFromElements(nil, bsoncore.AppendStringElement(nil, "jwt", c.token))
+	return MongoDBOIDC, payload, nil
+}
+
+func (c *oidcSaslClient) Next([]byte) ([]byte, error) {
+	return nil, newAuthError("unexpected server challenge", nil)
+}
+
+func (c *oidcSaslClient) Completed() bool {
+	return true
+}
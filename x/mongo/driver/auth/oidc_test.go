@@ -0,0 +1,157 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/appveen/mongo-go-driver/x/bsonx/bsoncore"
+	"github.com/appveen/mongo-go-driver/x/mongo/driver"
+	. "github.com/appveen/mongo-go-driver/x/mongo/driver/auth"
+	"github.com/appveen/mongo-go-driver/x/mongo/driver/description"
+	"github.com/appveen/mongo-go-driver/x/mongo/driver/drivertest"
+)
+
+var oidcDone = bsoncore.BuildDocumentFromElements(nil,
+	bsoncore.AppendInt32Element(nil, "ok", 1),
+	bsoncore.AppendInt32Element(nil, "conversationId", 1),
+	bsoncore.AppendBinaryElement(nil, "payload", 0x00, []byte{}),
+	bsoncore.AppendBooleanElement(nil, "done", true),
+)
+
+var oidcAuthFailed = bsoncore.BuildDocumentFromElements(nil,
+	bsoncore.AppendInt32Element(nil, "ok", 0),
+	bsoncore.AppendInt32Element(nil, "code", 18),
+	bsoncore.AppendStringElement(nil, "errmsg", "Authentication failed."),
+)
+
+// oidcConn returns a connection that replies with the given documents.
+func oidcConn(t *testing.T, replies ...bsoncore.Document) *drivertest.ChannelConn {
+	resps := make(chan []byte, len(replies))
+	writeReplies(t, resps, replies...)
+	return &drivertest.ChannelConn{
+		Written:  make(chan []byte, len(replies)),
+		ReadResp: resps,
+	}
+}
+
+// writtenJWT returns the access token sent in the saslStart command written to conn.
+func writtenJWT(t *testing.T, conn *drivertest.ChannelConn) string {
+	t.Helper()
+
+	cmd := writtenCommand(t, <-conn.Written)
+	require.Equal(t, MongoDBOIDC, cmd.Lookup("mechanism").StringValue())
+	_, payload := cmd.Lookup("payload").Binary()
+	return bsoncore.Document(payload).Lookup("jwt").StringValue()
+}
+
+func TestOIDCAuthenticator(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("tokens are cached", func(t *testing.T) {
+		var calls int
+		authenticator, err := CreateAuthenticator(MongoDBOIDC, &Cred{
+			Username: "principal",
+			OIDCCallback: func(_ context.Context, args *OIDCCallbackArgs) (*OIDCToken, error) {
+				calls++
+				require.Equal(t, "principal", args.Username)
+				return &OIDCToken{AccessToken: "token", ExpiresAt: time.Now().Add(time.Hour)}, nil
+			},
+		})
+		require.NoError(t, err)
+
+		for i := 0; i < 2; i++ {
+			conn := oidcConn(t, oidcDone)
+			require.NoError(t, authenticator.Auth(ctx, description.Server{}, conn))
+			require.Equal(t, "token", writtenJWT(t, conn))
+		}
+		require.Equal(t, 1, calls)
+	})
+	t.Run("refresh before expiry", func(t *testing.T) {
+		var refreshed string
+		authenticator := &OIDCAuthenticator{
+			Callback: func(context.Context, *OIDCCallbackArgs) (*OIDCToken, error) {
+				return &OIDCToken{
+					AccessToken:  "expiring",
+					ExpiresAt:    time.Now().Add(time.Minute),
+					RefreshToken: "refresh",
+				}, nil
+			},
+			RefreshCallback: func(_ context.Context, args *OIDCCallbackArgs) (*OIDCToken, error) {
+				refreshed = args.RefreshToken
+				return &OIDCToken{AccessToken: "refreshed", ExpiresAt: time.Now().Add(time.Hour)}, nil
+			},
+		}
+
+		conn := oidcConn(t, oidcDone)
+		require.NoError(t, authenticator.Auth(ctx, description.Server{}, conn))
+		require.Equal(t, "expiring", writtenJWT(t, conn))
+
+		conn = oidcConn(t, oidcDone)
+		require.NoError(t, authenticator.Auth(ctx, description.Server{}, conn))
+		require.Equal(t, "refreshed", writtenJWT(t, conn))
+		require.Equal(t, "refresh", refreshed)
+	})
+	t.Run("rejected token is replaced", func(t *testing.T) {
+		tokens := []string{"revoked", "fresh"}
+		authenticator := &OIDCAuthenticator{
+			Callback: func(context.Context, *OIDCCallbackArgs) (*OIDCToken, error) {
+				token := &OIDCToken{AccessToken: tokens[0]}
+				tokens = tokens[1:]
+				return token, nil
+			},
+		}
+
+		conn := oidcConn(t, oidcAuthFailed, oidcDone)
+		require.NoError(t, authenticator.Auth(ctx, description.Server{}, conn))
+		require.Equal(t, "revoked", writtenJWT(t, conn))
+		require.Equal(t, "fresh", writtenJWT(t, conn))
+		require.Empty(t, tokens)
+	})
+	t.Run("callback error", func(t *testing.T) {
+		authenticator := &OIDCAuthenticator{
+			Callback: func(context.Context, *OIDCCallbackArgs) (*OIDCToken, error) {
+				return nil, errors.New("identity provider unavailable")
+			},
+		}
+		err := authenticator.Auth(ctx, description.Server{}, oidcConn(t))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "identity provider unavailable")
+	})
+	t.Run("credential validation", func(t *testing.T) {
+		_, err := CreateAuthenticator(MongoDBOIDC, &Cred{})
+		require.Error(t, err)
+
+		callback := func(context.Context, *OIDCCallbackArgs) (*OIDCToken, error) { return nil, nil }
+		_, err = CreateAuthenticator(MongoDBOIDC, &Cred{Password: "pencil", OIDCCallback: callback})
+		require.Error(t, err)
+		_, err = CreateAuthenticator(MongoDBOIDC, &Cred{Source: "admin", OIDCCallback: callback})
+		require.Error(t, err)
+	})
+}
+
+func TestHandshakerReauthenticate(t *testing.T) {
+	var calls int
+	authenticator := &OIDCAuthenticator{
+		Callback: func(context.Context, *OIDCCallbackArgs) (*OIDCToken, error) {
+			calls++
+			return &OIDCToken{AccessToken: "token"}, nil
+		},
+	}
+	handshaker := Handshaker(nil, &HandshakeOptions{Authenticator: authenticator})
+	ah, ok := handshaker.(driver.AuthHandshaker)
+	require.True(t, ok, "expected the handshaker to reauthenticate connections")
+
+	conn := oidcConn(t, oidcDone)
+	require.NoError(t, ah.Reauthenticate(context.Background(), description.Server{}, conn))
+	require.Equal(t, "token", writtenJWT(t, conn))
+	require.Equal(t, 1, calls)
+}
@@ -0,0 +1,71 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package auth
+
+import (
+	"context"
+	"sync"
+)
+
+// CredentialProvider returns the mechanism and credential used to authenticate a connection.
+type CredentialProvider func(ctx context.Context) (mechanism string, cred *Cred, err error)
+
+// ProvidedCredentials authenticates connections with credentials that can change during the lifetime of a client,
+// such as passwords rotated by a secrets manager. The provider is called for every connection that authenticates.
+// The authenticator created for a credential is reused while the provider returns the same credential, so state it
+// caches, such as SCRAM keys, is shared by the connections.
+type ProvidedCredentials struct {
+	provider CredentialProvider
+
+	mu            sync.Mutex
+	mechanism     string
+	cred          *Cred
+	authenticator Authenticator
+}
+
+// NewProvidedCredentials creates a ProvidedCredentials that gets credentials from provider.
+func NewProvidedCredentials(provider CredentialProvider) *ProvidedCredentials {
+	return &ProvidedCredentials{provider: provider}
+}
+
+// get returns the current credential from the provider and the authenticator for it.
+func (pc *ProvidedCredentials) get(ctx context.Context) (string, *Cred, Authenticator, error) {
+	mechanism, cred, err := pc.provider(ctx)
+	if err != nil {
+		return "", nil, nil, newAuthError("credential provider error", err)
+	}
+	if cred == nil {
+		return "", nil, nil, newAuthError("credential provider returned no credential", nil)
+	}
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if pc.authenticator != nil && pc.mechanism == mechanism && sameCred(pc.cred, cred) {
+		return mechanism, pc.cred, pc.authenticator, nil
+	}
+	authenticator, err := CreateAuthenticator(mechanism, cred)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	pc.mechanism, pc.cred, pc.authenticator = mechanism, cred, authenticator
+	return mechanism, cred, authenticator, nil
+}
+
+// sameCred returns true if the credentials authenticate the same user in the same way.
+func sameCred(c1, c2 *Cred) bool {
+	if c1.Source != c2.Source || c1.Username != c2.Username || c1.Password != c2.Password ||
+		c1.PasswordSet != c2.PasswordSet || len(c1.Props) != len(c2.Props) {
+		return false
+	}
+	for k, v := range c1.Props {
+		if v2, ok := c2.Props[k]; !ok || v != v2 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	. "github.com/appveen/mongo-go-driver/x/mongo/driver/auth"
+)
+
+func TestProvidedCredentials(t *testing.T) {
+	// passwordProvider returns a provider that returns the passwords in turn, repeating the last one.
+	passwordProvider := func(mechanism string, calls *int, passwords ...string) CredentialProvider {
+		return func(context.Context) (string, *Cred, error) {
+			password := passwords[0]
+			if len(passwords) > 1 {
+				passwords = passwords[1:]
+			}
+			*calls++
+			return mechanism, &Cred{Source: "admin", Username: "user", Password: password, PasswordSet: true}, nil
+		}
+	}
+
+	t.Run("called for each connection", func(t *testing.T) {
+		var calls int
+		options := &HandshakeOptions{
+			Credentials: NewProvidedCredentials(passwordProvider(SCRAMSHA256, &calls, "pencil")),
+		}
+		for i := 0; i < 2; i++ {
+			s := newHandshakeServer(t, true)
+			commands, err := s.handshakeWithOptions(options)
+			require.NoError(t, err)
+			require.Equal(t, []string{"isMaster", "saslContinue"}, commands)
+		}
+		require.Equal(t, 2, calls)
+	})
+	t.Run("rotated password", func(t *testing.T) {
+		var calls int
+		options := &HandshakeOptions{
+			Credentials: NewProvidedCredentials(passwordProvider(SCRAMSHA256, &calls, "expired", "pencil")),
+		}
+		s := newHandshakeServer(t, true)
+		commands, err := s.handshakeWithOptions(options)
+		require.NoError(t, err)
+		require.Equal(t, []string{"isMaster", "saslContinue", "saslStart", "saslContinue"}, commands)
+		require.Equal(t, 2, calls)
+		require.True(t, s.conv.Valid())
+	})
+	t.Run("retried once", func(t *testing.T) {
+		var calls int
+		options := &HandshakeOptions{
+			Credentials: NewProvidedCredentials(passwordProvider(SCRAMSHA256, &calls, "expired", "wrong", "pencil")),
+		}
+		s := newHandshakeServer(t, false)
+		commands, err := s.handshakeWithOptions(options)
+		require.Error(t, err)
+		require.Equal(t, []string{"isMaster", "saslStart", "saslContinue", "saslStart", "saslContinue"}, commands)
+		require.Equal(t, 2, calls)
+	})
+	t.Run("not retried with the same credential", func(t *testing.T) {
+		var calls int
+		options := &HandshakeOptions{
+			Credentials: NewProvidedCredentials(passwordProvider(SCRAMSHA256, &calls, "wrong")),
+		}
+		s := newHandshakeServer(t, false)
+		commands, err := s.handshakeWithOptions(options)
+		require.Error(t, err)
+		require.Equal(t, []string{"isMaster", "saslStart", "saslContinue"}, commands)
+		require.Equal(t, 2, calls)
+	})
+	t.Run("default mechanism negotiation", func(t *testing.T) {
+		var calls int
+		options := &HandshakeOptions{
+			Credentials: NewProvidedCredentials(passwordProvider("", &calls, "pencil")),
+		}
+		s := newHandshakeServer(t, true)
+		_, err := s.handshakeWithOptions(options)
+		require.NoError(t, err)
+		require.Equal(t, "admin.user", s.isMaster.Lookup("saslSupportedMechs").StringValue())
+	})
+	t.Run("provider error", func(t *testing.T) {
+		options := &HandshakeOptions{
+			Credentials: NewProvidedCredentials(func(context.Context) (string, *Cred, error) {
+				return "", nil, errors.New("secrets manager unavailable")
+			}),
+		}
+		s := newHandshakeServer(t, true)
+		commands, err := s.handshakeWithOptions(options)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "secrets manager unavailable")
+		require.Empty(t, commands)
+	})
+}
@@ -28,66 +28,80 @@ type SaslClientCloser interface {
 	Close()
 }
 
-// ConductSaslConversation handles running a sasl conversation with MongoDB.
-func ConductSaslConversation(ctx context.Context, conn driver.Connection, db string, client SaslClient) error {
+// saslConversation runs a SASL conversation, whose first message may be sent with the connection handshake.
+type saslConversation struct {
+	client      SaslClient
+	source      string
+	mechanism   string
+	speculative bool
+}
 
-	if db == "" {
-		db = defaultAuthDB
-	}
+var _ SpeculativeConversation = (*saslConversation)(nil)
 
-	if closer, ok := client.(SaslClientCloser); ok {
-		defer closer.Close()
+func newSaslConversation(client SaslClient, source string, speculative bool) *saslConversation {
+	if source == "" {
+		source = defaultAuthDB
 	}
+	return &saslConversation{
+		client:      client,
+		source:      source,
+		speculative: speculative,
+	}
+}
 
-	mech, payload, err := client.Start()
+// FirstMessage returns the saslStart command. A speculative saslStart names the database to authenticate against,
+// because the handshake runs on the admin database.
+func (sc *saslConversation) FirstMessage() (bsoncore.Document, error) {
+	var payload []byte
+	var err error
+	sc.mechanism, payload, err = sc.client.Start()
 	if err != nil {
-		return newError(err, mech)
+		return nil, err
 	}
 
-	doc := bsoncore.BuildDocumentFromElements(nil,
+	elems := [][]byte{
 		bsoncore.AppendInt32Element(nil, "saslStart", 1),
-		bsoncore.AppendStringElement(nil, "mechanism", mech),
+		bsoncore.AppendStringElement(nil, "mechanism", sc.mechanism),
 		bsoncore.AppendBinaryElement(nil, "payload", 0x00, payload),
-	)
-	saslStartCmd := operation.NewCommand(doc).Database(db).Deployment(driver.SingleConnectionDeployment{conn})
-
-	type saslResponse struct {
-		ConversationID int    `bson:"conversationId"`
-		Code           int    `bson:"code"`
-		Done           bool   `bson:"done"`
-		Payload        []byte `bson:"payload"`
 	}
-
-	var saslResp saslResponse
-
-	err = saslStartCmd.Execute(ctx)
-	if err != nil {
-		return newError(err, mech)
+	if sc.speculative {
+		elems = append(elems, bsoncore.AppendStringElement(nil, "db", sc.source))
 	}
-	rdr := saslStartCmd.Result()
+	return bsoncore.BuildDocumentFromElements(nil, elems...), nil
+}
+
+type saslResponse struct {
+	ConversationID int    `bson:"conversationId"`
+	Code           int    `bson:"code"`
+	Done           bool   `bson:"done"`
+	Payload        []byte `bson:"payload"`
+}
 
-	err = bson.Unmarshal(rdr, &saslResp)
+// Finish continues the conversation from the server's reply to the saslStart command. It does not close the client.
+func (sc *saslConversation) Finish(ctx context.Context, conn driver.Connection, firstResponse bsoncore.Document) error {
+	var saslResp saslResponse
+	err := bson.Unmarshal(firstResponse, &saslResp)
 	if err != nil {
 		return newAuthError("unmarshall error", err)
 	}
 
 	cid := saslResp.ConversationID
-
+	var payload []byte
 	for {
 		if saslResp.Code != 0 {
-			return newError(err, mech)
+			return newError(err, sc.mechanism)
 		}
 
-		if saslResp.Done && client.Completed() {
+		if saslResp.Done && sc.client.Completed() {
 			return nil
 		}
 
-		payload, err = client.Next(saslResp.Payload)
+		payload, err = sc.client.Next(saslResp.Payload)
 		if err != nil {
-			return newError(err, mech)
+			return newError(err, sc.mechanism)
 		}
 
-		if saslResp.Done && client.Completed() {
+		if saslResp.Done && sc.client.Completed() {
 			return nil
 		}
 
@@ -96,13 +110,13 @@ func ConductSaslConversation(ctx context.Context, conn driver.Connection, db str
 			bsoncore.AppendInt32Element(nil, "conversationId", int32(cid)),
 			bsoncore.AppendBinaryElement(nil, "payload", 0x00, payload),
 		)
-		saslContinueCmd := operation.NewCommand(doc).Database(db).Deployment(driver.SingleConnectionDeployment{conn})
+		saslContinueCmd := operation.NewCommand(doc).Database(sc.source).Deployment(driver.SingleConnectionDeployment{conn})
 
 		err = saslContinueCmd.Execute(ctx)
 		if err != nil {
-			return newError(err, mech)
+			return newError(err, sc.mechanism)
 		}
-		rdr = saslContinueCmd.Result()
+		rdr := saslContinueCmd.Result()
 
 		err = bson.Unmarshal(rdr, &saslResp)
 		if err != nil {
@@ -110,3 +124,25 @@ func ConductSaslConversation(ctx context.Context, conn driver.Connection, db str
 		}
 	}
 }
+
+// ConductSaslConversation handles running a sasl conversation with MongoDB.
+func ConductSaslConversation(ctx context.Context, conn driver.Connection, db string, client SaslClient) error {
+	if closer, ok := client.(SaslClientCloser); ok {
+		defer closer.Close()
+	}
+
+	conversation := newSaslConversation(client, db, false)
+	saslStartDoc, err := conversation.FirstMessage()
+	if err != nil {
+		return newError(err, conversation.mechanism)
+	}
+	saslStartCmd := operation.NewCommand(saslStartDoc).
+		Database(conversation.source).
+		Deployment(driver.SingleConnectionDeployment{conn})
+
+	err = saslStartCmd.Execute(ctx)
+	if err != nil {
+		return newError(err, conversation.mechanism)
+	}
+	return conversation.Finish(ctx, conn, saslStartCmd.Result())
+}
@@ -15,9 +15,11 @@ package auth
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/xdg/scram"
 	"github.com/xdg/stringprep"
+	"github.com/appveen/mongo-go-driver/x/bsonx/bsoncore"
 	"github.com/appveen/mongo-go-driver/x/mongo/driver"
 	"github.com/appveen/mongo-go-driver/x/mongo/driver/description"
 )
@@ -30,16 +32,7 @@ const SCRAMSHA256 = "SCRAM-SHA-256"
 
 func newScramSHA1Authenticator(cred *Cred) (Authenticator, error) {
 	passdigest := mongoPasswordDigest(cred.Username, cred.Password)
-	client, err := scram.SHA1.NewClientUnprepped(cred.Username, passdigest, "")
-	if err != nil {
-		return nil, newAuthError("error initializing SCRAM-SHA-1 client", err)
-	}
-	client.WithMinIterations(4096)
-	return &ScramAuthenticator{
-		mechanism: SCRAMSHA1,
-		source:    cred.Source,
-		client:    client,
-	}, nil
+	return newScramAuthenticator(SCRAMSHA1, scram.SHA1, cred.Source, cred.Username, passdigest)
 }
 
 func newScramSHA256Authenticator(cred *Cred) (Authenticator, error) {
@@ -47,35 +40,119 @@ func newScramSHA256Authenticator(cred *Cred) (Authenticator, error) {
 	if err != nil {
 		return nil, newAuthError(fmt.Sprintf("error SASLprepping password '%s'", cred.Password), err)
 	}
-	client, err := scram.SHA256.NewClientUnprepped(cred.Username, passprep, "")
-	if err != nil {
-		return nil, newAuthError("error initializing SCRAM-SHA-256 client", err)
+	return newScramAuthenticator(SCRAMSHA256, scram.SHA256, cred.Source, cred.Username, passprep)
+}
+
+func newScramAuthenticator(mechanism string, hashGen scram.HashGeneratorFcn, source, username, password string) (Authenticator, error) {
+	a := &ScramAuthenticator{
+		mechanism: mechanism,
+		source:    source,
+		username:  username,
+		password:  password,
+		hashGen:   hashGen,
 	}
-	client.WithMinIterations(4096)
-	return &ScramAuthenticator{
-		mechanism: SCRAMSHA256,
-		source:    cred.Source,
-		client:    client,
-	}, nil
+	if _, err := a.getClient(); err != nil {
+		return nil, err
+	}
+	return a, nil
 }
 
 // ScramAuthenticator uses the SCRAM algorithm over SASL to authenticate a connection.
+//
+// Deriving the client and server keys from the password with PBKDF2 is expensive, so the SCRAM client caches them by
+// the salt and iteration count the server sends. The authenticator is shared by the connections of a pool, so the keys
+// are derived once per (password, salt, iteration count) rather than once per connection. The cached keys are
+// discarded when authentication fails, e.g. because the password or the user's salt changed.
 type ScramAuthenticator struct {
 	mechanism string
 	source    string
-	client    *scram.Client
+	username  string
+	password  string // prepared for the mechanism
+	hashGen   scram.HashGeneratorFcn
+
+	mu     sync.Mutex
+	client *scram.Client
 }
 
+var _ SpeculativeAuthenticator = (*ScramAuthenticator)(nil)
+
 // Auth authenticates the connection.
 func (a *ScramAuthenticator) Auth(ctx context.Context, _ description.Server, conn driver.Connection) error {
-	adapter := &scramSaslAdapter{conversation: a.client.NewConversation(), mechanism: a.mechanism}
-	err := ConductSaslConversation(ctx, conn, a.source, adapter)
+	client, err := a.getClient()
+	if err != nil {
+		return err
+	}
+	adapter := &scramSaslAdapter{conversation: client.NewConversation(), mechanism: a.mechanism}
+	err = ConductSaslConversation(ctx, conn, a.source, adapter)
 	if err != nil {
+		a.invalidate(client, err)
 		return newAuthError("sasl conversation error", err)
 	}
 	return nil
 }
 
+// CreateSpeculativeConversation creates a speculative conversation for SCRAM authentication.
+func (a *ScramAuthenticator) CreateSpeculativeConversation() (SpeculativeConversation, error) {
+	client, err := a.getClient()
+	if err != nil {
+		return nil, err
+	}
+	adapter := &scramSaslAdapter{conversation: client.NewConversation(), mechanism: a.mechanism}
+	return &scramConversation{
+		saslConversation: newSaslConversation(adapter, a.source, true),
+		authenticator:    a,
+		client:           client,
+	}, nil
+}
+
+// getClient returns the SCRAM client holding the cached keys, creating it if the keys were discarded.
+func (a *ScramAuthenticator) getClient() (*scram.Client, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.client != nil {
+		return a.client, nil
+	}
+	client, err := a.hashGen.NewClientUnprepped(a.username, a.password, "")
+	if err != nil {
+		return nil, newAuthError(fmt.Sprintf("error initializing %s client", a.mechanism), err)
+	}
+	client.WithMinIterations(4096)
+	a.client = client
+	return client, nil
+}
+
+// invalidate discards the keys cached by client if authenticating with it failed for a reason other than a network
+// error. Another connection may have replaced the client already.
+func (a *ScramAuthenticator) invalidate(client *scram.Client, err error) {
+	if de, ok := driverError(err); ok && de.NetworkError() {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.client == client {
+		a.client = nil
+	}
+}
+
+// scramConversation is a speculative SCRAM conversation, which discards the cached keys if it fails.
+type scramConversation struct {
+	*saslConversation
+	authenticator *ScramAuthenticator
+	client        *scram.Client
+}
+
+// Finish implements the SpeculativeConversation interface.
+func (sc *scramConversation) Finish(ctx context.Context, conn driver.Connection, firstResponse bsoncore.Document) error {
+	err := sc.saslConversation.Finish(ctx, conn, firstResponse)
+	if err != nil {
+		sc.authenticator.invalidate(sc.client, err)
+	}
+	return err
+}
+
 type scramSaslAdapter struct {
 	mechanism    string
 	conversation *scram.ClientConversation
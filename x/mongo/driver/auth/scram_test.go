@@ -0,0 +1,107 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/xdg/scram"
+	"github.com/appveen/mongo-go-driver/x/bsonx/bsoncore"
+	"github.com/appveen/mongo-go-driver/x/mongo/driver/description"
+	"github.com/appveen/mongo-go-driver/x/mongo/driver/drivertest"
+)
+
+// scramConn returns a connection that replies with the given documents, or fails to read with readErr if it is set.
+func scramConn(readErr error, replies ...bsoncore.Document) *drivertest.ChannelConn {
+	conn := &drivertest.ChannelConn{
+		Written:  make(chan []byte, len(replies)+1),
+		ReadResp: make(chan []byte, len(replies)),
+		ReadErr:  make(chan error, 1),
+	}
+	for _, reply := range replies {
+		conn.ReadResp <- drivertest.MakeReply(reply)
+	}
+	if readErr != nil {
+		conn.ReadErr <- readErr
+	}
+	return conn
+}
+
+func TestScramKeyCache(t *testing.T) {
+	cred := &Cred{Source: "admin", Username: "user", Password: "pencil", PasswordSet: true}
+	authFailed := bsoncore.BuildDocumentFromElements(nil,
+		bsoncore.AppendInt32Element(nil, "ok", 0),
+		bsoncore.AppendInt32Element(nil, "code", authenticationFailedCode),
+		bsoncore.AppendStringElement(nil, "errmsg", "Authentication failed."),
+	)
+	clientOf := func(t *testing.T, a Authenticator) *scram.Client {
+		client, err := a.(*ScramAuthenticator).getClient()
+		require.NoError(t, err)
+		return client
+	}
+
+	t.Run("client is shared", func(t *testing.T) {
+		a, err := newScramSHA256Authenticator(cred)
+		require.NoError(t, err)
+		require.True(t, clientOf(t, a) == clientOf(t, a), "expected the SCRAM client to be reused")
+
+		conversation, err := a.(*ScramAuthenticator).CreateSpeculativeConversation()
+		require.NoError(t, err)
+		require.True(t, conversation.(*scramConversation).client == clientOf(t, a))
+	})
+	t.Run("invalidated on authentication failure", func(t *testing.T) {
+		a, err := newScramSHA256Authenticator(cred)
+		require.NoError(t, err)
+		client := clientOf(t, a)
+
+		err = a.Auth(context.Background(), description.Server{}, scramConn(nil, authFailed))
+		require.Error(t, err)
+		require.False(t, clientOf(t, a) == client, "expected cached keys to be discarded")
+	})
+	t.Run("kept on network error", func(t *testing.T) {
+		a, err := newScramSHA1Authenticator(cred)
+		require.NoError(t, err)
+		client := clientOf(t, a)
+
+		err = a.Auth(context.Background(), description.Server{}, scramConn(errors.New("connection reset")))
+		require.Error(t, err)
+		require.True(t, clientOf(t, a) == client, "expected cached keys to be kept")
+	})
+	t.Run("speculative conversation failure", func(t *testing.T) {
+		a, err := newScramSHA256Authenticator(cred)
+		require.NoError(t, err)
+		client := clientOf(t, a)
+
+		conversation, err := a.(*ScramAuthenticator).CreateSpeculativeConversation()
+		require.NoError(t, err)
+		_, err = conversation.FirstMessage()
+		require.NoError(t, err)
+		// the server's first message is invalid, so the conversation fails before any command is run
+		err = conversation.Finish(context.Background(), scramConn(nil), bsoncore.BuildDocumentFromElements(nil,
+			bsoncore.AppendInt32Element(nil, "conversationId", 1),
+			bsoncore.AppendBooleanElement(nil, "done", false),
+			bsoncore.AppendBinaryElement(nil, "payload", 0x00, []byte("invalid")),
+		))
+		require.Error(t, err)
+		require.False(t, clientOf(t, a) == client, "expected cached keys to be discarded")
+	})
+	t.Run("default authenticator shares SCRAM authenticators", func(t *testing.T) {
+		a := &DefaultAuthenticator{Cred: cred}
+		sha256, err := a.scramAuthenticator(SCRAMSHA256)
+		require.NoError(t, err)
+		again, err := a.scramAuthenticator(SCRAMSHA256)
+		require.NoError(t, err)
+		require.True(t, sha256 == again)
+
+		sha1, err := a.scramAuthenticator(SCRAMSHA1)
+		require.NoError(t, err)
+		require.Equal(t, SCRAMSHA1, sha1.(*ScramAuthenticator).mechanism)
+	})
+}
@@ -0,0 +1,222 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package auth_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/xdg/scram"
+	"github.com/appveen/mongo-go-driver/x/bsonx/bsoncore"
+	"github.com/appveen/mongo-go-driver/x/mongo/driver/address"
+	. "github.com/appveen/mongo-go-driver/x/mongo/driver/auth"
+	"github.com/appveen/mongo-go-driver/x/mongo/driver/drivertest"
+	"github.com/appveen/mongo-go-driver/x/mongo/driver/wiremessage"
+)
+
+// writtenCommand returns the command of an OP_QUERY wire message.
+func writtenCommand(t *testing.T, wm []byte) bsoncore.Document {
+	t.Helper()
+
+	_, _, _, opcode, wm, ok := wiremessage.ReadHeader(wm)
+	require.True(t, ok)
+	require.Equal(t, wiremessage.OpQuery, opcode)
+	_, wm, _ = wiremessage.ReadQueryFlags(wm)
+	_, wm, _ = wiremessage.ReadQueryFullCollectionName(wm)
+	_, wm, _ = wiremessage.ReadQueryNumberToSkip(wm)
+	_, wm, _ = wiremessage.ReadQueryNumberToReturn(wm)
+	cmd, _, ok := wiremessage.ReadQueryQuery(wm)
+	require.True(t, ok)
+	return cmd
+}
+
+// handshakeServer is a server stand-in that answers the handshake and SCRAM-SHA-256 or MONGODB-X509 authentication.
+type handshakeServer struct {
+	t           *testing.T
+	conn        *drivertest.ChannelConn
+	speculative bool // whether the server supports speculative authentication
+	scram       *scram.Server
+
+	commands []string
+	isMaster bsoncore.Document // the last isMaster command
+	conv     *scram.ServerConversation
+}
+
+func newHandshakeServer(t *testing.T, speculative bool) *handshakeServer {
+	client, err := scram.SHA256.NewClient("user", "pencil", "")
+	require.NoError(t, err)
+	creds := client.GetStoredCredentials(scram.KeyFactors{Salt: "saltsaltsalt", Iters: 4096})
+	server, err := scram.SHA256.NewServer(func(string) (scram.StoredCredentials, error) { return creds, nil })
+	require.NoError(t, err)
+
+	return &handshakeServer{
+		t: t,
+		conn: &drivertest.ChannelConn{
+			Written:  make(chan []byte, 10),
+			ReadResp: make(chan []byte, 10),
+		},
+		speculative: speculative,
+		scram:       server,
+	}
+}
+
+// serve answers the commands written to the connection until it is closed.
+func (s *handshakeServer) serve(done chan<- struct{}) {
+	defer close(done)
+
+	for wm := range s.conn.Written {
+		cmd := writtenCommand(s.t, wm)
+		elems, err := cmd.Elements()
+		require.NoError(s.t, err)
+		name := elems[0].Key()
+		s.commands = append(s.commands, name)
+
+		var reply [][]byte
+		switch name {
+		case "isMaster":
+			s.isMaster = cmd
+			reply = append(reply,
+				bsoncore.AppendBooleanElement(nil, "ismaster", true),
+				bsoncore.AppendInt32Element(nil, "maxWireVersion", 9),
+			)
+			if spec, ok := cmd.Lookup("speculativeAuthenticate").DocumentOK(); ok && s.speculative {
+				if res, err := s.authenticate(spec); err == nil {
+					reply = append(reply, bsoncore.AppendDocumentElement(nil, "speculativeAuthenticate", res))
+				}
+			}
+		case "saslStart", "saslContinue", "authenticate":
+			res, err := s.authenticate(cmd)
+			if err != nil {
+				s.conn.ReadResp <- drivertest.MakeReply(bsoncore.BuildDocumentFromElements(nil,
+					bsoncore.AppendInt32Element(nil, "ok", 0),
+					bsoncore.AppendInt32Element(nil, "code", 18),
+					bsoncore.AppendStringElement(nil, "errmsg", "Authentication failed."),
+				))
+				continue
+			}
+			elems, err := res.Elements()
+			require.NoError(s.t, err)
+			for _, elem := range elems {
+				reply = append(reply, elem)
+			}
+		}
+		reply = append(reply, bsoncore.AppendInt32Element(nil, "ok", 1))
+		s.conn.ReadResp <- drivertest.MakeReply(bsoncore.BuildDocumentFromElements(nil, reply...))
+	}
+}
+
+// authenticate runs an authentication command and returns the reply without the ok field, or an error if the
+// credential is rejected.
+func (s *handshakeServer) authenticate(cmd bsoncore.Document) (bsoncore.Document, error) {
+	elems, err := cmd.Elements()
+	require.NoError(s.t, err)
+
+	switch elems[0].Key() {
+	case "authenticate":
+		return bsoncore.BuildDocumentFromElements(nil,
+			bsoncore.AppendStringElement(nil, "dbname", "$external"),
+			bsoncore.AppendStringElement(nil, "user", "CN=client"),
+		), nil
+	case "saslStart":
+		require.Equal(s.t, SCRAMSHA256, cmd.Lookup("mechanism").StringValue())
+		s.conv = s.scram.NewConversation()
+	}
+
+	_, payload := cmd.Lookup("payload").Binary()
+	step, err := s.conv.Step(string(payload))
+	if err != nil {
+		return nil, err
+	}
+	return bsoncore.BuildDocumentFromElements(nil,
+		bsoncore.AppendInt32Element(nil, "conversationId", 1),
+		bsoncore.AppendBooleanElement(nil, "done", s.conv.Done()),
+		bsoncore.AppendBinaryElement(nil, "payload", 0x00, []byte(step)),
+	), nil
+}
+
+// handshake runs the handshake with the authenticator and returns the commands the server received.
+func (s *handshakeServer) handshake(authenticator Authenticator) ([]string, error) {
+	return s.handshakeWithOptions(&HandshakeOptions{Authenticator: authenticator})
+}
+
+// handshakeWithOptions runs the handshake with the options and returns the commands the server received.
+func (s *handshakeServer) handshakeWithOptions(options *HandshakeOptions) ([]string, error) {
+	done := make(chan struct{})
+	go s.serve(done)
+
+	handshaker := Handshaker(nil, options)
+	_, err := handshaker.Handshake(context.Background(), address.Address("localhost:27017"), s.conn)
+	close(s.conn.Written)
+	<-done
+	return s.commands, err
+}
+
+func TestSpeculativeAuthentication(t *testing.T) {
+	cred := &Cred{Source: "admin", Username: "user", Password: "pencil", PasswordSet: true}
+
+	t.Run("SCRAM-SHA-256", func(t *testing.T) {
+		authenticator, err := CreateAuthenticator(SCRAMSHA256, cred)
+		require.NoError(t, err)
+
+		s := newHandshakeServer(t, true)
+		commands, err := s.handshake(authenticator)
+		require.NoError(t, err)
+		require.Equal(t, []string{"isMaster", "saslContinue"}, commands)
+		require.True(t, s.conv.Valid())
+	})
+	t.Run("default mechanism", func(t *testing.T) {
+		authenticator, err := CreateAuthenticator("", cred)
+		require.NoError(t, err)
+
+		s := newHandshakeServer(t, true)
+		commands, err := s.handshake(authenticator)
+		require.NoError(t, err)
+		require.Equal(t, []string{"isMaster", "saslContinue"}, commands)
+		require.True(t, s.conv.Valid())
+	})
+	t.Run("fallback without server support", func(t *testing.T) {
+		authenticator, err := CreateAuthenticator(SCRAMSHA256, cred)
+		require.NoError(t, err)
+
+		s := newHandshakeServer(t, false)
+		commands, err := s.handshake(authenticator)
+		require.NoError(t, err)
+		require.Equal(t, []string{"isMaster", "saslStart", "saslContinue"}, commands)
+		require.True(t, s.conv.Valid())
+	})
+	t.Run("MONGODB-X509", func(t *testing.T) {
+		authenticator, err := CreateAuthenticator(MongoDBX509, &Cred{Source: "$external"})
+		require.NoError(t, err)
+
+		s := newHandshakeServer(t, true)
+		commands, err := s.handshake(authenticator)
+		require.NoError(t, err)
+		require.Equal(t, []string{"isMaster"}, commands)
+	})
+	t.Run("MONGODB-X509 fallback", func(t *testing.T) {
+		authenticator, err := CreateAuthenticator(MongoDBX509, &Cred{Source: "$external"})
+		require.NoError(t, err)
+
+		s := newHandshakeServer(t, false)
+		commands, err := s.handshake(authenticator)
+		require.NoError(t, err)
+		require.Equal(t, []string{"isMaster", "authenticate"}, commands)
+	})
+	t.Run("speculative message", func(t *testing.T) {
+		authenticator, err := CreateAuthenticator(SCRAMSHA1, cred)
+		require.NoError(t, err)
+
+		conversation, err := authenticator.(SpeculativeAuthenticator).CreateSpeculativeConversation()
+		require.NoError(t, err)
+		msg, err := conversation.FirstMessage()
+		require.NoError(t, err)
+		require.Equal(t, int32(1), msg.Lookup("saslStart").Int32())
+		require.Equal(t, SCRAMSHA1, msg.Lookup("mechanism").StringValue())
+		require.Equal(t, "admin", msg.Lookup("db").StringValue())
+	})
+}
@@ -27,6 +27,39 @@ type MongoDBX509Authenticator struct {
 	User string
 }
 
+var _ SpeculativeAuthenticator = (*MongoDBX509Authenticator)(nil)
+
+// x509Conversation is a speculative MONGODB-X509 conversation, which completes with the handshake.
+type x509Conversation struct {
+	user string
+}
+
+var _ SpeculativeConversation = (*x509Conversation)(nil)
+
+// FirstMessage returns the authenticate command. Servers that support speculative authentication take the user name
+// from the client certificate, so it is only sent if it was set explicitly.
+func (c *x509Conversation) FirstMessage() (bsoncore.Document, error) {
+	elems := [][]byte{
+		bsoncore.AppendInt32Element(nil, "authenticate", 1),
+		bsoncore.AppendStringElement(nil, "mechanism", MongoDBX509),
+		bsoncore.AppendStringElement(nil, "db", "$external"),
+	}
+	if c.user != "" {
+		elems = append(elems, bsoncore.AppendStringElement(nil, "user", c.user))
+	}
+	return bsoncore.BuildDocumentFromElements(nil, elems...), nil
+}
+
+// Finish implements the SpeculativeConversation interface. The server's reply means the connection is authenticated.
+func (c *x509Conversation) Finish(context.Context, driver.Connection, bsoncore.Document) error {
+	return nil
+}
+
+// CreateSpeculativeConversation creates a speculative conversation for MONGODB-X509 authentication.
+func (a *MongoDBX509Authenticator) CreateSpeculativeConversation() (SpeculativeConversation, error) {
+	return &x509Conversation{user: a.User}, nil
+}
+
 // Auth implements the Authenticator interface.
 func (a *MongoDBX509Authenticator) Auth(ctx context.Context, desc description.Server, conn driver.Connection) error {
 	requestDoc := bsoncore.AppendInt32Element(nil, "authenticate", 1)
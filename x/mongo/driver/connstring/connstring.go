@@ -279,7 +279,7 @@ func (p *parser) setDefaultAuthParams(dbName string) error {
 			p.AuthMechanismProperties["SERVICE_NAME"] = "mongodb"
 		}
 		fallthrough
-	case "mongodb-x509":
+	case "mongodb-x509", "mongodb-aws", "mongodb-oidc":
 		if p.AuthSource == "" {
 			p.AuthSource = "$external"
 		} else if p.AuthSource != "$external" {
@@ -328,6 +328,28 @@ func (p *parser) validateAuth() error {
 		if p.AuthMechanismProperties != nil {
 			return fmt.Errorf("MONGO-X509 cannot have mechanism properties")
 		}
+	case "mongodb-aws":
+		if p.Username != "" && p.Password == "" {
+			return fmt.Errorf("password required for MONGODB-AWS if a username is specified")
+		}
+		if p.Username == "" && p.Password != "" {
+			return fmt.Errorf("username required for MONGODB-AWS if a password is specified")
+		}
+		for k := range p.AuthMechanismProperties {
+			if k != "AWS_SESSION_TOKEN" {
+				return fmt.Errorf("invalid auth property for MONGODB-AWS")
+			}
+		}
+		if p.AuthMechanismProperties["AWS_SESSION_TOKEN"] != "" && p.Username == "" {
+			return fmt.Errorf("AWS_SESSION_TOKEN requires a username and password for MONGODB-AWS")
+		}
+	case "mongodb-oidc":
+		if p.Password != "" {
+			return fmt.Errorf("password cannot be specified for MONGODB-OIDC")
+		}
+		if p.AuthMechanismProperties != nil {
+			return fmt.Errorf("MONGODB-OIDC cannot have mechanism properties")
+		}
 	case "gssapi":
 		if p.Username == "" {
 			return fmt.Errorf("username required for GSSAPI")
@@ -8,11 +8,13 @@ package driver
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/tls"
 	"fmt"
 	"io"
 	"time"
 
+	"github.com/appveen/mongo-go-driver/event"
 	"github.com/appveen/mongo-go-driver/x/bsonx/bsoncore"
 	"github.com/appveen/mongo-go-driver/x/mongo/driver/mongocrypt"
 	"github.com/appveen/mongo-go-driver/x/mongo/driver/mongocrypt/options"
@@ -40,6 +42,21 @@ type CryptOptions struct {
 	KmsProviders         map[string]map[string]interface{}
 	SchemaMap            map[string]bsoncore.Document
 	BypassAutoEncryption bool
+
+	// CustomKmsProviders are KMS providers implemented in Go, by provider name. The names "aws" and "local" are
+	// reserved for the KMS providers of libmongocrypt.
+	CustomKmsProviders map[string]KmsProvider
+	// KmsEndpoints overrides the "host" or "host:port" of the KMS of a provider.
+	KmsEndpoints map[string]string
+	// KmsTLSConfig overrides the TLS configuration used to connect to the KMS of a provider.
+	KmsTLSConfig map[string]*tls.Config
+	// KeyCacheTTL enables caching the data keys retrieved from the key vault for the given duration. AWS data keys are
+	// cached decrypted with AWS KMS and rewrapped with a local master key.
+	KeyCacheTTL time.Duration
+	// KeyCacheMaxSize limits the number of cached data keys. There is no limit if it is 0.
+	KeyCacheMaxSize int
+	// Monitor receives data key cache and KMS events.
+	Monitor *event.EncryptionMonitor
 }
 
 // Crypt consumes the libmongocrypt.MongoCrypt type to iterate the mongocrypt state machine and perform encryption
@@ -50,6 +67,14 @@ type Crypt struct {
 	keyFn      KeyRetrieverFn
 	markFn     MarkCommandFn
 
+	kmsProviders map[string]KmsProvider
+	localKey     []byte // the local master key that data keys of kmsProviders are handed to libmongocrypt with
+	ownLocalKey  bool   // whether localKey was generated, in which case it must never wrap a data key that is stored
+	kmsEndpoints map[string]string
+	kmsTLSConfig map[string]*tls.Config
+	keyCache     *keyCache
+	monitor      *event.EncryptionMonitor
+
 	BypassAutoEncryption bool
 }
 
@@ -59,9 +84,43 @@ func NewCrypt(opts *CryptOptions) (*Crypt, error) {
 		collInfoFn:           opts.CollInfoFn,
 		keyFn:                opts.KeyFn,
 		markFn:               opts.MarkFn,
+		kmsProviders:         opts.CustomKmsProviders,
+		kmsEndpoints:         opts.KmsEndpoints,
+		kmsTLSConfig:         opts.KmsTLSConfig,
+		monitor:              opts.Monitor,
 		BypassAutoEncryption: opts.BypassAutoEncryption,
 	}
-	mc, err := mongocrypt.NewMongoCrypt(createMongoCryptOptions(opts))
+	if opts.KeyCacheTTL > 0 {
+		c.keyCache = newKeyCache(opts.KeyCacheTTL, opts.KeyCacheMaxSize)
+	}
+
+	for name := range c.kmsProviders {
+		if name == "aws" || name == "local" {
+			return nil, fmt.Errorf("KMS provider name %q is reserved", name)
+		}
+	}
+
+	kmsProviders := opts.KmsProviders
+	if len(c.kmsProviders) > 0 || (c.keyCache != nil && opts.KmsProviders["aws"] != nil) {
+		// data keys of custom KMS providers, and cached AWS data keys, are handed to libmongocrypt wrapped with the
+		// local master key, which is generated if no local KMS provider is configured
+		if key, ok := opts.KmsProviders["local"]["key"].([]byte); ok {
+			c.localKey = key
+		} else {
+			c.localKey = make([]byte, localKeyLen)
+			c.ownLocalKey = true
+			if _, err := io.ReadFull(rand.Reader, c.localKey); err != nil {
+				return nil, err
+			}
+			kmsProviders = make(map[string]map[string]interface{}, len(opts.KmsProviders)+1)
+			for name, providerOpts := range opts.KmsProviders {
+				kmsProviders[name] = providerOpts
+			}
+			kmsProviders["local"] = map[string]interface{}{"key": c.localKey}
+		}
+	}
+
+	mc, err := mongocrypt.NewMongoCrypt(createMongoCryptOptions(kmsProviders, opts.SchemaMap))
 	if err != nil {
 		return nil, err
 	}
@@ -98,6 +157,13 @@ func (c *Crypt) Decrypt(ctx context.Context, cmdResponse bsoncore.Document) (bso
 
 // CreateDataKey creates a data key using the given KMS provider and options.
 func (c *Crypt) CreateDataKey(ctx context.Context, kmsProvider string, opts *options.DataKeyOptions) (bsoncore.Document, error) {
+	if kms, ok := c.customKms(kmsProvider); ok {
+		return c.createCustomDataKey(ctx, kmsProvider, kms, opts)
+	}
+	if err := c.checkKmsProvider(kmsProvider); err != nil {
+		return nil, err
+	}
+
 	cryptCtx, err := c.mongoCrypt.CreateDataKeyContext(kmsProvider, opts)
 	if err != nil {
 		return nil, err
@@ -148,12 +214,93 @@ func (c *Crypt) DecryptExplicit(ctx context.Context, subtype byte, data []byte)
 	return res.Lookup("v"), nil
 }
 
+// RewrapManyDataKey re-encrypts the data keys matching filter with the master key given in opts and returns the
+// updated key documents. The data keys are retrieved from the key vault, but the key vault is not updated.
+func (c *Crypt) RewrapManyDataKey(ctx context.Context, filter bsoncore.Document,
+	opts *options.RewrapManyDataKeyOptions) ([]bsoncore.Document, error) {
+
+	// data keys are rewrapped for custom KMS providers by rewrapping them with the local master key first
+	var kms KmsProvider
+	var masterKey bsoncore.Document
+	if opts.KmsProvider != nil {
+		var ok bool
+		if kms, ok = c.customKms(*opts.KmsProvider); ok {
+			var err error
+			if masterKey, err = customMasterKey(*opts.KmsProvider, opts.MasterKey); err != nil {
+				return nil, err
+			}
+			opts = options.RewrapManyDataKey().SetKmsProvider("local")
+		} else if err := c.checkKmsProvider(*opts.KmsProvider); err != nil {
+			return nil, err
+		}
+	}
+
+	cryptCtx, err := c.mongoCrypt.CreateRewrapManyDataKeyContext(filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cryptCtx.Close()
+
+	res, err := c.runStateMachine(ctx, cryptCtx, "", c.fetchStoredKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	arr, ok := res.Lookup("v").ArrayOK()
+	if !ok {
+		// no data key matched the filter
+		return nil, nil
+	}
+	vals, err := arr.Values()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]bsoncore.Document, 0, len(vals))
+	for _, val := range vals {
+		key, ok := val.DocumentOK()
+		if !ok {
+			return nil, fmt.Errorf("rewrapped data key is a %v, not a document", val.Type)
+		}
+		if kms != nil {
+			if key, err = c.rewrapCustomKey(ctx, key, kms, masterKey); err != nil {
+				return nil, err
+			}
+		}
+		keys = append(keys, key)
+	}
+
+	if opts.KmsProvider == nil && len(c.kmsProviders) > 0 {
+		// data keys of custom KMS providers were rewrapped with the local master key they were handed to
+		// libmongocrypt with, so they are rewrapped with their own master key again
+		if err = c.restoreCustomKeys(ctx, keys); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// checkKmsProvider returns an error if the KMS provider is the local one that was generated for custom KMS providers,
+// since nothing wrapped with it can be decrypted once the process exits.
+func (c *Crypt) checkKmsProvider(provider string) error {
+	if provider == "local" && c.ownLocalKey {
+		return fmt.Errorf("KMS provider %q is not configured", provider)
+	}
+	return nil
+}
+
 // Close cleans up any resources associated with the Crypt instance.
 func (c *Crypt) Close() {
 	c.mongoCrypt.Close()
 }
 
 func (c *Crypt) executeStateMachine(ctx context.Context, cryptCtx *mongocrypt.Context, db string) (bsoncore.Document, error) {
+	return c.runStateMachine(ctx, cryptCtx, db, c.fetchKeys)
+}
+
+// runStateMachine iterates the state machine of cryptCtx, handing it the data keys returned by fetch.
+func (c *Crypt) runStateMachine(ctx context.Context, cryptCtx *mongocrypt.Context, db string,
+	fetch KeyRetrieverFn) (bsoncore.Document, error) {
+
 	var err error
 	for {
 		state := cryptCtx.State()
@@ -163,7 +310,7 @@ func (c *Crypt) executeStateMachine(ctx context.Context, cryptCtx *mongocrypt.Co
 		case mongocrypt.NeedMongoMarkings:
 			err = c.markCommand(ctx, cryptCtx, db)
 		case mongocrypt.NeedMongoKeys:
-			err = c.retrieveKeys(ctx, cryptCtx)
+			err = c.retrieveKeys(ctx, cryptCtx, fetch)
 		case mongocrypt.NeedKms:
 			err = c.decryptKeys(ctx, cryptCtx)
 		case mongocrypt.Ready:
@@ -213,13 +360,13 @@ func (c *Crypt) markCommand(ctx context.Context, cryptCtx *mongocrypt.Context, d
 	return cryptCtx.CompleteOperation()
 }
 
-func (c *Crypt) retrieveKeys(ctx context.Context, cryptCtx *mongocrypt.Context) error {
+func (c *Crypt) retrieveKeys(ctx context.Context, cryptCtx *mongocrypt.Context, fetch KeyRetrieverFn) error {
 	op, err := cryptCtx.NextOperation()
 	if err != nil {
 		return err
 	}
 
-	keys, err := c.keyFn(ctx, op)
+	keys, err := fetch(ctx, op)
 	if err != nil {
 		return err
 	}
@@ -248,7 +395,7 @@ func (c *Crypt) decryptKeys(ctx context.Context, cryptCtx *mongocrypt.Context) e
 	return cryptCtx.FinishKmsContexts()
 }
 
-func (c *Crypt) decryptKey(ctx context.Context, kmsCtx *mongocrypt.KmsContext) error {
+func (c *Crypt) decryptKey(ctx context.Context, kmsCtx *mongocrypt.KmsContext) (err error) {
 	host, err := kmsCtx.HostName()
 	if err != nil {
 		return err
@@ -258,8 +405,11 @@ func (c *Crypt) decryptKey(ctx context.Context, kmsCtx *mongocrypt.KmsContext) e
 		return err
 	}
 
-	addr := fmt.Sprintf("%s:%d", host, defaultKmsPort)
-	conn, err := tls.Dial("tcp", addr, &tls.Config{})
+	// libmongocrypt only creates KMS requests for AWS
+	defer func(start time.Time) {
+		c.kmsRequestEvent("aws", start, err)
+	}(time.Now())
+	conn, err := c.dialKms("aws", host)
 	if err != nil {
 		return err
 	}
@@ -292,10 +442,12 @@ func (c *Crypt) decryptKey(ctx context.Context, kmsCtx *mongocrypt.KmsContext) e
 	}
 }
 
-func createMongoCryptOptions(opts *CryptOptions) *options.MongoCryptOptions {
-	mcOpts := options.MongoCrypt().SetLocalSchemaMap(opts.SchemaMap)
+func createMongoCryptOptions(kmsProviders map[string]map[string]interface{},
+	schemaMap map[string]bsoncore.Document) *options.MongoCryptOptions {
+
+	mcOpts := options.MongoCrypt().SetLocalSchemaMap(schemaMap)
 	// KMS providers options
-	for provider, providerOpts := range opts.KmsProviders {
+	for provider, providerOpts := range kmsProviders {
 		switch provider {
 		case "aws":
 			awsOpts := options.AwsKmsProvider()
@@ -54,6 +54,19 @@ type Connection interface {
 	Address() address.Address
 }
 
+// Reauthenticator is a Connection that can authenticate again, which the server requires once the credentials the
+// connection authenticated with expire.
+type Reauthenticator interface {
+	Reauthenticate(context.Context) error
+}
+
+// AuthHandshaker is a Handshaker that authenticates connections. Reauthenticate authenticates an established
+// connection to a server with the given description again.
+type AuthHandshaker interface {
+	Handshaker
+	Reauthenticate(context.Context, description.Server, Connection) error
+}
+
 // LocalAddresser is a type that is able to supply its local address
 type LocalAddresser interface {
 	LocalAddress() address.Address
@@ -281,6 +281,12 @@ func (e Error) NamespaceNotFound() bool {
 	return e.Code == 26 || e.Message == "ns not found"
 }
 
+// ReauthenticationRequired returns true if this error is a ReauthenticationRequired error, which the server returns
+// when the credentials a connection authenticated with, such as an OIDC access token, have expired.
+func (e Error) ReauthenticationRequired() bool {
+	return e.Code == 391
+}
+
 // helper method to extract an error from a reader if there is one; first returned item is the
 // error if it exists, the second holds parsing errors
 func extractError(rdr bsoncore.Document) error {
@@ -0,0 +1,317 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package driver
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/appveen/mongo-go-driver/bson/bsontype"
+	"github.com/appveen/mongo-go-driver/event"
+	"github.com/appveen/mongo-go-driver/x/bsonx/bsoncore"
+)
+
+// keyCache caches the data key documents handed to libmongocrypt by _id and key alt name, so libmongocrypt cache
+// misses do not query the key vault collection. The data keys of AWS and of custom KMS providers are cached unwrapped
+// and rewrapped with the local master key, which libmongocrypt decrypts without a KMS round trip.
+type keyCache struct {
+	ttl     time.Duration
+	maxSize int // no limit if 0
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element // by the BSON value of the _id
+	altNames map[string]*list.Element
+	lru      *list.List // of *keyCacheEntry, most recently used first
+	now      func() time.Time
+}
+
+type keyCacheEntry struct {
+	id       string
+	altNames []string
+	doc      bsoncore.Document
+	expires  time.Time
+}
+
+func newKeyCache(ttl time.Duration, maxSize int) *keyCache {
+	return &keyCache{
+		ttl:      ttl,
+		maxSize:  maxSize,
+		entries:  make(map[string]*list.Element),
+		altNames: make(map[string]*list.Element),
+		lru:      list.New(),
+		now:      time.Now,
+	}
+}
+
+// get returns the unexpired data key with the given _id.
+func (kc *keyCache) get(id bsoncore.Value) (bsoncore.Document, bool) {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+
+	return kc.use(kc.entries[string(id.Data)])
+}
+
+// getByAltName returns the unexpired data key with the given key alt name.
+func (kc *keyCache) getByAltName(name string) (bsoncore.Document, bool) {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+
+	return kc.use(kc.altNames[name])
+}
+
+func (kc *keyCache) use(elem *list.Element) (bsoncore.Document, bool) {
+	if elem == nil {
+		return nil, false
+	}
+	entry := elem.Value.(*keyCacheEntry)
+	if !kc.now().Before(entry.expires) {
+		kc.remove(elem)
+		return nil, false
+	}
+	kc.lru.MoveToFront(elem)
+	return entry.doc, true
+}
+
+// add caches a data key document, evicting the least recently used data key if the cache is full.
+func (kc *keyCache) add(doc bsoncore.Document) {
+	id, err := doc.LookupErr("_id")
+	if err != nil {
+		return
+	}
+	entry := &keyCacheEntry{id: string(id.Data), doc: doc, expires: kc.now().Add(kc.ttl)}
+	if arr, ok := doc.Lookup("keyAltNames").ArrayOK(); ok {
+		vals, _ := arr.Values()
+		for _, val := range vals {
+			if name, ok := val.StringValueOK(); ok {
+				entry.altNames = append(entry.altNames, name)
+			}
+		}
+	}
+
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+
+	if elem, ok := kc.entries[entry.id]; ok {
+		kc.remove(elem)
+	}
+	elem := kc.lru.PushFront(entry)
+	kc.entries[entry.id] = elem
+	for _, name := range entry.altNames {
+		if old, ok := kc.altNames[name]; ok {
+			// the key alt name moved to another data key
+			kc.remove(old)
+		}
+		kc.altNames[name] = elem
+	}
+
+	for kc.maxSize > 0 && kc.lru.Len() > kc.maxSize {
+		kc.remove(kc.lru.Back())
+	}
+}
+
+// invalidate removes the data key with the given _id.
+func (kc *keyCache) invalidate(id bsoncore.Value) {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+
+	if elem, ok := kc.entries[string(id.Data)]; ok {
+		kc.remove(elem)
+	}
+}
+
+func (kc *keyCache) remove(elem *list.Element) {
+	entry := kc.lru.Remove(elem).(*keyCacheEntry)
+	delete(kc.entries, entry.id)
+	for _, name := range entry.altNames {
+		if kc.altNames[name] == elem {
+			delete(kc.altNames, name)
+		}
+	}
+}
+
+// parseKeyFilter returns the _ids and key alt names requested by a key vault filter built by libmongocrypt, which has
+// the form {$or: [{_id: {$in: [...]}}, {keyAltNames: {$in: [...]}}]}. It returns false for other filters.
+func parseKeyFilter(filter bsoncore.Document) ([]bsoncore.Value, []string, bool) {
+	or, ok := filter.Lookup("$or").ArrayOK()
+	if !ok {
+		return nil, nil, false
+	}
+	clauses, err := or.Values()
+	if err != nil {
+		return nil, nil, false
+	}
+
+	var ids []bsoncore.Value
+	var names []string
+	for _, clause := range clauses {
+		doc, ok := clause.DocumentOK()
+		if !ok {
+			return nil, nil, false
+		}
+		elems, err := doc.Elements()
+		if err != nil || len(elems) != 1 {
+			return nil, nil, false
+		}
+		cond, ok := elems[0].Value().DocumentOK()
+		if !ok {
+			return nil, nil, false
+		}
+		in, ok := cond.Lookup("$in").ArrayOK()
+		if !ok {
+			return nil, nil, false
+		}
+		vals, err := in.Values()
+		if err != nil {
+			return nil, nil, false
+		}
+
+		switch elems[0].Key() {
+		case "_id":
+			ids = append(ids, vals...)
+		case "keyAltNames":
+			for _, val := range vals {
+				name, ok := val.StringValueOK()
+				if !ok {
+					return nil, nil, false
+				}
+				names = append(names, name)
+			}
+		default:
+			return nil, nil, false
+		}
+	}
+	return ids, names, true
+}
+
+// cachedKeys returns the data keys requested by libmongocrypt from the key cache. It returns false if any of them is
+// not cached, or if the filter was not built by libmongocrypt to fetch data keys by _id and key alt name.
+func (c *Crypt) cachedKeys(filter bsoncore.Document) ([]bsoncore.Document, bool) {
+	ids, names, ok := parseKeyFilter(filter)
+	if !ok {
+		return nil, false
+	}
+
+	var keys []bsoncore.Document
+	seen := make(map[string]bool)
+	found := true
+	for _, id := range ids {
+		key, ok := c.keyCache.get(id)
+		c.keyCacheEvent(key, id.Data, "")
+		if !ok {
+			found = false
+			continue
+		}
+		if keyID := string(key.Lookup("_id").Data); !seen[keyID] {
+			seen[keyID] = true
+			keys = append(keys, key)
+		}
+	}
+	for _, name := range names {
+		key, ok := c.keyCache.getByAltName(name)
+		c.keyCacheEvent(key, nil, name)
+		if !ok {
+			found = false
+			continue
+		}
+		if keyID := string(key.Lookup("_id").Data); !seen[keyID] {
+			seen[keyID] = true
+			keys = append(keys, key)
+		}
+	}
+
+	if !found {
+		return nil, false
+	}
+	return keys, true
+}
+
+// keyCacheEvent publishes a data key cache hit for a cached data key, or a miss if it is nil, for a data key ID, which
+// is the BSON value of the _id, or key alt name.
+func (c *Crypt) keyCacheEvent(key bsoncore.Document, id []byte, name string) {
+	if c.monitor == nil || c.monitor.Event == nil {
+		return
+	}
+
+	evt := &event.EncryptionEvent{Type: event.KeyCacheMiss, KeyAltName: name}
+	if key != nil {
+		evt.Type = event.KeyCacheHit
+		// the provider libmongocrypt decrypts the data key with, which is "local" for AWS and custom KMS providers
+		evt.Provider, _ = key.Lookup("masterKey", "provider").StringValueOK()
+	}
+	if id != nil {
+		// the event holds the data of the binary _id
+		if _, data, ok := (bsoncore.Value{Type: bsontype.Binary, Data: id}).BinaryOK(); ok {
+			evt.KeyID = data
+		}
+	}
+	c.monitor.Event(evt)
+}
+
+// kmsRequestEvent publishes a KMS round trip that started at start.
+func (c *Crypt) kmsRequestEvent(provider string, start time.Time, err error) {
+	if c.monitor == nil || c.monitor.Event == nil {
+		return
+	}
+
+	evt := &event.EncryptionEvent{Type: event.KmsRequest, Provider: provider, Duration: time.Since(start)}
+	if err != nil {
+		evt.Failure = err.Error()
+	}
+	c.monitor.Event(evt)
+}
+
+// InvalidateKey removes the data key with the given _id from the key cache, so it is retrieved from the key vault the
+// next time libmongocrypt needs it. It must be called when a data key is changed or deleted in the key vault.
+func (c *Crypt) InvalidateKey(id bsoncore.Value) {
+	if c.keyCache != nil {
+		c.keyCache.invalidate(id)
+	}
+}
+
+// fetchStoredKeys retrieves the data keys matching filter from the key vault without using the key cache, and prepares
+// them for libmongocrypt to rewrap. AWS data keys are returned as stored, since libmongocrypt unwraps them itself.
+func (c *Crypt) fetchStoredKeys(ctx context.Context, filter bsoncore.Document) ([]bsoncore.Document, error) {
+	keys, err := c.keyFn(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		if provider, _ := key.Lookup("masterKey", "provider").StringValueOK(); provider == "aws" {
+			continue
+		}
+		if keys[i], err = c.translateKey(ctx, key); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// fetchKeys retrieves the data keys matching filter from the key vault and prepares them for libmongocrypt, using the
+// key cache if it is enabled.
+func (c *Crypt) fetchKeys(ctx context.Context, filter bsoncore.Document) ([]bsoncore.Document, error) {
+	if c.keyCache != nil {
+		if keys, ok := c.cachedKeys(filter); ok {
+			return keys, nil
+		}
+	}
+
+	keys, err := c.keyFn(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		if keys[i], err = c.translateKey(ctx, key); err != nil {
+			return nil, err
+		}
+		if c.keyCache != nil {
+			c.keyCache.add(keys[i])
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,294 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/appveen/mongo-go-driver/bson/bsontype"
+	"github.com/appveen/mongo-go-driver/event"
+	"github.com/appveen/mongo-go-driver/x/bsonx/bsoncore"
+	"github.com/appveen/mongo-go-driver/x/mongo/driver/mongocrypt/options"
+)
+
+func testDataKey(id byte, altNames ...string) bsoncore.Document {
+	idx, doc := bsoncore.AppendDocumentStart(nil)
+	doc = bsoncore.AppendBinaryElement(doc, "_id", 0x04, bytes.Repeat([]byte{id}, 16))
+	if len(altNames) > 0 {
+		aidx, arr := bsoncore.AppendArrayElementStart(doc, "keyAltNames")
+		for i, name := range altNames {
+			arr = bsoncore.AppendStringElement(arr, string('0'+byte(i)), name)
+		}
+		doc, _ = bsoncore.AppendArrayEnd(arr, aidx)
+	}
+	doc = bsoncore.AppendBinaryElement(doc, "keyMaterial", 0x00, []byte{id})
+	doc, _ = bsoncore.AppendDocumentEnd(doc, idx)
+	return doc
+}
+
+func testDataKeyID(id byte) bsoncore.Value {
+	return bsoncore.Value{Type: bsontype.Binary, Data: bsoncore.AppendBinary(nil, 0x04, bytes.Repeat([]byte{id}, 16))}
+}
+
+// testKeyFilter builds a filter like the ones libmongocrypt uses to retrieve data keys.
+func testKeyFilter(ids []byte, names []string) bsoncore.Document {
+	idx, doc := bsoncore.AppendDocumentStart(nil)
+	oidx, doc := bsoncore.AppendArrayElementStart(doc, "$or")
+
+	cidx, doc := bsoncore.AppendDocumentElementStart(doc, "0")
+	didx, doc := bsoncore.AppendDocumentElementStart(doc, "_id")
+	aidx, doc := bsoncore.AppendArrayElementStart(doc, "$in")
+	for i, id := range ids {
+		doc = bsoncore.AppendValueElement(doc, string('0'+byte(i)), testDataKeyID(id))
+	}
+	doc, _ = bsoncore.AppendArrayEnd(doc, aidx)
+	doc, _ = bsoncore.AppendDocumentEnd(doc, didx)
+	doc, _ = bsoncore.AppendDocumentEnd(doc, cidx)
+
+	cidx, doc = bsoncore.AppendDocumentElementStart(doc, "1")
+	didx, doc = bsoncore.AppendDocumentElementStart(doc, "keyAltNames")
+	aidx, doc = bsoncore.AppendArrayElementStart(doc, "$in")
+	for i, name := range names {
+		doc = bsoncore.AppendStringElement(doc, string('0'+byte(i)), name)
+	}
+	doc, _ = bsoncore.AppendArrayEnd(doc, aidx)
+	doc, _ = bsoncore.AppendDocumentEnd(doc, didx)
+	doc, _ = bsoncore.AppendDocumentEnd(doc, cidx)
+
+	doc, _ = bsoncore.AppendArrayEnd(doc, oidx)
+	doc, _ = bsoncore.AppendDocumentEnd(doc, idx)
+	return doc
+}
+
+func TestKeyCache(t *testing.T) {
+	t.Run("lookup by _id and key alt name", func(t *testing.T) {
+		kc := newKeyCache(time.Minute, 0)
+		key := testDataKey(1, "a", "b")
+		kc.add(key)
+
+		if got, ok := kc.get(testDataKeyID(1)); !ok || !bytes.Equal(got, key) {
+			t.Fatalf("expected data key by _id")
+		}
+		if got, ok := kc.getByAltName("b"); !ok || !bytes.Equal(got, key) {
+			t.Fatalf("expected data key by key alt name")
+		}
+		if _, ok := kc.get(testDataKeyID(2)); ok {
+			t.Fatalf("expected miss for uncached _id")
+		}
+		if _, ok := kc.getByAltName("c"); ok {
+			t.Fatalf("expected miss for uncached key alt name")
+		}
+	})
+	t.Run("expiry", func(t *testing.T) {
+		now := time.Now()
+		kc := newKeyCache(time.Minute, 0)
+		kc.now = func() time.Time { return now }
+		kc.add(testDataKey(1, "a"))
+
+		now = now.Add(59 * time.Second)
+		if _, ok := kc.get(testDataKeyID(1)); !ok {
+			t.Fatalf("expected data key before expiry")
+		}
+		now = now.Add(time.Second)
+		if _, ok := kc.getByAltName("a"); ok {
+			t.Fatalf("expected miss after expiry")
+		}
+		if kc.lru.Len() != 0 || len(kc.entries) != 0 || len(kc.altNames) != 0 {
+			t.Fatalf("expected expired data key to be removed")
+		}
+	})
+	t.Run("max size", func(t *testing.T) {
+		kc := newKeyCache(time.Minute, 2)
+		kc.add(testDataKey(1, "a"))
+		kc.add(testDataKey(2))
+		// data key 1 becomes the most recently used one
+		if _, ok := kc.get(testDataKeyID(1)); !ok {
+			t.Fatalf("expected data key 1")
+		}
+		kc.add(testDataKey(3))
+
+		if _, ok := kc.get(testDataKeyID(2)); ok {
+			t.Fatalf("expected least recently used data key to be evicted")
+		}
+		if _, ok := kc.getByAltName("a"); !ok {
+			t.Fatalf("expected data key 1 to be cached")
+		}
+		if _, ok := kc.get(testDataKeyID(3)); !ok {
+			t.Fatalf("expected data key 3 to be cached")
+		}
+	})
+	t.Run("key alt name moved", func(t *testing.T) {
+		kc := newKeyCache(time.Minute, 0)
+		kc.add(testDataKey(1, "a"))
+		kc.add(testDataKey(2, "a"))
+
+		got, ok := kc.getByAltName("a")
+		if !ok || !bytes.Equal(got, testDataKey(2, "a")) {
+			t.Fatalf("expected key alt name to refer to data key 2")
+		}
+	})
+	t.Run("invalidate", func(t *testing.T) {
+		kc := newKeyCache(time.Minute, 0)
+		kc.add(testDataKey(1, "a"))
+		kc.add(testDataKey(2))
+		kc.invalidate(testDataKeyID(1))
+
+		if _, ok := kc.get(testDataKeyID(1)); ok {
+			t.Fatalf("expected invalidated data key to be removed")
+		}
+		if _, ok := kc.getByAltName("a"); ok {
+			t.Fatalf("expected key alt names of invalidated data key to be removed")
+		}
+		if _, ok := kc.get(testDataKeyID(2)); !ok {
+			t.Fatalf("expected data key 2 to be cached")
+		}
+	})
+}
+
+func TestParseKeyFilter(t *testing.T) {
+	ids, names, ok := parseKeyFilter(testKeyFilter([]byte{1, 2}, []string{"a"}))
+	if !ok {
+		t.Fatalf("expected filter to be parsed")
+	}
+	if len(ids) != 2 || !bytes.Equal(ids[1].Data, testDataKeyID(2).Data) {
+		t.Fatalf("unexpected _ids %v", ids)
+	}
+	if len(names) != 1 || names[0] != "a" {
+		t.Fatalf("unexpected key alt names %v", names)
+	}
+
+	idx, other := bsoncore.AppendDocumentStart(nil)
+	other = bsoncore.AppendStringElement(other, "masterKey.provider", "aws")
+	other, _ = bsoncore.AppendDocumentEnd(other, idx)
+	if _, _, ok = parseKeyFilter(other); ok {
+		t.Fatalf("expected other filters not to be parsed")
+	}
+}
+
+func TestCryptFetchKeys(t *testing.T) {
+	var queries int
+	var events []*event.EncryptionEvent
+	c := &Crypt{
+		keyFn: func(ctx context.Context, filter bsoncore.Document) ([]bsoncore.Document, error) {
+			queries++
+			return []bsoncore.Document{testDataKey(1, "a"), testDataKey(2)}, nil
+		},
+		keyCache: newKeyCache(time.Minute, 0),
+		monitor: &event.EncryptionMonitor{
+			Event: func(evt *event.EncryptionEvent) {
+				events = append(events, evt)
+			},
+		},
+	}
+	ctx := context.Background()
+
+	keys, err := c.fetchKeys(ctx, testKeyFilter([]byte{1, 2}, nil))
+	noerr(t, err)
+	if queries != 1 || len(keys) != 2 {
+		t.Fatalf("expected 1 query returning 2 data keys, got %d queries and %d data keys", queries, len(keys))
+	}
+	if len(events) != 2 || events[0].Type != event.KeyCacheMiss {
+		t.Fatalf("expected 2 cache miss events, got %v", events)
+	}
+	if !bytes.Equal(events[0].KeyID, bytes.Repeat([]byte{1}, 16)) {
+		t.Fatalf("expected the miss event to have the data key's ID, got %v", events[0].KeyID)
+	}
+
+	events = nil
+	keys, err = c.fetchKeys(ctx, testKeyFilter([]byte{1}, []string{"a"}))
+	noerr(t, err)
+	if queries != 1 {
+		t.Fatalf("expected data keys to be served from the cache, got %d queries", queries)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("expected data key requested by _id and key alt name to be returned once, got %d", len(keys))
+	}
+	if len(events) != 2 || events[0].Type != event.KeyCacheHit || events[1].KeyAltName != "a" {
+		t.Fatalf("expected 2 cache hit events, got %v", events)
+	}
+
+	_, err = c.fetchKeys(ctx, testKeyFilter([]byte{1, 3}, nil))
+	noerr(t, err)
+	if queries != 2 {
+		t.Fatalf("expected a query for an uncached data key, got %d queries", queries)
+	}
+
+	c.InvalidateKey(testDataKeyID(2))
+	_, err = c.fetchKeys(ctx, testKeyFilter([]byte{2}, nil))
+	noerr(t, err)
+	if queries != 3 {
+		t.Fatalf("expected a query for an invalidated data key, got %d queries", queries)
+	}
+}
+
+func TestCryptKeyCacheHitProvider(t *testing.T) {
+	kms := &xorKms{}
+	var events []*event.EncryptionEvent
+	c := &Crypt{
+		kmsProviders: map[string]KmsProvider{"xor": kms},
+		localKey:     newLocalKey(t),
+		keyCache:     newKeyCache(time.Minute, 0),
+		monitor: &event.EncryptionMonitor{
+			Event: func(evt *event.EncryptionEvent) {
+				events = append(events, evt)
+			},
+		},
+	}
+	ctx := context.Background()
+
+	key, err := c.CreateDataKey(ctx, "xor", options.DataKey().SetMasterKey(xorMasterKey(0x5a)).SetKeyAltNames([]string{"x"}))
+	noerr(t, err)
+	c.keyFn = func(context.Context, bsoncore.Document) ([]bsoncore.Document, error) {
+		return []bsoncore.Document{key}, nil
+	}
+	_, err = c.fetchKeys(ctx, testKeyFilter(nil, []string{"x"}))
+	noerr(t, err)
+
+	events = nil
+	_, err = c.fetchKeys(ctx, testKeyFilter(nil, []string{"x"}))
+	noerr(t, err)
+	// the data key was cached unwrapped, so the hit does not need a KMS round trip
+	if len(events) != 1 || events[0].Type != event.KeyCacheHit || events[0].Provider != "local" {
+		t.Fatalf("expected a cache hit for the local provider, got %v", events)
+	}
+}
+
+func TestCryptFetchStoredKeys(t *testing.T) {
+	kms := &xorKms{}
+	c := &Crypt{
+		kmsProviders: map[string]KmsProvider{"xor": kms},
+		localKey:     newLocalKey(t),
+		keyCache:     newKeyCache(time.Minute, 0),
+	}
+	ctx := context.Background()
+
+	custom, err := c.CreateDataKey(ctx, "xor", options.DataKey().SetMasterKey(xorMasterKey(0x5a)))
+	noerr(t, err)
+	idx, aws := bsoncore.AppendDocumentStart(nil)
+	aws = bsoncore.AppendBinaryElement(aws, "_id", 0x04, bytes.Repeat([]byte{1}, 16))
+	aws = bsoncore.AppendBinaryElement(aws, "keyMaterial", 0x00, []byte{1, 2, 3})
+	midx, aws := bsoncore.AppendDocumentElementStart(aws, "masterKey")
+	aws = bsoncore.AppendStringElement(aws, "provider", "aws")
+	aws, _ = bsoncore.AppendDocumentEnd(aws, midx)
+	aws, _ = bsoncore.AppendDocumentEnd(aws, idx)
+	c.keyFn = func(context.Context, bsoncore.Document) ([]bsoncore.Document, error) {
+		return []bsoncore.Document{custom, aws}, nil
+	}
+
+	// the AWS data key would be rewrapped by libmongocrypt if it were translated for the key cache
+	keys, err := c.fetchStoredKeys(ctx, testKeyFilter([]byte{1}, nil))
+	noerr(t, err)
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 data keys, got %d", len(keys))
+	}
+	if provider := keys[0].Lookup("masterKey", "provider").StringValue(); provider != "local" {
+		t.Fatalf("expected the custom data key to be translated to provider local, got %q", provider)
+	}
+	if !bytes.Equal(keys[1], aws) {
+		t.Fatalf("expected the AWS data key to be unchanged")
+	}
+	if n := c.keyCache.lru.Len(); n != 0 {
+		t.Fatalf("expected stored data keys not to be cached, got %d cached data keys", n)
+	}
+}
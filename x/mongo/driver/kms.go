@@ -0,0 +1,372 @@
+// Copyright (C) MongoDB, Inc. 2017-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package driver
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/appveen/mongo-go-driver/x/bsonx/bsoncore"
+	"github.com/appveen/mongo-go-driver/x/mongo/driver/mongocrypt/options"
+	"github.com/appveen/mongo-go-driver/x/mongo/driver/uuid"
+)
+
+// localKeyLen is the length of local master keys and of data keys.
+const localKeyLen = 96
+
+// ErrInvalidKeyMaterial is returned when wrapped key material cannot be unwrapped with a local master key.
+var ErrInvalidKeyMaterial = errors.New("invalid key material")
+
+// KmsProvider is a key management service implemented in Go, e.g. a client for HashiCorp Vault or an HSM service. It
+// wraps the data keys of its KMS provider name, whose masterKey documents are {provider: <name>, <master key fields>},
+// where the master key fields are those given when the data key was created.
+//
+// Data keys of a KmsProvider are unwrapped by the driver and handed to libmongocrypt wrapped with a local master key
+// that never leaves the process, so libmongocrypt does not need to know about the KMS.
+type KmsProvider interface {
+	// WrapKey encrypts a new data key with the given master key.
+	WrapKey(ctx context.Context, masterKey bsoncore.Document, dataKey []byte) ([]byte, error)
+	// UnwrapKey decrypts a data key that was encrypted with the given master key.
+	UnwrapKey(ctx context.Context, masterKey bsoncore.Document, keyMaterial []byte) ([]byte, error)
+}
+
+// customKms returns the KmsProvider registered for the given provider name.
+func (c *Crypt) customKms(provider string) (KmsProvider, bool) {
+	kms, ok := c.kmsProviders[provider]
+	return kms, ok
+}
+
+// createCustomDataKey creates a data key document for a KmsProvider.
+func (c *Crypt) createCustomDataKey(ctx context.Context, provider string, kms KmsProvider,
+	opts *options.DataKeyOptions) (bsoncore.Document, error) {
+
+	masterKey, err := customMasterKey(provider, opts.MasterKey)
+	if err != nil {
+		return nil, err
+	}
+	dataKey := make([]byte, localKeyLen)
+	if _, err = io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	keyMaterial, err := kms.WrapKey(ctx, masterKey, dataKey)
+	c.kmsRequestEvent(provider, start, err)
+	if err != nil {
+		return nil, err
+	}
+	id, err := uuid.New()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	idx, doc := bsoncore.AppendDocumentStart(nil)
+	doc = bsoncore.AppendBinaryElement(doc, "_id", 0x04, id[:])
+	if len(opts.KeyAltNames) > 0 {
+		aidx, arr := bsoncore.AppendArrayElementStart(doc, "keyAltNames")
+		for i, name := range opts.KeyAltNames {
+			arr = bsoncore.AppendStringElement(arr, fmt.Sprint(i), name)
+		}
+		doc, _ = bsoncore.AppendArrayEnd(arr, aidx)
+	}
+	doc = bsoncore.AppendBinaryElement(doc, "keyMaterial", 0x00, keyMaterial)
+	doc = bsoncore.AppendDateTimeElement(doc, "creationDate", now)
+	doc = bsoncore.AppendDateTimeElement(doc, "updateDate", now)
+	doc = bsoncore.AppendInt32Element(doc, "status", 0)
+	doc = bsoncore.AppendDocumentElement(doc, "masterKey", masterKey)
+	return bsoncore.AppendDocumentEnd(doc, idx)
+}
+
+// translateKey rewraps a data key document of a KmsProvider with the local master key, so libmongocrypt can decrypt
+// it. If the key cache is enabled, AWS data keys are rewrapped with the local master key too, so they are decrypted
+// with AWS KMS once per cached data key rather than on every libmongocrypt cache miss. Other data keys are returned
+// unchanged.
+func (c *Crypt) translateKey(ctx context.Context, key bsoncore.Document) (bsoncore.Document, error) {
+	masterKey, ok := key.Lookup("masterKey").DocumentOK()
+	if !ok {
+		return key, nil
+	}
+	provider, ok := masterKey.Lookup("provider").StringValueOK()
+	if !ok {
+		// not a valid data key, which libmongocrypt reports
+		return key, nil
+	}
+	if provider == "aws" && c.keyCache != nil && c.localKey != nil {
+		return c.translateAwsKey(ctx, key)
+	}
+	kms, ok := c.customKms(provider)
+	if !ok {
+		return key, nil
+	}
+
+	subtype, keyMaterial, ok := key.Lookup("keyMaterial").BinaryOK()
+	if !ok || subtype != 0x00 {
+		return nil, ErrInvalidKeyMaterial
+	}
+	start := time.Now()
+	dataKey, err := kms.UnwrapKey(ctx, masterKey, keyMaterial)
+	c.kmsRequestEvent(provider, start, err)
+	if err != nil {
+		return nil, err
+	}
+	if keyMaterial, err = wrapLocalKey(c.localKey, dataKey); err != nil {
+		return nil, err
+	}
+
+	localMasterKey, _ := customMasterKey("local", nil)
+	return replaceKeyMaterial(key, keyMaterial, localMasterKey)
+}
+
+// translateAwsKey has libmongocrypt rewrap an AWS data key document with the local master key. libmongocrypt decrypts
+// the data key with AWS KMS to rewrap it.
+func (c *Crypt) translateAwsKey(ctx context.Context, key bsoncore.Document) (bsoncore.Document, error) {
+	id, err := key.LookupErr("_id")
+	if err != nil {
+		return nil, err
+	}
+	filter := bsoncore.BuildDocument(nil, bsoncore.AppendValueElement(nil, "_id", id))
+	opts := options.RewrapManyDataKey().SetKmsProvider("local")
+	cryptCtx, err := c.mongoCrypt.CreateRewrapManyDataKeyContext(filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cryptCtx.Close()
+
+	// the data key is rewrapped as retrieved, not as stored in the key vault now
+	retrieved := func(context.Context, bsoncore.Document) ([]bsoncore.Document, error) {
+		return []bsoncore.Document{key}, nil
+	}
+	res, err := c.runStateMachine(ctx, cryptCtx, "", retrieved)
+	if err != nil {
+		return nil, err
+	}
+	rewrapped, ok := res.Lookup("v", "0").DocumentOK()
+	if !ok {
+		return nil, fmt.Errorf("data key %v was not rewrapped", id)
+	}
+	subtype, keyMaterial, ok := rewrapped.Lookup("keyMaterial").BinaryOK()
+	if !ok || subtype != 0x00 {
+		return nil, ErrInvalidKeyMaterial
+	}
+
+	// libmongocrypt only returns the rewrapped fields
+	localMasterKey, _ := customMasterKey("local", nil)
+	return replaceKeyMaterial(key, keyMaterial, localMasterKey)
+}
+
+// rewrapCustomKey rewraps a data key document that libmongocrypt rewrapped with the local master key with the given
+// master key of a KmsProvider.
+func (c *Crypt) rewrapCustomKey(ctx context.Context, key bsoncore.Document, kms KmsProvider,
+	masterKey bsoncore.Document) (bsoncore.Document, error) {
+
+	subtype, keyMaterial, ok := key.Lookup("keyMaterial").BinaryOK()
+	if !ok || subtype != 0x00 {
+		return nil, ErrInvalidKeyMaterial
+	}
+	dataKey, err := unwrapLocalKey(c.localKey, keyMaterial)
+	if err != nil {
+		return nil, err
+	}
+	provider, ok := masterKey.Lookup("provider").StringValueOK()
+	if !ok {
+		return nil, errors.New("master key has no provider")
+	}
+	start := time.Now()
+	keyMaterial, err = kms.WrapKey(ctx, masterKey, dataKey)
+	c.kmsRequestEvent(provider, start, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return replaceKeyMaterial(key, keyMaterial, masterKey)
+}
+
+// restoreCustomKeys rewraps the data keys of KmsProviders among keys, which libmongocrypt rewrapped with the local
+// master key they were translated to, with the master key they are stored with in the key vault.
+func (c *Crypt) restoreCustomKeys(ctx context.Context, keys []bsoncore.Document) error {
+	idx, filter := bsoncore.AppendDocumentStart(nil)
+	didx, filter := bsoncore.AppendDocumentElementStart(filter, "_id")
+	aidx, filter := bsoncore.AppendArrayElementStart(filter, "$in")
+	var n int
+	for _, key := range keys {
+		if provider, _ := key.Lookup("masterKey", "provider").StringValueOK(); provider != "local" {
+			continue
+		}
+		id, err := key.LookupErr("_id")
+		if err != nil {
+			return err
+		}
+		filter = bsoncore.AppendValueElement(filter, fmt.Sprint(n), id)
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	filter, _ = bsoncore.AppendArrayEnd(filter, aidx)
+	filter, _ = bsoncore.AppendDocumentEnd(filter, didx)
+	filter, _ = bsoncore.AppendDocumentEnd(filter, idx)
+
+	stored, err := c.keyFn(ctx, filter)
+	if err != nil {
+		return err
+	}
+	masterKeys := make(map[string]bsoncore.Document, len(stored))
+	for _, key := range stored {
+		if masterKey, ok := key.Lookup("masterKey").DocumentOK(); ok {
+			masterKeys[string(key.Lookup("_id").Data)] = masterKey
+		}
+	}
+
+	for i, key := range keys {
+		if provider, _ := key.Lookup("masterKey", "provider").StringValueOK(); provider != "local" {
+			continue
+		}
+		masterKey := masterKeys[string(key.Lookup("_id").Data)]
+		provider, _ := masterKey.Lookup("provider").StringValueOK()
+		kms, ok := c.customKms(provider)
+		if !ok {
+			if c.ownLocalKey {
+				// the data key changed in the key vault since it was rewrapped
+				return fmt.Errorf("data key %v is no longer stored with a custom KMS provider", key.Lookup("_id"))
+			}
+			continue
+		}
+		if keys[i], err = c.rewrapCustomKey(ctx, key, kms, masterKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// customMasterKey returns the masterKey document {provider: <provider>, <fields>...} of a data key.
+func customMasterKey(provider string, fields bsoncore.Document) (bsoncore.Document, error) {
+	idx, doc := bsoncore.AppendDocumentStart(nil)
+	doc = bsoncore.AppendStringElement(doc, "provider", provider)
+	if fields != nil {
+		elems, err := fields.Elements()
+		if err != nil {
+			return nil, err
+		}
+		for _, elem := range elems {
+			if elem.Key() != "provider" {
+				doc = append(doc, elem...)
+			}
+		}
+	}
+	return bsoncore.AppendDocumentEnd(doc, idx)
+}
+
+// replaceKeyMaterial returns a copy of a data key document with the given keyMaterial and masterKey.
+func replaceKeyMaterial(key bsoncore.Document, keyMaterial []byte,
+	masterKey bsoncore.Document) (bsoncore.Document, error) {
+
+	elems, err := key.Elements()
+	if err != nil {
+		return nil, err
+	}
+	idx, doc := bsoncore.AppendDocumentStart(nil)
+	for _, elem := range elems {
+		switch elem.Key() {
+		case "keyMaterial":
+			doc = bsoncore.AppendBinaryElement(doc, "keyMaterial", 0x00, keyMaterial)
+		case "masterKey":
+			doc = bsoncore.AppendDocumentElement(doc, "masterKey", masterKey)
+		default:
+			doc = append(doc, elem...)
+		}
+	}
+	return bsoncore.AppendDocumentEnd(doc, idx)
+}
+
+// dialKms connects to the KMS of the given provider at host, or at the endpoint configured for the provider.
+func (c *Crypt) dialKms(provider, host string) (net.Conn, error) {
+	addr := fmt.Sprintf("%s:%d", host, defaultKmsPort)
+	if endpoint, ok := c.kmsEndpoints[provider]; ok {
+		addr = endpoint
+		if _, _, err := net.SplitHostPort(endpoint); err != nil {
+			addr = fmt.Sprintf("%s:%d", endpoint, defaultKmsPort)
+		}
+	}
+
+	tlsConfig := &tls.Config{}
+	if cfg, ok := c.kmsTLSConfig[provider]; ok && cfg != nil {
+		tlsConfig = cfg.Clone()
+	}
+	return tls.DialWithDialer(&net.Dialer{Timeout: defaultKmsTimeout}, "tcp", addr, tlsConfig)
+}
+
+// wrapLocalKey encrypts a data key like libmongocrypt does with a local master key, using AEAD_AES_256_CBC_HMAC_SHA_512
+// without associated data: the first 32 bytes of the master key are the MAC key and the next 32 bytes the encryption
+// key. The result is the IV, the ciphertext and the truncated HMAC.
+func wrapLocalKey(masterKey, dataKey []byte) ([]byte, error) {
+	if len(masterKey) != localKeyLen {
+		return nil, fmt.Errorf("local master key must be %d bytes, got %d", localKeyLen, len(masterKey))
+	}
+	block, err := aes.NewCipher(masterKey[32:64])
+	if err != nil {
+		return nil, err
+	}
+
+	padding := aes.BlockSize - len(dataKey)%aes.BlockSize
+	out := make([]byte, aes.BlockSize, aes.BlockSize+len(dataKey)+padding+sha512.Size256)
+	if _, err = io.ReadFull(rand.Reader, out); err != nil {
+		return nil, err
+	}
+	out = append(out, dataKey...)
+	out = append(out, bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, out[:aes.BlockSize]).CryptBlocks(out[aes.BlockSize:], out[aes.BlockSize:])
+
+	return append(out, localKeyMAC(masterKey, out)...), nil
+}
+
+// unwrapLocalKey decrypts key material encrypted with wrapLocalKey.
+func unwrapLocalKey(masterKey, keyMaterial []byte) ([]byte, error) {
+	if len(masterKey) != localKeyLen {
+		return nil, fmt.Errorf("local master key must be %d bytes, got %d", localKeyLen, len(masterKey))
+	}
+	macLen := sha512.Size256
+	if len(keyMaterial) < 2*aes.BlockSize+macLen || (len(keyMaterial)-macLen)%aes.BlockSize != 0 {
+		return nil, ErrInvalidKeyMaterial
+	}
+	data, mac := keyMaterial[:len(keyMaterial)-macLen], keyMaterial[len(keyMaterial)-macLen:]
+	if !hmac.Equal(mac, localKeyMAC(masterKey, data)) {
+		return nil, ErrInvalidKeyMaterial
+	}
+
+	block, err := aes.NewCipher(masterKey[32:64])
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(data)-aes.BlockSize)
+	cipher.NewCBCDecrypter(block, data[:aes.BlockSize]).CryptBlocks(plaintext, data[aes.BlockSize:])
+
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, ErrInvalidKeyMaterial
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
+
+// localKeyMAC returns the truncated HMAC-SHA-512 of the IV and ciphertext, followed by the 64-bit length of the empty
+// associated data.
+func localKeyMAC(masterKey, data []byte) []byte {
+	h := hmac.New(sha512.New, masterKey[:32])
+	_, _ = h.Write(data)
+	_, _ = h.Write(make([]byte, 8))
+	return h.Sum(nil)[:sha512.Size256]
+}
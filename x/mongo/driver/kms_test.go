@@ -0,0 +1,302 @@
+package driver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/appveen/mongo-go-driver/x/bsonx/bsoncore"
+	"github.com/appveen/mongo-go-driver/x/mongo/driver/mongocrypt/options"
+)
+
+// xorKms is a KmsProvider that wraps data keys by XORing them with the byte in the master key's "xor" field.
+type xorKms struct {
+	dataKeys [][]byte
+}
+
+func (xk *xorKms) xor(masterKey bsoncore.Document, key []byte) ([]byte, error) {
+	b, ok := masterKey.Lookup("xor").Int32OK()
+	if !ok {
+		return nil, fmt.Errorf("master key has no xor field")
+	}
+	out := make([]byte, len(key))
+	for i := range key {
+		out[i] = key[i] ^ byte(b)
+	}
+	return out, nil
+}
+
+func (xk *xorKms) WrapKey(_ context.Context, masterKey bsoncore.Document, dataKey []byte) ([]byte, error) {
+	xk.dataKeys = append(xk.dataKeys, dataKey)
+	return xk.xor(masterKey, dataKey)
+}
+
+func (xk *xorKms) UnwrapKey(_ context.Context, masterKey bsoncore.Document, keyMaterial []byte) ([]byte, error) {
+	return xk.xor(masterKey, keyMaterial)
+}
+
+func newLocalKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, localKeyLen)
+	_, err := io.ReadFull(rand.Reader, key)
+	noerr(t, err)
+	return key
+}
+
+func xorMasterKey(b int32) bsoncore.Document {
+	idx, doc := bsoncore.AppendDocumentStart(nil)
+	doc = bsoncore.AppendInt32Element(doc, "xor", b)
+	doc, _ = bsoncore.AppendDocumentEnd(doc, idx)
+	return doc
+}
+
+func TestLocalKeyWrapping(t *testing.T) {
+	masterKey := newLocalKey(t)
+	dataKey := newLocalKey(t)
+
+	t.Run("round trip", func(t *testing.T) {
+		wrapped, err := wrapLocalKey(masterKey, dataKey)
+		noerr(t, err)
+		// IV, 96 bytes of data key and a full block of padding, MAC
+		if len(wrapped) != 16+112+32 {
+			t.Fatalf("expected 160 bytes of key material, got %d", len(wrapped))
+		}
+		unwrapped, err := unwrapLocalKey(masterKey, wrapped)
+		noerr(t, err)
+		if !bytes.Equal(unwrapped, dataKey) {
+			t.Fatalf("unwrapped data key does not match")
+		}
+	})
+	t.Run("tampered", func(t *testing.T) {
+		wrapped, err := wrapLocalKey(masterKey, dataKey)
+		noerr(t, err)
+		wrapped[20] ^= 1
+		if _, err = unwrapLocalKey(masterKey, wrapped); err != ErrInvalidKeyMaterial {
+			t.Fatalf("expected error %v, got %v", ErrInvalidKeyMaterial, err)
+		}
+	})
+	t.Run("wrong master key", func(t *testing.T) {
+		wrapped, err := wrapLocalKey(masterKey, dataKey)
+		noerr(t, err)
+		if _, err = unwrapLocalKey(newLocalKey(t), wrapped); err != ErrInvalidKeyMaterial {
+			t.Fatalf("expected error %v, got %v", ErrInvalidKeyMaterial, err)
+		}
+	})
+	t.Run("invalid master key length", func(t *testing.T) {
+		if _, err := wrapLocalKey(masterKey[:32], dataKey); err == nil {
+			t.Fatalf("expected error for short master key, got nil")
+		}
+	})
+}
+
+func TestCustomKmsProvider(t *testing.T) {
+	kms := &xorKms{}
+	c := &Crypt{
+		kmsProviders: map[string]KmsProvider{"xor": kms},
+		localKey:     newLocalKey(t),
+	}
+	ctx := context.Background()
+
+	opts := options.DataKey().SetMasterKey(xorMasterKey(0x5a)).SetKeyAltNames([]string{"alt"})
+	key, err := c.CreateDataKey(ctx, "xor", opts)
+	noerr(t, err)
+	if len(kms.dataKeys) != 1 {
+		t.Fatalf("expected 1 wrapped data key, got %d", len(kms.dataKeys))
+	}
+	dataKey := kms.dataKeys[0]
+
+	if provider := key.Lookup("masterKey", "provider").StringValue(); provider != "xor" {
+		t.Fatalf("expected provider xor, got %q", provider)
+	}
+	if b := key.Lookup("masterKey", "xor").Int32(); b != 0x5a {
+		t.Fatalf("expected master key field xor 0x5a, got %#x", b)
+	}
+	if name := key.Lookup("keyAltNames", "0").StringValue(); name != "alt" {
+		t.Fatalf("expected key alt name alt, got %q", name)
+	}
+	if subtype, _ := key.Lookup("_id").Binary(); subtype != 0x04 {
+		t.Fatalf("expected _id of subtype 4, got %d", subtype)
+	}
+
+	t.Run("translate", func(t *testing.T) {
+		translated, err := c.translateKey(ctx, key)
+		noerr(t, err)
+		if provider := translated.Lookup("masterKey", "provider").StringValue(); provider != "local" {
+			t.Fatalf("expected provider local, got %q", provider)
+		}
+		if !bytes.Equal(translated.Lookup("_id").Data, key.Lookup("_id").Data) {
+			t.Fatalf("translated key has a different _id")
+		}
+		_, keyMaterial := translated.Lookup("keyMaterial").Binary()
+		unwrapped, err := unwrapLocalKey(c.localKey, keyMaterial)
+		noerr(t, err)
+		if !bytes.Equal(unwrapped, dataKey) {
+			t.Fatalf("translated key material does not decrypt to the data key")
+		}
+	})
+	t.Run("other providers are not translated", func(t *testing.T) {
+		idx, doc := bsoncore.AppendDocumentStart(nil)
+		doc = bsoncore.AppendBinaryElement(doc, "keyMaterial", 0x00, []byte{1, 2, 3})
+		midx, doc := bsoncore.AppendDocumentElementStart(doc, "masterKey")
+		doc = bsoncore.AppendStringElement(doc, "provider", "aws")
+		doc, _ = bsoncore.AppendDocumentEnd(doc, midx)
+		doc, _ = bsoncore.AppendDocumentEnd(doc, idx)
+
+		translated, err := c.translateKey(ctx, doc)
+		noerr(t, err)
+		if !bytes.Equal(translated, doc) {
+			t.Fatalf("expected key to be unchanged")
+		}
+	})
+	t.Run("master key without provider", func(t *testing.T) {
+		idx, doc := bsoncore.AppendDocumentStart(nil)
+		doc = bsoncore.AppendBinaryElement(doc, "keyMaterial", 0x00, []byte{1, 2, 3})
+		midx, doc := bsoncore.AppendDocumentElementStart(doc, "masterKey")
+		doc = bsoncore.AppendInt32Element(doc, "provider", 1)
+		doc, _ = bsoncore.AppendDocumentEnd(doc, midx)
+		doc, _ = bsoncore.AppendDocumentEnd(doc, idx)
+
+		translated, err := c.translateKey(ctx, doc)
+		noerr(t, err)
+		if !bytes.Equal(translated, doc) {
+			t.Fatalf("expected key to be unchanged")
+		}
+	})
+	t.Run("rewrap", func(t *testing.T) {
+		translated, err := c.translateKey(ctx, key)
+		noerr(t, err)
+		masterKey, err := customMasterKey("xor", xorMasterKey(0x33))
+		noerr(t, err)
+
+		rewrapped, err := c.rewrapCustomKey(ctx, translated, kms, masterKey)
+		noerr(t, err)
+		if b := rewrapped.Lookup("masterKey", "xor").Int32(); b != 0x33 {
+			t.Fatalf("expected master key field xor 0x33, got %#x", b)
+		}
+		_, keyMaterial := rewrapped.Lookup("keyMaterial").Binary()
+		unwrapped, err := kms.UnwrapKey(ctx, masterKey, keyMaterial)
+		noerr(t, err)
+		if !bytes.Equal(unwrapped, dataKey) {
+			t.Fatalf("rewrapped key material does not decrypt to the data key")
+		}
+	})
+}
+
+func TestCustomKmsProviderRewrapWithoutProvider(t *testing.T) {
+	kms := &xorKms{}
+	var stored []bsoncore.Document
+	c := &Crypt{
+		keyFn: func(context.Context, bsoncore.Document) ([]bsoncore.Document, error) {
+			return stored, nil
+		},
+		kmsProviders: map[string]KmsProvider{"xor": kms},
+		localKey:     newLocalKey(t),
+		ownLocalKey:  true,
+	}
+	ctx := context.Background()
+
+	key, err := c.CreateDataKey(ctx, "xor", options.DataKey().SetMasterKey(xorMasterKey(0x5a)))
+	noerr(t, err)
+	stored = append(stored, key)
+	dataKey := kms.dataKeys[0]
+
+	// libmongocrypt rewraps the translated key with the local master key when no provider is given
+	translated, err := c.translateKey(ctx, key)
+	noerr(t, err)
+	_, keyMaterial := translated.Lookup("keyMaterial").Binary()
+	unwrapped, err := unwrapLocalKey(c.localKey, keyMaterial)
+	noerr(t, err)
+	keyMaterial, err = wrapLocalKey(c.localKey, unwrapped)
+	noerr(t, err)
+	localMasterKey, err := customMasterKey("local", nil)
+	noerr(t, err)
+	rewrapped, err := replaceKeyMaterial(translated, keyMaterial, localMasterKey)
+	noerr(t, err)
+
+	keys := []bsoncore.Document{rewrapped}
+	noerr(t, c.restoreCustomKeys(ctx, keys))
+	if provider := keys[0].Lookup("masterKey", "provider").StringValue(); provider != "xor" {
+		t.Fatalf("expected provider xor, got %q", provider)
+	}
+	if b := keys[0].Lookup("masterKey", "xor").Int32(); b != 0x5a {
+		t.Fatalf("expected master key field xor 0x5a, got %#x", b)
+	}
+
+	// the data key can still be decrypted once the local master key is gone
+	fresh := &Crypt{
+		kmsProviders: map[string]KmsProvider{"xor": kms},
+		localKey:     newLocalKey(t),
+	}
+	translated, err = fresh.translateKey(ctx, keys[0])
+	noerr(t, err)
+	_, keyMaterial = translated.Lookup("keyMaterial").Binary()
+	unwrapped, err = unwrapLocalKey(fresh.localKey, keyMaterial)
+	noerr(t, err)
+	if !bytes.Equal(unwrapped, dataKey) {
+		t.Fatalf("restored key material does not decrypt to the data key")
+	}
+
+	t.Run("changed in the key vault", func(t *testing.T) {
+		stored = nil
+		keys := []bsoncore.Document{rewrapped}
+		if err := c.restoreCustomKeys(ctx, keys); err == nil {
+			t.Fatalf("expected an error for a key that is no longer stored with a custom KMS provider")
+		}
+	})
+	t.Run("generated local provider", func(t *testing.T) {
+		if _, err := c.CreateDataKey(ctx, "local", options.DataKey()); err == nil {
+			t.Fatalf("expected an error creating a data key with the generated local master key")
+		}
+		if _, err := c.RewrapManyDataKey(ctx, nil, options.RewrapManyDataKey().SetKmsProvider("local")); err == nil {
+			t.Fatalf("expected an error rewrapping data keys with the generated local master key")
+		}
+	})
+}
+
+func TestDialKms(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "kms stand-in")
+	}))
+	defer srv.Close()
+	endpoint := strings.TrimPrefix(srv.URL, "https://")
+	tlsConfig := srv.Client().Transport.(*http.Transport).TLSClientConfig
+
+	t.Run("endpoint and TLS override", func(t *testing.T) {
+		c := &Crypt{
+			kmsEndpoints: map[string]string{"aws": endpoint},
+			kmsTLSConfig: map[string]*tls.Config{"aws": tlsConfig},
+		}
+		conn, err := c.dialKms("aws", "kms.us-east-1.amazonaws.com")
+		noerr(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+
+		_, err = io.WriteString(conn, "POST / HTTP/1.1\r\nHost: kms.us-east-1.amazonaws.com\r\nContent-Length: 0\r\n\r\n")
+		noerr(t, err)
+		res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		noerr(t, err)
+		body, err := ioutil.ReadAll(res.Body)
+		noerr(t, err)
+		if string(body) != "kms stand-in" {
+			t.Fatalf("expected response from the stand-in, got %q", body)
+		}
+	})
+	t.Run("default TLS configuration", func(t *testing.T) {
+		c := &Crypt{kmsEndpoints: map[string]string{"aws": endpoint}}
+		conn, err := c.dialKms("aws", "kms.us-east-1.amazonaws.com")
+		if err == nil {
+			_ = conn.Close()
+			t.Fatalf("expected certificate verification to fail, got nil")
+		}
+	})
+}
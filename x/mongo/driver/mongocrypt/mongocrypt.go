@@ -211,6 +211,53 @@ func (m *MongoCrypt) CreateExplicitDecryptionContext(doc bsoncore.Document) (*Co
 	return ctx, nil
 }
 
+// CreateRewrapManyDataKeyContext creates a Context to use for re-encrypting the data keys matching filter. The keys
+// are decrypted with their current master keys and encrypted with the master key given in opts, or with their current
+// master keys if opts does not specify a KMS provider. This requires libmongocrypt 1.5 or later.
+func (m *MongoCrypt) CreateRewrapManyDataKeyContext(filter bsoncore.Document, opts *options.RewrapManyDataKeyOptions) (*Context, error) {
+	ctx := newContext(C.mongocrypt_ctx_new(m.wrapped))
+	if ctx.wrapped == nil {
+		return nil, m.createErrorFromStatus()
+	}
+
+	if opts.KmsProvider != nil {
+		switch *opts.KmsProvider {
+		case AwsProvider, LocalProvider:
+		default:
+			return nil, ErrInvalidProvider
+		}
+
+		// create document {"provider": <provider>, <master key fields>...}
+		idx, doc := bsoncore.AppendDocumentStart(nil)
+		doc = bsoncore.AppendStringElement(doc, "provider", *opts.KmsProvider)
+		if opts.MasterKey != nil {
+			elems, err := opts.MasterKey.Elements()
+			if err != nil {
+				return nil, err
+			}
+			for _, elem := range elems {
+				if elem.Key() != "provider" {
+					doc = append(doc, elem...)
+				}
+			}
+		}
+		doc, _ = bsoncore.AppendDocumentEnd(doc, idx)
+
+		keyBinary := newBinaryFromBytes(doc)
+		defer keyBinary.close()
+		if ok := C.mongocrypt_ctx_setopt_key_encryption_key(ctx.wrapped, keyBinary.wrapped); !ok {
+			return nil, ctx.createErrorFromStatus()
+		}
+	}
+
+	filterBinary := newBinaryFromBytes(filter)
+	defer filterBinary.close()
+	if ok := C.mongocrypt_ctx_rewrap_many_datakey_init(ctx.wrapped, filterBinary.wrapped); !ok {
+		return nil, ctx.createErrorFromStatus()
+	}
+	return ctx, nil
+}
+
 // Close cleans up any resources associated with the given MongoCrypt instance.
 func (m *MongoCrypt) Close() {
 	C.mongocrypt_destroy(m.wrapped)
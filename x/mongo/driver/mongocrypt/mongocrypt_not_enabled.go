@@ -48,6 +48,11 @@ func (m *MongoCrypt) CreateExplicitDecryptionContext(doc bsoncore.Document) (*Co
 	panic(cseNotSupportedMsg)
 }
 
+// CreateRewrapManyDataKeyContext creates a Context to use for re-encrypting the data keys matching filter.
+func (m *MongoCrypt) CreateRewrapManyDataKeyContext(filter bsoncore.Document, opts *options.RewrapManyDataKeyOptions) (*Context, error) {
+	panic(cseNotSupportedMsg)
+}
+
 // Close cleans up any resources associated with the given MongoCrypt instance.
 func (m *MongoCrypt) Close() {
 	panic(cseNotSupportedMsg)
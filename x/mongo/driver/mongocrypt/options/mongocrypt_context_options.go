@@ -63,3 +63,27 @@ func (eeo *ExplicitEncryptionOptions) SetAlgorithm(algorithm string) *ExplicitEn
 	eeo.Algorithm = algorithm
 	return eeo
 }
+
+// RewrapManyDataKeyOptions specifies options for re-encrypting data keys.
+type RewrapManyDataKeyOptions struct {
+	KmsProvider *string
+	MasterKey   bsoncore.Document
+}
+
+// RewrapManyDataKey creates a new RewrapManyDataKeyOptions instance.
+func RewrapManyDataKey() *RewrapManyDataKeyOptions {
+	return &RewrapManyDataKeyOptions{}
+}
+
+// SetKmsProvider specifies the KMS provider of the new master key. If it is not set, each data key is re-encrypted
+// with its current master key.
+func (rmdko *RewrapManyDataKeyOptions) SetKmsProvider(provider string) *RewrapManyDataKeyOptions {
+	rmdko.KmsProvider = &provider
+	return rmdko
+}
+
+// SetMasterKey specifies the new master key.
+func (rmdko *RewrapManyDataKeyOptions) SetMasterKey(key bsoncore.Document) *RewrapManyDataKeyOptions {
+	rmdko.MasterKey = key
+	return rmdko
+}
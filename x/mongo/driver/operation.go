@@ -278,6 +278,7 @@ func (op Operation) Execute(ctx context.Context, scratch []byte) error {
 	var operationErr WriteCommandError
 	var original error
 	var retries int
+	var reauthenticated bool
 	retryable := op.retryable(desc.Server)
 	if retryable && op.RetryMode != nil {
 		switch op.Type {
@@ -441,6 +442,14 @@ func (op Operation) Execute(ctx context.Context, scratch []byte) error {
 			if tt.HasErrorLabel(TransientTransactionError) || tt.HasErrorLabel(UnknownTransactionCommitResult) {
 				op.Client.ClearPinnedServer()
 			}
+			if ra, ok := conn.(Reauthenticator); ok && tt.ReauthenticationRequired() && !reauthenticated {
+				// authenticate the connection again and rerun the command on it once
+				reauthenticated = true
+				if err = ra.Reauthenticate(ctx); err != nil {
+					return err
+				}
+				continue
+			}
 			if e := err.(Error); retryable && op.Type == Write && e.UnsupportedStorageEngine() {
 				return ErrUnsupportedStorageEngine
 			}
@@ -22,6 +22,7 @@ type IsMaster struct {
 	appname            string
 	compressors        []string
 	saslSupportedMechs string
+	speculativeAuth    bsoncore.Document
 	d                  driver.Deployment
 	clock              *session.ClusterClock
 
@@ -60,6 +61,22 @@ func (im *IsMaster) SASLSupportedMechs(username string) *IsMaster {
 	return im
 }
 
+// SpeculativeAuthenticate sets the first message of an authentication conversation to run with the handshake.
+func (im *IsMaster) SpeculativeAuthenticate(doc bsoncore.Document) *IsMaster {
+	im.speculativeAuth = doc
+	return im
+}
+
+// SpeculativeAuthenticateResponse returns the server's reply to the speculative authentication message, or nil if the
+// server did not reply to it.
+func (im *IsMaster) SpeculativeAuthenticateResponse() bsoncore.Document {
+	doc, ok := im.res.Lookup("speculativeAuthenticate").DocumentOK()
+	if !ok {
+		return nil
+	}
+	return doc
+}
+
 // Deployment sets the Deployment for this operation.
 func (im *IsMaster) Deployment(d driver.Deployment) *IsMaster {
 	im.d = d
@@ -347,6 +364,9 @@ func (im *IsMaster) handshakeCommand(dst []byte, desc description.SelectedServer
 	if im.saslSupportedMechs != "" {
 		dst = bsoncore.AppendStringElement(dst, "saslSupportedMechs", im.saslSupportedMechs)
 	}
+	if im.speculativeAuth != nil {
+		dst = bsoncore.AppendDocumentElement(dst, "speculativeAuthenticate", im.speculativeAuth)
+	}
 	var idx int32
 	idx, dst = bsoncore.AppendArrayElementStart(dst, "compression")
 	for i, compressor := range im.compressors {
@@ -548,3 +548,77 @@ func (m *mockConnection) ReadWireMessage(_ context.Context, dst []byte) ([]byte,
 	m.pReadDst = dst
 	return m.rReadWM, m.rReadErr
 }
+
+// reauthConnection is a connection that reads the given replies and counts reauthentications.
+type reauthConnection struct {
+	mockConnection
+	replies   []bsoncore.Document
+	reauths   int
+	reauthErr error
+}
+
+func (c *reauthConnection) ReadWireMessage(_ context.Context, dst []byte) ([]byte, error) {
+	reply := c.replies[0]
+	c.replies = c.replies[1:]
+
+	idx, dst := wiremessage.AppendHeaderStart(dst[:0], 10, 9, wiremessage.OpReply)
+	dst = wiremessage.AppendReplyFlags(dst, 0)
+	dst = wiremessage.AppendReplyCursorID(dst, 0)
+	dst = wiremessage.AppendReplyStartingFrom(dst, 0)
+	dst = wiremessage.AppendReplyNumberReturned(dst, 1)
+	dst = append(dst, reply...)
+	return bsoncore.UpdateLength(dst, idx, int32(len(dst[idx:]))), nil
+}
+
+func (c *reauthConnection) Reauthenticate(context.Context) error {
+	c.reauths++
+	return c.reauthErr
+}
+
+// Connection implements the Server interface.
+func (c *reauthConnection) Connection(context.Context) (Connection, error) { return c, nil }
+
+func TestOperationReauthentication(t *testing.T) {
+	ok := bsoncore.BuildDocumentFromElements(nil, bsoncore.AppendInt32Element(nil, "ok", 1))
+	reauthRequired := bsoncore.BuildDocumentFromElements(nil,
+		bsoncore.AppendInt32Element(nil, "ok", 0),
+		bsoncore.AppendInt32Element(nil, "code", 391),
+		bsoncore.AppendStringElement(nil, "errmsg", "Reauthentication required"),
+	)
+	execute := func(conn *reauthConnection) error {
+		d := new(mockDeployment)
+		d.returns.server = conn
+		return Operation{
+			Database:   "foobar",
+			Deployment: d,
+			CommandFn: func(dst []byte, desc description.SelectedServer) ([]byte, error) {
+				return bsoncore.AppendInt32Element(dst, "ping", 1), nil
+			},
+		}.Execute(context.Background(), nil)
+	}
+
+	t.Run("command is rerun after reauthentication", func(t *testing.T) {
+		conn := &reauthConnection{replies: []bsoncore.Document{reauthRequired, ok}}
+		noerr(t, execute(conn))
+		if conn.reauths != 1 {
+			t.Fatalf("expected 1 reauthentication, got %d", conn.reauths)
+		}
+	})
+	t.Run("reauthenticates once", func(t *testing.T) {
+		conn := &reauthConnection{replies: []bsoncore.Document{reauthRequired, reauthRequired}}
+		err := execute(conn)
+		if e, ok := err.(Error); !ok || !e.ReauthenticationRequired() {
+			t.Fatalf("expected ReauthenticationRequired error, got %v", err)
+		}
+		if conn.reauths != 1 {
+			t.Fatalf("expected 1 reauthentication, got %d", conn.reauths)
+		}
+	})
+	t.Run("reauthentication error", func(t *testing.T) {
+		reauthErr := errors.New("auth error")
+		conn := &reauthConnection{replies: []bsoncore.Document{reauthRequired}, reauthErr: reauthErr}
+		if err := execute(conn); err != reauthErr {
+			t.Fatalf("expected error %v, got %v", reauthErr, err)
+		}
+	})
+}
@@ -328,6 +328,7 @@ type Connection struct {
 
 var _ driver.Connection = (*Connection)(nil)
 var _ driver.Expirable = (*Connection)(nil)
+var _ driver.Reauthenticator = (*Connection)(nil)
 
 // WriteWireMessage handles writing a wire message to the underlying connection.
 func (c *Connection) WriteWireMessage(ctx context.Context, wm []byte) error {
@@ -396,6 +397,21 @@ func (c *Connection) CompressWireMessage(src, dst []byte) ([]byte, error) {
 	return bsoncore.UpdateLength(dst, idx, int32(len(dst[idx:]))), nil
 }
 
+// Reauthenticate authenticates the connection again using the handshaker it was initialized with. It returns an error
+// if the handshaker does not authenticate connections.
+func (c *Connection) Reauthenticate(ctx context.Context) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.connection == nil {
+		return ErrConnectionClosed
+	}
+	ah, ok := c.config.handshaker.(driver.AuthHandshaker)
+	if !ok {
+		return errors.New("connection cannot reauthenticate without an authenticating handshaker")
+	}
+	return ah.Reauthenticate(ctx, c.desc, initConnection{c.connection})
+}
+
 // Description returns the server description of the server this connection is connected to.
 func (c *Connection) Description() description.Server {
 	c.mu.RLock()
@@ -353,10 +353,60 @@ func TestConnection(t *testing.T) {
 			if !cmp.Equal(got, want) {
 				t.Errorf("LocalAddresses do not match. got %v; want %v", got, want)
 			}
+
+			want = ErrConnectionClosed
+			got = conn.Reauthenticate(context.Background())
+			if !cmp.Equal(got, want, cmp.Comparer(compareErrors)) {
+				t.Errorf("errors do not match. got %v; want %v", got, want)
+			}
+		})
+		t.Run("Reauthenticate", func(t *testing.T) {
+			t.Run("uses the handshaker", func(t *testing.T) {
+				handshaker := &testAuthHandshaker{}
+				desc := description.Server{Addr: address.Address("localhost:27017")}
+				conn := &Connection{connection: &connection{
+					desc:   desc,
+					config: &connectionConfig{handshaker: handshaker},
+				}}
+
+				err := conn.Reauthenticate(context.Background())
+				noerr(t, err)
+				if handshaker.reauths != 1 {
+					t.Fatalf("expected 1 reauthentication, got %d", handshaker.reauths)
+				}
+				if !cmp.Equal(handshaker.desc, desc) {
+					t.Errorf("descriptions do not match. got %v; want %v", handshaker.desc, desc)
+				}
+			})
+			t.Run("handshaker without authentication", func(t *testing.T) {
+				handshaker := HandshakerFunc(func(context.Context, address.Address, driver.Connection) (description.Server, error) {
+					return description.Server{}, nil
+				})
+				conn := &Connection{connection: &connection{config: &connectionConfig{handshaker: handshaker}}}
+				if err := conn.Reauthenticate(context.Background()); err == nil {
+					t.Fatalf("expected an error, got nil")
+				}
+			})
 		})
 	})
 }
 
+// testAuthHandshaker is a driver.AuthHandshaker that records reauthentications.
+type testAuthHandshaker struct {
+	reauths int
+	desc    description.Server
+}
+
+func (h *testAuthHandshaker) Handshake(context.Context, address.Address, driver.Connection) (description.Server, error) {
+	return description.Server{}, nil
+}
+
+func (h *testAuthHandshaker) Reauthenticate(_ context.Context, desc description.Server, _ driver.Connection) error {
+	h.reauths++
+	h.desc = desc
+	return nil
+}
+
 type testNetConn struct {
 	nc  net.Conn
 	buf []byte
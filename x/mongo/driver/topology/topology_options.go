@@ -150,7 +150,8 @@ func WithConnString(fn func(connstring.ConnString) connstring.ConnString) Option
 			connOpts = append(connOpts, WithTLSConfig(func(*tls.Config) *tls.Config { return tlsConfig }))
 		}
 
-		if cs.Username != "" || cs.AuthMechanism == auth.MongoDBX509 || cs.AuthMechanism == auth.GSSAPI {
+		if cs.Username != "" || cs.AuthMechanism == auth.MongoDBX509 || cs.AuthMechanism == auth.GSSAPI ||
+			cs.AuthMechanism == auth.MongoDBAWS || cs.AuthMechanism == auth.MongoDBOIDC {
 			cred := &auth.Cred{
 				Source:      "admin",
 				Username:    cs.Username,
@@ -168,7 +169,7 @@ func WithConnString(fn func(connstring.ConnString) connstring.ConnString) Option
 						cred.Username = x509Username
 					}
 					fallthrough
-				case auth.GSSAPI, auth.PLAIN:
+				case auth.GSSAPI, auth.PLAIN, auth.MongoDBAWS, auth.MongoDBOIDC:
 					cred.Source = "$external"
 				default:
 					cred.Source = cs.Database